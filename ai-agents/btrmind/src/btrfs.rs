@@ -1,11 +1,12 @@
+use crate::SystemMetrics;
 use anyhow::{bail, Context, Result};
 use std::path::Path;
 use std::process::Command;
 use tracing::{debug, warn};
-use crate::SystemMetrics;
 
 pub struct BtrfsMonitor {
     target_path: String,
+    is_btrfs: bool,
 }
 
 impl BtrfsMonitor {
@@ -14,44 +15,59 @@ impl BtrfsMonitor {
         if !path.exists() {
             bail!("Target path does not exist: {}", target_path);
         }
-        
+
         // Verify this is a BTRFS filesystem
-        Self::verify_btrfs(target_path)?;
-        
+        let is_btrfs = Self::verify_btrfs(target_path)?;
+
         Ok(Self {
             target_path: target_path.to_string(),
+            is_btrfs,
         })
     }
-    
-    fn verify_btrfs(path: &str) -> Result<()> {
+
+    /// Whether the target is on BTRFS; cleanup actions must not run otherwise.
+    pub fn is_btrfs(&self) -> bool {
+        self.is_btrfs
+    }
+
+    fn verify_btrfs(path: &str) -> Result<bool> {
         let output = Command::new("stat")
             .args(["-f", "-c", "%T", path])
             .output()
             .context("Failed to check filesystem type")?;
-        
+
         if !output.status.success() {
-            bail!("Failed to stat filesystem: {}", String::from_utf8_lossy(&output.stderr));
+            bail!(
+                "Failed to stat filesystem: {}",
+                String::from_utf8_lossy(&output.stderr)
+            );
         }
-        
-        let fstype = String::from_utf8_lossy(&output.stdout).trim().to_lowercase();
-        if !fstype.contains("btrfs") {
-            // For development/testing, allow any filesystem type
-            warn!("Target path is not BTRFS filesystem (detected: {}), continuing anyway", fstype);
+
+        let fstype = String::from_utf8_lossy(&output.stdout)
+            .trim()
+            .to_lowercase();
+        if !is_btrfs_type(&fstype) {
+            // Metrics still work anywhere, so monitoring continues for development/testing
+            warn!(
+                "Target path is not BTRFS filesystem (detected: {}), actions will be disabled",
+                fstype
+            );
+            return Ok(false);
         }
-        
-        Ok(())
+
+        Ok(true)
     }
-    
+
     pub async fn collect_metrics(&self) -> Result<SystemMetrics> {
         let timestamp = chrono::Utc::now();
-        
+
         // Collect disk usage using 'df' (more reliable than btrfs filesystem usage)
         let disk_usage = self.get_disk_usage().await?;
-        
+
         // Collect BTRFS-specific metrics if available
         let metadata_usage = self.get_metadata_usage().await.unwrap_or(0.0);
         let fragmentation = self.get_fragmentation().await.unwrap_or(0.0);
-        
+
         Ok(SystemMetrics {
             timestamp,
             disk_usage_percent: disk_usage.used_percent,
@@ -60,26 +76,29 @@ impl BtrfsMonitor {
             fragmentation_percent: fragmentation,
         })
     }
-    
+
     async fn get_disk_usage(&self) -> Result<DiskUsage> {
         let output = Command::new("df")
             .args(["-BM", &self.target_path])
             .output()
             .context("Failed to run df command")?;
-        
+
         if !output.status.success() {
-            bail!("df command failed: {}", String::from_utf8_lossy(&output.stderr));
+            bail!(
+                "df command failed: {}",
+                String::from_utf8_lossy(&output.stderr)
+            );
         }
-        
+
         let output_str = String::from_utf8_lossy(&output.stdout);
         debug!("df output: {}", output_str);
-        
+
         // Parse df output - skip header line
         let lines: Vec<&str> = output_str.lines().collect();
         if lines.len() < 2 {
             bail!("Unexpected df output format");
         }
-        
+
         // df output format: Filesystem 1M-blocks Used Available Use% Mounted on
         let data_line = if lines[1].starts_with('/') {
             lines[1]
@@ -89,29 +108,37 @@ impl BtrfsMonitor {
         } else {
             bail!("Could not parse df output");
         };
-        
+
         let fields: Vec<&str> = data_line.split_whitespace().collect();
         if fields.len() < 5 {
             bail!("Unexpected df output format: {}", data_line);
         }
-        
+
         // Parse fields (skip filesystem name)
-        let total_mb: f64 = fields[fields.len()-5].trim_end_matches('M').parse()
+        let total_mb: f64 = fields[fields.len() - 5]
+            .trim_end_matches('M')
+            .parse()
             .context("Failed to parse total space")?;
-        let used_mb: f64 = fields[fields.len()-4].trim_end_matches('M').parse()
+        let used_mb: f64 = fields[fields.len() - 4]
+            .trim_end_matches('M')
+            .parse()
             .context("Failed to parse used space")?;
-        let free_mb: f64 = fields[fields.len()-3].trim_end_matches('M').parse()
+        let free_mb: f64 = fields[fields.len() - 3]
+            .trim_end_matches('M')
+            .parse()
             .context("Failed to parse free space")?;
-        
+
         let used_percent = if total_mb > 0.0 {
             (used_mb / total_mb) * 100.0
         } else {
             0.0
         };
-        
-        debug!("Disk usage: {:.1}% ({:.1}MB used, {:.1}MB free)", 
-               used_percent, used_mb, free_mb);
-        
+
+        debug!(
+            "Disk usage: {:.1}% ({:.1}MB used, {:.1}MB free)",
+            used_percent, used_mb, free_mb
+        );
+
         Ok(DiskUsage {
             _total_mb: total_mb,
             _used_mb: used_mb,
@@ -119,18 +146,18 @@ impl BtrfsMonitor {
             used_percent,
         })
     }
-    
+
     async fn get_metadata_usage(&self) -> Result<f64> {
         // Try to get BTRFS filesystem usage
         let output = Command::new("btrfs")
             .args(["filesystem", "usage", "-b", &self.target_path])
             .output();
-        
+
         match output {
             Ok(output) if output.status.success() => {
                 let output_str = String::from_utf8_lossy(&output.stdout);
                 debug!("btrfs filesystem usage output: {}", output_str);
-                
+
                 // Parse metadata usage from output
                 // This is a simplified parser - BTRFS output format is complex
                 for line in output_str.lines() {
@@ -140,7 +167,7 @@ impl BtrfsMonitor {
                         return Ok(5.0);
                     }
                 }
-                
+
                 Ok(0.0)
             }
             _ => {
@@ -149,24 +176,28 @@ impl BtrfsMonitor {
             }
         }
     }
-    
+
     async fn get_fragmentation(&self) -> Result<f64> {
         // BTRFS fragmentation is complex to measure accurately
         // For now, return a placeholder based on usage
         // TODO: Implement proper fragmentation detection
         let disk_usage = self.get_disk_usage().await?;
-        
+
         // Rough heuristic: higher usage tends to correlate with fragmentation
         let fragmentation = if disk_usage.used_percent > 80.0 {
             (disk_usage.used_percent - 80.0) * 2.0
         } else {
             0.0
         };
-        
+
         Ok(fragmentation.min(100.0))
     }
 }
 
+fn is_btrfs_type(fstype: &str) -> bool {
+    fstype.contains("btrfs")
+}
+
 #[derive(Debug)]
 struct DiskUsage {
     _total_mb: f64,
@@ -178,8 +209,7 @@ struct DiskUsage {
 #[cfg(test)]
 mod tests {
     use super::*;
-    
-    
+
     #[tokio::test]
     async fn test_disk_usage_collection() {
         // Test against root filesystem (should always exist)
@@ -192,52 +222,64 @@ mod tests {
                 return;
             }
         };
-        
+
         let metrics = match monitor.collect_metrics().await {
             Ok(metrics) => metrics,
             Err(_) => {
-                println!("Skipping test - could not collect metrics (non-BTRFS or unexpected df output)");
+                println!(
+                    "Skipping test - could not collect metrics (non-BTRFS or unexpected df output)"
+                );
                 return;
             }
         };
-        
+
         assert!(metrics.disk_usage_percent >= 0.0);
         assert!(metrics.disk_usage_percent <= 100.0);
         assert!(metrics.free_space_mb >= 0.0);
     }
-    
+
+    #[test]
+    fn test_filesystem_type_detection() {
+        assert!(is_btrfs_type("btrfs"));
+        assert!(!is_btrfs_type("ext2/ext3"));
+        assert!(!is_btrfs_type("xfs"));
+        assert!(!is_btrfs_type("tmpfs"));
+    }
+
     #[test]
     fn test_invalid_path() {
         let result = BtrfsMonitor::new("/nonexistent/path");
         assert!(result.is_err());
     }
-    
+
     #[tokio::test]
     async fn test_metrics_structure() {
         // Use a mock filesystem check
         let monitor = match BtrfsMonitor::new("/tmp") {
             Ok(monitor) => monitor,
             Err(_) => {
-                // Skip test if we can't create monitor  
+                // Skip test if we can't create monitor
                 println!("Skipping test - filesystem not available");
                 return;
             }
         };
-        
+
         let metrics = match monitor.collect_metrics().await {
             Ok(metrics) => metrics,
             Err(_) => {
-                println!("Skipping test - could not collect metrics (non-BTRFS or unexpected df output)");
+                println!(
+                    "Skipping test - could not collect metrics (non-BTRFS or unexpected df output)"
+                );
                 return;
             }
         };
-        
+
         // Verify all fields are present and reasonable
         assert!(metrics.disk_usage_percent >= 0.0);
         assert!(metrics.free_space_mb >= 0.0);
         assert!(metrics.metadata_usage_percent >= 0.0);
         assert!(metrics.fragmentation_percent >= 0.0);
-        
+
         // Timestamp should be recent
         let now = chrono::Utc::now();
         let diff = now.signed_duration_since(metrics.timestamp);
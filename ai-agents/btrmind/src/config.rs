@@ -271,6 +271,24 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_released_configs_still_load() {
+        let dir = Path::new(env!("CARGO_MANIFEST_DIR")).join("fixtures/configs");
+        let mut configs = 0;
+        for entry in std::fs::read_dir(&dir).unwrap() {
+            let path = entry.unwrap().path();
+            if path.extension().and_then(|e| e.to_str()) != Some("toml") {
+                continue;
+            }
+            let config = Config::load(&path).unwrap_or_else(|e| panic!("{path:?}: {e:#}"));
+            config
+                .validate()
+                .unwrap_or_else(|e| panic!("{path:?}: {e:#}"));
+            configs += 1;
+        }
+        assert!(configs > 0, "no configs in {dir:?}");
+    }
+
     #[test]
     fn test_invalid_thresholds() {
         let mut config = Config::default();
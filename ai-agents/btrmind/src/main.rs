@@ -1,31 +1,34 @@
 use anyhow::{Context, Result};
-use clap::{Parser, Subcommand};
+use clap::{CommandFactory, Parser, Subcommand};
 use serde::{Deserialize, Serialize};
 use std::path::PathBuf;
 use std::time::Duration;
 use tokio::time;
-use tracing::{info, warn, error, debug};
+use tracing::{debug, error, info, warn};
 
-mod btrfs;
-mod learning;
 mod actions;
+mod btrfs;
 mod config;
+mod learning;
+mod simulation;
 
+use actions::{Action, ActionExecutor};
 use btrfs::BtrfsMonitor;
+use config::{Config, ThresholdConfig};
 use learning::{ReinforcementLearner, State};
-use actions::{ActionExecutor, Action};
-use config::Config;
+use simulation::Trace;
 
 #[derive(Parser)]
 #[command(name = "btrmind")]
+#[command(version, long_version = regicide_cli::long_version!())]
 #[command(about = "AI-powered BTRFS storage monitoring and optimization")]
 struct Cli {
     #[command(subcommand)]
     command: Option<Commands>,
-    
+
     #[arg(short, long, default_value = "/etc/btrmind/config.toml")]
     config: PathBuf,
-    
+
     #[arg(short, long)]
     dry_run: bool,
 }
@@ -45,6 +48,16 @@ enum Commands {
     Stats,
     /// Validate configuration
     Config,
+    /// Replay a recorded metrics trace and print the chosen actions
+    Simulate {
+        trace: PathBuf,
+        /// Fail if a decision breaks the trace's expected policies
+        #[arg(long)]
+        check: bool,
+    },
+    /// Write the man page and shell completions to OUT_DIR (used by packaging)
+    #[command(hide = true)]
+    GenerateDocs { out_dir: PathBuf },
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -68,8 +81,18 @@ impl BtrMindAgent {
     pub fn new(config: Config) -> Result<Self> {
         let monitor = BtrfsMonitor::new(&config.monitoring.target_path)?;
         let learner = ReinforcementLearner::new(&config.learning)?;
-        let executor = ActionExecutor::new(config.actions.clone(), config.dry_run);
-        
+
+        // Cleanup actions assume BTRFS; anywhere else only observe
+        if !monitor.is_btrfs() && !config.dry_run {
+            warn!(
+                "Refusing to run actions on a non-BTRFS filesystem; running in monitor-only mode"
+            );
+        }
+        let executor = ActionExecutor::new(
+            config.actions.clone(),
+            config.dry_run || !monitor.is_btrfs(),
+        );
+
         Ok(Self {
             monitor,
             learner,
@@ -78,17 +101,18 @@ impl BtrMindAgent {
             last_metrics: None,
         })
     }
-    
+
     pub async fn run(&mut self) -> Result<()> {
         info!("Starting BtrMind agent");
         info!("Target path: {}", self.config.monitoring.target_path);
         info!("Poll interval: {}s", self.config.monitoring.poll_interval);
-        
-        let mut interval = time::interval(Duration::from_secs(self.config.monitoring.poll_interval));
-        
+
+        let mut interval =
+            time::interval(Duration::from_secs(self.config.monitoring.poll_interval));
+
         loop {
             interval.tick().await;
-            
+
             if let Err(e) = self.monitoring_cycle().await {
                 error!("Monitoring cycle failed: {}", e);
                 // Continue running despite errors
@@ -96,94 +120,77 @@ impl BtrMindAgent {
             }
         }
     }
-    
+
     async fn monitoring_cycle(&mut self) -> Result<()> {
         // 1. Observe current state
         let metrics = self.monitor.collect_metrics().await?;
         debug!("Collected metrics: {:?}", metrics);
-        
+
         // 2. Convert to ML state representation
         let state = State::from_metrics(&metrics);
-        
+
         // 3. Get action from RL agent
         let action = self.learner.select_action(&state)?;
         debug!("Selected action: {:?}", action);
-        
+
         // 4. Execute action
         let action_result = self.executor.execute_action(action).await;
-        
+
         // 5. Calculate reward
         let reward = if let Some(ref prev_metrics) = self.last_metrics {
-            self.calculate_reward(prev_metrics, &metrics)
+            calculate_reward(&self.config.thresholds, prev_metrics, &metrics)
         } else {
             0.0 // No reward for first observation
         };
-        
+
         // 6. Update learning model
         if let Some(ref prev_metrics) = self.last_metrics {
             let prev_state = State::from_metrics(prev_metrics);
             self.learner.update(&prev_state, action, reward, &state)?;
         }
-        
+
         // 7. Log and alert if needed
         self.check_thresholds(&metrics).await?;
-        
+
         // 8. Store metrics for next cycle
         self.last_metrics = Some(metrics);
-        
+
         if action_result.is_err() {
             warn!("Action execution failed: {:?}", action_result);
         }
-        
+
         Ok(())
     }
-    
-    fn calculate_reward(&self, prev_metrics: &SystemMetrics, curr_metrics: &SystemMetrics) -> f64 {
-        let util_delta = prev_metrics.disk_usage_percent - curr_metrics.disk_usage_percent;
-        
-        // Base reward: positive if space freed
-        let mut reward = util_delta * 10.0;
-        
-        // Penalties for critical thresholds
-        if curr_metrics.disk_usage_percent > self.config.thresholds.critical_level {
-            reward -= 50.0; // Severe penalty
-        } else if curr_metrics.disk_usage_percent > self.config.thresholds.warning_level {
-            reward -= 15.0; // Moderate penalty
-        }
-        
-        // Bonus for sustained improvement
-        if util_delta > 2.0 {
-            reward += 5.0;
-        }
-        
-        debug!("Reward calculation: util_delta={:.2}, reward={:.2}", util_delta, reward);
-        reward
-    }
-    
+
     async fn check_thresholds(&self, metrics: &SystemMetrics) -> Result<()> {
         if metrics.disk_usage_percent >= self.config.thresholds.emergency_level {
-            error!("EMERGENCY: Disk usage at {:.1}%! Immediate action required!", 
-                  metrics.disk_usage_percent);
+            error!(
+                "EMERGENCY: Disk usage at {:.1}%! Immediate action required!",
+                metrics.disk_usage_percent
+            );
             // TODO: Send system notification
         } else if metrics.disk_usage_percent >= self.config.thresholds.critical_level {
             warn!("CRITICAL: Disk usage at {:.1}%", metrics.disk_usage_percent);
         } else if metrics.disk_usage_percent >= self.config.thresholds.warning_level {
             info!("WARNING: Disk usage at {:.1}%", metrics.disk_usage_percent);
         }
-        
+
         Ok(())
     }
-    
+
     pub async fn analyze(&self) -> Result<()> {
         let metrics = self.monitor.collect_metrics().await?;
-        
+
         println!("=== BtrMind Storage Analysis ===");
-        println!("Timestamp: {}", metrics.timestamp.format("%Y-%m-%d %H:%M:%S UTC"));
+        println!(
+            "Timestamp: {}",
+            metrics.timestamp.format("%Y-%m-%d %H:%M:%S UTC")
+        );
         println!("Disk Usage: {:.1}%", metrics.disk_usage_percent);
         println!("Free Space: {:.1} MB", metrics.free_space_mb);
         println!("Metadata Usage: {:.1}%", metrics.metadata_usage_percent);
         println!("Fragmentation: {:.1}%", metrics.fragmentation_percent);
-        
+
         // Threshold status
         if metrics.disk_usage_percent >= self.config.thresholds.emergency_level {
             println!("Status: 🔴 EMERGENCY");
@@ -194,17 +201,21 @@ impl BtrMindAgent {
         } else {
             println!("Status: 🟢 NORMAL");
         }
-        
+
         Ok(())
     }
-    
+
     pub async fn cleanup(&mut self, aggressive: bool) -> Result<()> {
         info!("Running manual cleanup (aggressive: {})", aggressive);
-        
+
         if aggressive {
             // Run all cleanup actions
-            for action in [Action::DeleteTempFiles, Action::CompressFiles, 
-                          Action::BalanceMetadata, Action::CleanupSnapshots] {
+            for action in [
+                Action::DeleteTempFiles,
+                Action::CompressFiles,
+                Action::BalanceMetadata,
+                Action::CleanupSnapshots,
+            ] {
                 info!("Executing action: {:?}", action);
                 if let Err(e) = self.executor.execute_action(action).await {
                     warn!("Action failed: {:?}", e);
@@ -219,43 +230,97 @@ impl BtrMindAgent {
                 }
             }
         }
-        
+
         Ok(())
     }
 }
 
+pub fn calculate_reward(
+    thresholds: &ThresholdConfig,
+    prev_metrics: &SystemMetrics,
+    curr_metrics: &SystemMetrics,
+) -> f64 {
+    let util_delta = prev_metrics.disk_usage_percent - curr_metrics.disk_usage_percent;
+
+    // Base reward: positive if space freed
+    let mut reward = util_delta * 10.0;
+
+    // Penalties for critical thresholds
+    if curr_metrics.disk_usage_percent > thresholds.critical_level {
+        reward -= 50.0; // Severe penalty
+    } else if curr_metrics.disk_usage_percent > thresholds.warning_level {
+        reward -= 15.0; // Moderate penalty
+    }
+
+    // Bonus for sustained improvement
+    if util_delta > 2.0 {
+        reward += 5.0;
+    }
+
+    debug!(
+        "Reward calculation: util_delta={:.2}, reward={:.2}",
+        util_delta, reward
+    );
+    reward
+}
+
 #[tokio::main]
 async fn main() -> Result<()> {
     // Initialize tracing
     tracing_subscriber::fmt()
         .with_env_filter(tracing_subscriber::EnvFilter::from_default_env())
         .init();
-    
+
     let cli = Cli::parse();
-    
+
+    // Generating docs must not load, or create, a config file
+    if let Some(Commands::GenerateDocs { out_dir }) = &cli.command {
+        return regicide_cli::docs::generate(Cli::command(), "btrmind", out_dir);
+    }
+
     // Load configuration
     let config = Config::load(&cli.config)
         .with_context(|| format!("Failed to load config from {:?}", cli.config))?;
-    
+
     // Override dry_run from CLI
     let mut config = config;
     if cli.dry_run {
         config.dry_run = true;
         info!("Running in DRY-RUN mode - no actions will be executed");
     }
-    
+
+    // Simulation replays a trace instead of reading the filesystem
+    if let Some(Commands::Simulate { trace, check }) = &cli.command {
+        let trace = Trace::load(trace)?;
+        info!("Simulating trace: {}", trace.description);
+        let decisions = simulation::simulate(&config, &trace)?;
+        for decision in &decisions {
+            println!("{}", serde_json::to_string(decision)?);
+        }
+        if *check {
+            let violations = simulation::check(&trace, &decisions);
+            for violation in &violations {
+                error!("Policy violation: {}", violation);
+            }
+            if !violations.is_empty() {
+                anyhow::bail!("{} policy violation(s)", violations.len());
+            }
+        }
+        return Ok(());
+    }
+
     let mut agent = BtrMindAgent::new(config)?;
-    
+
     match cli.command {
         Some(Commands::Run) | None => {
             agent.run().await?;
-        },
+        }
         Some(Commands::Analyze) => {
             agent.analyze().await?;
-        },
+        }
         Some(Commands::Cleanup { aggressive }) => {
             agent.cleanup(aggressive).await?;
-        },
+        }
         Some(Commands::Stats) => {
             let stats = agent.learner.get_learning_stats();
             println!("=== BtrMind Learning Statistics ===");
@@ -268,13 +333,17 @@ async fn main() -> Result<()> {
             for (action, count) in stats.action_distribution {
                 println!("  {action:?}: {count} times");
             }
-        },
+        }
         Some(Commands::Config) => {
             println!("Configuration validation:");
             println!("Config file: {:?}", cli.config);
             println!("✓ Configuration loaded successfully");
-        },
+            agent.config.validate()?;
+            println!("✓ Configuration valid");
+        }
+        Some(Commands::Simulate { .. }) => unreachable!("handled before the agent is created"),
+        Some(Commands::GenerateDocs { .. }) => unreachable!("handled before the config is loaded"),
     }
-    
+
     Ok(())
 }
@@ -0,0 +1,213 @@
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::Path;
+
+use crate::actions::Action;
+use crate::config::Config;
+use crate::learning::{ReinforcementLearner, State};
+use crate::{calculate_reward, SystemMetrics};
+
+/// A pre-recorded metrics timeline with the policy the agent must follow on it.
+#[derive(Debug, Clone, Deserialize)]
+pub struct Trace {
+    pub description: String,
+    pub samples: Vec<TraceSample>,
+    #[serde(default)]
+    pub expect: Vec<Policy>,
+}
+
+/// One poll's worth of filesystem metrics.
+#[derive(Debug, Clone, Deserialize)]
+pub struct TraceSample {
+    pub disk_usage_percent: f64,
+    pub free_space_mb: f64,
+    #[serde(default)]
+    pub metadata_usage_percent: f64,
+    #[serde(default)]
+    pub fragmentation_percent: f64,
+}
+
+/// The actions allowed for an inclusive range of steps.
+#[derive(Debug, Clone, Deserialize)]
+pub struct Policy {
+    pub steps: (usize, usize),
+    pub allowed: Vec<Action>,
+    pub reason: String,
+}
+
+/// The action chosen at one step of a simulation.
+#[derive(Debug, Clone, Serialize)]
+pub struct Decision {
+    pub step: usize,
+    pub disk_usage_percent: f64,
+    pub action: Action,
+    pub reward: f64,
+}
+
+impl Trace {
+    pub fn load<P: AsRef<Path>>(path: P) -> Result<Self> {
+        let path = path.as_ref();
+        let content = std::fs::read_to_string(path)
+            .with_context(|| format!("Failed to read trace: {path:?}"))?;
+        serde_json::from_str(&content).with_context(|| format!("Failed to parse trace: {path:?}"))
+    }
+}
+
+/// Replay a trace through the agent's decide/reward/learn loop.
+///
+/// Mirrors `BtrMindAgent::monitoring_cycle` with the trace standing in for
+/// the filesystem: no action is executed and no model is loaded or saved.
+/// Decisions always exploit, since random exploration would make traces
+/// non-reproducible.
+pub fn simulate(config: &Config, trace: &Trace) -> Result<Vec<Decision>> {
+    let mut learner = ReinforcementLearner::ephemeral(&config.learning);
+    let start = chrono::Utc::now();
+    let poll = chrono::Duration::seconds(config.monitoring.poll_interval as i64);
+    let mut last_metrics: Option<SystemMetrics> = None;
+    let mut decisions = Vec::with_capacity(trace.samples.len());
+
+    for (step, sample) in trace.samples.iter().enumerate() {
+        let metrics = SystemMetrics {
+            timestamp: start + poll * step as i32,
+            disk_usage_percent: sample.disk_usage_percent,
+            free_space_mb: sample.free_space_mb,
+            metadata_usage_percent: sample.metadata_usage_percent,
+            fragmentation_percent: sample.fragmentation_percent,
+        };
+        let state = State::from_metrics(&metrics);
+        let action = learner.select_best_action(&state);
+
+        let mut reward = 0.0;
+        if let Some(ref prev_metrics) = last_metrics {
+            reward = calculate_reward(&config.thresholds, prev_metrics, &metrics);
+            learner.update(&State::from_metrics(prev_metrics), action, reward, &state)?;
+        }
+
+        decisions.push(Decision {
+            step,
+            disk_usage_percent: metrics.disk_usage_percent,
+            action,
+            reward,
+        });
+        last_metrics = Some(metrics);
+    }
+
+    Ok(decisions)
+}
+
+/// Return a description of every decision that breaks the trace's policies.
+pub fn check(trace: &Trace, decisions: &[Decision]) -> Vec<String> {
+    let mut violations = Vec::new();
+    for policy in &trace.expect {
+        let (first, last) = policy.steps;
+        if first > last {
+            violations.push(format!(
+                "policy for steps {first}-{last} starts after it ends"
+            ));
+            continue;
+        }
+        if last >= decisions.len() {
+            violations.push(format!(
+                "policy for steps {first}-{last} is past the end of the trace ({} samples)",
+                decisions.len()
+            ));
+            continue;
+        }
+        for decision in &decisions[first..=last] {
+            if !policy.allowed.contains(&decision.action) {
+                violations.push(format!(
+                    "step {} ({:.1}% used): chose {:?}, expected one of {:?} because {}",
+                    decision.step,
+                    decision.disk_usage_percent,
+                    decision.action,
+                    policy.allowed,
+                    policy.reason
+                ));
+            }
+        }
+    }
+    violations
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn trace_dir() -> std::path::PathBuf {
+        Path::new(env!("CARGO_MANIFEST_DIR")).join("fixtures/traces")
+    }
+
+    #[test]
+    fn test_recorded_traces_follow_policies() {
+        let config = Config::default();
+        let mut traces = 0;
+        for entry in std::fs::read_dir(trace_dir()).unwrap() {
+            let path = entry.unwrap().path();
+            if path.extension().and_then(|e| e.to_str()) != Some("json") {
+                continue;
+            }
+            let trace = Trace::load(&path).unwrap();
+            assert!(
+                !trace.expect.is_empty(),
+                "{path:?} has no expected policies"
+            );
+            let decisions = simulate(&config, &trace).unwrap();
+            let violations = check(&trace, &decisions);
+            assert!(
+                violations.is_empty(),
+                "{path:?}:\n{}",
+                violations.join("\n")
+            );
+            traces += 1;
+        }
+        assert!(traces > 0, "no traces in {:?}", trace_dir());
+    }
+
+    #[test]
+    fn test_simulation_is_deterministic() {
+        let config = Config::default();
+        let trace = Trace::load(trace_dir().join("gradual-fill.json")).unwrap();
+        let first: Vec<Action> = simulate(&config, &trace)
+            .unwrap()
+            .iter()
+            .map(|d| d.action)
+            .collect();
+        let second: Vec<Action> = simulate(&config, &trace)
+            .unwrap()
+            .iter()
+            .map(|d| d.action)
+            .collect();
+        assert_eq!(first, second);
+    }
+
+    #[test]
+    fn test_check_reports_violations() {
+        let trace: Trace = serde_json::from_str(
+            r#"{
+                "description": "one emergency sample",
+                "samples": [{"disk_usage_percent": 99.0, "free_space_mb": 100.0}],
+                "expect": [{"steps": [0, 0], "allowed": ["NoOperation"], "reason": "test"}]
+            }"#,
+        )
+        .unwrap();
+        let decisions = simulate(&Config::default(), &trace).unwrap();
+        assert_eq!(check(&trace, &decisions).len(), 1);
+    }
+
+    #[test]
+    fn test_check_reports_reversed_steps() {
+        let trace: Trace = serde_json::from_str(
+            r#"{
+                "description": "a policy whose steps are reversed",
+                "samples": [{"disk_usage_percent": 50.0, "free_space_mb": 5000.0}, {"disk_usage_percent": 50.0, "free_space_mb": 5000.0}],
+                "expect": [{"steps": [1, 0], "allowed": ["NoOperation"], "reason": "test"}]
+            }"#,
+        )
+        .unwrap();
+        let decisions = simulate(&Config::default(), &trace).unwrap();
+        assert_eq!(
+            check(&trace, &decisions),
+            vec!["policy for steps 1-0 starts after it ends".to_string()]
+        );
+    }
+}
@@ -0,0 +1,58 @@
+"""Advisory stages - stages whose failure warns instead of failing the run.
+
+advisory.toml lists them by stage name, and a run can add more (add()),
+e.g. for a --*-soft-fail flag.  When one fails, excuse() marks
+its failed steps "advisory" in the run summary and records a warning; the
+run still passes, and the end-of-run summary shows the warnings in
+yellow.
+"""
+
+import functools
+import os
+import sys
+import tomllib
+from pathlib import Path
+
+import run_history
+from failure_bundle import StageFailed
+
+
+ADVISORY_PATH = Path(__file__).parent / "advisory.toml"
+YELLOW = "\033[33m"
+RESET = "\033[0m"
+
+_added: set[str] = set()
+
+
+@functools.cache
+def stages() -> frozenset[str]:
+    """Return the names of the advisory stages."""
+    with ADVISORY_PATH.open("rb") as f:
+        return frozenset(tomllib.load(f).get("stages", []))
+
+
+def add(stage: str) -> None:
+    """Make stage advisory for this run, as if advisory.toml listed it."""
+    _added.add(stage)
+
+
+def is_advisory(stage: str) -> bool:
+    """Return whether stage is advisory."""
+    return stage in stages() or stage in _added
+
+
+def yellow(text: str) -> str:
+    """Return text in yellow, unless NO_COLOR is set."""
+    return text if "NO_COLOR" in os.environ else f"{YELLOW}{text}{RESET}"
+
+
+def excuse(stage: str, exc: StageFailed) -> bool:
+    """Record exc as an advisory failure if stage is advisory; return whether it was excused."""
+    if not is_advisory(stage):
+        return False
+    run_history.mark_advisory(exc.stage)
+    run_history.record_warning(
+        stage, f"{exc.stage} failed with exit code {exc.exit_code} [{exc.category}] (failure bundle: {exc.bundle})"
+    )
+    print(yellow(f"WARNING: advisory stage {stage} failed; continuing ({exc.bundle})"), file=sys.stderr)
+    return True
@@ -0,0 +1,62 @@
+"""Artifact contracts between pipeline stages.
+
+Each stage that hands files to a later stage or to the release declares
+here what it must leave under build-system/catalyst/output/.  The pipeline
+calls validate() right after the stage's export, so a stage that silently
+stops producing a file fails there with a "missing artifact" error naming
+the file, instead of a later stage failing on a path it cannot open.
+"""
+
+from pathlib import Path
+
+
+OUTPUT_DIR = Path("build-system/catalyst/output")
+
+_DOC_FILES = ["man/{name}.1", "completions/{name}.bash", "completions/_{name}", "completions/{name}.fish"]
+
+# Stage -> files it must produce, relative to OUTPUT_DIR.  "{arch}" and
+# "{target}" are filled in from validate()'s keyword arguments.
+CONTRACTS: dict[str, list[str]] = {
+    "release-optimized": ["bin/installer", "bin/btrmind"],
+    "cross-build": ["cross/{target}/installer", "cross/{target}/btrmind"],
+    "static-binaries": ["static/installer", "static/btrmind", "static/SHA256SUMS"],
+    "rust-sbom": ["sbom/rust-binaries.cdx.json", "sbom/rust-binaries.spdx.json"],
+    "generate-docs": [
+        f"docs/{name}/{file.format(name=name)}"
+        for name in ("btrmind", "regicide-installer")
+        for file in _DOC_FILES
+    ],
+    "stage4": ["stage4-{arch}-systemd-cosmic.tar.xz"],
+    "sbom": ["sbom.spdx.json"],
+    "squashfs": ["regicide-cosmic.img"],
+    "sign": [
+        "regicide-cosmic.img.sig",
+        "regicide-cosmic.img.bundle",
+        "regicide-cosmic.img.att",
+        "sbom.spdx.json.sig",
+        "sbom.spdx.json.bundle",
+    ],
+}
+
+
+class MissingArtifact(Exception):
+    """A stage finished without producing an artifact its contract requires."""
+
+    def __init__(self, stage: str, missing: list[Path]):
+        self.stage = stage
+        self.missing = missing
+        super().__init__(
+            f"missing artifact: stage {stage} did not produce "
+            + ", ".join(str(path) for path in missing)
+        )
+
+
+def validate(stage: str, root: Path = OUTPUT_DIR, **params: str) -> None:
+    """Raise MissingArtifact unless every file in stage's contract exists and is non-empty."""
+    missing = []
+    for pattern in CONTRACTS[stage]:
+        path = root / pattern.format(**params)
+        if not path.is_file() or path.stat().st_size == 0:
+            missing.append(path)
+    if missing:
+        raise MissingArtifact(stage, missing)
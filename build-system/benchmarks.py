@@ -0,0 +1,97 @@
+"""Benchmarks - btrmind timings, compared against main on pull requests.
+
+--benchmarks keeps each run's results in runs/<run>/benchmarks.json and
+records the mean of each as a bench-<trace>-ms metric for --trends.  On a
+pull request (REGICIDE_PR_NUMBER set), the newest passed run of the base
+branch (GITHUB_BASE_REF, else main) that has results is the baseline, and
+the PR comment tabulates both with the change in mean.  A change is
+marked significant when Welch's t statistic exceeds SIGNIFICANT_T,
+roughly p < 0.05 at the default run count; smaller differences are noise
+on a shared runner.
+
+The baseline comes from this host's run history, so the comparison is
+only supported on a self-hosted runner that keeps output/runs/ between
+the main and PR runs.  Timings from different machines are not
+comparable, so no shared store would help: each GitHub-hosted job gets a
+fresh VM of varying hardware, and on those (RUNNER_ENVIRONMENT
+github-hosted) the results are recorded but never compared.
+"""
+
+import json
+import math
+import os
+from pathlib import Path
+
+import run_history
+
+
+SIGNIFICANT_T = 2.1
+BASE_BRANCH = os.environ.get("GITHUB_BASE_REF") or "main"
+
+
+def parse(hyperfine_json: str) -> dict[str, dict]:
+    """Return {benchmark: {"mean", "stddev", "runs"}}, in seconds, from hyperfine's JSON export."""
+    return {
+        result["command"]: {"mean": result["mean"], "stddev": result["stddev"] or 0.0, "runs": len(result["times"])}
+        for result in json.loads(hyperfine_json)["results"]
+    }
+
+
+def record(results: dict[str, dict]) -> Path:
+    """Store this run's results and metrics; return runs/<run>/benchmarks.json."""
+    for name, result in results.items():
+        run_history.record_metric(f"bench-{name}-ms", round(result["mean"] * 1000, 2))
+    path = run_history.RUNS_DIR / run_history.run_id() / "benchmarks.json"
+    path.parent.mkdir(parents=True, exist_ok=True)
+    path.write_text(json.dumps(results, indent=2) + "\n")
+    return path
+
+
+def hosted_runner() -> bool:
+    """Return whether this run is on a GitHub-hosted runner, whose timings are not comparable."""
+    return os.environ.get("RUNNER_ENVIRONMENT") == "github-hosted"
+
+
+def baseline(branch: str = BASE_BRANCH) -> tuple[str, dict[str, dict]] | None:
+    """Return (run, results) of the newest passed run of branch that ran the benchmarks."""
+    for summary in reversed(run_history.recent_summaries(0)):
+        path = run_history.RUNS_DIR / summary["run"] / "benchmarks.json"
+        if summary["status"] == "passed" and summary.get("branch") == branch and path.is_file():
+            return summary["run"], json.loads(path.read_text())
+    return None
+
+
+def welch_t(base: dict, head: dict) -> float:
+    """Return Welch's t statistic for the difference in mean of two results."""
+    error = math.sqrt(base["stddev"] ** 2 / base["runs"] + head["stddev"] ** 2 / head["runs"])
+    if error == 0:
+        return 0.0 if base["mean"] == head["mean"] else math.inf
+    return (head["mean"] - base["mean"]) / error
+
+
+def comparison(base_run: str, base: dict[str, dict], head: dict[str, dict]) -> str:
+    """Return the Markdown before/after table for a PR comment."""
+    lines = [
+        "### btrmind benchmarks",
+        "",
+        f"Compared with `{BASE_BRANCH}` run `{base_run}`; mean ± standard deviation of `btrmind simulate` per trace.",
+        "",
+        f"| trace | {BASE_BRANCH} (ms) | this PR (ms) | change | |",
+        "|---|---:|---:|---:|---|",
+    ]
+    for name in sorted(base.keys() | head.keys()):
+        if name not in base or name not in head:
+            only = head.get(name) or base[name]
+            cells = ["-", _ms(only)] if name in head else [_ms(only), "-"]
+            lines.append(f"| {name} | {cells[0]} | {cells[1]} | | {'new' if name in head else 'removed'} |")
+            continue
+        change = (head[name]["mean"] - base[name]["mean"]) / base[name]["mean"] * 100
+        t = welch_t(base[name], head[name])
+        marker = "" if abs(t) <= SIGNIFICANT_T else ("**slower**" if t > 0 else "**faster**")
+        lines.append(f"| {name} | {_ms(base[name])} | {_ms(head[name])} | {change:+.1f}% | {marker} |")
+    lines += ["", f"Marked changes have Welch's |t| > {SIGNIFICANT_T}; the rest are within noise."]
+    return "\n".join(lines) + "\n"
+
+
+def _ms(result: dict) -> str:
+    return f"{result['mean'] * 1000:.2f} ± {result['stddev'] * 1000:.2f}"
@@ -0,0 +1,103 @@
+"""Binpkg channel - the overlay's binary packages as a signed OCI artifact on ghcr.io.
+
+--binpkg-channel runs the overlay deep install tests with FEATURES=buildpkg
+(dagger_pipeline.overlay_deep_tests), so only packages that installed,
+reinstalled and uninstalled cleanly are published.  collect() keeps the
+binpkgs of the overlay's own packages, not the Gentoo dependencies pulled
+from the binhost, in a PKGDIR with its Packages index.  push() uploads that
+PKGDIR with ORAS as one artifact of ARTIFACT_TYPE, one layer per file, to
+REPOSITORY:<arch> and REPOSITORY:<arch>-<commit>; the pipeline then signs
+its digest with cosign (signing.py).  Systems verify the signature, pull the
+artifact into their PKGDIR and emerge with --usepkg; see the README.
+"""
+
+import os
+import shlex
+
+import dagger
+
+import build_info
+import oci_policy
+import publish
+from failure_bundle import checked_exec, from_image
+
+
+REPOSITORY = os.environ.get("REGICIDE_BINPKG_REPOSITORY", "ghcr.io/awdemos/regicide-binpkgs")
+ORAS_IMAGE = "ghcr.io/oras-project/oras:v1.2.0"
+ARTIFACT_TYPE = "application/vnd.regicideos.binpkgs.v1"
+INDEX_MEDIA_TYPE = "application/vnd.regicideos.binpkgs.index.v1"
+GPKG_MEDIA_TYPE = "application/vnd.gentoo.gpkg.v1.tar"
+# Where the deep tests write binpkgs; the binhost's are fetched here too.
+BUILD_PKGDIR = "/var/cache/regicide-channel-build"
+OVERLAY = "/var/db/repos/regicide-overlay"
+
+
+def buildpkg(container: dagger.Container) -> dagger.Container:
+    """Make every merge in container also write a binpkg to BUILD_PKGDIR.
+
+    Without binpkg-multi-instance the reinstall replaces the install's
+    binpkg instead of adding a second one.
+    """
+    return (
+        container
+        .with_env_variable("FEATURES", "buildpkg -binpkg-multi-instance")
+        .with_env_variable("PKGDIR", BUILD_PKGDIR)
+    )
+
+
+async def collect(tested: dagger.Container) -> dagger.Directory:
+    """Return a PKGDIR of the overlay packages' binpkgs in tested, with a Packages index."""
+    collected = await checked_exec(
+        tested,
+        [
+            "sh", "-c",
+            "set -eu; mkdir -p /channel; "
+            f"cd {OVERLAY}; "
+            f'for d in */*/; do [ -d "{BUILD_PKGDIR}/$d" ] || continue; '
+            f'mkdir -p "/channel/$d"; cp -a "{BUILD_PKGDIR}/$d." "/channel/$d"; done; '
+            "ls /channel/regicide-tools/*/*.gpkg.tar > /dev/null"
+            ' || { echo "no regicide-tools binpkgs were built" >&2; exit 1; }; '
+            "PKGDIR=/channel emaint binhost --fix >&2",
+        ],
+        "binpkg-collect",
+    )
+    return collected.directory("/channel")
+
+
+def annotations(arch: str) -> dict[str, str]:
+    """Return the artifact's annotations, checked against oci-label-policy.toml."""
+    labels = build_info.oci_labels("overlay") | {
+        "org.opencontainers.image.title": f"regicide-rust binpkgs ({arch})",
+        "org.opencontainers.image.description": "Binary packages of the RegicideOS regicide-rust overlay",
+    }
+    oci_policy.enforce(f"{REPOSITORY}:{arch}", labels)
+    return labels
+
+
+async def push(client: dagger.Client, channel: dagger.Directory, arch: str) -> str:
+    """Push channel to REPOSITORY:<arch> and :<arch>-<commit>; return REPOSITORY@sha256:..."""
+    user, token = publish.credentials()
+    tags = f"{arch},{arch}-{build_info.git_sha()}"
+    flags = " ".join(f"--annotation {shlex.quote(f'{name}={value}')}" for name, value in annotations(arch).items())
+    pusher = (
+        from_image(client, ORAS_IMAGE)
+        .with_directory("/channel", channel)
+        .with_workdir("/channel")
+        .with_secret_variable("REGISTRY_TOKEN", client.set_secret("oras-registry-token", token))
+    )
+    pushed = await checked_exec(
+        pusher,
+        [
+            "sh", "-c",
+            "set -eu; "
+            f'echo "$REGISTRY_TOKEN" | oras login {publish.REGISTRY} -u {shlex.quote(user)} --password-stdin >&2; '
+            f"files=\"Packages:{INDEX_MEDIA_TYPE}\"; "
+            'for f in $(find . -name "*.gpkg.tar" | sed "s|^\\./||" | sort);'
+            f' do files="$files $f:{GPKG_MEDIA_TYPE}"; done; '
+            f"oras push --artifact-type {ARTIFACT_TYPE} {flags} --export-manifest /tmp/manifest.json "
+            f"{REPOSITORY}:{tags} $files >&2; "
+            "sha256sum /tmp/manifest.json | cut -d' ' -f1",
+        ],
+        "binpkg-push",
+    )
+    return f"{REPOSITORY}@sha256:{(await pushed.stdout()).strip()}"
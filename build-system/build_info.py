@@ -0,0 +1,96 @@
+"""Build metadata stamped into release artifacts.
+
+Release binaries, the stage4 rootfs and build-system/catalyst/output/
+build-info.json all carry the pipeline run ID, the git commit and the
+build profile, so a deployed RegicideOS artifact can be traced back to the
+CI run that built it (`btrmind --version`, `regicide-installer --version`,
+/usr/lib/regicide/build-info).
+
+Only stamp stages whose output ships: the run ID changes every run, so
+stamping a stage also stops Dagger from reusing its cached result.
+"""
+
+import json
+import os
+import subprocess
+import tomllib
+from pathlib import Path
+
+import run_history
+
+
+SOURCE_URL = "https://github.com/awdemos/RegicideOS"
+INFO_PATH = Path("build-system/catalyst/output/build-info.json")
+WORKSPACE_MANIFEST = Path("Cargo.toml")
+
+
+def git_sha() -> str:
+    """Return the commit being built: GITHUB_SHA in Actions, else the checkout's HEAD."""
+    sha = os.environ.get("GITHUB_SHA")
+    if sha:
+        return sha
+    try:
+        return subprocess.run(
+            ["git", "rev-parse", "HEAD"],
+            check=True, capture_output=True, text=True,
+        ).stdout.strip()
+    except (OSError, subprocess.CalledProcessError):
+        return "unknown"
+
+
+def branch() -> str:
+    """Return the branch being built: the pull request's head or the pushed branch in Actions, else the checkout's."""
+    name = os.environ.get("GITHUB_HEAD_REF") or os.environ.get("GITHUB_REF_NAME")
+    if name:
+        return name
+    return subprocess.run(
+        ["git", "rev-parse", "--abbrev-ref", "HEAD"], check=True, capture_output=True, text=True,
+    ).stdout.strip()
+
+
+def git_ref() -> str:
+    """Return the ref being built: GITHUB_REF in Actions, else the checked-out branch."""
+    return os.environ.get("GITHUB_REF") or f"refs/heads/{branch()}"
+
+
+def env(profile: str) -> dict[str, str]:
+    """Return the REGICIDE_BUILD_* variables the binaries and stage6 read."""
+    return {
+        "REGICIDE_BUILD_RUN_ID": run_history.run_id(),
+        "REGICIDE_BUILD_GIT_SHA": git_sha(),
+        "REGICIDE_BUILD_PROFILE": profile,
+    }
+
+
+def license() -> str:
+    """Return the SPDX license of what RegicideOS publishes: the Cargo workspace's."""
+    with WORKSPACE_MANIFEST.open("rb") as f:
+        return tomllib.load(f)["workspace"]["package"]["license"]
+
+
+def oci_labels(profile: str, version: str = "") -> dict[str, str]:
+    """Return org.opencontainers.image.* labels for anything published as an OCI artifact.
+
+    Publishing stages must pass these through oci_policy.enforce() first.
+    """
+    labels = {
+        "org.opencontainers.image.title": "RegicideOS",
+        "org.opencontainers.image.description": "RegicideOS, an immutable Gentoo-based desktop with the COSMIC desktop",
+        "org.opencontainers.image.source": SOURCE_URL,
+        "org.opencontainers.image.revision": git_sha(),
+        "org.opencontainers.image.licenses": license(),
+        "dev.regicideos.build.run-id": run_history.run_id(),
+        "dev.regicideos.build.profile": profile,
+    }
+    if version:
+        labels["org.opencontainers.image.version"] = version
+    return labels
+
+
+def write(profile: str) -> Path:
+    """Write build-info.json next to the release artifacts and return its path."""
+    INFO_PATH.parent.mkdir(parents=True, exist_ok=True)
+    INFO_PATH.write_text(
+        json.dumps({"build": env(profile), "labels": oci_labels(profile)}, indent=2) + "\n", newline="\n"
+    )
+    return INFO_PATH
@@ -0,0 +1,70 @@
+"""Cache volume naming.
+
+Dagger cache volumes are global to the engine, so by default every branch
+shares them, and a toolchain bump on one branch can leave binpkgs, ccache
+or incremental build output that poisons the next run on another.
+REGICIDE_CACHE_NAMESPACE picks how volume names are namespaced:
+
+- ``shared`` (default): no suffix; every branch shares one set of volumes.
+- ``branch``: suffixed with the git branch (build_info.branch()), so
+  branches never share.
+- ``toolchain``: suffixed with a hash of the toolchain inputs (the Rust
+  image and the pinned base image digests), so branches share until one
+  changes the toolchain.
+
+Download caches whose entries are verified by checksum (distfiles, the
+cargo registry) cannot be poisoned and stay shared under every strategy.
+"""
+
+import hashlib
+import os
+import re
+
+import dagger
+
+import build_info
+import image_lock
+
+
+STRATEGIES = ("shared", "branch", "toolchain")
+
+
+def strategy() -> str:
+    """Return the namespacing strategy from REGICIDE_CACHE_NAMESPACE."""
+    value = os.environ.get("REGICIDE_CACHE_NAMESPACE", "shared")
+    if value not in STRATEGIES:
+        raise ValueError(
+            f"REGICIDE_CACHE_NAMESPACE={value!r}; expected one of {', '.join(STRATEGIES)}"
+        )
+    return value
+
+
+def _toolchain_hash() -> str:
+    """Return a short hash of the inputs that decide what compilers produce."""
+    rust_image = os.environ.get("REGICIDE_RUST_IMAGE", "")
+    lock = image_lock.LOCK_PATH.read_text() if image_lock.LOCK_PATH.is_file() else ""
+    return hashlib.sha256(f"{rust_image}\n{lock}".encode()).hexdigest()[:12]
+
+
+def namespace() -> str:
+    """Return the suffix for namespaced volumes, or "" when they are shared."""
+    chosen = strategy()
+    if chosen == "branch":
+        return re.sub(r"[^a-z0-9]+", "-", build_info.branch().lower()).strip("-")[:40]
+    if chosen == "toolchain":
+        return f"tc-{_toolchain_hash()}"
+    return ""
+
+
+def volume_name(name: str, shared: bool = False) -> str:
+    """Return the namespaced name of cache volume name."""
+    suffix = "" if shared else namespace()
+    return f"{name}-{suffix}" if suffix else name
+
+
+def volume(client: dagger.Client, name: str, shared: bool = False) -> dagger.CacheVolume:
+    """Return the cache volume name under the configured namespace.
+
+    Pass shared=True for checksum-verified download caches.
+    """
+    return client.cache_volume(volume_name(name, shared))
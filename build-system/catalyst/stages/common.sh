@@ -49,6 +49,12 @@ export OUTPUT_DIR
 BINPKGS_DIR="${REGICIDE_BINPKGS_DIR:-${ROOTFS}/var/cache/binpkgs}"
 export BINPKGS_DIR
 
+# ccache directory for C/C++ compiles in the chroot.  Unset (the default for
+# manual host builds) disables ccache; the Dagger pipeline points it at a
+# directory it syncs with a cache volume.
+CCACHE_HOST_DIR="${REGICIDE_CCACHE_DIR:-}"
+export CCACHE_HOST_DIR
+
 # bwrap cannot create namespaces under qemu-user emulation (cross-arch
 # builds): its unshare/clone3 calls fail with EINVAL. Probe once per stage
 # run and fall back to a plain chroot (with explicit bind mounts) in that
@@ -90,6 +96,9 @@ run_in_chroot_bwrap() {
         --unshare-cgroup
         --share-net
     )
+    if [[ -n "${CCACHE_HOST_DIR}" ]]; then
+        bwrap_args+=(--bind "${CCACHE_HOST_DIR}" /var/cache/ccache)
+    fi
     if [[ -d "${ROOTFS}/var/db/repos/cosmic-overlay" ]]; then
         bwrap_args+=(--bind "${ROOTFS}/var/db/repos/cosmic-overlay" /var/db/repos/cosmic-overlay)
     fi
@@ -127,6 +136,10 @@ run_in_chroot_chroot() {
         mkdir -p "${ROOTFS}/var/cache/binpkgs"
         mount --bind "${BINPKGS_DIR}" "${ROOTFS}/var/cache/binpkgs" && mounted+=("${ROOTFS}/var/cache/binpkgs")
     fi
+    if [[ -n "${CCACHE_HOST_DIR}" ]]; then
+        mkdir -p "${ROOTFS}/var/cache/ccache"
+        mount --bind "${CCACHE_HOST_DIR}" "${ROOTFS}/var/cache/ccache" && mounted+=("${ROOTFS}/var/cache/ccache")
+    fi
     mount --bind /etc/resolv.conf "${ROOTFS}/etc/resolv.conf" && mounted+=("${ROOTFS}/etc/resolv.conf")
 
     chroot "${ROOTFS}" /usr/bin/env -i \
@@ -158,6 +171,9 @@ ensure_dirs() {
     mkdir -p "${ROOTFS}"/var/cache/distfiles
     mkdir -p "${ROOTFS}"/var/cache/binpkgs
     mkdir -p "${BINPKGS_DIR}"
+    if [[ -n "${CCACHE_HOST_DIR}" ]]; then
+        mkdir -p "${CCACHE_HOST_DIR}" "${ROOTFS}"/var/cache/ccache
+    fi
     mkdir -p "${ROOTFS}"/overlay
     mkdir -p "${ROOTFS}"/roots
     mkdir -p "${ROOTFS}"/home
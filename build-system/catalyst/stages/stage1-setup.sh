@@ -31,7 +31,9 @@ else
     echo "Using existing stage3: ${STAGE3_FILE}"
 fi
 
-if [[ -z "$(ls -A "${ROOTFS}" 2>/dev/null)" ]]; then
+# The Dagger pipeline seeds rootfs/var/cache/distfiles before this stage,
+# so test for an extracted stage3 rather than an empty rootfs.
+if [[ ! -d "${ROOTFS}/usr/bin" ]]; then
     echo "Extracting stage3 to rootfs..."
     mkdir -p "${ROOTFS}/dev"
     tar -C "${ROOTFS}" -xJf "${STAGE3_FILE}" \
@@ -12,7 +12,14 @@ mkdir -p "${ROOTFS}/etc/portage"
 # reuse previously built binpkgs instead of recompiling. FEATURES=buildpkg
 # keeps producing binpkgs for anything that still needs a source build.
 # Set REGICIDE_USE_BINPKGS=0 to force source builds.
-EMERGE_OPTS="--jobs --load-average"
+# Parallelism is configurable: REGICIDE_MAKEOPTS sets MAKEOPTS (its -jN also
+# drives ninja/samu/cargo), REGICIDE_EMERGE_DEFAULT_OPTS replaces the base
+# emerge options.  The binpkg options below are appended either way.
+CPUS="$(nproc)"
+MAKEOPTS_VALUE="${REGICIDE_MAKEOPTS:--j${CPUS} -l${CPUS}}"
+BUILD_JOBS="$(sed -n 's/.*-j[[:space:]]*\([0-9]\+\).*/\1/p' <<< "${MAKEOPTS_VALUE}")"
+BUILD_JOBS="${BUILD_JOBS:-${CPUS}}"
+EMERGE_OPTS="${REGICIDE_EMERGE_DEFAULT_OPTS:---jobs --load-average ${CPUS}}"
 if [[ "${REGICIDE_USE_BINPKGS:-1}" != "0" ]]; then
     EMERGE_OPTS="${EMERGE_OPTS} --usepkg --binpkg-respect-use=y"
     log_status "binpkgs" "local binpkg reuse enabled (--usepkg)"
@@ -26,10 +33,10 @@ CFLAGS="\${COMMON_FLAGS}"
 CXXFLAGS="\${COMMON_FLAGS}"
 FCFLAGS="\${COMMON_FLAGS}"
 FFLAGS="\${COMMON_FLAGS}"
-MAKEOPTS="-j8"
-NINJAFLAGS="-j8"
-SAMUFLAGS="-j8"
-CARGO_BUILD_JOBS="8"
+MAKEOPTS="${MAKEOPTS_VALUE}"
+NINJAFLAGS="-j${BUILD_JOBS}"
+SAMUFLAGS="-j${BUILD_JOBS}"
+CARGO_BUILD_JOBS="${BUILD_JOBS}"
 USE="wayland dist-kernel fuse flatpak gstreamer lvm networkmanager nls pipewire pipewire-alsa policykit udev usb screencast ${GENTOO_VIDEO_CARDS} vaapi vpx xkb"
 FEATURES="parallel-fetch buildpkg -ipc-sandbox -network-sandbox -pid-sandbox -userfetch -usersandbox -userpriv"
 ACCEPT_LICENSE="*"
@@ -71,9 +78,29 @@ cat > "${ROOTFS}/etc/portage/package.env" << 'EOF'
 app-emulation/qemu-guest-agent allow-container-storage.conf
 EOF
 
-echo "Syncing Portage tree..."
-log_status "sync" "emerge-webrsync"
-run_in_chroot emerge-webrsync
+# The Dagger pipeline unpacks a snapshot fetched the same day in stage1
+# and sets REGICIDE_SKIP_WEBRSYNC=1; manual builds sync here.
+if [[ "${REGICIDE_SKIP_WEBRSYNC:-0}" == "1" ]]; then
+    log_status "sync" "using the stage1 Portage snapshot"
+else
+    echo "Syncing Portage tree..."
+    log_status "sync" "emerge-webrsync"
+    run_in_chroot emerge-webrsync
+fi
+
+# ccache for C/C++ packages: install it first, then enable FEATURES=ccache
+# so @world and every later stage compile through the persistent cache.
+if [[ -n "${CCACHE_HOST_DIR}" && "${REGICIDE_USE_CCACHE:-1}" != "0" ]]; then
+    log_status "ccache" "enabling ccache (${REGICIDE_CCACHE_SIZE:-10G})"
+    ensure_dirs
+    run_in_chroot emerge -q1 --noreplace dev-util/ccache
+    printf 'max_size = %s\ncompiler_check = content\n' "${REGICIDE_CCACHE_SIZE:-10G}" \
+        > "${CCACHE_HOST_DIR}/ccache.conf"
+    cat >> "${ROOTFS}/etc/portage/make.conf" << 'EOF'
+FEATURES="${FEATURES} ccache"
+CCACHE_DIR="/var/cache/ccache"
+EOF
+fi
 
 echo "Updating @world..."
 log_status "world-update" "emerge -uDNq @world"
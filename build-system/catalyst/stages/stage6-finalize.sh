@@ -453,6 +453,17 @@ run_in_chroot bash <<'STAGE6CLEANEOF'
     rm -rf /tmp/* /tmp/.*[!.]* 2>/dev/null || true
 STAGE6CLEANEOF
 
+# Record which pipeline run built the image (build-system/build_info.py).
+if [[ -n "${REGICIDE_BUILD_RUN_ID:-}" ]]; then
+    install -d "${ROOTFS}/usr/lib/regicide"
+    cat > "${ROOTFS}/usr/lib/regicide/build-info" <<EOF
+REGICIDE_BUILD_RUN_ID=${REGICIDE_BUILD_RUN_ID}
+REGICIDE_BUILD_GIT_SHA=${REGICIDE_BUILD_GIT_SHA:-unknown}
+REGICIDE_BUILD_PROFILE=${REGICIDE_BUILD_PROFILE:-release}
+EOF
+    chmod 0644 "${ROOTFS}/usr/lib/regicide/build-info"
+fi
+
 echo "Creating stage4 tarball..."
 log_status "tarball" "creating stage4-amd64-systemd-cosmic.tar.xz"
 mkdir -p "${OUTPUT_DIR}"
@@ -15,101 +15,14 @@ DEFAULT_QCOW2="${OUTPUT_DIR}/regicide-cosmic.qcow2"
 QCOW2="${1:-${DEFAULT_QCOW2}}"
 QCOW2="$(realpath -e "${QCOW2}" 2>/dev/null || true)"
 
-# Pick a free local SSH forwarding port.  A fixed port (2222) collides when
-# another RegicideOS VM is already running on the host.
-find_free_port() {
-    local base="${1:-2222}"
-    local port
-    for port in $(seq "${base}" 2999); do
-        if ! (command -v ss >/dev/null 2>&1 && ss -Htn "sport = :${port}" | grep -q .) && \
-           ! (command -v netstat >/dev/null 2>&1 && netstat -atn 2>/dev/null | grep -q ":${port} ") && \
-           ! (timeout 1 bash -c "exec 3<>/dev/tcp/127.0.0.1/${port}" 2>/dev/null); then
-            echo "${port}"
-            return 0
-        fi
-    done
-    echo "ERROR: no free TCP port found in range ${base}-2999" >&2
-    return 1
-}
-SSH_PORT="${REGICIDE_VM_SSH_PORT:-$(find_free_port 2222)}"
-VM_MEMORY="${REGICIDE_VM_MEMORY:-4096}"
-VM_SMP="${REGICIDE_VM_SMP:-4}"
-TIMEOUT_SEC="${REGICIDE_VM_TIMEOUT:-300}"
+source "$(dirname "$0")/vm-common.sh"
 DIAG_DIR="${OUTPUT_DIR}/vm-test-diagnostics"
-VM_DISPLAY="${REGICIDE_VM_DISPLAY:-none}"
-SSH_USER="regicide"
-SSH_PASS="regicide"
-
-log_status() {
-    local event="${1:-info}"
-    local detail="${2:-}"
-    local status_dir="${OUTPUT_DIR}"
-    local status_file="${status_dir}/build-status.jsonl"
-    mkdir -p "${status_dir}"
-    printf '{"time":"%s","stage":"%s","event":"%s","detail":"%s"}\n' \
-        "$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
-        "${STAGE_NAME}" \
-        "${event}" \
-        "${detail}" >> "${status_file}"
-}
 
 if [[ -z "${QCOW2}" || ! -f "${QCOW2}" ]]; then
     echo "ERROR: QCOW2 image not found: ${1:-${DEFAULT_QCOW2}}"
     exit 1
 fi
 
-if [[ ! -e /dev/kvm ]]; then
-    echo "Warning: /dev/kvm not available; VM will be very slow."
-fi
-
-mkdir -p "${DIAG_DIR}"
-
-# Use /var/tmp for sockets/OVMF copy so a small tmpfs /tmp is not exhausted.
-WORK_DIR="$(TMPDIR=/var/tmp mktemp -d -t regicide-vm-test-XXXXXX)"
-trap 'rm -rf "${WORK_DIR}"' EXIT
-
-OVMF_CODE=""
-OVMF_VARS_SRC=""
-for path in \
-    /usr/share/OVMF/OVMF_CODE.fd \
-    /usr/share/edk2/ovmf/OVMF_CODE.fd \
-    /usr/share/qemu/OVMF_CODE.fd \
-    /usr/share/ovmf/x64/OVMF_CODE.fd
-do
-    if [[ -f "${path}" ]]; then
-        OVMF_CODE="${path}"
-        break
-    fi
-done
-for path in \
-    /usr/share/OVMF/OVMF_VARS.fd \
-    /usr/share/edk2/ovmf/OVMF_VARS.fd \
-    /usr/share/qemu/OVMF_VARS.fd \
-    /usr/share/ovmf/x64/OVMF_VARS.fd
-do
-    if [[ -f "${path}" ]]; then
-        OVMF_VARS_SRC="${path}"
-        break
-    fi
-done
-
-if [[ -z "${OVMF_CODE}" ]]; then
-    echo "ERROR: OVMF firmware not found."
-    exit 1
-fi
-
-OVMF_VARS="${WORK_DIR}/ovmf-vars.fd"
-cp "${OVMF_VARS_SRC:-${OVMF_CODE}}" "${OVMF_VARS}" 2>/dev/null || true
-
-SERIAL_SOCK="${WORK_DIR}/serial.sock"
-MONITOR_SOCK="${WORK_DIR}/monitor.sock"
-PIDFILE="${WORK_DIR}/qemu.pid"
-
-KVM_FLAGS=()
-if [[ -e /dev/kvm ]] && [[ -r /dev/kvm ]]; then
-    KVM_FLAGS=(-enable-kvm -cpu host)
-fi
-
 log_status "start" "booting ${QCOW2}"
 echo "Stage 8: post-install VM test"
 echo "  Image:  ${QCOW2}"
@@ -119,151 +32,9 @@ echo "  Memory: ${VM_MEMORY} MB"
 echo "  CPUs:   ${VM_SMP}"
 echo "  Timeout: ${TIMEOUT_SEC}s"
 
-# Default to headless; use REGICIDE_VM_DISPLAY=vnc or sdl for manual observation.
-DISPLAY_ARGS=(-display none -vga none)
-case "${VM_DISPLAY}" in
-    vnc) DISPLAY_ARGS=(-display vnc=:0 -vga virtio) ;;
-    sdl) DISPLAY_ARGS=(-display "sdl,gl=on" -vga virtio) ;;
-esac
-
-echo "Starting QEMU..."
-qemu-system-x86_64 \
-    "${KVM_FLAGS[@]}" \
-    -m "${VM_MEMORY}" \
-    -smp "${VM_SMP}" \
-    -drive "file=${QCOW2},format=qcow2,if=virtio" \
-    -netdev "user,id=net0,hostfwd=tcp::${SSH_PORT}-:22" \
-    -device virtio-net-pci,netdev=net0 \
-    "${DISPLAY_ARGS[@]}" \
-    -machine type=q35 \
-    -drive "if=pflash,format=raw,readonly=on,file=${OVMF_CODE}" \
-    -drive "if=pflash,format=raw,file=${OVMF_VARS}" \
-    -serial "unix:${SERIAL_SOCK},server,nowait" \
-    -monitor "unix:${MONITOR_SOCK},server,nowait" \
-    -daemonize \
-    -pidfile "${PIDFILE}"
-
-# Wait for QEMU to create the serial socket.
-for _ in $(seq 1 30); do
-    if [[ -S "${SERIAL_SOCK}" ]]; then
-        break
-    fi
-    sleep 0.5
-done
-if [[ ! -S "${SERIAL_SOCK}" ]]; then
-    echo "ERROR: QEMU serial socket did not appear."
-    exit 1
-fi
-
-QEMU_PID="$(cat "${PIDFILE}" 2>/dev/null || true)"
-if [[ -z "${QEMU_PID}" ]]; then
-    echo "ERROR: QEMU pidfile empty."
-    exit 1
-fi
-
-cleanup_qemu() {
-    if [[ -n "${QEMU_PID}" ]] && kill -0 "${QEMU_PID}" 2>/dev/null; then
-        echo "Stopping QEMU (pid ${QEMU_PID})..."
-        kill "${QEMU_PID}" 2>/dev/null || true
-        sleep 2
-        kill -9 "${QEMU_PID}" 2>/dev/null || true
-    fi
-}
-trap 'cleanup_qemu; rm -rf "${WORK_DIR}"' EXIT
-
-# Wait for the login prompt on the serial console; this confirms the OS has
-# booted far enough for SSH to be usable without polling the TCP port.
-echo "Waiting for VM to reach login prompt (up to ${TIMEOUT_SEC}s)..."
-python3 - "${SERIAL_SOCK}" "${TIMEOUT_SEC}" <<'PYEOF'
-import socket, sys, time
-sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
-deadline = time.time() + 30
-while True:
-    try:
-        sock.connect(sys.argv[1])
-        break
-    except (FileNotFoundError, ConnectionRefusedError):
-        if time.time() > deadline:
-            print("!ERR: serial socket unavailable", flush=True)
-            sys.exit(1)
-        time.sleep(0.2)
-sock.setblocking(False)
-buf = b""
-login_deadline = time.time() + int(sys.argv[2])
-while time.time() < login_deadline:
-    try:
-        data = sock.recv(4096)
-        if data:
-            buf += data
-            if len(buf) > 8192:
-                buf = buf[-8192:]
-            text = buf.decode(errors="replace")
-            if "login:" in text or "Password:" in text:
-                print("LOGIN_PROMPT_OK", flush=True)
-                sys.exit(0)
-    except BlockingIOError:
-        pass
-    time.sleep(0.2)
-print("!ERR: login prompt not seen within timeout", flush=True)
-sys.exit(1)
-PYEOF
-
-# Wait for sshd to be ready on the forwarded port.  A TCP open is not enough;
-# QEMU's user networking accepts the connection before the guest sshd is ready,
-# so wait for the SSH protocol banner.  Allow extra time for first-boot sshd
-# socket activation and host-key generation on slower hosts.
-echo "Waiting for sshd banner on localhost:${SSH_PORT}..."
-ready=false
-# Give systemd a moment to start sshd.socket after the login prompt appears.
-sleep 3
-for _ in $(seq 1 180); do
-    # Read one line rather than a fixed byte count; OpenSSH banners are
-    # shorter than 32 bytes ("SSH-2.0-...\\r\\n"), so head -c 32 can block
-    # waiting for more data and cause the timeout to fire even when sshd is
-    # already listening.
-    # Use 127.0.0.1 explicitly; QEMU user networking binds to IPv4 only and
-    # bash's /dev/tcp may try ::1 first when localhost is used, causing spurious
-    # banner-wait failures on hosts where IPv6 is preferred.
-    if timeout 3 bash -c "exec 3<>/dev/tcp/127.0.0.1/${SSH_PORT}; head -n 1 <&3 | grep -q SSH" 2>/dev/null; then
-        ready=true
-        break
-    fi
-    sleep 1
-done
-if [[ "${ready}" != true ]]; then
-    echo "ERROR: sshd did not become reachable on port ${SSH_PORT}"
-    exit 1
-fi
-
-# Use 127.0.0.1 explicitly. QEMU user networking binds the SSH forward to IPv4
-# only, and ssh/bash /dev/tcp may try ::1 first when "localhost" is used,
-# causing spurious banner-wait or login failures on IPv6-preferring hosts.
-SSH_HOST="127.0.0.1"
-
-# The SSH protocol banner proves sshd is listening, but user networking can
-# race and an early banner does not guarantee that the default user can log in
-# (e.g. missing /home, host keys, or PAM issues).  Probe a real password login
-# once before running the full diagnostic suite so failures surface quickly.
-echo "Probing real SSH password login for ${SSH_USER}..."
-if ! sshpass -p "${SSH_PASS}" ssh \
-        -o StrictHostKeyChecking=no \
-        -o UserKnownHostsFile=/dev/null \
-        -o LogLevel=ERROR \
-        -o ConnectTimeout=10 \
-        -p "${SSH_PORT}" \
-        "${SSH_USER}@${SSH_HOST}" \
-        "whoami" | grep -qx "${SSH_USER}"; then
-    echo "ERROR: SSH password login failed for ${SSH_USER}@${SSH_HOST}:${SSH_PORT}"
-    echo "       sshd banner was reachable, but authentication did not succeed."
-    exit 1
-fi
-SSH_OPTS=(-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o LogLevel=ERROR -o ConnectTimeout=5 -p "${SSH_PORT}")
-
-# Use sshpass for password-based SSH; StrictHostKeyChecking=no because this is
-# a freshly built VM with new host keys generated on first boot.
-run_ssh() {
-    sshpass -p "${SSH_PASS}" ssh "${SSH_OPTS[@]}" "${SSH_USER}@${SSH_HOST}" "$@"
-}
+vm_start "${QCOW2}"
+wait_for_login
+wait_for_ssh
 
 mkdir -p "${DIAG_DIR}"
 
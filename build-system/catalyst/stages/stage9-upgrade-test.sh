@@ -0,0 +1,218 @@
+#!/bin/bash
+# Stage 9: upgrade-path VM test.
+# Boots the previous RegicideOS QCOW2 artifact, installs the newly built
+# stage4 tarball with regicide-image (the same path users take to update an
+# existing system), reboots, and checks that the new image is running and
+# that every service active before the upgrade came back without failures.
+# It then makes a regicide-update transaction fail halfway and checks that
+# the BTRFS snapshot rollback restores /etc and /var on the next boot.
+# The previous image is never modified; the VM runs on a copy-on-write
+# overlay of it.
+set -euo pipefail
+
+source "$(dirname "$0")/common.sh"
+STAGE_NAME="stage9-upgrade-test"
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+CATALYST_DIR="$(cd "${SCRIPT_DIR}/.." && pwd)"
+OUTPUT_DIR="${OUTPUT_DIR:-${CATALYST_DIR}/output}"
+
+usage="usage: stage9-upgrade-test.sh <previous-qcow2> <stage4-tarball>"
+PREVIOUS_QCOW2="$(realpath -e "${1:?${usage}}" 2>/dev/null || true)"
+UPDATE_TARBALL="$(realpath -e "${2:?${usage}}" 2>/dev/null || true)"
+
+source "$(dirname "$0")/vm-common.sh"
+DIAG_DIR="${OUTPUT_DIR}/upgrade-test-diagnostics"
+GUEST_TARBALL="/var/tmp/regicide-update.tar.xz"
+GUEST_ROOTS="/var/tmp/regicide-upgrade-roots"
+
+if [[ -z "${PREVIOUS_QCOW2}" || ! -f "${PREVIOUS_QCOW2}" ]]; then
+    echo "ERROR: previous QCOW2 image not found: ${1}"
+    exit 1
+fi
+if [[ -z "${UPDATE_TARBALL}" || ! -f "${UPDATE_TARBALL}" ]]; then
+    echo "ERROR: stage4 tarball not found: ${2}"
+    exit 1
+fi
+
+rm -rf "${DIAG_DIR}"
+mkdir -p "${DIAG_DIR}"
+
+DISK="${WORK_DIR}/upgrade.qcow2"
+qemu-img create -q -f qcow2 -F qcow2 -b "${PREVIOUS_QCOW2}" "${DISK}"
+
+log_status "start" "upgrading ${PREVIOUS_QCOW2} to ${UPDATE_TARBALL}"
+echo "Stage 9: upgrade-path VM test"
+echo "  Previous image: ${PREVIOUS_QCOW2}"
+echo "  Update:         ${UPDATE_TARBALL}"
+echo "  SSH:            localhost:${SSH_PORT} -> :22"
+echo "  Timeout:        ${TIMEOUT_SEC}s per boot"
+
+vm_start "${DISK}"
+
+# Services that are legitimately per-boot or per-connection and so do not
+# have to be active on both sides of the reboot.
+active_services() {
+    run_ssh "systemctl list-units --type=service --state=active --no-legend --plain" \
+        | awk '{ print $1 }' \
+        | grep -Ev '^(sshd@|user@|user-runtime-dir@|session-|systemd-fsck@)' \
+        | sort || true
+}
+
+# cosmic-greeter.service fails without a display; stage8 allows it too.
+failed_units() {
+    run_ssh "systemctl --failed --no-legend --plain" \
+        | awk '{ print $1 }' \
+        | grep -v '^cosmic-greeter.service$' || true
+}
+
+collect_diagnostics() {
+    local phase="$1"
+    run_ssh "journalctl -b --no-pager -p warning" > "${DIAG_DIR}/${phase}-journal-warnings.txt" 2>&1 || true
+    run_ssh "systemctl status --no-pager -l" > "${DIAG_DIR}/${phase}-services.txt" 2>&1 || true
+}
+
+echo "Booting previous image..."
+wait_for_login "${DIAG_DIR}/serial-previous.log"
+wait_for_ssh
+
+OLD_BOOT_ID="$(run_ssh cat /proc/sys/kernel/random/boot_id)"
+run_ssh cat /etc/os-release > "${DIAG_DIR}/os-release-previous.txt"
+active_services > "${DIAG_DIR}/services-before.txt"
+failed_units > "${DIAG_DIR}/failed-before.txt"
+collect_diagnostics previous
+if ! run_ssh "command -v regicide-image" >/dev/null 2>&1; then
+    echo "ERROR: the previous image has no regicide-image; it cannot be upgraded in place."
+    log_status "failed" "previous image predates regicide-image"
+    exit 1
+fi
+
+echo "Copying $(du -h "${UPDATE_TARBALL}" | cut -f1) update into the VM..."
+sshpass -p "${SSH_PASS}" scp "${SSH_OPTS[@]}" -P "${SSH_PORT}" \
+    "${UPDATE_TARBALL}" "${SSH_USER}@${SSH_HOST}:${GUEST_TARBALL}"
+
+# The running root is mounted read-only, so install through a second,
+# writable mount of the top-level subvolume.
+echo "Applying the update with regicide-image install..."
+if ! run_ssh "set -e
+    dev=\$(findmnt -n -o SOURCE / | sed 's/\\[.*//')
+    sudo -n mkdir -p ${GUEST_ROOTS}
+    sudo -n mount -o subvolid=5 \"\${dev}\" ${GUEST_ROOTS}
+    sudo -n regicide-image install ${GUEST_TARBALL} --roots-mount ${GUEST_ROOTS}
+    sudo -n umount ${GUEST_ROOTS}
+    sudo -n rm -f ${GUEST_TARBALL}
+    sync" > "${DIAG_DIR}/install.txt" 2>&1; then
+    cat "${DIAG_DIR}/install.txt"
+    echo "ERROR: regicide-image install failed"
+    log_status "failed" "regicide-image install failed"
+    exit 1
+fi
+
+echo "Rebooting into the updated image..."
+run_ssh "sudo -n systemctl reboot" || true
+wait_for_login "${DIAG_DIR}/serial-updated.log"
+wait_for_ssh
+
+failures=()
+
+# Compare service state after a reboot with the baseline in
+# services-before.txt; PHASE names the diagnostics files.
+check_services() {
+    local phase="$1"
+    local missing
+    # Let the boot settle before judging service state.
+    run_ssh "timeout ${TIMEOUT_SEC} systemctl is-system-running --wait" > "${DIAG_DIR}/system-state-${phase}.txt" 2>&1 || true
+    active_services > "${DIAG_DIR}/services-${phase}.txt"
+    failed_units > "${DIAG_DIR}/failed-${phase}.txt"
+    collect_diagnostics "${phase}"
+
+    missing="$(comm -23 "${DIAG_DIR}/services-before.txt" "${DIAG_DIR}/services-${phase}.txt")"
+    if [[ -n "${missing}" ]]; then
+        failures+=("${phase}: services no longer active: $(echo "${missing}" | paste -sd' ')")
+    fi
+    if [[ -s "${DIAG_DIR}/failed-${phase}.txt" ]]; then
+        failures+=("${phase}: failed units: $(paste -sd' ' "${DIAG_DIR}/failed-${phase}.txt")")
+    fi
+    for unit in sshd.socket cosmic-greeter-daemon.service; do
+        state="$(run_ssh "systemctl is-active ${unit}" 2>/dev/null || true)"
+        [[ "${state}" == "active" ]] || failures+=("${phase}: ${unit} is ${state:-unknown}")
+    done
+}
+
+fail_if_any() {
+    if (( ${#failures[@]} > 0 )); then
+        printf 'FAIL: %s\n' "${failures[@]}"
+        log_status "failed" "$(printf '%s; ' "${failures[@]}")"
+        exit 1
+    fi
+}
+
+NEW_BOOT_ID="$(run_ssh cat /proc/sys/kernel/random/boot_id)"
+[[ "${NEW_BOOT_ID}" != "${OLD_BOOT_ID}" ]] || failures+=("updated: the VM did not reboot")
+
+run_ssh cat /etc/os-release > "${DIAG_DIR}/os-release-updated.txt"
+if tar -xOf "${UPDATE_TARBALL}" --wildcards '*usr/lib/os-release' > "${WORK_DIR}/os-release-expected" 2>/dev/null \
+        && [[ -s "${WORK_DIR}/os-release-expected" ]]; then
+    diff -u "${WORK_DIR}/os-release-expected" "${DIAG_DIR}/os-release-updated.txt" \
+        > "${DIAG_DIR}/os-release.diff" || failures+=("updated: os-release does not match the update")
+else
+    echo "Warning: no usr/lib/os-release in the tarball; skipping the version check."
+fi
+check_services updated
+fail_if_any
+echo "Upgrade applied and services restarted cleanly."
+
+# Rollback: run a package transaction through regicide-update whose emerge
+# dies halfway, after it has already changed /etc and /var.  regicide-update
+# must schedule a revert to its pre-transaction snapshot, and the next boot
+# must restore that snapshot and come up healthy.
+echo "Injecting a failure into a regicide-update transaction..."
+run_ssh "sudo -n cat /etc/hostname" > "${DIAG_DIR}/hostname-before-fault.txt" 2>&1 || true
+if run_ssh "set -e
+    mkdir -p /var/tmp/regicide-fault
+    cat > /var/tmp/regicide-fault/emerge <<'FAULTEOF'
+#!/bin/sh
+echo 'Injected fault: emerge dying mid-merge' >&2
+echo regicide-fault > /etc/regicide-fault-marker
+echo regicide-fault > /var/lib/regicide-fault-marker
+echo regicide-fault-host > /etc/hostname
+exit 1
+FAULTEOF
+    chmod 755 /var/tmp/regicide-fault/emerge
+    sudo -n env PATH=/var/tmp/regicide-fault:/usr/sbin:/usr/bin:/sbin:/bin \
+        regicide-update install app-misc/regicide-fault" > "${DIAG_DIR}/fault-transaction.txt" 2>&1; then
+    failures+=("rollback: regicide-update reported success for a failed emerge")
+fi
+grep -q "Reboot to roll back to" "${DIAG_DIR}/fault-transaction.txt" \
+    || failures+=("rollback: regicide-update did not schedule a revert")
+fail_if_any
+PRE_SNAPSHOT="$(sed -n 's/.*Reboot to roll back to \(.*\)\.$/\1/p' "${DIAG_DIR}/fault-transaction.txt" | tail -1)"
+
+echo "Rebooting to apply the rollback to ${PRE_SNAPSHOT}..."
+run_ssh "sudo -n systemctl reboot" || true
+wait_for_login "${DIAG_DIR}/serial-rollback.log"
+wait_for_ssh
+
+ROLLBACK_BOOT_ID="$(run_ssh cat /proc/sys/kernel/random/boot_id)"
+[[ "${ROLLBACK_BOOT_ID}" != "${NEW_BOOT_ID}" ]] || failures+=("rollback: the VM did not reboot")
+run_ssh "sudo -n journalctl -b --no-pager -u regicide-rollback-apply.service" > "${DIAG_DIR}/rollback-apply.txt" 2>&1 || true
+grep -q "Revert applied" "${DIAG_DIR}/rollback-apply.txt" \
+    || failures+=("rollback: regicide-rollback-apply.service did not apply the revert")
+for marker in /etc/regicide-fault-marker /var/lib/regicide-fault-marker; do
+    run_ssh "test ! -e ${marker}" || failures+=("rollback: ${marker} survived the rollback")
+done
+run_ssh "sudo -n cat /etc/hostname" > "${DIAG_DIR}/hostname-after-rollback.txt" 2>&1 || true
+cmp -s "${DIAG_DIR}/hostname-before-fault.txt" "${DIAG_DIR}/hostname-after-rollback.txt" \
+    || failures+=("rollback: /etc/hostname was not restored")
+run_ssh "sudo -n test ! -e /roots/.regicide-revert" || failures+=("rollback: the revert flag was not cleared")
+current="$(run_ssh "sudo -n regicide-rollback current" 2>/dev/null || true)"
+[[ "${current}" == "${PRE_SNAPSHOT}" ]] \
+    || failures+=("rollback: current snapshot set is '${current}', expected '${PRE_SNAPSHOT}'")
+check_services rollback
+fail_if_any
+
+echo ""
+echo "Stage 9 upgrade-path VM test passed (upgrade and rollback)."
+echo "Diagnostics collected in ${DIAG_DIR}"
+log_status "complete" "upgrade from ${PREVIOUS_QCOW2##*/} and rollback passed"
+exit 0
@@ -0,0 +1,187 @@
+#!/bin/bash
+# QEMU helpers shared by the VM test stages (stage8-vm-test.sh and
+# stage9-upgrade-test.sh).  Source it after common.sh, with STAGE_NAME and
+# OUTPUT_DIR set.  It creates WORK_DIR under /var/tmp; vm_start boots a
+# disk and installs the EXIT trap that stops QEMU and removes WORK_DIR.
+
+VM_MEMORY="${REGICIDE_VM_MEMORY:-4096}"
+VM_SMP="${REGICIDE_VM_SMP:-4}"
+TIMEOUT_SEC="${REGICIDE_VM_TIMEOUT:-300}"
+VM_DISPLAY="${REGICIDE_VM_DISPLAY:-none}"
+SSH_USER="regicide"
+SSH_PASS="regicide"
+# Use 127.0.0.1 explicitly. QEMU user networking binds the SSH forward to IPv4
+# only, and ssh may try ::1 first when "localhost" is used.
+SSH_HOST="127.0.0.1"
+
+# The VM stages take OUTPUT_DIR from the caller, so log next to it rather
+# than in catalyst/output like the build stages.
+log_status() {
+    local event="${1:-info}"
+    local detail="${2:-}"
+    mkdir -p "${OUTPUT_DIR}"
+    printf '{"time":"%s","stage":"%s","event":"%s","detail":"%s"}\n' \
+        "$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+        "${STAGE_NAME}" \
+        "${event}" \
+        "${detail}" >> "${OUTPUT_DIR}/build-status.jsonl"
+}
+
+# Pick a free local SSH forwarding port.  A fixed port (2222) collides when
+# another RegicideOS VM is already running on the host.
+find_free_port() {
+    local base="${1:-2222}"
+    local port
+    for port in $(seq "${base}" 2999); do
+        if ! (command -v ss >/dev/null 2>&1 && ss -Htn "sport = :${port}" | grep -q .) && \
+           ! (command -v netstat >/dev/null 2>&1 && netstat -atn 2>/dev/null | grep -q ":${port} ") && \
+           ! (timeout 1 bash -c "exec 3<>/dev/tcp/127.0.0.1/${port}" 2>/dev/null); then
+            echo "${port}"
+            return 0
+        fi
+    done
+    echo "ERROR: no free TCP port found in range ${base}-2999" >&2
+    return 1
+}
+SSH_PORT="${REGICIDE_VM_SSH_PORT:-$(find_free_port 2222)}"
+
+# Use /var/tmp for the overlay disk, sockets and OVMF copy so a small tmpfs
+# /tmp is not exhausted.
+WORK_DIR="$(TMPDIR=/var/tmp mktemp -d -t "regicide-${STAGE_NAME}-XXXXXX")"
+trap 'rm -rf "${WORK_DIR}"' EXIT
+SERIAL_SOCK="${WORK_DIR}/serial.sock"
+MONITOR_SOCK="${WORK_DIR}/monitor.sock"
+PIDFILE="${WORK_DIR}/qemu.pid"
+QEMU_PID=""
+
+# Set OVMF_CODE and OVMF_VARS, a writable copy of the UEFI variable store.
+# doctor.py checks the same paths.
+find_ovmf() {
+    local dir
+    local vars_src=""
+    OVMF_CODE=""
+    for dir in /usr/share/OVMF /usr/share/edk2/ovmf /usr/share/qemu /usr/share/ovmf/x64; do
+        [[ -z "${OVMF_CODE}" && -f "${dir}/OVMF_CODE.fd" ]] && OVMF_CODE="${dir}/OVMF_CODE.fd"
+        [[ -z "${vars_src}" && -f "${dir}/OVMF_VARS.fd" ]] && vars_src="${dir}/OVMF_VARS.fd"
+    done
+    if [[ -z "${OVMF_CODE}" ]]; then
+        echo "ERROR: OVMF firmware not found."
+        return 1
+    fi
+    OVMF_VARS="${WORK_DIR}/ovmf-vars.fd"
+    cp "${vars_src:-${OVMF_CODE}}" "${OVMF_VARS}"
+}
+
+cleanup_qemu() {
+    if [[ -n "${QEMU_PID}" ]] && kill -0 "${QEMU_PID}" 2>/dev/null; then
+        echo "Stopping QEMU (pid ${QEMU_PID})..."
+        kill "${QEMU_PID}" 2>/dev/null || true
+        sleep 2
+        kill -9 "${QEMU_PID}" 2>/dev/null || true
+    fi
+}
+
+# Boot DISK (qcow2) headless, or on REGICIDE_VM_DISPLAY=vnc or sdl for
+# manual observation, with SSH forwarded to SSH_PORT.
+vm_start() {
+    local disk="$1"
+    local kvm_flags=()
+    local display_args=(-display none -vga none)
+    if [[ -r /dev/kvm ]]; then
+        kvm_flags=(-enable-kvm -cpu host)
+    else
+        echo "Warning: /dev/kvm not available; VM will be very slow."
+    fi
+    case "${VM_DISPLAY}" in
+        vnc) display_args=(-display vnc=:0 -vga virtio) ;;
+        sdl) display_args=(-display "sdl,gl=on" -vga virtio) ;;
+    esac
+    find_ovmf
+
+    echo "Starting QEMU..."
+    qemu-system-x86_64 \
+        "${kvm_flags[@]}" \
+        -m "${VM_MEMORY}" \
+        -smp "${VM_SMP}" \
+        -drive "file=${disk},format=qcow2,if=virtio" \
+        -netdev "user,id=net0,hostfwd=tcp::${SSH_PORT}-:22" \
+        -device virtio-net-pci,netdev=net0 \
+        "${display_args[@]}" \
+        -machine type=q35 \
+        -drive "if=pflash,format=raw,readonly=on,file=${OVMF_CODE}" \
+        -drive "if=pflash,format=raw,file=${OVMF_VARS}" \
+        -serial "unix:${SERIAL_SOCK},server,nowait" \
+        -monitor "unix:${MONITOR_SOCK},server,nowait" \
+        -daemonize \
+        -pidfile "${PIDFILE}"
+
+    QEMU_PID="$(cat "${PIDFILE}" 2>/dev/null || true)"
+    if [[ -z "${QEMU_PID}" ]]; then
+        echo "ERROR: QEMU pidfile empty."
+        return 1
+    fi
+    trap 'cleanup_qemu; rm -rf "${WORK_DIR}"' EXIT
+}
+
+# Wait for the login prompt on the serial console, which confirms the OS
+# has booted far enough for SSH, copying the console to SERIAL_LOG.  QEMU
+# keeps the socket across guest reboots, so this works for every boot.
+wait_for_login() {
+    local serial_log="${1:-/dev/null}"
+    echo "Waiting for the VM to reach the login prompt (up to ${TIMEOUT_SEC}s)..."
+    python3 - "${SERIAL_SOCK}" "${TIMEOUT_SEC}" "${serial_log}" <<'PYEOF'
+import socket, sys, time
+sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+deadline = time.time() + 30
+while True:
+    try:
+        sock.connect(sys.argv[1])
+        break
+    except (FileNotFoundError, ConnectionRefusedError):
+        if time.time() > deadline:
+            print("!ERR: serial socket unavailable", flush=True)
+            sys.exit(1)
+        time.sleep(0.2)
+sock.settimeout(0.2)
+tail = b""
+login_deadline = time.time() + int(sys.argv[2])
+with open(sys.argv[3], "ab") as log:
+    while time.time() < login_deadline:
+        try:
+            data = sock.recv(4096)
+        except socket.timeout:
+            continue
+        if not data:
+            break
+        log.write(data)
+        tail = (tail + data)[-8192:]
+        if b"login:" in tail or b"Password:" in tail:
+            print("LOGIN_PROMPT_OK", flush=True)
+            sys.exit(0)
+print("!ERR: login prompt not seen within timeout", flush=True)
+sys.exit(1)
+PYEOF
+}
+
+# StrictHostKeyChecking=no because every boot of a fresh image generates new
+# host keys.
+SSH_OPTS=(-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o LogLevel=ERROR -o ConnectTimeout=5)
+
+run_ssh() {
+    sshpass -p "${SSH_PASS}" ssh "${SSH_OPTS[@]}" -p "${SSH_PORT}" "${SSH_USER}@${SSH_HOST}" "$@"
+}
+
+# QEMU's user networking accepts connections, and even sends sshd's banner,
+# before the default user can log in (missing /home, host keys or PAM
+# issues), so wait until a real password login works.
+wait_for_ssh() {
+    echo "Waiting for SSH login as ${SSH_USER} on localhost:${SSH_PORT}..."
+    for _ in $(seq 1 180); do
+        if run_ssh whoami 2>/dev/null | grep -qx "${SSH_USER}"; then
+            return 0
+        fi
+        sleep 1
+    done
+    echo "ERROR: SSH login for ${SSH_USER} did not succeed on port ${SSH_PORT}"
+    return 1
+}
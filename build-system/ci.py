@@ -0,0 +1,690 @@
+#!/usr/bin/env python3
+"""Command-line entry point for the RegicideOS CI.
+
+    python build-system/ci.py build [--profile release|debug] [--target TRIPLE] [--pgo]
+    python build-system/ci.py scan [--threshold SEVERITY] [--upload-sarif] [--history] [--hadolint-soft-fail]
+    python build-system/ci.py overlay [--arch ARCH] [--deep] [--openrc] [--pkgcheck] [--manifests]
+    python build-system/ci.py agents
+    python build-system/ci.py preview
+    python build-system/ci.py all [--arch ARCH] [--threshold SEVERITY]
+    python build-system/ci.py images bump [-- PIPELINE_ARGS...]
+    python build-system/ci.py gc [--keep-last N] [--keep-releases] [--dry-run]
+    python build-system/ci.py trends [--last N]
+    python build-system/ci.py rescan --release TAG [--image REF] [--threshold SEVERITY] [--notify]
+    python build-system/ci.py verify [--artifacts DIR] [--image REF] [--identity ID | --key PUB]
+    python build-system/ci.py doctor [--for checks|image|vm]
+    python build-system/ci.py release-check [--only CHECK] [--previous-qcow2 PATH] [--dry-run]
+
+The stage commands translate their options into dagger_pipeline.py flags
+and run it under `dagger run`; --dry-run prints the command instead.  Each
+accepts --parallel N, --source DIR to build another checkout and, after
+--, any further dagger_pipeline.py flags.  When a stage command passes,
+./dist (or --dist DIR) holds the binaries and reports it produced; see
+dist.py.  ci.py can be run from any directory, on Linux, macOS or
+Windows (see host_platform.py); building the OS image needs a Linux host.
+
+`images bump` is meant to run weekly from the CI scheduler.  It resolves
+the current digest of every image in image_lock.TRACKED_IMAGES, and if any
+changed, writes images.lock.json, runs the full pipeline against the new
+digests, and opens a pull request with the updated lock and the run
+report.  The replaced digests go to images.known-good.json, the fallback
+for a scanner image whose new digest cannot be pulled.  Both files are
+checked in empty ({}) until the first bump fills them.  The PR is opened
+even when the pipeline fails, so the breakage is reviewed instead of
+silently blocking future bumps.  Requires Dagger, git,
+and the GitHub CLI with a token in GH_TOKEN/GITHUB_TOKEN.
+
+A stage command exits with dagger_pipeline.py's exit code, which names
+the failure class (see exit_codes.py and --help).
+
+`gc` applies the retention policy in retention.py to run history,
+failure bundles and exported artifacts; schedule it after nightly runs.
+`trends` writes reports/trends.md and SVG charts of stage durations,
+coverage and artifact sizes (reports/trends.html; see trend_charts.py)
+from the local run history, without starting Dagger.
+`rescan` re-scans a published release with today's vulnerability data
+(see release_rescan.py) and exits 5 when findings reach the threshold; it
+is meant to run on a schedule too.  `verify`
+checks the cosign signatures of the release files a run listed as signed
+and of published images (see signing.py).  `doctor` checks the host before a run: the container runtime,
+the Dagger engine, disk space, the privileges of the OS image and VM
+stages and the network, printing a fix for each problem (see doctor.py).
+
+`release-check` is the last gate before cutting a release, and is meant to
+run on a schedule: every check of RELEASE_MATRIX (both architectures, the
+debug profile, the deep overlay tests, the QEMU boot, the upgrade path
+from --previous-qcow2 and a signing dry run with a throwaway key) as its
+own pipeline run, then a single go/no-go report (see release_check.py).
+"""
+
+import argparse
+import asyncio
+import os
+import subprocess
+import sys
+import tempfile
+import time
+from pathlib import Path
+
+import dagger
+
+import artifacts
+import doctor
+import exit_codes
+import failure_bundle
+import host_platform
+import image_lock
+import release_check
+import release_rescan
+import retention
+import run_history
+import security_scan
+import signing
+import source_layout
+import trend_charts
+import workspace_checks
+
+
+PIPELINE = Path(__file__).resolve().parent / "dagger_pipeline.py"
+SKOPEO_IMAGE = "quay.io/skopeo/stable:latest"
+BUMP_BRANCH_PREFIX = "ci/images-bump-"
+# Pipeline stages that exercise the AI agents under ai-agents/.
+AGENT_STAGES = [
+    "--btrmind-simulation",
+    "--config-migration",
+    "--non-btrfs-tests",
+    "--readonly-root-tests",
+    "--syscall-audit",
+    "--systemd-declarations",
+]
+# release-check: check -> (what it covers, dagger_pipeline.py flags).  The
+# image checks are signed with release-check's throwaway key.
+RELEASE_MATRIX = {
+    "workspace": ("rustfmt, clippy, tests, cargo-deny, scans, release/cross/static builds, agents", [
+        "--checks-only", "--rustfmt", "--clippy", "--cargo-tests", "--cargo-deny", "--security-scan",
+        "--release-optimized", "--cross-build", "--static-binaries", "--ebuild-versions", *AGENT_STAGES,
+    ]),
+    "debug": ("debug profile", ["--dev"]),
+    "overlay-amd64": ("overlay on amd64: deep, OpenRC, pkgcheck and Manifests", [
+        "--checks-only", "--skip-cargo-check", "--arch", "amd64",
+        "--overlay-tests", "--overlay-deep-tests", "--overlay-openrc-tests", "--pkgcheck", "--manifest-check",
+    ]),
+    "overlay-arm64": ("overlay on arm64: deep", [
+        "--checks-only", "--skip-cargo-check", "--arch", "arm64", "--overlay-tests", "--overlay-deep-tests",
+    ]),
+    "image-amd64": ("amd64 image, QEMU boot, image diff, signing", [
+        "--arch", "amd64", "--skip-cargo-check", "--run-vm-test", "--image-diff",
+    ]),
+    "image-arm64": ("arm64 image, signing", ["--arch", "arm64", "--skip-cargo-check"]),
+}
+SIGNED_CHECKS = ["image-amd64", "image-arm64"]
+
+
+def _qualified(ref: str) -> str:
+    """Return ref with the registry spelled out, as skopeo needs ("rust:1" -> "docker.io/library/rust:1")."""
+    first, _, rest = ref.partition("/")
+    if rest and ("." in first or ":" in first or first == "localhost"):
+        return ref
+    return f"docker.io/{ref}" if rest else f"docker.io/library/{ref}"
+
+
+async def resolve_digests(refs: list[str]) -> dict[str, str]:
+    """Return {ref: digest of its manifest or index} as the registry serves it now."""
+    config = dagger.Config(log_output=sys.stderr)
+    async with dagger.Connection(config) as client:
+        # Registry contents change under the same arguments, so never reuse
+        # a cached lookup.
+        skopeo = (
+            client.container()
+            .from_(image_lock.pinned(SKOPEO_IMAGE))
+            .with_env_variable("REGICIDE_RESOLVED_AT", str(time.time()))
+        )
+
+        async def digest(ref: str) -> str:
+            resolved = skopeo.with_exec([
+                "sh", "-c",
+                'skopeo inspect --raw "docker://$1" > /tmp/manifest && skopeo manifest-digest /tmp/manifest',
+                "sh", _qualified(ref),
+            ])
+            return (await resolved.stdout()).strip()
+
+        digests = await asyncio.gather(*(digest(ref) for ref in refs))
+    return dict(zip(refs, digests))
+
+
+def _git(*args: str) -> str:
+    return subprocess.run(["git", *args], check=True, capture_output=True, text=True).stdout
+
+
+def _gh(*args: str) -> str:
+    return subprocess.run(["gh", *args], check=True, capture_output=True, text=True).stdout
+
+
+def _previous_run(current: str) -> str | None:
+    """Return the most recent run before current that has a summary, if any."""
+    runs = [s["run"] for s in run_history.recent_summaries(50) if s["run"] != current]
+    return runs[-1] if runs else None
+
+
+def bump_report(old: dict[str, str], new: dict[str, str], run: str, passed: bool) -> str:
+    """Return the Markdown PR body: digest changes, pipeline result, and run comparison."""
+    lines = [
+        "Weekly bump of the pinned container images in `build-system/images.lock.json`.",
+        "",
+        "| image | old digest | new digest |",
+        "|---|---|---|",
+    ]
+    for ref in sorted(new):
+        if old.get(ref) != new[ref]:
+            lines.append(f"| `{ref}` | `{old.get(ref, 'unpinned')}` | `{new[ref]}` |")
+    lines += ["", f"The full pipeline (run `{run}`) **{'passed' if passed else 'failed'}** against the new digests."]
+    try:
+        summary = run_history.load_summary(run)
+    except FileNotFoundError:
+        lines += ["", "The run wrote no summary; see the CI logs."]
+        return "\n".join(lines) + "\n"
+    previous = _previous_run(run)
+    if previous is not None:
+        lines += ["", run_history.compare(previous, run).replace("# Run comparison", "## Run comparison", 1)]
+    else:
+        report = "\n".join(f"{s['stage']:<32} {s['status']:<8} {s['seconds']:>9}" for s in summary["stages"])
+        lines += ["", "```", report, "```"]
+    return "\n".join(lines) + "\n"
+
+
+def run_pipeline(pipeline_args: list[str], env: dict[str, str] | None = None, plain: bool = True) -> int:
+    """Run dagger_pipeline.py under `dagger run` and return its exit code.
+
+    plain=False keeps Dagger's interactive TUI, which terminals need.
+    """
+    return subprocess.run(
+        ["dagger", "run", sys.executable, str(PIPELINE), *(["--plain"] if plain else []), *pipeline_args],
+        env={**os.environ, **(env or {})},
+    ).returncode
+
+
+def stage_args(args: argparse.Namespace) -> list[str]:
+    """Return the dagger_pipeline.py flags for a stage command."""
+    if args.command == "build":
+        if args.profile == "debug":
+            # Incremental debug build and cargo check, no OS image.
+            return ["--dev"]
+        return [
+            "--checks-only", "--rustfmt", "--release-optimized", "--rust-target", args.target,
+            *(["--pgo"] if args.pgo else []),
+        ]
+    if args.command == "scan":
+        return [
+            "--checks-only", "--skip-cargo-check", "--security-scan", "--security-threshold", args.threshold,
+            *(["--upload-sarif"] if args.upload_sarif else []),
+            *(["--scan-history"] if args.history else []),
+            *(["--hadolint-soft-fail"] if args.hadolint_soft_fail else []),
+        ]
+    if args.command == "overlay":
+        return [
+            "--checks-only", "--skip-cargo-check", "--arch", args.arch, "--overlay-tests",
+            *(["--overlay-deep-tests"] if args.deep else []),
+            *(["--overlay-openrc-tests"] if args.openrc else []),
+            *(["--pkgcheck"] if args.pkgcheck else []),
+            *(["--manifest-check"] if args.manifests else []),
+        ]
+    if args.command == "agents":
+        return ["--checks-only", *AGENT_STAGES]
+    if args.command == "preview":
+        return ["--checks-only", "--btrmind-preview"]
+    # all: every stage above, rustfmt, clippy, cargo-deny, the cross and
+    # static builds and the cargo tests, then the OS image build.
+    return [
+        "--arch", args.arch, "--rustfmt", "--release-optimized",
+        "--security-scan", "--security-threshold", args.threshold, "--cargo-deny", "--cross-build",
+        "--static-binaries", "--clippy", "--cargo-tests", "--overlay-tests", *AGENT_STAGES,
+    ]
+
+
+def _current_ref() -> str:
+    """Return the checked-out branch, or the commit when HEAD is detached."""
+    ref = _git("rev-parse", "--abbrev-ref", "HEAD").strip()
+    return ref if ref != "HEAD" else _git("rev-parse", "HEAD").strip()
+
+
+def _free_branch(name: str) -> str:
+    """Return name, or name-2, name-3, ... when a local or origin branch already has it."""
+    def taken(branch: str) -> bool:
+        local = subprocess.run(["git", "rev-parse", "--verify", "--quiet", f"refs/heads/{branch}"], capture_output=True)
+        return local.returncode == 0 or bool(_git("ls-remote", "--heads", "origin", branch).strip())
+
+    candidate, number = name, 1
+    while taken(candidate):
+        number += 1
+        candidate = f"{name}-{number}"
+    return candidate
+
+
+def images_bump(pipeline_args: list[str], base: str) -> int:
+    """Resolve new digests, test them with the full pipeline, and open a PR.
+
+    The lock files are written and tested on a new branch from origin/base,
+    never in the branch that was checked out, which is checked out again
+    afterwards.  A bump that changes nothing or fails before its commit
+    leaves no branch behind.
+    """
+    new = asyncio.run(resolve_digests(image_lock.TRACKED_IMAGES))
+    start = _current_ref()
+    _git("fetch", "origin", base)
+    branch = _free_branch(f"{BUMP_BRANCH_PREFIX}{time.strftime('%Y%m%d', time.gmtime())}")
+    run = f"images-bump-{branch.removeprefix(BUMP_BRANCH_PREFIX)}"
+    lock_files = [str(image_lock.LOCK_PATH), str(image_lock.KNOWN_GOOD_PATH)]
+    _git("switch", "--create", branch, f"origin/{base}")
+    committed = False
+    try:
+        old = image_lock.load()
+        changed = sorted(ref for ref in new if old.get(ref) != new[ref])
+        if not changed:
+            print("All pinned images are current")
+            return 0
+        print("New digests for: " + ", ".join(changed))
+
+        image_lock.save({**old, **new})
+        image_lock.save_known_good(old, new)
+        exit_code = run_pipeline(pipeline_args, {"REGICIDE_RUN_ID": run})
+        passed = exit_code == exit_codes.OK
+
+        body_path = run_history.RUNS_DIR / run / "images-bump.md"
+        body_path.parent.mkdir(parents=True, exist_ok=True)
+        body_path.write_text(bump_report(old, new, run, passed))
+
+        _git("add", *lock_files)
+        _git("commit", "-m", f"Bump pinned container images ({len(changed)} changed)")
+        committed = True
+        _git("push", "--set-upstream", "origin", branch)
+        title = "Bump pinned container images" + ("" if passed else " (pipeline failing)")
+        url = _gh(
+            "pr", "create",
+            "--base", base,
+            "--head", branch,
+            "--title", title,
+            "--body-file", str(body_path),
+        ).strip()
+        print(f"Opened {url}")
+        return exit_code
+    finally:
+        if not committed:
+            _git("checkout", "HEAD", "--", *lock_files)
+        _git("checkout", "--quiet", start)
+        if not committed:
+            _git("branch", "--delete", "--force", branch)
+
+
+def collect_garbage(keep_last: int, keep_releases: bool, dry_run: bool) -> int:
+    """Delete the history, failure bundles and artifacts of runs outside the retention policy."""
+    source_layout.use_root(source_layout.DEFAULT_ROOT)
+    paths = retention.collect(keep_last, keep_releases)
+    freed = 0
+    for path in paths:
+        size = retention.size(path) if dry_run else retention.delete([path])
+        freed += size
+        print(f"{'Would delete' if dry_run else 'Deleted'} {path} ({size / 2**20:.1f} MiB)")
+    print(f"{'Would free' if dry_run else 'Freed'} {freed / 2**20:.1f} MiB from {len(paths)} paths")
+    return 0
+
+
+def trends(last: int) -> int:
+    """Write the trend tables and charts of the last runs in the run history."""
+    source_layout.use_root(source_layout.DEFAULT_ROOT)
+    report_path = workspace_checks.REPORTS_DIR / "trends.md"
+    report_path.parent.mkdir(parents=True, exist_ok=True)
+    report_path.write_text(run_history.trends(last) + "\n")
+    print(f"Output: {report_path}")
+    for chart_path in trend_charts.write(last, workspace_checks.REPORTS_DIR):
+        print(f"Output: {chart_path}")
+    return 0
+
+
+async def verify(
+    artifacts_dir: Path | None, images: list[str], identity: str, key: Path | None, run: str | None = None
+) -> int:
+    """Verify the signed files in artifacts_dir and the images; return the exit code.
+
+    The files are the ones listed in artifacts_dir's signing.SIGNED, by
+    the run that signed them, and each signature listed with a file is
+    verified.  With run, the listing must be that run's.
+    """
+    files = []
+    if artifacts_dir is not None:
+        try:
+            signed_by, files = signing.signed_files(artifacts_dir)
+        except FileNotFoundError:
+            print(f"Error: no {signing.SIGNED} listing the signed files in {artifacts_dir}", file=sys.stderr)
+            return exit_codes.CONFIG_ERROR
+        if run is not None and signed_by != run:
+            listing = artifacts_dir / signing.SIGNED
+            print(f"Error: {listing} lists the files of run {signed_by}, not {run}", file=sys.stderr)
+            return exit_codes.SECURITY_GATE
+        missing = [path for entry in files for path in entry.values() if path is not None and not path.is_file()]
+        if missing:
+            print(f"Error: signed file missing: {', '.join(map(str, missing))}", file=sys.stderr)
+            return exit_codes.SECURITY_GATE
+    names = [entry["file"].name for entry in files]
+    config = dagger.Config(log_output=sys.stderr)
+    async with dagger.Connection(config) as client:
+        public_key = client.host().file(str(key)) if key else None
+        try:
+            if files:
+                directory = client.directory()
+                for name, entry in zip(names, files):
+                    directory = directory.with_file(name, client.host().file(str(entry["file"])))
+                    for field, suffix in signing.SIGNATURE_FILES.items():
+                        if entry.get(field) is not None:
+                            directory = directory.with_file(f"{name}.{suffix}", client.host().file(str(entry[field])))
+                bundles = [name for name, entry in zip(names, files) if entry.get("bundle") is not None]
+                signatures = [name for name, entry in zip(names, files) if entry.get("signature") is not None]
+                await signing.verify_blobs(client, directory, bundles, signatures, identity, public_key)
+            for ref in images:
+                await signing.verify_image(client, ref, identity, public_key)
+        except failure_bundle.StageFailed as exc:
+            print(f"Error: {exc}", file=sys.stderr)
+            return exit_codes.SECURITY_GATE
+    for name in [*names, *images]:
+        print(f"Verified {name}")
+    return exit_codes.OK
+
+
+def rescan_release(tag: str, images: list[str], threshold: str, notify: bool) -> int:
+    """Re-scan release tag and images, notify if asked, and return the exit code.
+
+    Findings at or above threshold fail the security gate.  Raises
+    ValueError when there is nothing to scan.
+    """
+    try:
+        _, blocked = asyncio.run(release_rescan.rescan(tag, images, threshold))
+    except failure_bundle.StageFailed as exc:
+        print(f"Error: {exc}", file=sys.stderr)
+        return exit_codes.for_failure(exc)
+    except dagger.DaggerError as exc:
+        print(f"Error: Dagger engine failure: {exc}", file=sys.stderr)
+        return exit_codes.INFRASTRUCTURE
+    print(f"{len(blocked)} findings at or above {threshold}")
+    if blocked and notify:
+        try:
+            release_rescan.notify(tag, blocked, threshold)
+        except (OSError, subprocess.CalledProcessError) as exc:
+            print(f"Error: could not file the issue for {tag}: {getattr(exc, 'stderr', None) or exc}", file=sys.stderr)
+            return exit_codes.INFRASTRUCTURE
+    return exit_codes.SECURITY_GATE if blocked else exit_codes.OK
+
+
+async def _generate_key_pair(directory: Path) -> None:
+    async with dagger.Connection(dagger.Config(log_output=sys.stderr)) as client:
+        await (await signing.generate_key_pair(client)).export(str(directory))
+
+
+def release_readiness(checks: list[str], previous_qcow2: Path | None, pipeline_args: list[str], dry_run: bool) -> int:
+    """Run the release matrix checks, write the go/no-go report and return the exit code."""
+    stamp = time.strftime("%Y%m%d-%H%M%S", time.gmtime())
+    commands = {}
+    for check in checks:
+        flags = RELEASE_MATRIX[check][1]
+        if check == "image-amd64" and previous_qcow2:
+            flags = [*flags, "--upgrade-test", str(previous_qcow2)]
+        commands[check] = [*flags, *pipeline_args]
+    if dry_run:
+        for check, command in commands.items():
+            print(" ".join(["dagger", "run", "python", str(PIPELINE), "--plain", *command]))
+        return exit_codes.OK
+
+    results = {}
+    with tempfile.TemporaryDirectory(prefix="release-check-") as directory:
+        keys = Path(directory)
+        if any(check in SIGNED_CHECKS for check in checks):
+            asyncio.run(_generate_key_pair(keys))
+        for check, command in commands.items():
+            run = f"release-check-{stamp}-{check}"
+            env = {"REGICIDE_RUN_ID": run}
+            if check in SIGNED_CHECKS:
+                # COSIGN_KEY, unlike COSIGN_KEY_PATH, wins over a release key in the environment.
+                env |= {"COSIGN_KEY": (keys / "cosign.key").read_text(), "COSIGN_PASSWORD": ""}
+            print(f"release-check: {check} ({run})", flush=True)
+            exit_code = run_pipeline(command, env)
+            note = ""
+            if exit_code == exit_codes.OK and check in SIGNED_CHECKS:
+                output = source_layout.DEFAULT_ROOT / artifacts.OUTPUT_DIR
+                verified = asyncio.run(verify(output, [], signing.IDENTITY, keys / "cosign.pub", run))
+                if verified != exit_codes.OK:
+                    exit_code, note = verified, "the signing dry run's signatures did not verify"
+            results[check] = {"covers": RELEASE_MATRIX[check][0], "exit_code": exit_code, "note": note, "run": run}
+    if "image-amd64" in checks and previous_qcow2 is None:
+        results["upgrade"] = {
+            "covers": "upgrade from the previous release", "exit_code": None,
+            "note": "not run: pass --previous-qcow2 with the last release's disk image", "run": "",
+        }
+
+    go, text = release_check.report(results)
+    report_path = workspace_checks.REPORTS_DIR / release_check.REPORT
+    report_path.parent.mkdir(parents=True, exist_ok=True)
+    report_path.write_text(text)
+    print(text)
+    print(f"Output: {report_path}")
+    release_check.publish(text)
+    if go:
+        return exit_codes.OK
+    failed = [result["exit_code"] for result in results.values() if result["exit_code"] not in (None, exit_codes.OK)]
+    return failed[0] if failed else exit_codes.CONFIG_ERROR
+
+
+def _passthrough(pipeline_args: list[str]) -> list[str]:
+    return pipeline_args[1:] if pipeline_args[:1] == ["--"] else pipeline_args
+
+
+def main() -> None:
+    parser = argparse.ArgumentParser(
+        description="RegicideOS CI", epilog=exit_codes.HELP, formatter_class=argparse.RawDescriptionHelpFormatter
+    )
+    commands = parser.add_subparsers(dest="command", required=True)
+
+    common = argparse.ArgumentParser(add_help=False)
+    common.add_argument("--parallel", type=int, default=1, metavar="N", help="Run up to N independent stages at once")
+    common.add_argument(
+        "--source", type=Path, metavar="DIR", help="Repository root to build (default: this checkout)"
+    )
+    common.add_argument("--dry-run", action="store_true", help="Print the pipeline command instead of running it")
+    common.add_argument(
+        "--dist", type=Path, default=Path("dist"), metavar="DIR",
+        help="Where to export the binaries and reports a passing run produced (default: ./dist)",
+    )
+    common.add_argument(
+        "pipeline_args",
+        nargs=argparse.REMAINDER,
+        help="Further dagger_pipeline.py flags after --",
+    )
+    arch = argparse.ArgumentParser(add_help=False)
+    arch.add_argument(
+        "--arch", choices=["amd64", "arm64"], default="amd64", help="Gentoo architecture (default: amd64)"
+    )
+    threshold = argparse.ArgumentParser(add_help=False)
+    threshold.add_argument(
+        "--threshold",
+        choices=security_scan.SEVERITIES[1:],
+        default="high",
+        help="Lowest finding severity that fails the scan (default: high)",
+    )
+
+    build = commands.add_parser("build", parents=[common], help="Build the Rust components")
+    build.add_argument(
+        "--profile",
+        choices=["release", "debug"],
+        default="release",
+        help="release: release-optimized binaries in output/bin/; debug: incremental cargo check (default: release)",
+    )
+    build.add_argument(
+        "--target",
+        choices=[workspace_checks.HOST_TARGET, *workspace_checks.CROSS_TARGETS],
+        default=workspace_checks.HOST_TARGET,
+        help=f"Rust target triple for release builds (default: {workspace_checks.HOST_TARGET})",
+    )
+    build.add_argument("--pgo", action="store_true", help="Apply profile-guided optimization to btrmind")
+    scan = commands.add_parser("scan", parents=[common, threshold], help="Run the security scanners")
+    scan.add_argument(
+        "--upload-sarif", action="store_true", help="Upload trivy's and gitleaks' SARIF to GitHub code scanning"
+    )
+    scan.add_argument("--history", action="store_true", help="Also scan every commit of the clone for secrets")
+    scan.add_argument(
+        "--hadolint-soft-fail", action="store_true", help="Report hadolint findings without failing on them"
+    )
+    overlay = commands.add_parser("overlay", parents=[common, arch], help="Test the regicide-rust overlay")
+    overlay.add_argument("--deep", action="store_true", help="Also install, reinstall and uninstall every package")
+    overlay.add_argument("--openrc", action="store_true", help="Also install every package on an OpenRC stage3")
+    overlay.add_argument("--pkgcheck", action="store_true", help="Also run pkgcheck's QA checks on the ebuilds")
+    overlay.add_argument(
+        "--manifests", action="store_true", help="Also regenerate every Manifest and fail if a committed one differs"
+    )
+    commands.add_parser("agents", parents=[common], help="Test the AI agents (btrmind)")
+    commands.add_parser(
+        "preview",
+        parents=[common],
+        help="Open a shell beside btrmind on a disposable loopback BTRFS, torn down on exit",
+    )
+    commands.add_parser(
+        "all",
+        parents=[common, arch, threshold],
+        help="Run every stage above, rustfmt, clippy, cargo-deny, the cross and static builds"
+        " and the cargo tests, then build the OS image",
+    )
+    images = commands.add_parser("images", help="Manage the pinned container images")
+    image_commands = images.add_subparsers(dest="images_command", required=True)
+    bump = image_commands.add_parser(
+        "bump",
+        help="Resolve new digests, run the pipeline against them, and open a PR",
+    )
+    bump.add_argument("--base", default="main", help="Branch the PR targets (default: main)")
+    bump.add_argument(
+        "pipeline_args",
+        nargs=argparse.REMAINDER,
+        help="Arguments for dagger_pipeline.py after --, e.g. -- --arch arm64",
+    )
+    gc = commands.add_parser("gc", help="Delete the history, failure bundles and artifacts of old runs")
+    gc.add_argument("--keep-last", type=int, default=20, metavar="N", help="Keep the N most recent runs (default: 20)")
+    gc.add_argument("--keep-releases", action="store_true", help="Also keep every passed run of a tagged commit")
+    gc.add_argument("--dry-run", action="store_true", help="List what would be deleted without deleting it")
+    trends_parser = commands.add_parser(
+        "trends", help="Chart stage durations, coverage and artifact sizes of past runs"
+    )
+    trends_parser.add_argument(
+        "--last", type=int, default=20, metavar="N", help="Cover the N most recent runs (default: 20)"
+    )
+    rescan = commands.add_parser(
+        "rescan", parents=[threshold], help="Re-scan a published release with today's vulnerability data"
+    )
+    rescan.add_argument("--release", required=True, metavar="TAG", help="GitHub release tag, e.g. v1.2.0")
+    rescan.add_argument(
+        "--image", action="append", default=[], metavar="REF", help="Also scan this published image (repeatable)"
+    )
+    rescan.add_argument(
+        "--notify", action="store_true", help="Open or update a release-vulnerable issue for findings at the threshold"
+    )
+    verify_parser = commands.add_parser(
+        "verify", help="Check the cosign signatures of release files and published images"
+    )
+    verify_parser.add_argument(
+        "--artifacts", type=Path, metavar="DIR",
+        help=f"Verify the files DIR's {signing.SIGNED} lists as signed"
+        " (default: the pipeline output, unless --image is given)",
+    )
+    verify_parser.add_argument(
+        "--image", action="append", default=[], metavar="REF", help="Verify this published image (repeatable)"
+    )
+    verify_parser.add_argument(
+        "--identity", default=signing.IDENTITY, metavar="ID",
+        help=f"Signer identity for keyless signatures (default: {signing.IDENTITY})",
+    )
+    verify_parser.add_argument(
+        "--key", type=Path, metavar="PUB", help="Verify key-based signatures with this cosign public key"
+    )
+    doctor_parser = commands.add_parser("doctor", help="Check the host for what a run needs and print how to fix it")
+    doctor_parser.add_argument(
+        "--for", dest="purpose", choices=doctor.PURPOSES, default="checks",
+        help="checks: workspace checks only; image: the OS image build too; vm: the VM stages too (default: checks)",
+    )
+    release = commands.add_parser(
+        "release-check", help="Run the full release matrix and write a go/no-go readiness report"
+    )
+    release.add_argument(
+        "--only", action="append", choices=list(RELEASE_MATRIX), metavar="CHECK",
+        help=f"Run only this check (repeatable): {', '.join(RELEASE_MATRIX)}",
+    )
+    release.add_argument(
+        "--previous-qcow2", type=Path, metavar="PATH",
+        help="The previous release's qcow2, for the upgrade test; without it the report is a no-go",
+    )
+    release.add_argument("--dry-run", action="store_true", help="Print the pipeline commands instead of running them")
+    release.add_argument(
+        "pipeline_args",
+        nargs=argparse.REMAINDER,
+        help="Further dagger_pipeline.py flags for every check after --",
+    )
+    args = parser.parse_args()
+    host_platform.configure()
+
+    if args.command == "images" and args.images_command == "bump":
+        sys.exit(images_bump(_passthrough(args.pipeline_args), args.base))
+    if args.command == "doctor":
+        results = asyncio.run(doctor.run(args.purpose))
+        failed = [check for status, check, _, _ in results if status == doctor.FAIL]
+        print(f"{len(failed)} of {len(results)} checks failed" + (f": {', '.join(failed)}" if failed else ""))
+        sys.exit(exit_codes.INFRASTRUCTURE if failed else exit_codes.OK)
+    if args.command == "gc":
+        if args.keep_last < 1:
+            parser.error("--keep-last must be at least 1")
+        sys.exit(collect_garbage(args.keep_last, args.keep_releases, args.dry_run))
+    if args.command == "trends":
+        if args.last < 1:
+            parser.error("--last must be at least 1")
+        sys.exit(trends(args.last))
+    if args.command == "verify":
+        artifacts_dir = args.artifacts.resolve() if args.artifacts else None
+        if artifacts_dir is None and not args.image:
+            artifacts_dir = source_layout.DEFAULT_ROOT / artifacts.OUTPUT_DIR
+        key = args.key.resolve() if args.key else None
+        source_layout.use_root(source_layout.DEFAULT_ROOT)
+        sys.exit(asyncio.run(verify(artifacts_dir, args.image, args.identity, key)))
+    if args.command == "release-check":
+        previous = args.previous_qcow2.resolve() if args.previous_qcow2 else None
+        if previous is not None and not previous.is_file():
+            parser.error(f"--previous-qcow2 {previous} does not exist")
+        source_layout.use_root(source_layout.DEFAULT_ROOT)
+        checks = [check for check in RELEASE_MATRIX if not args.only or check in args.only]
+        sys.exit(release_readiness(checks, previous, _passthrough(args.pipeline_args), args.dry_run))
+    if args.command == "rescan":
+        try:
+            sys.exit(rescan_release(args.release, args.image, args.threshold, args.notify))
+        except ValueError as exc:
+            parser.error(str(exc))
+
+    if args.command == "build" and args.profile == "debug" and (
+        args.pgo or args.target != workspace_checks.HOST_TARGET
+    ):
+        parser.error("--pgo and --target apply to release builds only")
+    if args.parallel < 1:
+        parser.error("--parallel must be at least 1")
+    pipeline_args = [*stage_args(args), "--parallel", str(args.parallel), *_passthrough(args.pipeline_args)]
+    if args.source:
+        pipeline_args += ["--source", str(args.source.resolve())]
+    if args.command != "preview":
+        pipeline_args += ["--dist", str(args.dist.resolve())]
+    crlf = host_platform.crlf_files(args.source or source_layout.DEFAULT_ROOT)
+    if crlf:
+        print(
+            f"Error: {len(crlf)} files are checked out with CRLF line endings ({', '.join(crlf[:3])}, ...);"
+            " the stages run them in Linux containers.  Commit or stash your changes, then run"
+            " `git rm -r --cached -q . && git reset --hard` to check them out again with LF.",
+            file=sys.stderr,
+        )
+        sys.exit(exit_codes.CONFIG_ERROR)
+    plain = args.command != "preview"
+    if args.dry_run:
+        print(" ".join(["dagger", "run", "python", str(PIPELINE), *(["--plain"] if plain else []), *pipeline_args]))
+        sys.exit(0)
+    sys.exit(run_pipeline(pipeline_args, plain=plain))
+
+
+if __name__ == "__main__":
+    main()
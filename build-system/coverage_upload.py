@@ -0,0 +1,77 @@
+"""Coverage upload - send the --coverage LCOV report to Codecov or Coveralls.
+
+The service's token is read from the host environment (CODECOV_TOKEN or
+COVERALLS_REPO_TOKEN) and handed to the uploader container as a Dagger
+secret, so it never appears in the container definition, the cache key
+or the logs.  Pull requests from forks, and local runs, have no token;
+upload() then prints why it skipped instead of failing the run.  Both
+uploaders are pinned: codecov-cli by version, and the Coveralls reporter
+by release, checked against that release's published checksums.
+"""
+
+import os
+
+import dagger
+
+import build_info
+from failure_bundle import checked_exec, from_image
+
+
+CODECOV_CLI_VERSION = "0.7.4"
+COVERALLS_VERSION = "0.6.14"
+# service -> (token variable, uploader image)
+SERVICES = {
+    "codecov": ("CODECOV_TOKEN", "python:3.12-alpine"),
+    "coveralls": ("COVERALLS_REPO_TOKEN", "alpine:latest"),
+}
+REPORT = "/coverage/lcov.info"
+
+
+async def upload(client: dagger.Client, service: str, report: dagger.File) -> None:
+    """Upload report to service for the commit being built, or skip without a token."""
+    variable, image = SERVICES[service]
+    value = os.environ.get(variable)
+    if not value:
+        print(f"{variable} not set; not uploading coverage to {service}")
+        return
+    uploader = (
+        from_image(client, image)
+        .with_mounted_file(REPORT, report)
+        .with_secret_variable(variable, client.set_secret(variable, value))
+    )
+    sha, branch = build_info.git_sha(), build_info.branch()
+    if service == "codecov":
+        uploader = await checked_exec(
+            uploader, ["pip", "install", "--quiet", f"codecov-cli=={CODECOV_CLI_VERSION}"], "coverage-upload-install",
+        )
+        # Without a slug codecovcli guesses the repository from the git
+        # remote, which the uploader container does not have.
+        repository = os.environ.get("GITHUB_REPOSITORY")
+        slug = f" --slug {repository}" if repository else ""
+        args = [
+            "sh", "-c",
+            f'codecovcli upload-process --token "${variable}" --file {REPORT}'
+            f" --commit-sha {sha} --branch {branch}{slug} --disable-search",
+        ]
+    else:
+        release = f"https://github.com/coverallsapp/coverage-reporter/releases/download/v{COVERALLS_VERSION}"
+        uploader = await checked_exec(
+            uploader,
+            [
+                "sh", "-c",
+                "apk add --no-cache curl coreutils && cd /tmp"
+                f" && curl -sfLO {release}/coveralls-linux.tar.gz"
+                f" && curl -sfLO {release}/coveralls-checksums.txt"
+                " && grep ' coveralls-linux.tar.gz$' coveralls-checksums.txt | sha256sum -c -"
+                " && tar -xzf coveralls-linux.tar.gz -C /usr/local/bin",
+            ],
+            "coverage-upload-install",
+        )
+        uploader = (
+            uploader
+            .with_env_variable("COVERALLS_GIT_COMMIT", sha)
+            .with_env_variable("COVERALLS_GIT_BRANCH", branch)
+        )
+        args = ["coveralls", "report", REPORT, "--format", "lcov"]
+    await checked_exec(uploader, args, "coverage-upload")
+    print(f"Uploaded coverage to {service} ({sha[:12]} on {branch})")
@@ -29,25 +29,196 @@ Usage:
 import argparse
 import asyncio
 import getpass
+import json
 import os
+import shutil
+import signal
 import subprocess
 import sys
 import tempfile
+from collections.abc import Awaitable, Callable
 from pathlib import Path
 
 import dagger
 
+import advisory
+import artifacts
+import benchmarks
+import binpkg_channel
+import build_info
+import cache_keys
+import coverage_upload
+import declared_stages
+import dependency_submission
+import dist
+import events
+import exit_codes
+import failure_bundle
+import failure_issues
+import fingerprint
+import github_release
+import host_platform
+import image_diff
+import image_overrides
+import junit_report
+import oci_policy
+import provenance
+import publish
+import release_notes
+import security_scan
+import signing
+import source_layout
+import syft_sbom
+import stage_memo
+import stage_selection
+import run_history
+import run_lock
+import test_impact
+import toolchain_report
+import trend_charts
+import workspace_checks
+
 
 def _dagger_cloud_org() -> str:
     """Return the Dagger Cloud organization name configured for this pipeline."""
     return os.environ.get("DAGGER_CLOUD_ORG", "RegicideOS")
 
 
+# Partial outputs and scratch directories removed if the run is interrupted.
+# Paths are unregistered once the step that produces them completes.
+_interrupt_cleanup: set[Path] = set()
+
+
+def _finish(status: str) -> dict:
+    """Record the run as status, print its stage timings and return its summary."""
+    summary_path = run_history.write_summary(status)
+    events.finish_run(status)
+    summary = json.loads(summary_path.read_text())
+    timings = run_history.timings(summary)
+    print(f"\nStage timings ({summary_path.parent / 'timings.txt'}):")
+    for line in timings.splitlines():
+        print(advisory.yellow(line) if " advisory " in line else line)
+    if summary["warnings"]:
+        stages = ", ".join(dict.fromkeys(w["stage"] for w in summary["warnings"]))
+        print(advisory.yellow(f"{status} with advisory failures: {stages}"))
+    if os.environ.get("REGICIDE_TIMINGS_FILE"):
+        Path(os.environ["REGICIDE_TIMINGS_FILE"]).write_text(timings)
+    if toolchain_report.probed():
+        toolchain_report.write_run()
+    return summary
+
+
+def _print_changes(summary: dict) -> None:
+    """Print what changed since the previous run, to explain a new failure."""
+    if "changes" not in summary:
+        return
+    changed = summary["changes"]["changed"]
+    print(f"Changed since run {summary['changes']['since']}:" if changed else
+          f"No recorded input changed since run {summary['changes']['since']}.", file=sys.stderr)
+    for line in changed:
+        print(f"  {line}", file=sys.stderr)
+
+
+def _fail(error: BaseException, exit_code: int, message: str = "") -> None:
+    """Record the run as failed, report error and exit with exit_code.
+
+    Nightly runs file (or update) the GitHub issue for the failure.
+    """
+    summary = _finish("failed")
+    print(f"Error: {message or error}", file=sys.stderr)
+    if isinstance(error, failure_bundle.StageFailed):
+        _print_changes(summary)
+    if os.environ.get("REGICIDE_NIGHTLY") == "1":
+        if isinstance(error, failure_bundle.StageFailed):
+            failure_issues.report_failure(error)
+        else:
+            failure_issues.report_error(error, exit_code)
+    sys.exit(exit_code)
+
+
+def _cleanup_interrupted() -> None:
+    """Remove partial outputs left behind by an interrupted run."""
+    for path in sorted(_interrupt_cleanup):
+        if path.is_dir():
+            shutil.rmtree(path, ignore_errors=True)
+        else:
+            path.unlink(missing_ok=True)
+        print(f"Removed partial output: {path}", file=sys.stderr)
+
+
 def _cpu_count() -> int:
     """Return the number of host CPUs to expose to the build container."""
     return os.cpu_count() or 4
 
 
+def _run_host(stage: str, command: list[str]) -> None:
+    """Run a host-side step of the OS image build.
+
+    Raises RunFailed with TEST_FAILURE for exit_codes.HOST_TEST_STEPS and
+    STAGE_FAILED otherwise when the command fails.
+    """
+    try:
+        subprocess.run(command, check=True)
+    except subprocess.CalledProcessError as exc:
+        exit_code = exit_codes.TEST_FAILURE if stage in exit_codes.HOST_TEST_STEPS else exit_codes.STAGE_FAILED
+        raise exit_codes.RunFailed(stage, exit_code, f"{stage}: {command[0]} exited {exc.returncode}") from exc
+
+
+def _write_report(path: Path, text: str) -> Path:
+    """Write a stage's report to path, creating its directory, and print where it went."""
+    path.parent.mkdir(parents=True, exist_ok=True)
+    path.write_text(text)
+    print(f"Output: {path}")
+    return path
+
+
+PORTAGE_SNAPSHOT_URL = "https://distfiles.gentoo.org/snapshots/portage-latest.tar.xz"
+
+
+async def portage_snapshot(client: dagger.Client, image_tag: str, stage: str) -> dagger.File:
+    """Return the Portage snapshot tarball, downloaded at most once a day.
+
+    The tarball and its checksum are kept in the shared
+    regicide-portage-snapshot-v1 cache volume and fetched again once they
+    are older than REGICIDE_PORTAGE_MAX_AGE_DAYS (default 1).  The step
+    itself never caches, but an unchanged tarball is the same File, so
+    everything unpacked from it keeps its cache key until the snapshot
+    is refreshed.
+    """
+    max_age_minutes = int(os.environ.get("REGICIDE_PORTAGE_MAX_AGE_DAYS", "1")) * 24 * 60
+    fetched = await failure_bundle.checked_exec(
+        failure_bundle.from_image(client, image_tag)
+        .with_mounted_cache("/cache/portage", cache_keys.volume(client, "regicide-portage-snapshot-v1", shared=True))
+        .with_workdir("/cache/portage"),
+        [
+            "sh", "-c",
+            f"find . -name 'portage-latest.tar.xz*' -mmin +{max_age_minutes} -delete;"
+            " { md5sum -c portage-latest.tar.xz.md5sum >/dev/null 2>&1"
+            f" || {{ wget -q -O portage-latest.tar.xz {PORTAGE_SNAPSHOT_URL}"
+            f" && wget -q -O portage-latest.tar.xz.md5sum {PORTAGE_SNAPSHOT_URL}.md5sum"
+            " && md5sum -c portage-latest.tar.xz.md5sum; }; }"
+            " && cp portage-latest.tar.xz /portage-latest.tar.xz",
+        ],
+        f"{stage}-snapshot",
+    )
+    return fetched.without_mount("/cache/portage").file("/portage-latest.tar.xz")
+
+
+async def with_portage_tree(container: dagger.Container, snapshot: dagger.File, stage: str) -> dagger.Container:
+    """Return container with /var/db/repos/gentoo unpacked from snapshot instead of emerge-webrsync."""
+    unpacked = await failure_bundle.checked_exec(
+        container.with_mounted_file("/tmp/portage-latest.tar.xz", snapshot),
+        [
+            "sh", "-c",
+            "rm -rf /var/db/repos/gentoo && mkdir -p /var/db/repos/gentoo"
+            " && tar -C /var/db/repos/gentoo --strip-components=1 -xJf /tmp/portage-latest.tar.xz"
+            " && chown -R portage:portage /var/db/repos/gentoo",
+        ],
+        f"{stage}-portage",
+    )
+    return unpacked.without_mount("/tmp/portage-latest.tar.xz")
+
+
 async def build_cosmic(
     client: dagger.Client,
     arch: str = "amd64",
@@ -65,17 +236,11 @@ async def build_cosmic(
     # Cache volume names are arch-specific so amd64 and arm64 content never mix.
     vol = (lambda name: name) if arch == "amd64" else (lambda name: f"regicide-arm64-{name.removeprefix('regicide-')}")
 
-    src = client.host().directory(
-        ".",
-        exclude=[
-            ".git/",
-            "build-system/catalyst/tmp/",
-            "build-system/catalyst/output/",
-            "target/",
-            "*.img",
-            "*.tar.xz",
-            "*.qcow2",
-        ],
+    # Only the catalyst scripts and what stage6 copies into the rootfs, so
+    # edits elsewhere in the tree do not re-upload or re-key the build.
+    src = workspace_checks.workspace_source(
+        client,
+        paths=["build-system/catalyst", "src", "pyproject.toml", "data", *source_layout.source_paths("overlay")],
     )
 
     # Cache volumes preserve downloaded distfiles and compiled binary
@@ -83,12 +248,18 @@ async def build_cosmic(
     # execs. Dagger >=0.21 never caches an exec that has a cache mount
     # attached, so mounting them on the base container would poison every
     # downstream vertex (observed: full @world rebuilds on every run).
-    distfiles_cache = client.cache_volume(vol("regicide-distfiles-v5"))
-    binpkgs_cache = client.cache_volume(vol("regicide-binpkgs-v5"))
+    # Distfiles are source tarballs and identical for every arch, so amd64
+    # and arm64 share one volume; binpkgs stay arch-specific.
+    distfiles_cache = cache_keys.volume(client, "regicide-distfiles-v5", shared=True)
+    binpkgs_cache = cache_keys.volume(client, vol("regicide-binpkgs-v5"))
+    ccache_cache = cache_keys.volume(client, vol("regicide-ccache-v1"))
+    # One Portage snapshot feeds the build tools, stage1 and stage2, so
+    # the tree is downloaded once a day instead of synced three times.
+    snapshot = await portage_snapshot(client, image_tag, "build-tools")
+    cpus = _cpu_count()
 
     base = (
-        client.container()
-        .from_(image_tag)
+        failure_bundle.from_image(client, image_tag)
         .with_env_variable("REGICIDE_ARCH", arch)
         .with_env_variable("GENTOO_MIRRORS", os.environ.get("GENTOO_MIRRORS", "https://distfiles.gentoo.org"))
         # REGICIDE_USE_BINPKGS=0 forces full source builds, bypassing the
@@ -97,12 +268,26 @@ async def build_cosmic(
         # Point the chroot PKGDIR at a container-level dir shared by all stage
         # execs; the binpkgs seed/save execs sync it with the cache volume.
         .with_env_variable("REGICIDE_BINPKGS_DIR", os.environ.get("REGICIDE_BINPKGS_DIR", "/var/cache/binpkgs"))
+        # Portage parallelism (written to make.conf by stage2), defaulting to
+        # the host CPU count.  The values are part of the stage2 cache key,
+        # so builders that share caches should set them explicitly.
+        .with_env_variable("REGICIDE_MAKEOPTS", os.environ.get("REGICIDE_MAKEOPTS", f"-j{cpus} -l{cpus}"))
+        .with_env_variable(
+            "REGICIDE_EMERGE_DEFAULT_OPTS",
+            os.environ.get("REGICIDE_EMERGE_DEFAULT_OPTS", f"--jobs --load-average {cpus}"),
+        )
+        # ccache for C/C++ emerges; REGICIDE_USE_CCACHE=0 disables it.
+        .with_env_variable("REGICIDE_CCACHE_DIR", "/var/cache/ccache")
+        .with_env_variable("REGICIDE_USE_CCACHE", os.environ.get("REGICIDE_USE_CCACHE", "1"))
+        .with_env_variable("REGICIDE_CCACHE_SIZE", os.environ.get("REGICIDE_CCACHE_SIZE", "10G"))
     )
 
     # Prepare the build tooling.
-    with_portage = base.with_exec(["emerge-webrsync"])
-    with_tools = with_portage.with_exec(
-        ["emerge", "-qv", "sys-apps/bubblewrap", "dev-vcs/git", "app-arch/tar", "net-misc/curl"]
+    with_portage = await with_portage_tree(base, snapshot, "build-tools")
+    with_tools = await failure_bundle.checked_exec(
+        with_portage,
+        ["emerge", "-qv", "sys-apps/bubblewrap", "dev-vcs/git", "app-arch/tar", "net-misc/curl"],
+        "build-tools",
     )
 
     # Mount only the files each stage needs, and mount them just before the
@@ -115,8 +300,7 @@ async def build_cosmic(
     # volumes.  The cosmic-overlay is cloned fresh into the rootfs by stage4a
     # (no cache volume) so that stage stays content-cacheable too.
     with_build_dir = (
-        with_tools
-        .with_exec(["mkdir", "-p", "/var/tmp/regicide-build/stage3"])
+        (await failure_bundle.checked_exec(with_tools, ["mkdir", "-p", "/var/tmp/regicide-build/stage3"], "build-dir"))
         .with_env_variable("REGICIDE_BUILD_DIR", "/var/tmp/regicide-build")
         .with_env_variable("REGICIDE_OUTPUT_DIR", "/var/tmp/regicide-build/output")
         .with_workdir("/src/build-system/catalyst")
@@ -130,43 +314,53 @@ async def build_cosmic(
     # REGICIDE_USE_BINPKGS), so seeded binpkgs make rebuilds fast; the
     # from-source pipeline (REGICIDE_USE_BINPKGS=0) ignores them but still
     # produces fresh binpkgs via FEATURES=buildpkg, keeping the volume warm.
-    build = (
-        with_build_dir
-        .with_mounted_cache("/cache/distfiles", distfiles_cache)
-        .with_exec([
+    build = (await failure_bundle.checked_exec(
+        with_build_dir.with_mounted_cache("/cache/distfiles", distfiles_cache),
+        [
             "sh", "-c",
             "mkdir -p /var/tmp/regicide-build/rootfs/var/cache/distfiles"
             " && cp -an /cache/distfiles/. /var/tmp/regicide-build/rootfs/var/cache/distfiles/"
             " 2>/dev/null || true",
-        ])
-        .without_mount("/cache/distfiles")
-        .with_mounted_cache("/cache/binpkgs", binpkgs_cache)
-        .with_exec([
+        ],
+        "seed-distfiles",
+    )).without_mount("/cache/distfiles")
+    build = (await failure_bundle.checked_exec(
+        build.with_mounted_cache("/cache/binpkgs", binpkgs_cache),
+        [
             "sh", "-c",
             "mkdir -p /var/cache/binpkgs"
             " && cp -an /cache/binpkgs/. /var/cache/binpkgs/"
             " 2>/dev/null || true",
-        ])
-        .without_mount("/cache/binpkgs")
-    )
+        ],
+        "seed-binpkgs",
+    )).without_mount("/cache/binpkgs")
 
     stages_path = "/src/build-system/catalyst/stages"
     overlays_path = "/src/overlays"
     catalyst_path = "/src/build-system/catalyst"
     repo_path = "/src"
 
-    # Mount the shared helper once.
-    build = with_build_dir.with_mounted_file(
+    # Mount the shared helper once (on top of the seeded caches above).
+    build = build.with_mounted_file(
         f"{stages_path}/common.sh",
         src.file("build-system/catalyst/stages/common.sh"),
     )
 
+    # Hand stage1 the snapshot so it skips the download, and tell stage2
+    # the tree is already current so it skips emerge-webrsync.  The stage1
+    # cache key is stable until the snapshot is refreshed.
+    build = (
+        build
+        .with_file("/var/tmp/regicide-build/portage-latest.tar.xz", snapshot)
+        .with_env_variable("REGICIDE_SKIP_WEBRSYNC", "1")
+    )
+
     # Stage 4a copies the local overlays into the rootfs; mount them too.
     build = (
         build
         .with_directory(f"{catalyst_path}/overlay", src.directory("build-system/catalyst/overlay"))
         .with_directory(f"{catalyst_path}/cosmic-overlay", src.directory("build-system/catalyst/cosmic-overlay"))
-        .with_directory(f"{overlays_path}/regicide-rust", src.directory("overlays/regicide-rust"))
+        .with_directory(f"{overlays_path}/regicide-rust", source_layout.directory(client, src, "overlay"))
         # stage6-finalize.sh copies src/regicide_update into the rootfs.
         .with_directory(f"{repo_path}/src", src.directory("src"))
     )
@@ -192,6 +386,17 @@ async def build_cosmic(
         # matches the repository layout.  Strip that prefix for the in-container
         # mount path.
         script_basename = script.removeprefix("stages/")
+        if script_basename == "stage2-sync.sh":
+            # Seed ccache just before the first compiling stage, so cache
+            # growth never invalidates stage1.
+            build = (await failure_bundle.checked_exec(
+                build.with_mounted_cache("/cache/ccache", ccache_cache),
+                [
+                    "sh", "-c",
+                    "mkdir -p /var/cache/ccache && cp -an /cache/ccache/. /var/cache/ccache/ 2>/dev/null || true",
+                ],
+                "seed-ccache",
+            )).without_mount("/cache/ccache")
         build = build.with_mounted_file(
             f"{stages_path}/{script_basename}",
             src.file(f"build-system/catalyst/{script}"),
@@ -210,84 +415,281 @@ async def build_cosmic(
                 )
                 .with_directory(f"{repo_path}/data", src.directory("data"))
             )
-        build = build.with_exec([f"./{script}"], insecure_root_capabilities=True)
-        if script_basename in ("stage3-base-f.sh", "stage4-cosmic-b.sh", "stage5-regicide.sh"):
-            # Persist newly downloaded distfiles and newly built binpkgs to
-            # the cache volumes, then detach again so later stages stay
-            # content-cacheable.
-            build = (
-                build
-                .with_mounted_cache("/cache/distfiles", distfiles_cache)
-                .with_exec([
+            # Stamped here, not on the base container: the run ID changes
+            # every run and would otherwise invalidate stages 1-5.
+            for name, value in build_info.env("release").items():
+                build = build.with_env_variable(name, value)
+        # Evaluate each stage as it is added so a failure exports its Portage
+        # logs instead of losing them with the container.
+        stage = script_basename.removesuffix(".sh")
+        build = await failure_bundle.checked_exec(
+            build,
+            [f"./{script}"],
+            stage,
+            insecure_root_capabilities=True,
+        )
+        if script_basename == "stage2-sync.sh":
+            toolchain_report.record("portage-snapshot", await build.file(
+                "/var/tmp/regicide-build/rootfs/var/db/repos/gentoo/metadata/timestamp.chk",
+            ).contents())
+        if script_basename != "stage1-setup.sh":
+            # Persist newly downloaded distfiles after every emerging stage,
+            # so a failure later in the run does not lose them, then detach
+            # again so later stages stay content-cacheable.
+            build = (await failure_bundle.checked_exec(
+                build.with_mounted_cache("/cache/distfiles", distfiles_cache),
+                [
                     "sh", "-c",
                     "cp -au /var/tmp/regicide-build/rootfs/var/cache/distfiles/. /cache/distfiles/"
                     " 2>/dev/null || true",
-                ])
-                .without_mount("/cache/distfiles")
-                .with_mounted_cache("/cache/binpkgs", binpkgs_cache)
-                .with_exec([
-                    "sh", "-c",
-                    "cp -au /var/cache/binpkgs/. /cache/binpkgs/"
-                    " 2>/dev/null || true",
-                ])
-                .without_mount("/cache/binpkgs")
-            )
+                ],
+                f"{stage}-save-distfiles",
+            )).without_mount("/cache/distfiles")
+        if script_basename in ("stage3-base-f.sh", "stage4-cosmic-b.sh", "stage5-regicide.sh"):
+            # Persist newly built binpkgs and ccache objects to their volumes.
+            build = (await failure_bundle.checked_exec(
+                build.with_mounted_cache("/cache/binpkgs", binpkgs_cache),
+                ["sh", "-c", "cp -au /var/cache/binpkgs/. /cache/binpkgs/ 2>/dev/null || true"],
+                f"{stage}-save-binpkgs",
+            )).without_mount("/cache/binpkgs")
+            build = (await failure_bundle.checked_exec(
+                build.with_mounted_cache("/cache/ccache", ccache_cache),
+                ["sh", "-c", "cp -au /var/cache/ccache/. /cache/ccache/ 2>/dev/null || true"],
+                f"{stage}-save-ccache",
+            )).without_mount("/cache/ccache")
 
     tarball_name = f"stage4-{arch}-systemd-cosmic.tar.xz"
-    build = build.with_exec([
-        "mkdir", "-p", f"{catalyst_path}/output",
-    ]).with_exec([
-        "cp",
-        f"/var/tmp/regicide-build/output/{tarball_name}",
-        f"{catalyst_path}/output/{tarball_name}",
-    ])
+    build = await failure_bundle.checked_exec(
+        build,
+        [
+            "sh", "-c",
+            f"mkdir -p {catalyst_path}/output"
+            f" && cp /var/tmp/regicide-build/output/{tarball_name} {catalyst_path}/output/{tarball_name}",
+        ],
+        "collect-tarball",
+    )
 
     return build.with_workdir(catalyst_path)
 
 
+def binhost_service(client: dagger.Client, image_tag: str, arch: str = "amd64") -> dagger.Service:
+    """Serve the binpkgs cache volume over HTTP as a Portage binhost.
+
+    Stage builds write a Packages index next to the binpkgs (FEATURES=buildpkg),
+    so the volume can be consumed directly with --getbinpkg.  The server runs
+    on image_tag, the Gentoo stage3 its clients use, whose Python is pinned
+    with it in images.lock.json; no extra image is pulled.
+    """
+    volume = "regicide-binpkgs-v5" if arch == "amd64" else "regicide-arm64-binpkgs-v5"
+    return (
+        failure_bundle.from_image(client, image_tag)
+        .with_mounted_cache("/binpkgs", cache_keys.volume(client, volume))
+        .with_exposed_port(8080)
+        .as_service(args=["python3", "-m", "http.server", "8080", "--directory", "/binpkgs"])
+    )
+
+
+async def overlay_test_container(
+    client: dagger.Client,
+    stage: str,
+    arch: str = "amd64",
+    with_git: bool = False,
+    init: str = "systemd",
+) -> dagger.Container:
+    """Return a Gentoo container with the regicide-rust overlay registered.
+
+    Dependencies are fetched from binhost_service() when a matching binpkg
+    exists, so emerge --pretend/-1 runs do not compile from source.  The
+    binpkgs are built for the systemd profile, so on an OpenRC stage3 most
+    of them are rebuilt.  Its setup steps are named after stage.  with_git
+    mounts the whole checkout, .git included, at /regicide for the live
+    ebuilds to clone; otherwise only the overlay is loaded.
+    """
+    src = workspace_checks.workspace_source(client, with_git=with_git, paths=source_layout.source_paths("overlay"))
+    image_tag = {
+        ("amd64", "systemd"): "gentoo/stage3:amd64-systemd",
+        ("arm64", "systemd"): "gentoo/stage3:arm64-desktop-systemd",
+        ("amd64", "openrc"): "gentoo/stage3:amd64-openrc",
+        ("arm64", "openrc"): "gentoo/stage3:arm64-openrc",
+    }[(arch, init)]
+    synced = await with_portage_tree(
+        failure_bundle.from_image(client, image_tag)
+        .with_service_binding("binhost", binhost_service(client, image_tag, arch)),
+        await portage_snapshot(client, image_tag, stage),
+        stage,
+    )
+    configured = (
+        synced
+        .with_directory("/var/db/repos/regicide-overlay", source_layout.directory(client, src, "overlay"))
+        .with_new_file(
+            "/etc/portage/repos.conf/regicide.conf",
+            "[regicide-rust]\nlocation = /var/db/repos/regicide-overlay\nauto-sync = no\n",
+        )
+        .with_new_file(
+            "/etc/portage/binrepos.conf/regicide.conf",
+            "[regicide-binhost]\nsync-uri = http://binhost:8080\npriority = 10\n",
+        )
+    )
+    if with_git:
+        configured = configured.with_directory("/regicide", src)
+    tester = await failure_bundle.checked_exec(
+        configured,
+        [
+            "sh", "-c",
+            "echo 'EMERGE_DEFAULT_OPTS=\"${EMERGE_DEFAULT_OPTS} --getbinpkg --binpkg-respect-use=y\"'"
+            " >> /etc/portage/make.conf",
+        ],
+        f"{stage}-binhost",
+    )
+    return tester.with_workdir("/var/db/repos/regicide-overlay")
+
+
+async def overlay_tests(client: dagger.Client, arch: str = "amd64") -> str:
+    """Run the regicide-rust overlay tests in a Gentoo container."""
+    tested = await failure_bundle.checked_exec(
+        await overlay_test_container(client, "overlay-tests", arch),
+        ["./test-in-docker.sh"],
+        "overlay-tests",
+        insecure_root_capabilities=True,
+    )
+    return await tested.stdout()
+
+
+async def overlay_pkgcheck(client: dagger.Client, keywords: str | None = None) -> str:
+    """Run pkgcheck's QA checks on the regicide-rust overlay; fail on any error or warning.
+
+    The overlay's metadata/pkgcheck.conf holds its keyword filter; keywords
+    (pkgcheck's --keywords syntax) replaces it for this run.
+    """
+    tester = await failure_bundle.checked_exec(
+        await overlay_test_container(client, "pkgcheck"),
+        ["emerge", "--oneshot", "--noreplace", "--quiet-build=y", "dev-util/pkgcheck"],
+        "pkgcheck-install",
+    )
+    checked = await failure_bundle.checked_exec(
+        tester,
+        ["pkgcheck", "scan", "--exit", "error,warning", *(["--keywords", keywords] if keywords else [])],
+        "pkgcheck",
+    )
+    return await checked.stdout()
+
+
+async def overlay_manifest_check(client: dagger.Client) -> dagger.Container:
+    """Regenerate every Manifest in the regicide-rust overlay; fail if a committed one differs.
+
+    The distfiles are fetched again at least daily, so an upstream tarball
+    that changed under its name shows up as a hash mismatch.  With
+    REGICIDE_UPDATE_MANIFESTS=1 differences do not fail; the returned
+    container's overlay holds the regenerated Manifests.
+    """
+    tester = (await overlay_test_container(client, "manifest-check")).with_env_variable(
+        "REGICIDE_SCAN_DAY", security_scan.scan_day()
+    )
+    if os.environ.get("REGICIDE_UPDATE_MANIFESTS") == "1":
+        tester = tester.with_env_variable("REGICIDE_UPDATE_MANIFESTS", "1")
+    return await failure_bundle.checked_exec(tester, ["./check-manifests.sh"], "manifest-check")
+
+
+async def overlay_openrc_tests(client: dagger.Client, arch: str = "amd64") -> str:
+    """Check that regicide-tools packages work on OpenRC or refuse to install.
+
+    Packages that ship a systemd unit must also install an OpenRC init
+    script; packages that need systemd must say so when emerge fails.
+    """
+    tester = await failure_bundle.checked_exec(
+        await overlay_test_container(client, "overlay-openrc-tests", arch, with_git=True, init="openrc"),
+        ["emerge", "--oneshot", "--noreplace", "--quiet-build=y", "dev-vcs/git"],
+        "overlay-openrc-tests-git",
+    )
+    tested = await failure_bundle.checked_exec(
+        tester,
+        ["./test-openrc.sh"],
+        "overlay-openrc-tests",
+        insecure_root_capabilities=True,
+    )
+    return await tested.stdout()
+
+
+async def overlay_deep_tests(client: dagger.Client, arch: str = "amd64", buildpkg: bool = False) -> dagger.Container:
+    """Install, reinstall and uninstall every regicide-tools package.
+
+    After the install, each package's files are checked against its
+    installed-files list; every path checks that the maintainer hooks ran
+    cleanly and left the expected users, directories and unit state.
+
+    The live ebuilds clone the workspace's .git through an EGIT override, so
+    this tests committed HEAD rather than uncommitted changes.  With
+    REGICIDE_UPDATE_SNAPSHOTS=1 the installed-files lists are rewritten.
+    With buildpkg, every merge also writes a binpkg for binpkg_channel.
+    """
+    tester = await failure_bundle.checked_exec(
+        await overlay_test_container(client, "overlay-deep-tests", arch, with_git=True),
+        ["emerge", "--oneshot", "--noreplace", "--quiet-build=y", "dev-vcs/git"],
+        "overlay-deep-tests-git",
+    )
+    if os.environ.get("REGICIDE_UPDATE_SNAPSHOTS") == "1":
+        tester = tester.with_env_variable("REGICIDE_UPDATE_SNAPSHOTS", "1")
+    if buildpkg:
+        tester = binpkg_channel.buildpkg(tester)
+    return await failure_bundle.checked_exec(
+        tester,
+        ["./test-deep-install.sh"],
+        "overlay-deep-tests",
+        insecure_root_capabilities=True,
+    )
+
+
+async def image_smoke_test(client: dagger.Client, ref: str) -> str:
+    """Pull a published btrmind image by digest and check that it works.
+
+    Runs in a container built only from the pulled image, with no workspace
+    or cache mounts: btrmind --version, config validation with the config
+    shipped in the image, and a dry-run analyze, which never acts.
+    """
+    image = (
+        failure_bundle.from_image(client, ref)
+        .with_env_variable("NO_COLOR", "1")
+        .with_env_variable("RUST_LOG", "info")
+    )
+    output = []
+    for stage, args in [
+        ("image-smoke-version", ["btrmind", "--version"]),
+        ("image-smoke-config", ["btrmind", "config"]),
+        ("image-smoke-analyze", ["btrmind", "--dry-run", "analyze"]),
+    ]:
+        ran = await failure_bundle.checked_exec(image, args, stage)
+        output.append(f"$ {' '.join(args)}\n{await ran.stdout()}{await ran.stderr()}")
+    return "\n".join(output)
+
+
 async def build_iso(
     client: dagger.Client,
     tarball: dagger.File,
 ) -> dagger.File:
     """Create a SquashFS image from a stage4 tarball for live ISO use."""
 
-    builder = (
-        client.container()
-        .from_("alpine:latest")
-        .with_exec(["apk", "add", "squashfs-tools", "tar", "xz"])
-        .with_file("/tmp/stage4.tar.xz", tarball)
-        .with_exec(["mkdir", "-p", "/tmp/rootfs"])
-        .with_exec([
-            "tar", "-C", "/tmp/rootfs", "-xpJf", "/tmp/stage4.tar.xz",
-        ])
-        .with_exec([
+    builder = await failure_bundle.checked_exec(
+        failure_bundle.from_image(client, "alpine:latest"),
+        ["apk", "add", "squashfs-tools", "tar", "xz"],
+        "squashfs-tools",
+    )
+    builder = await failure_bundle.checked_exec(
+        builder.with_file("/tmp/stage4.tar.xz", tarball),
+        ["sh", "-c", "mkdir -p /tmp/rootfs && tar -C /tmp/rootfs -xpJf /tmp/stage4.tar.xz"],
+        "squashfs-extract",
+    )
+    builder = await failure_bundle.checked_exec(
+        builder,
+        [
             "mksquashfs", "/tmp/rootfs", "/tmp/regicide-cosmic.img",
             "-comp", "zstd", "-Xcompression-level", "19",
-        ])
+        ],
+        "squashfs",
     )
 
     return builder.file("/tmp/regicide-cosmic.img")
 
 
-def _with_cosign(container: dagger.Container) -> dagger.Container:
-    """Install cosign v2.4.0 into a Linux container from the official release."""
-    cosign_url = (
-        "https://github.com/sigstore/cosign/releases/download/"
-        "v2.4.0/cosign-linux-amd64"
-    )
-    expected_sha256 = "cd7636b3586a3bdac2d9c8f3b421ed119edcb20499107887fd929211110e8418"
-    return (
-        container
-        .with_exec(["apk", "add", "--no-cache", "curl", "ca-certificates", "coreutils"])
-        .with_exec([
-            "sh", "-c",
-            f"curl -sL -o /usr/local/bin/cosign '{cosign_url}' && "
-            f"echo '{expected_sha256}  /usr/local/bin/cosign' | sha256sum -c - && "
-            "chmod +x /usr/local/bin/cosign",
-        ])
-    )
-
-
 async def sign_artifacts(
     client: dagger.Client,
     squashfs: dagger.File,
@@ -299,8 +701,8 @@ async def sign_artifacts(
     Returns (squashfs_sig, squashfs_cert, squashfs_bundle, sbom_sig, sbom_cert, sbom_bundle, attestation_bundle).
     In key-based mode the certificate files are None.
     """
-    signer = client.container().from_("alpine:latest")
-    signer = _with_cosign(signer)
+    signer = failure_bundle.from_image(client, "alpine:latest")
+    signer = await signing.with_cosign(signer, "sign-artifacts")
 
     signer = (
         signer
@@ -309,12 +711,10 @@ async def sign_artifacts(
         .with_env_variable("COSIGN_EXPERIMENTAL", "1")
     )
 
-    key_path = os.environ.get("COSIGN_KEY_PATH")
-    if key_path:
-        signer = signer.with_mounted_file("/secrets/cosign.key", client.host().file(key_path))
-        signer = signer.with_env_variable("COSIGN_PASSWORD", os.environ.get("COSIGN_PASSWORD", ""))
+    if signing.key_based():
+        signer = signing.with_key(client, signer)
 
-        signer = signer.with_exec([
+        signer = await failure_bundle.checked_exec(signer, [
             "cosign", "sign-blob",
             "--key=/secrets/cosign.key",
             "--tlog-upload=false",
@@ -322,8 +722,8 @@ async def sign_artifacts(
             "--output-certificate=/artifacts/regicide-cosmic.img.cert",
             "--bundle=/artifacts/regicide-cosmic.img.bundle",
             "/artifacts/regicide-cosmic.img",
-        ])
-        signer = signer.with_exec([
+        ], "sign-squashfs")
+        signer = await failure_bundle.checked_exec(signer, [
             "cosign", "sign-blob",
             "--key=/secrets/cosign.key",
             "--tlog-upload=false",
@@ -331,8 +731,8 @@ async def sign_artifacts(
             "--output-certificate=/artifacts/sbom.spdx.json.cert",
             "--bundle=/artifacts/sbom.spdx.json.bundle",
             "/artifacts/sbom.spdx.json",
-        ])
-        signer = signer.with_exec([
+        ], "sign-sbom")
+        signer = await failure_bundle.checked_exec(signer, [
             "cosign", "attest-blob",
             "--key=/secrets/cosign.key",
             "--tlog-upload=false",
@@ -340,7 +740,7 @@ async def sign_artifacts(
             "--type=spdx",
             "--output-attestation=/artifacts/regicide-cosmic.img.att",
             "/artifacts/regicide-cosmic.img",
-        ])
+        ], "attest-sbom")
         return (
             signer.file("/artifacts/regicide-cosmic.img.sig"),
             None,
@@ -358,32 +758,32 @@ async def sign_artifacts(
     # the identity claims and is verified by the standard verify-blob flow.
     signer = signer.with_env_variable("COSIGN_YES", "true")
 
-    signer = signer.with_exec([
+    signer = await failure_bundle.checked_exec(signer, [
         "sh", "-c",
         "cosign sign-blob "
         "--output-signature=/artifacts/regicide-cosmic.img.sig "
         "--output-certificate=/artifacts/regicide-cosmic.img.cert "
         "--bundle=/artifacts/regicide-cosmic.img.bundle "
         "/artifacts/regicide-cosmic.img",
-    ])
+    ], "sign-squashfs")
 
-    signer = signer.with_exec([
+    signer = await failure_bundle.checked_exec(signer, [
         "sh", "-c",
         "cosign sign-blob "
         "--output-signature=/artifacts/sbom.spdx.json.sig "
         "--output-certificate=/artifacts/sbom.spdx.json.cert "
         "--bundle=/artifacts/sbom.spdx.json.bundle "
         "/artifacts/sbom.spdx.json",
-    ])
+    ], "sign-sbom")
 
-    signer = signer.with_exec([
+    signer = await failure_bundle.checked_exec(signer, [
         "sh", "-c",
         "cosign attest-blob "
         "--predicate=/artifacts/sbom.spdx.json "
         "--type=spdx "
         "--output-attestation=/artifacts/regicide-cosmic.img.att "
         "/artifacts/regicide-cosmic.img",
-    ])
+    ], "attest-sbom")
 
     return (
         signer.file("/artifacts/regicide-cosmic.img.sig"),
@@ -449,7 +849,7 @@ async def build_qcow2_locally(
         print(f"Building encrypted QCOW2 image: {output_path}")
 
     try:
-        subprocess.run(cmd, check=True)
+        _run_host("qcow2", cmd)
     finally:
         if passphrase_file is not None:
             try:
@@ -460,9 +860,590 @@ async def build_qcow2_locally(
     print(f"QCOW2 image complete: {output_path}")
 
 
+async def run_stages(jobs: list[Callable[[], Awaitable[None]]], parallel: int) -> None:
+    """Run jobs with at most parallel of them at once.
+
+    The first job to fail cancels the rest, so a failed run still stops
+    early, and its exception propagates unchanged; a failed advisory job
+    (advisory.toml) only warns.  Each job is a progress event stage named
+    after its function: job_security_scan is security-scan.  With
+    --memoize, a job whose inputs match an earlier passing run is skipped
+    (stage_memo.py).
+    """
+    semaphore = asyncio.Semaphore(parallel)
+
+    async def bounded(job: Callable[[], Awaitable[None]]) -> None:
+        name = job.__name__.removeprefix("job_").replace("_", "-")
+        async with semaphore:
+            try:
+                async with events.stage(name):
+                    if stage_memo.enabled():
+                        await stage_memo.run(name, job)
+                    else:
+                        await job()
+            except failure_bundle.StageFailed as exc:
+                if not advisory.excuse(name, exc):
+                    raise
+
+    tasks = [asyncio.create_task(bounded(job)) for job in jobs]
+    try:
+        await asyncio.gather(*tasks)
+    finally:
+        for task in tasks:
+            task.cancel()
+
+
+async def run_workspace_checks(
+    client: dagger.Client, args: argparse.Namespace
+) -> list[Callable[[], Awaitable[None]]]:
+    """Run the Cargo workspace checks selected on the command line.
+
+    rustfmt, cargo check and the ebuild version check gate everything else.  The
+    remaining stages share no outputs, so they run up to --parallel at a
+    time, in the order below.  The jobs that push to a registry
+    (--binpkg-channel, --publish) are returned instead of run: main() runs
+    them once every gating stage, the OS image build included, has passed.
+    """
+    reports_dir = workspace_checks.REPORTS_DIR
+
+    if args.rustfmt:
+        print("Checking formatting (cargo fmt --check)...")
+        await workspace_checks.rustfmt(client)
+
+    if not args.skip_cargo_check:
+        print("Type-checking the workspace (cargo check)...")
+        output = await workspace_checks.cargo_check(client)
+        _write_report(reports_dir / "cargo-check.txt", output)
+
+    if args.ebuild_versions:
+        print("Checking overlay ebuild versions against workspace crates...")
+        base = test_impact.base_ref(args.ebuild_versions) or workspace_checks.latest_tag()
+        if base is None:
+            print("WARNING: no base ref or tag to detect crate version bumps against", file=sys.stderr)
+        errors, warnings = workspace_checks.ebuild_version_drift(base)
+        for warning in warnings:
+            print(f"WARNING: {warning}", file=sys.stderr)
+        if errors:
+            for error in errors:
+                print(f"Error: {error}", file=sys.stderr)
+            raise exit_codes.RunFailed(
+                "ebuild-versions", exit_codes.POLICY_GATE,
+                f"{len(errors)} overlay ebuild(s) out of step with their crates",
+            )
+
+    jobs: list[Callable[[], Awaitable[None]]] = []
+    publishing: list[Callable[[], Awaitable[None]]] = []
+
+    if args.public_api_diff:
+        async def job_public_api_diff() -> None:
+            print(f"Diffing public API against {args.public_api_diff}...")
+            report = await workspace_checks.public_api_diff(client, base_ref=args.public_api_diff)
+            report_path = reports_dir / "public-api-diff.md"
+            await report.export(str(report_path))
+            print(f"Output: {report_path}")
+            workspace_checks.post_pr_comment(report_path)
+        jobs.append(job_public_api_diff)
+
+    if args.benchmarks is not None:
+        async def job_benchmarks() -> None:
+            print(f"Benchmarking btrmind ({args.benchmarks} runs per trace)...")
+            export = await workspace_checks.btrmind_benchmarks(client, runs=args.benchmarks)
+            results = benchmarks.parse(await export.contents())
+            print(f"Output: {benchmarks.record(results)}")
+            if not os.environ.get("REGICIDE_PR_NUMBER"):
+                return
+            if benchmarks.hosted_runner():
+                print("Not comparing benchmarks on a GitHub-hosted runner; see benchmarks.py")
+                return
+            found = benchmarks.baseline()
+            if found is None:
+                print(f"No passed {benchmarks.BASE_BRANCH} run with benchmarks to compare against")
+                return
+            report_path = _write_report(
+                reports_dir / "benchmarks.md", benchmarks.comparison(found[0], found[1], results)
+            )
+            workspace_checks.post_pr_comment(report_path)
+        jobs.append(job_benchmarks)
+
+    if args.dependency_trees:
+        async def job_dependency_trees() -> None:
+            print("Exporting dependency trees...")
+            trees = await workspace_checks.dependency_trees(client)
+            trees_path = reports_dir / "dependency-trees"
+            await trees.export(str(trees_path))
+            if args.submit_dependencies:
+                workspace_checks.require_lockfile("dependency-submission")
+                metadata = await workspace_checks.dependency_graph(client)
+                snapshot = dependency_submission.snapshot(metadata, build_info.git_sha(), build_info.git_ref())
+                (trees_path / "snapshot.json").write_text(json.dumps(snapshot, indent=2) + "\n")
+                dependency_submission.submit(snapshot)
+            print(f"Output: {trees_path}/")
+        jobs.append(job_dependency_trees)
+
+    if args.duplicate_budget:
+        async def job_duplicate_budget() -> None:
+            print("Checking duplicate crate versions...")
+            duplicates = await workspace_checks.duplicate_crates(client)
+            _write_report(
+                reports_dir / "duplicate-crates.txt",
+                "".join(f"{name} {' '.join(versions)}\n" for name, versions in duplicates.items()),
+            )
+            violations = workspace_checks.duplicate_budget_violations(duplicates)
+            if violations:
+                for violation in violations:
+                    print(f"Error: duplicate crate over budget: {violation}", file=sys.stderr)
+                raise exit_codes.RunFailed(
+                    "duplicate-budget", exit_codes.POLICY_GATE,
+                    f"{len(violations)} duplicate crate(s) over budget; unify the versions or add a justified"
+                    f" entry to {workspace_checks.DUPLICATE_ALLOWLIST.name}",
+                )
+        jobs.append(job_duplicate_budget)
+
+    if args.build_timings:
+        async def job_build_timings() -> None:
+            await export_build_timings(client, reports_dir)
+        jobs.append(job_build_timings)
+
+    if args.feature_powerset is not None:
+        async def job_feature_powerset() -> None:
+            print(f"Checking feature powerset (depth {args.feature_powerset})...")
+            await workspace_checks.feature_powerset(client, depth=args.feature_powerset)
+        jobs.append(job_feature_powerset)
+
+    if args.security_scan:
+        async def job_security_scan() -> None:
+            print(f"Running {', '.join(security_scan.SCANNERS)} concurrently...")
+            raw, findings = await security_scan.scan(client, options={"gitleaks": {"history": args.scan_history}})
+            run_history.record_findings(findings)
+            policy = security_scan.load_policy()
+            for message in security_scan.expiring(policy, security_scan.trivy_ignores()):
+                print(f"WARNING: {message}", file=sys.stderr)
+                run_history.record_warning("security-scan", message)
+            scan_dir = reports_dir / "security"
+            scan_dir.mkdir(parents=True, exist_ok=True)
+            for name, report in raw.items():
+                (scan_dir / name).write_text(report)
+            (scan_dir / "findings.json").write_text(json.dumps(findings, indent=2) + "\n")
+            (scan_dir / "summary.txt").write_text(
+                security_scan.summary(findings, args.security_threshold, policy["thresholds"])
+            )
+            print(f"Output: {scan_dir}/")
+            if args.upload_sarif:
+                for name in sorted(raw):
+                    if name.endswith(".sarif"):
+                        security_scan.upload_sarif(raw[name], name.removesuffix(".sarif"))
+            await security_scan.gate(client, findings, args.security_threshold)
+        jobs.append(job_security_scan)
+
+    if args.overlay_tests:
+        async def job_overlay_tests() -> None:
+            print(f"Running overlay tests ({args.arch}) against the binpkgs binhost...")
+            output = await overlay_tests(client, arch=args.arch)
+            _write_report(reports_dir / "overlay-tests.txt", output)
+        jobs.append(job_overlay_tests)
+
+    if args.smoke_test_image:
+        async def job_smoke_test_image() -> None:
+            print(f"Smoke-testing {args.smoke_test_image}...")
+            output = await image_smoke_test(client, args.smoke_test_image)
+            _write_report(reports_dir / "image-smoke-test.txt", output)
+        jobs.append(job_smoke_test_image)
+
+    if args.check_image_labels:
+        async def job_check_image_labels() -> None:
+            print(f"Checking the labels of {args.check_image_labels} against {oci_policy.POLICY_PATH.name}...")
+            labels = await oci_policy.image_labels(client, args.check_image_labels)
+            _write_report(
+                reports_dir / "image-labels.txt", "".join(f"{name}={value}\n" for name, value in sorted(labels.items()))
+            )
+            oci_policy.enforce(args.check_image_labels, labels)
+        jobs.append(job_check_image_labels)
+
+    if args.pkgcheck:
+        async def job_pkgcheck() -> None:
+            print("Running pkgcheck on the regicide-rust overlay...")
+            output = await overlay_pkgcheck(client, keywords=args.pkgcheck_keywords)
+            _write_report(reports_dir / "pkgcheck.txt", output)
+        jobs.append(job_pkgcheck)
+
+    if args.manifest_check:
+        async def job_manifest_check() -> None:
+            print("Regenerating the regicide-rust overlay's Manifests...")
+            checked = await overlay_manifest_check(client)
+            _write_report(reports_dir / "manifest-check.txt", await checked.stdout())
+            if os.environ.get("REGICIDE_UPDATE_MANIFESTS") == "1":
+                overlay = checked.directory("/var/db/repos/regicide-overlay")
+                manifests = client.directory().with_directory(".", overlay, include=["*/*/Manifest"])
+                await manifests.export(str(source_layout.component("overlay")))
+        jobs.append(job_manifest_check)
+
+    if args.overlay_openrc_tests:
+        async def job_overlay_openrc_tests() -> None:
+            print(f"Running overlay tests on an OpenRC stage3 ({args.arch})...")
+            output = await overlay_openrc_tests(client, arch=args.arch)
+            _write_report(reports_dir / "overlay-openrc-tests.txt", output)
+        jobs.append(job_overlay_openrc_tests)
+
+    if args.overlay_deep_tests:
+        async def job_overlay_deep_tests() -> None:
+            print(f"Running deep install tests of regicide-tools packages ({args.arch})...")
+            tested = await overlay_deep_tests(client, arch=args.arch)
+            _write_report(reports_dir / "overlay-deep-tests.txt", await tested.stdout())
+            if os.environ.get("REGICIDE_UPDATE_SNAPSHOTS") == "1":
+                lists = source_layout.component("overlay") / "installed-files"
+                await tested.directory(f"/var/db/repos/regicide-overlay/{lists.name}").export(str(lists))
+        jobs.append(job_overlay_deep_tests)
+
+    if args.binpkg_channel:
+        async def job_binpkg_channel() -> None:
+            print(f"Building and deep-testing the regicide-rust binpkgs ({args.arch})...")
+            tested = await overlay_deep_tests(client, arch=args.arch, buildpkg=True)
+            channel = await binpkg_channel.collect(tested)
+            print(f"Pushing the binpkg channel to {binpkg_channel.REPOSITORY}...")
+            ref = await binpkg_channel.push(client, channel, args.arch)
+            if not args.skip_sign:
+                print(f"Signing {ref}...")
+                await signing.sign_image(client, ref, publish.REGISTRY, *publish.credentials())
+            report_path = reports_dir / "binpkg-channel.txt"
+            report_path.parent.mkdir(parents=True, exist_ok=True)
+            report_path.write_text(f"{ref}\n" + "".join(f"{entry}\n" for entry in await channel.glob("**/*.gpkg.tar")))
+            print(f"Published {ref}")
+        publishing.append(job_binpkg_channel)
+
+    if args.clippy:
+        async def job_clippy() -> None:
+            print("Linting the workspace (cargo clippy)...")
+            output = await workspace_checks.clippy(client, deny_warnings=not args.clippy_warn)
+            _write_report(reports_dir / "clippy.txt", output)
+        jobs.append(job_clippy)
+
+    if args.cargo_tests:
+        async def job_cargo_tests() -> None:
+            packages = None
+            if args.test_impact:
+                packages, impact = test_impact.plan(await workspace_checks.dependency_graph(client), args.test_impact)
+                print(impact, end="")
+                _write_report(reports_dir / "test-impact.txt", impact)
+                if not packages:
+                    print("No workspace crate is impacted; skipping the tests")
+                    return
+            print(f"Running the workspace tests (cargo nextest, {args.test_shards} shard(s))...")
+            tested = await workspace_checks.cargo_tests(client, args.test_shards, packages)
+            report_path = reports_dir / "junit" / "cargo-tests.xml"
+            report_path.parent.mkdir(parents=True, exist_ok=True)
+            reports = [
+                await shard.file(f"{workspace_checks.WORKSPACE}/{workspace_checks.JUNIT_REPORT}").contents()
+                for shard in tested
+            ]
+            report_path.write_text(junit_report.merge(reports))
+            summary = junit_report.publish("Cargo tests", report_path)
+            print(
+                f"{summary['tests']} tests, {summary['failed']} failed, {summary['skipped']} skipped; "
+                f"JUnit report: {report_path}"
+            )
+            await workspace_checks.cargo_tests_gate(tested)
+        jobs.append(job_cargo_tests)
+
+    if args.coverage:
+        async def job_coverage() -> None:
+            print("Measuring test coverage (cargo llvm-cov)...")
+            report, percent = await workspace_checks.coverage(client)
+            report_path = reports_dir / "coverage" / "lcov.info"
+            report_path.parent.mkdir(parents=True, exist_ok=True)
+            await report.export(str(report_path))
+            run_history.record_metric("coverage-lines", round(percent, 2))
+            print(f"Line coverage {percent:.1f}%; output: {report_path}")
+            if args.upload_coverage:
+                await coverage_upload.upload(client, args.upload_coverage, report)
+        jobs.append(job_coverage)
+
+    if args.cargo_deny:
+        async def job_cargo_deny() -> None:
+            print("Checking licenses, banned and duplicate crates (cargo deny)...")
+            checked = await workspace_checks.cargo_deny(client)
+            report = await checked.file(workspace_checks.DENY_REPORT).contents()
+            _write_report(reports_dir / "cargo-deny.json", report)
+            for violation in workspace_checks.deny_violations(report):
+                print(
+                    f"Error: cargo-deny {violation['check']} [{violation['code']}] "
+                    f"{violation['crate'] or 'deny.toml'}: {violation['message']}",
+                    file=sys.stderr,
+                )
+            await workspace_checks.cargo_deny_gate(checked)
+        jobs.append(job_cargo_deny)
+
+    if args.installer_tui_tests:
+        async def job_installer_tui_tests() -> None:
+            print("Running installer TUI snapshot tests...")
+            ran = await workspace_checks.installer_tui_snapshots(client)
+            _write_report(reports_dir / "installer-tui-snapshots.txt", await ran.stderr())
+            if os.environ.get("REGICIDE_UPDATE_SNAPSHOTS") == "1":
+                snapshots = workspace_checks.SNAPSHOT_DIR
+                await ran.directory(f"{workspace_checks.WORKSPACE}/{snapshots}").export(str(snapshots))
+                print(f"Updated snapshots: {snapshots}/")
+        jobs.append(job_installer_tui_tests)
+
+    if args.cli_golden:
+        async def job_cli_golden() -> None:
+            print("Diffing CLI output with golden files...")
+            ran = await workspace_checks.cli_golden(client)
+            _write_report(reports_dir / "cli-golden.txt", await ran.stderr())
+            if os.environ.get("REGICIDE_UPDATE_SNAPSHOTS") == "1":
+                golden = workspace_checks.CLI_GOLDEN_DIR
+                await ran.directory(f"{workspace_checks.WORKSPACE}/{golden}").export(str(golden))
+                print(f"Updated golden files: {golden}/")
+        jobs.append(job_cli_golden)
+
+    if args.btrmind_simulation:
+        async def job_btrmind_simulation() -> None:
+            print("Replaying btrmind metric traces...")
+            output = await workspace_checks.btrmind_simulation(client)
+            _write_report(reports_dir / "btrmind-simulation.txt", output)
+        jobs.append(job_btrmind_simulation)
+
+    if args.config_migration is not None:
+        async def job_config_migration() -> None:
+            previous = args.config_migration or workspace_checks.previous_btrmind_release()
+            print(f"Validating released btrmind configs{f' and {previous}' if previous else ''}...")
+            output = await workspace_checks.btrmind_config_migration(client, previous)
+            _write_report(reports_dir / "btrmind-config-migration.txt", output)
+        jobs.append(job_config_migration)
+
+    if args.non_btrfs_tests:
+        async def job_non_btrfs_tests() -> None:
+            print("Running btrmind against ext4 and xfs...")
+            output = await workspace_checks.btrmind_non_btrfs(client)
+            _write_report(reports_dir / "btrmind-non-btrfs.txt", output)
+        jobs.append(job_non_btrfs_tests)
+
+    if args.locale_matrix:
+        async def job_locale_matrix() -> None:
+            print("Running the CLIs across locales and timezones...")
+            report = await workspace_checks.locale_matrix(client)
+            _write_report(reports_dir / "locale-matrix.csv", report)
+        jobs.append(job_locale_matrix)
+
+    if args.readonly_root_tests:
+        async def job_readonly_root_tests() -> None:
+            print("Running btrmind on a read-only root...")
+            output = await workspace_checks.btrmind_readonly_root(client)
+            _write_report(reports_dir / "btrmind-readonly-root.txt", output)
+        jobs.append(job_readonly_root_tests)
+
+    if args.declared:
+        async def job_declared_stages() -> None:
+            # One job, so each stage still runs after the ones it needs.
+            failed: set[str] = set()
+            for name in args.declared:
+                spec = args.declared_stages[name]
+                if failed & set(spec.get("needs", [])):
+                    print(f"Skipping declared stage {name}: an advisory stage it needs failed")
+                    run_history.record_stage(name, "skipped", 0)
+                    failed.add(name)
+                    continue
+                print(f"Running declared stage {name}: {spec.get('description', '')}")
+                try:
+                    output = await declared_stages.run(client, name, spec)
+                except failure_bundle.StageFailed as exc:
+                    if not advisory.excuse(name, exc):
+                        raise
+                    failed.add(name)
+                    continue
+                if "report" in spec:
+                    _write_report(reports_dir / spec["report"], output)
+        jobs.append(job_declared_stages)
+
+    if args.syscall_audit:
+        async def job_syscall_audit() -> None:
+            print("Auditing btrmind syscalls against its systemd unit...")
+            report = await workspace_checks.btrmind_syscall_audit(client)
+            _write_report(reports_dir / "btrmind-syscalls.txt", report)
+        jobs.append(job_syscall_audit)
+
+    if args.soak is not None:
+        async def job_soak() -> None:
+            print(f"Soaking btrmind for {args.soak}s...")
+            report = await workspace_checks.btrmind_soak(client, args.soak)
+            report_path = reports_dir / "btrmind-soak"
+            await report.export(str(report_path))
+            print(f"Output: {report_path}/")
+        jobs.append(job_soak)
+
+    if args.gpu_tests:
+        async def job_gpu_tests() -> None:
+            if workspace_checks.gpu_available():
+                print("Running GPU tests...")
+                output = await workspace_checks.gpu_tests(client)
+                _write_report(reports_dir / "gpu-tests.txt", output)
+            else:
+                print("No GPU on this runner; skipping GPU tests (set REGICIDE_GPU=1 to force)")
+                run_history.record_stage("gpu-tests", "skipped", 0)
+        jobs.append(job_gpu_tests)
+
+    if args.generate_docs:
+        async def job_generate_docs() -> None:
+            print("Generating man pages and shell completions...")
+            docs = await workspace_checks.generated_docs(client)
+            docs_dir = Path("build-system/catalyst/output/docs")
+            await docs.export(str(docs_dir))
+            artifacts.validate("generate-docs")
+            print(f"Output: {docs_dir}/")
+        jobs.append(job_generate_docs)
+
+    if args.cross_build is not None:
+        async def job_cross_build() -> None:
+            targets = args.cross_build or list(workspace_checks.CROSS_TARGETS)
+            print(f"Cross-compiling installer and btrmind for {', '.join(targets)}...")
+            builds = await asyncio.gather(*(workspace_checks.cross_binaries(client, target) for target in targets))
+            for target, binaries in zip(targets, builds):
+                target_dir = Path("build-system/catalyst/output/cross") / target
+                await binaries.export(str(target_dir))
+                artifacts.validate("cross-build", target=target)
+                for package in workspace_checks.WORKSPACE_PACKAGES:
+                    run_history.record_artifact(f"cross-{target}-{package}", target_dir / package)
+                print(f"Output: {target_dir}/")
+        jobs.append(job_cross_build)
+
+    if args.static_binaries:
+        async def job_static_binaries() -> None:
+            print(f"Building static installer and btrmind ({workspace_checks.STATIC_TARGET})...")
+            binaries = await workspace_checks.static_binaries(client)
+            static_dir = Path("build-system/catalyst/output/static")
+            await binaries.export(str(static_dir))
+            artifacts.validate("static-binaries")
+            for package in workspace_checks.WORKSPACE_PACKAGES:
+                run_history.record_artifact(f"static-{package}", static_dir / package)
+            print(f"Output: {static_dir}/")
+        jobs.append(job_static_binaries)
+
+    if args.sbom:
+        async def job_sbom() -> None:
+            print("Generating CycloneDX and SPDX SBOMs for the Rust binaries (syft)...")
+            documents = await syft_sbom.rust_binaries(client)
+            await documents.export(str(syft_sbom.OUTPUT_DIR))
+            artifacts.validate("rust-sbom")
+            for suffix in syft_sbom.FORMATS:
+                run_history.record_artifact(f"rust-sbom-{suffix}", syft_sbom.OUTPUT_DIR / f"rust-binaries.{suffix}")
+            print(f"Output: {syft_sbom.OUTPUT_DIR}/")
+        jobs.append(job_sbom)
+
+    if args.release_optimized:
+        async def job_release_optimized() -> None:
+            print(f"Building optimized release binaries for {args.rust_target}{' with PGO' if args.pgo else ''}...")
+            binaries = await workspace_checks.optimized_binaries(client, pgo=args.pgo, target=args.rust_target)
+            bin_dir = Path("build-system/catalyst/output/bin")
+            await binaries.export(str(bin_dir))
+            artifacts.validate("release-optimized")
+            print(f"Output: {bin_dir}/")
+        jobs.append(job_release_optimized)
+
+    if args.publish:
+        async def job_publish() -> None:
+            version = workspace_checks.crate_version("btrmind")
+            print(f"Building the btrmind {version} image for {publish.REPOSITORY}...")
+            image = await publish.btrmind_image(client, version)
+            refs = await publish.push(client, image, version)
+            # Both tags name the same digest; signing it covers them.
+            digest_ref = f"{publish.REPOSITORY}@{refs[0].split('@')[1]}"
+            print(f"Smoke-testing {digest_ref}...")
+            _write_report(reports_dir / "image-smoke-test.txt", await image_smoke_test(client, digest_ref))
+            if not args.skip_sign:
+                print(f"Signing {digest_ref}...")
+                await signing.sign_image(client, digest_ref, publish.REGISTRY, *publish.credentials())
+            if args.sbom:
+                print(f"Generating SBOMs for {digest_ref} (syft)...")
+                documents = await syft_sbom.image(client, digest_ref, "btrmind-image")
+                await documents.export(str(syft_sbom.OUTPUT_DIR))
+                print(f"Output: {syft_sbom.OUTPUT_DIR}/")
+                if not args.skip_sign:
+                    print(f"Attaching the SBOMs to {digest_ref} as attestations...")
+                    await syft_sbom.attest(client, digest_ref, documents, "btrmind-image")
+            report_path = reports_dir / "publish.txt"
+            report_path.parent.mkdir(parents=True, exist_ok=True)
+            report_path.write_text("".join(f"{ref}\n" for ref in refs))
+            for ref in refs:
+                print(f"Published {ref}")
+        publishing.append(job_publish)
+
+    await run_stages(jobs, args.parallel)
+    return publishing
+
+
+async def export_build_timings(client: dagger.Client, reports_dir: Path) -> None:
+    """Export cargo timings per component plus a slowest-crates summary."""
+    timings_dir = reports_dir / "timings"
+    timings_dir.mkdir(parents=True, exist_ok=True)
+    summary = ["# Slowest crates (release build)"]
+    for package in workspace_checks.WORKSPACE_PACKAGES:
+        print(f"Profiling release build of {package}...")
+        html = await (await workspace_checks.build_timings(client, package)).contents()
+        (timings_dir / f"{package}.html").write_text(html)
+        units = workspace_checks.timings_units(html)
+        (timings_dir / f"{package}.json").write_text(json.dumps(units, indent=2) + "\n")
+        summary += ["", f"## {package}", "", "| crate | version | mode | seconds |", "|---|---|---|---|"]
+        for unit in workspace_checks.slowest_units(units):
+            summary.append(f"| {unit['name']} | {unit['version']} | {unit['mode']} | {unit['duration']:.1f} |")
+    (timings_dir / "summary.md").write_text("\n".join(summary) + "\n")
+    print(f"Output: {timings_dir}/")
+
+
+async def repro(client: dagger.Client, run_stage: str, manifest: dict) -> None:
+    """Re-run only the failed step of run_stage, in the container it failed in.
+
+    The container is loaded from the ID in the triage manifest, so nothing
+    before the step runs again.  The step goes through checked_exec, so a
+    repeat failure exports a new bundle under this run's ID.  Secrets do
+    not outlive the session that set them, so a container holding one
+    cannot be loaded; then the recorded pipeline invocation is printed to
+    re-run by hand.
+    """
+    command = manifest["command"]
+    print(f"Replaying {run_stage}: {' '.join(command)}")
+    try:
+        container = await client.load_container_from_id(dagger.ContainerID(manifest["container"])).sync()
+    except dagger.QueryError:
+        print(
+            f"Error: the container of {run_stage} cannot be loaded into a new session; re-run the recorded "
+            f"invocation instead: {' '.join(manifest['pipeline_argv'])}",
+            file=sys.stderr,
+        )
+        raise
+    ran = await failure_bundle.checked_exec(container, command, manifest["stage"], **manifest["exec_options"])
+    print(await ran.stdout(), end="")
+    print(f"{run_stage} passed on replay")
+
+
+async def export_dist(client: dagger.Client, args: argparse.Namespace, since: dict[Path, int]) -> None:
+    """Export what the run produced to --dist, if given (see dist.py)."""
+    if args.dist is None:
+        return
+    files = await dist.export(client, since, args.dist)
+    print(f"Output: {args.dist}/ ({len(files)} files)")
+
+
+def attach_release_assets(args: argparse.Namespace, since: dict[Path, int]) -> None:
+    """Attach the release assets the run produced to --release-tag, if given (see github_release.py)."""
+    if not args.release_tag:
+        return
+    assets = github_release.assets(dist.produced(since))
+    if not assets:
+        print(f"No release assets were produced; nothing to attach to release {args.release_tag}")
+        return
+    names = ", ".join(asset.name for asset in assets)
+    try:
+        github_release.upload(args.release_tag, assets)
+    except (OSError, subprocess.CalledProcessError) as exc:
+        detail = (getattr(exc, "stderr", None) or str(exc)).strip()
+        message = f"could not attach {names} to release {args.release_tag}: {detail}"
+        raise exit_codes.RunFailed("release-upload", exit_codes.INFRASTRUCTURE, message) from exc
+    print(f"Attached {names} to release {args.release_tag}")
+
+
 async def main() -> None:
     parser = argparse.ArgumentParser(
-        description="Build RegicideOS COSMIC stage4, SquashFS, and optional encrypted QCOW2."
+        description="Build RegicideOS COSMIC stage4, SquashFS, and optional encrypted QCOW2.",
+        epilog=exit_codes.HELP,
+        formatter_class=argparse.RawDescriptionHelpFormatter,
     )
     parser.add_argument(
         "--arch",
@@ -507,15 +1488,670 @@ async def main() -> None:
         action="store_true",
         help="Build an unencrypted QCOW2 from the stage4 tarball and run stage8-vm-test.sh",
     )
+    parser.add_argument(
+        "--upgrade-test",
+        type=Path,
+        default=None,
+        metavar="PREVIOUS_QCOW2",
+        help="Boot PREVIOUS_QCOW2, apply the new stage4 tarball with regicide-image, and run stage9-upgrade-test.sh",
+    )
+    parser.add_argument(
+        "--image-diff",
+        action="store_true",
+        help="Diff the new image's packages, files and sizes against the previous build (reports/image-diff.md)",
+    )
     parser.add_argument(
         "--skip-sign",
         action="store_true",
         help="Skip Sigstore signing (useful for local test builds without cosign credentials)",
     )
+    parser.add_argument(
+        "--public-api-diff",
+        nargs="?",
+        const="origin/main",
+        default=None,
+        metavar="BASE_REF",
+        help="Diff library crate public APIs against BASE_REF (default: origin/main) and comment on the PR",
+    )
+    parser.add_argument(
+        "--dependency-trees",
+        action="store_true",
+        help="Export cargo tree output for the workspace and every feature variant",
+    )
+    parser.add_argument(
+        "--submit-dependencies",
+        action="store_true",
+        help="Submit --dependency-trees' resolved crate graph to GitHub's dependency graph"
+        " (needs GITHUB_REPOSITORY and gh)",
+    )
+    parser.add_argument(
+        "--cargo-deny",
+        action="store_true",
+        help="Check licenses, banned and duplicate crates against deny.toml with cargo-deny",
+    )
+    parser.add_argument(
+        "--duplicate-budget",
+        action="store_true",
+        help="Fail when crates resolve to more versions than duplicate-crates.toml allows",
+    )
+    parser.add_argument(
+        "--build-timings",
+        action="store_true",
+        help="Profile release builds of each component with cargo --timings",
+    )
+    parser.add_argument(
+        "--release-optimized",
+        action="store_true",
+        help="Build installer and btrmind with the thin-LTO release-optimized profile",
+    )
+    parser.add_argument(
+        "--cross-build",
+        nargs="*",
+        default=None,
+        choices=list(workspace_checks.CROSS_TARGETS),
+        metavar="TARGET",
+        help=f"Cross-compile installer and btrmind for TARGETs (default: {', '.join(workspace_checks.CROSS_TARGETS)})",
+    )
+    parser.add_argument(
+        "--static-binaries",
+        action="store_true",
+        help=f"Build fully static installer and btrmind binaries ({workspace_checks.STATIC_TARGET})"
+        " for rescue environments",
+    )
+    parser.add_argument(
+        "--sbom",
+        action="store_true",
+        help="Write CycloneDX and SPDX SBOMs of the Rust binaries with syft, and with --publish of the image, attested",
+    )
+    parser.add_argument(
+        "--pgo",
+        action="store_true",
+        help="With --release-optimized, apply profile-guided optimization to btrmind",
+    )
+    parser.add_argument(
+        "--rust-target",
+        choices=[workspace_checks.HOST_TARGET, *workspace_checks.CROSS_TARGETS],
+        default=workspace_checks.HOST_TARGET,
+        help=f"Rust target triple for --release-optimized (default: {workspace_checks.HOST_TARGET})",
+    )
+    parser.add_argument(
+        "--feature-powerset",
+        nargs="?",
+        const=2,
+        default=None,
+        type=int,
+        metavar="DEPTH",
+        help="Check every crate under all feature combinations up to DEPTH (default: 2) with cargo-hack",
+    )
+    parser.add_argument(
+        "--repro",
+        metavar="RUN/STAGE",
+        default=None,
+        help="Re-run only the failed step recorded in a failure bundle's triage manifest",
+    )
+    parser.add_argument(
+        "--nightly",
+        action="store_true",
+        help="Mark this as a nightly run: failures open or update a GitHub issue",
+    )
+    parser.add_argument(
+        "--compare",
+        nargs=2,
+        metavar=("RUN_A", "RUN_B"),
+        default=None,
+        help="Compare stage durations and artifacts of two previous runs, then exit",
+    )
+    parser.add_argument(
+        "--trends",
+        nargs="?",
+        const=20,
+        default=None,
+        type=int,
+        metavar="N",
+        help="Write duration, coverage, and size trend tables and charts over the last N runs (default: 20), then exit",
+    )
+    parser.add_argument(
+        "--stream",
+        action="store_true",
+        help="Stream exec output live with plain progress, announcing each exec with its stage name",
+    )
+    parser.add_argument(
+        "--timings",
+        type=Path,
+        metavar="FILE",
+        help="Also write the end-of-run stage timing table to FILE",
+    )
+    parser.add_argument(
+        "--dist",
+        nargs="?",
+        type=Path,
+        const=Path("dist"),
+        default=None,
+        metavar="DIR",
+        help="When the run passes, export the binaries and reports it produced to DIR (default: ./dist)",
+    )
+    parser.add_argument(
+        "--source",
+        type=Path,
+        default=Path(os.environ.get("REGICIDE_SOURCE", source_layout.DEFAULT_ROOT)),
+        metavar="DIR",
+        help="Repository root to build (default: $REGICIDE_SOURCE, else the checkout this script is in)",
+    )
+    parser.add_argument(
+        "--image-overrides",
+        type=Path,
+        metavar="FILE",
+        help="Replace stages' base images as FILE's [images] and [stages.<stage>] tables say (see image_overrides.py)",
+    )
+    parser.add_argument(
+        "--image-override",
+        action="append",
+        default=[],
+        metavar="[STAGE::]REF=IMAGE",
+        help="Pull IMAGE wherever the pipeline (or only STAGE) pulls REF (repeatable; wins over --image-overrides)",
+    )
+    parser.add_argument(
+        "--component",
+        action="append",
+        default=[],
+        metavar="NAME=PATH",
+        help="Take a component from PATH instead of its layout.toml subpath (repeatable)",
+    )
+    parser.add_argument(
+        "--source-exclude",
+        action="append",
+        default=[],
+        metavar="GLOB",
+        help="Also leave GLOB out of the source uploaded to the engine (repeatable)",
+    )
+    parser.add_argument(
+        "--source-include",
+        action="append",
+        default=[],
+        metavar="GLOB",
+        help="Upload only source matching GLOB (repeatable)",
+    )
+    parser.add_argument(
+        "--no-gitignore",
+        action="store_true",
+        help="Upload files .gitignore ignores too",
+    )
+    parser.add_argument(
+        "--overlay-tests",
+        action="store_true",
+        help="Run the regicide-rust overlay tests against a binhost serving the binpkgs cache",
+    )
+    parser.add_argument(
+        "--overlay-deep-tests",
+        action="store_true",
+        help="Install, reinstall and uninstall every regicide-tools package, checking installed files and hooks",
+    )
+    parser.add_argument(
+        "--pkgcheck",
+        action="store_true",
+        help="Run pkgcheck scan on the regicide-rust overlay, failing on any error or warning",
+    )
+    parser.add_argument(
+        "--pkgcheck-keywords",
+        metavar="FILTER",
+        help="pkgcheck --keywords filter to use instead of the overlay's metadata/pkgcheck.conf,"
+        " e.g. -RedundantVersion",
+    )
+    parser.add_argument(
+        "--manifest-check",
+        action="store_true",
+        help="Regenerate the regicide-rust overlay's Manifests from fresh distfiles"
+        " and fail if a committed one differs",
+    )
+    parser.add_argument(
+        "--binpkg-channel",
+        action="store_true",
+        help="Deep-test the regicide-rust overlay's binpkgs and push them to ghcr.io as a signed OCI artifact (ORAS)",
+    )
+    parser.add_argument(
+        "--smoke-test-image",
+        metavar="REF",
+        help="Pull a published btrmind image by digest (NAME@sha256:...) and run --version, config and analyze in it",
+    )
+    parser.add_argument(
+        "--security-scan",
+        action="store_true",
+        help="Run cargo-audit, trivy, gitleaks, osv-scanner and hadolint concurrently"
+        " and gate on their merged findings",
+    )
+    parser.add_argument(
+        "--security-threshold",
+        choices=security_scan.SEVERITIES[1:],
+        default="high",
+        help="Lowest severity that fails --security-scan, for scanners security-policy.toml"
+        " sets no threshold for (default: high)",
+    )
+    parser.add_argument(
+        "--upload-sarif",
+        action="store_true",
+        help="Upload --security-scan's trivy and gitleaks SARIF to GitHub code scanning"
+        " (needs GITHUB_REPOSITORY and gh)",
+    )
+    parser.add_argument(
+        "--hadolint-soft-fail",
+        action="store_true",
+        help="Report --security-scan's hadolint findings without gating on them, for local runs",
+    )
+    parser.add_argument(
+        "--scan-history",
+        action="store_true",
+        help="Have --security-scan's gitleaks scan every commit of the clone, not just the working tree",
+    )
+    parser.add_argument(
+        "--check-image-labels",
+        metavar="REF",
+        help="Fail unless the published image REF carries the labels oci-label-policy.toml requires",
+    )
+    parser.add_argument(
+        "--overlay-openrc-tests",
+        action="store_true",
+        help="Emerge every regicide-tools package on an OpenRC stage3 and check its init scripts",
+    )
+    parser.add_argument(
+        "--ebuild-versions",
+        nargs="?",
+        const="auto",
+        default=None,
+        metavar="BASE_REF",
+        help="Fail when a crate version changed since BASE_REF (default: the PR base, else the latest tag)"
+        " without a matching regicide-rust ebuild, or when ebuild versions drift from crate versions",
+    )
+    parser.add_argument(
+        "--release-notes",
+        nargs="?",
+        const="Unreleased",
+        default=None,
+        metavar="VERSION",
+        help="Aggregate component changelogs into release notes for VERSION (default: Unreleased), then exit",
+    )
+    parser.add_argument(
+        "--release-tag",
+        metavar="TAG",
+        help="Attach the SBOM and static binaries the run produced to GitHub release TAG when it passes;"
+        " with --release-notes, make the notes its body and attach them instead (needs gh)",
+    )
+    parser.add_argument(
+        "--rustfmt",
+        action="store_true",
+        help="Fail fast, before cargo check and the build, if any workspace crate is not rustfmt-formatted",
+    )
+    parser.add_argument(
+        "--clippy",
+        action="store_true",
+        help="Lint installer and btrmind with cargo clippy --all-targets, failing on any warning",
+    )
+    parser.add_argument(
+        "--clippy-warn",
+        action="store_true",
+        help="Report --clippy warnings without failing (for local runs)",
+    )
+    parser.add_argument(
+        "--cargo-tests",
+        action="store_true",
+        help="Run the installer and btrmind tests with cargo-nextest and export JUnit XML",
+    )
+    parser.add_argument(
+        "--test-impact",
+        nargs="?",
+        const="auto",
+        default=None,
+        metavar="BASE_REF",
+        help="Run only the tests of crates changed since BASE_REF and their dependents "
+        "(default: the PR's base; every test on main)",
+    )
+    parser.add_argument(
+        "--coverage",
+        action="store_true",
+        help="Measure installer and btrmind line coverage with cargo-llvm-cov and export LCOV",
+    )
+    parser.add_argument(
+        "--upload-coverage",
+        nargs="?",
+        const="codecov",
+        default=None,
+        choices=sorted(coverage_upload.SERVICES),
+        metavar="SERVICE",
+        help="Upload --coverage's report to codecov (default) or coveralls; skipped without the service's token",
+    )
+    parser.add_argument(
+        "--test-shards",
+        type=int,
+        default=1,
+        metavar="N",
+        help="Split --cargo-tests across N parallel containers after one shared build (default: 1)",
+    )
+    parser.add_argument(
+        "--installer-tui-tests",
+        action="store_true",
+        help="Drive the interactive installer on a PTY and diff its screens against golden snapshots",
+    )
+    parser.add_argument(
+        "--cli-golden",
+        action="store_true",
+        help="Diff --help, --version, and error output of every binary with tests/cli/golden/",
+    )
+    parser.add_argument(
+        "--generate-docs",
+        action="store_true",
+        help="Generate man pages and bash/zsh/fish completions from the clap CLIs into output/docs/",
+    )
+    parser.add_argument(
+        "--btrmind-simulation",
+        action="store_true",
+        help="Replay recorded disk-pressure traces through btrmind and check its actions against expected policies",
+    )
+    parser.add_argument(
+        "--config-migration",
+        nargs="?",
+        const="",
+        default=None,
+        metavar="PREVIOUS_REF",
+        help="Check that configs from released btrmind versions load with the current binary "
+        "(default PREVIOUS_REF: latest btrmind-v* tag)",
+    )
+    parser.add_argument(
+        "--non-btrfs-tests",
+        action="store_true",
+        help="Check that btrmind refuses to act on ext4 and xfs loopback mounts",
+    )
+    parser.add_argument(
+        "--locale-matrix",
+        action="store_true",
+        help="Run the installer and btrmind CLIs under odd locales, timezones, and an empty environment",
+    )
+    parser.add_argument(
+        "--readonly-root-tests",
+        action="store_true",
+        help="Run btrmind with its shipped config on a read-only root with tmpfs /var and fail on forbidden writes",
+    )
+    parser.add_argument(
+        "--lockfile-drift",
+        action="append_const",
+        dest="declared",
+        const="lockfile-drift",
+        default=[],
+        help="Fail unless Cargo.lock is committed, in sync with Cargo.toml, and unchanged by a build"
+        " (same as --stage lockfile-drift)",
+    )
+    parser.add_argument(
+        "--systemd-declarations",
+        action="append_const",
+        dest="declared",
+        const="systemd-declarations",
+        default=[],
+        help="Validate the agents' sysusers.d and tmpfiles.d files with systemd-sysusers and systemd-tmpfiles"
+        " (same as --stage systemd-declarations)",
+    )
+    parser.add_argument(
+        "--stage",
+        action="append",
+        default=[],
+        metavar="NAME[,NAME...]",
+        help="Run only the named stages, declared ones after the stages they need (repeatable; see --list-stages)",
+    )
+    parser.add_argument(
+        "--skip",
+        action="append",
+        default=[],
+        metavar="NAME[,NAME...]",
+        help="Drop the named stages from the ones the other flags select (repeatable; see --list-stages)",
+    )
+    parser.add_argument(
+        "--list-stages",
+        action="store_true",
+        help="List every stage --stage and --skip accept and exit",
+    )
+    parser.add_argument(
+        "--syscall-audit",
+        action="store_true",
+        help="Trace btrmind with strace and fail on syscalls outside its systemd unit's SystemCallFilter=",
+    )
+    parser.add_argument(
+        "--btrmind-preview",
+        action="store_true",
+        help="Build btrmind and open a shell beside it on a disposable loopback BTRFS, then exit"
+        " (needs the interactive TUI)",
+    )
+    parser.add_argument(
+        "--queue",
+        action="store_true",
+        help="Wait for a run sharing this run's cache volumes to finish instead of failing (see run_lock.py)",
+    )
+    parser.add_argument(
+        "--skip-superseded",
+        action="store_true",
+        help="With --queue, skip this run if a later run of the same branch queued behind it",
+    )
+    parser.add_argument(
+        "--no-lock",
+        action="store_true",
+        help="Run without taking the run lock",
+    )
+    parser.add_argument(
+        "--memoize",
+        action="store_true",
+        help="Skip stages whose inputs match an earlier passing run and reuse its outputs (see stage_memo.py)",
+    )
+    parser.add_argument(
+        "--publish",
+        action="store_true",
+        help="Build the btrmind container image, push it to ghcr.io tagged with the commit and version,"
+        " and smoke-test it",
+    )
+    parser.add_argument(
+        "--benchmarks",
+        nargs="?",
+        type=int,
+        const=10,
+        default=None,
+        metavar="RUNS",
+        help="Time btrmind on each simulation trace RUNS times (default 10); on PRs, comment a comparison with main",
+    )
+    parser.add_argument(
+        "--soak",
+        nargs="?",
+        type=int,
+        const=7200,
+        default=None,
+        metavar="SECONDS",
+        help="Run btrmind against a churn generator for SECONDS (default 7200) and check memory, actions, and errors",
+    )
+    parser.add_argument(
+        "--gpu-tests",
+        action="store_true",
+        help="Run the AI agent tests, including GPU-only ones, with GPUs passed through (skipped without a GPU)",
+    )
+    parser.add_argument(
+        "--dev",
+        action="store_true",
+        help="Fast local loop: incremental debug builds, workspace checks only, no release-only steps",
+    )
+    parser.add_argument(
+        "--skip-cargo-check",
+        action="store_true",
+        help="Skip the cargo check stage that otherwise runs before everything else",
+    )
+    parser.add_argument(
+        "--parallel",
+        type=int,
+        default=1,
+        metavar="N",
+        help="Run up to N independent check stages at once (default: 1, one after another)",
+    )
+    parser.add_argument(
+        "--checks-only",
+        action="store_true",
+        help="Run only the requested workspace checks and skip the OS image build",
+    )
     args = parser.parse_args()
+    # Paths on the command line are relative to where the pipeline was
+    # started; everything after use_root() resolves against the source root.
+    for name, value in vars(args).items():
+        if isinstance(value, Path):
+            setattr(args, name, value.resolve())
+    try:
+        for spec in args.component:
+            source_layout.override(spec)
+        if args.image_overrides:
+            image_overrides.load(args.image_overrides)
+        for spec in args.image_override:
+            image_overrides.add(spec)
+        source_layout.use_root(args.source)
+        if args.dist is not None:
+            dist.check(args.dist)
+    except ValueError as exc:
+        parser.error(str(exc))
+    try:
+        args.declared_stages = declared_stages.load()
+        args.declared = declared_stages.order(
+            args.declared_stages, stage_selection.apply(parser, args, args.declared_stages)
+        )
+        needed = [name for name in stage_selection.names(args.skip) if name in args.declared]
+        if needed:
+            raise ValueError(f"cannot skip {', '.join(needed)}: a selected stage needs it")
+    except ValueError as exc:
+        parser.error(str(exc))
+    if args.skip_superseded and not args.queue:
+        parser.error("--skip-superseded requires --queue")
+    if args.queue and args.no_lock:
+        parser.error("--queue and --no-lock are mutually exclusive")
+    if args.upload_coverage and not args.coverage:
+        parser.error("--upload-coverage requires --coverage")
+    if args.test_shards != 1 and not args.cargo_tests:
+        parser.error("--test-shards requires --cargo-tests")
+    if args.test_impact and not args.cargo_tests:
+        parser.error("--test-impact requires --cargo-tests")
+    if args.test_shards < 1:
+        parser.error("--test-shards must be at least 1")
+    if args.clippy_warn and not args.clippy:
+        parser.error("--clippy-warn requires --clippy")
+    if args.upload_sarif and not args.security_scan:
+        parser.error("--upload-sarif requires --security-scan")
+    if args.scan_history and not args.security_scan:
+        parser.error("--scan-history requires --security-scan")
+    if args.pkgcheck_keywords and not args.pkgcheck:
+        parser.error("--pkgcheck-keywords requires --pkgcheck")
+    if args.hadolint_soft_fail and not args.security_scan:
+        parser.error("--hadolint-soft-fail requires --security-scan")
+    if args.hadolint_soft_fail:
+        advisory.add("security-hadolint")
+    if args.security_scan:
+        try:
+            security_scan.load_policy()
+            security_scan.trivy_ignores()
+        except ValueError as exc:
+            parser.error(str(exc))
+    if args.submit_dependencies and not args.dependency_trees:
+        parser.error("--submit-dependencies requires --dependency-trees")
+    if args.pgo and not args.release_optimized:
+        parser.error("--pgo requires --release-optimized")
+    if args.pgo and args.rust_target != workspace_checks.HOST_TARGET:
+        parser.error("--pgo trains btrmind by running it, so it needs the host --rust-target")
+    if args.parallel < 1:
+        parser.error("--parallel must be at least 1")
+    if args.publish and publish.credentials() is None:
+        parser.error("--publish needs GHCR_TOKEN or GITHUB_TOKEN, and GHCR_USER or GITHUB_ACTOR")
+    if args.binpkg_channel and publish.credentials() is None:
+        parser.error("--binpkg-channel needs GHCR_TOKEN or GITHUB_TOKEN, and GHCR_USER or GITHUB_ACTOR")
+    if args.image_diff and args.checks_only:
+        parser.error("--image-diff diffs the OS image, which --checks-only skips")
+    if args.benchmarks is not None and args.benchmarks < 2:
+        parser.error("--benchmarks needs at least 2 runs per trace")
+    if args.dev:
+        release_only = [
+            flag for flag, given in [
+                ("--release-optimized", args.release_optimized),
+                ("--build-timings", args.build_timings),
+                ("--soak", args.soak is not None),
+                ("--nightly", args.nightly),
+            ] if given
+        ]
+        if release_only:
+            parser.error(f"--dev skips release-only steps; drop {', '.join(release_only)}")
+        # The OS image build, SquashFS and signing are release-only too.
+        args.checks_only = True
+    if not args.checks_only and not host_platform.builds_images():
+        parser.error(
+            "the OS image stages run host tools (sudo, mksquashfs, stage7-verify.sh) and need a Linux host;"
+            " pass --checks-only"
+        )
+    try:
+        cache_namespace = cache_keys.namespace()
+    except ValueError as exc:
+        parser.error(str(exc))
+    if args.smoke_test_image and "@sha256:" not in args.smoke_test_image:
+        parser.error("--smoke-test-image needs a digest reference (NAME@sha256:...), not a tag")
+
+    if args.repro:
+        try:
+            args.repro_manifest = failure_bundle.load_manifest(args.repro)
+        except FileNotFoundError:
+            parser.error(f"no failure bundle manifest for {args.repro}")
+        if not args.repro_manifest.get("container"):
+            parser.error(f"{args.repro} predates step replay; re-run its pipeline_argv instead")
+
+    if args.list_stages:
+        for name in stage_selection.all_stages(args.declared_stages):
+            print(stage_selection.describe(name, args.declared_stages))
+        sys.exit(0)
+
+    run_history.record_fingerprint(fingerprint.environment())
+    run_history.record_commit(build_info.git_sha())
+    run_history.record_branch(build_info.branch())
+
+    if args.compare:
+        try:
+            print(run_history.compare(*args.compare))
+        except FileNotFoundError as exc:
+            print(f"Error: no run summary: {exc.filename}", file=sys.stderr)
+            sys.exit(exit_codes.CONFIG_ERROR)
+        sys.exit(0)
+
+    if args.trends is not None:
+        _write_report(workspace_checks.REPORTS_DIR / "trends.md", run_history.trends(args.trends) + "\n")
+        for chart_path in trend_charts.write(args.trends, workspace_checks.REPORTS_DIR):
+            print(f"Output: {chart_path}")
+        sys.exit(0)
+
+    if args.release_notes is not None:
+        report_path = _write_report(
+            workspace_checks.REPORTS_DIR / "release-notes.md", release_notes.release_notes(args.release_notes)
+        )
+        if args.release_tag:
+            try:
+                github_release.set_notes(args.release_tag, report_path)
+                github_release.upload(args.release_tag, [report_path])
+            except (OSError, subprocess.CalledProcessError) as exc:
+                print(f"Error: could not attach the notes to release {args.release_tag}: "
+                      f"{getattr(exc, 'stderr', '') or exc}", file=sys.stderr)
+                sys.exit(exit_codes.INFRASTRUCTURE)
+            print(f"Attached the release notes to release {args.release_tag}")
+        sys.exit(0)
 
     if args.plain:
         os.environ["DAGGER_PROGRESS"] = "plain"
+    if args.nightly:
+        os.environ["REGICIDE_NIGHTLY"] = "1"
+    if args.dev:
+        os.environ["REGICIDE_DEV"] = "1"
+    if args.stream:
+        os.environ["DAGGER_PROGRESS"] = "plain"
+        os.environ["REGICIDE_STREAM_EXEC"] = "1"
+    if args.timings:
+        os.environ["REGICIDE_TIMINGS_FILE"] = str(args.timings.resolve())
+    if args.source_exclude:
+        os.environ["REGICIDE_SOURCE_EXCLUDE"] = ",".join(args.source_exclude)
+    if args.source_include:
+        os.environ["REGICIDE_SOURCE_INCLUDE"] = ",".join(args.source_include)
+    if args.no_gitignore:
+        os.environ["REGICIDE_SOURCE_GITIGNORE"] = "0"
+    if args.memoize:
+        os.environ["REGICIDE_MEMOIZE"] = "1"
 
     tarball_path: Path | None = None
     squashfs_input: Path | None = None
@@ -523,14 +2159,21 @@ async def main() -> None:
         tarball_path = args.from_tarball.resolve()
         if not tarball_path.is_file():
             print(f"Error: --from-tarball file not found: {tarball_path}", file=sys.stderr)
-            sys.exit(1)
+            sys.exit(exit_codes.CONFIG_ERROR)
     if args.from_squashfs:
         squashfs_input = args.from_squashfs.resolve()
         if not squashfs_input.is_file():
             print(f"Error: --from-squashfs file not found: {squashfs_input}", file=sys.stderr)
-            sys.exit(1)
+            sys.exit(exit_codes.CONFIG_ERROR)
+
+    events.start_run(sys.argv)
+    if not args.no_lock:
+        run_lock.acquire(run_lock.key(), queue=args.queue, skip_superseded=args.skip_superseded)
 
-    config = dagger.Config(log_output=sys.stdout)
+    if cache_namespace:
+        print(f"Cache volumes namespaced as *-{cache_namespace} ({cache_keys.strategy()})")
+    host_platform.configure()
+    config = dagger.Config(log_output=failure_bundle.engine_log(sys.stdout))
     os.environ.setdefault("DAGGER_CLOUD_ORG", _dagger_cloud_org())
     # DAGGER_CLOUD_TOKEN selects the Dagger Cloud organization; ensure it points
     # to the RegicideOS org rather than any previously-configured org.
@@ -539,13 +2182,37 @@ async def main() -> None:
             "WARNING: DAGGER_CLOUD_TOKEN is not set; Dagger Cloud traces will not be sent.",
             file=sys.stderr,
         )
-    async with dagger.Connection(config) as client:
+    async with dagger.Connection(config) as client, toolchain_report.probing(client):
+        if args.btrmind_preview:
+            print("Starting the btrmind preview (exit the shell to tear it down)...")
+            await workspace_checks.btrmind_preview(client)
+            return
+        if args.repro:
+            await repro(client, args.repro, args.repro_manifest)
+            return
+        produced_since = stage_memo.snapshot()
+        publishing = await run_workspace_checks(client, args)
+        if args.checks_only:
+            await run_stages(publishing, args.parallel)
+            print(f"Output: {provenance.write(produced_since)}")
+            await export_dist(client, args, produced_since)
+            attach_release_assets(args, produced_since)
+            return
+
+        memoized = False
+        if tarball_path is None and stage_memo.enabled():
+            reused = stage_memo.reuse("os-image")
+            if reused:
+                tarball_path, memoized = reused[0], True
         if tarball_path is None:
             print(f"Building RegicideOS COSMIC stage4 ({args.arch})...")
-            build_container = await build_cosmic(client, arch=args.arch)
+            async with events.stage("os-image"):
+                build_container = await build_cosmic(client, arch=args.arch)
             tarball = build_container.file(
                 f"/src/build-system/catalyst/output/stage4-{args.arch}-systemd-cosmic.tar.xz"
             )
+        elif memoized:
+            tarball = client.host().file(str(tarball_path))
         else:
             print(f"Using existing stage4 tarball: {tarball_path}")
             tarball = client.host().file(str(tarball_path))
@@ -556,29 +2223,37 @@ async def main() -> None:
 
         if tarball_path is None:
             print("Exporting stage4 tarball...")
+            _interrupt_cleanup.add(out_dir / f"stage4-{args.arch}-systemd-cosmic.tar.xz")
             await tarball.export(str(out_dir / f"stage4-{args.arch}-systemd-cosmic.tar.xz"))
+            _interrupt_cleanup.clear()
+            artifacts.validate("stage4", arch=args.arch)
             print(f"Output: build-system/catalyst/output/stage4-{args.arch}-systemd-cosmic.tar.xz")
             tarball_path = out_dir / f"stage4-{args.arch}-systemd-cosmic.tar.xz"
+            if stage_memo.enabled():
+                stage_memo.remember("os-image", [tarball_path])
+        run_history.record_artifact("stage4-tarball", tarball_path)
+        print(f"Output: {build_info.write('release')}")
+        await toolchain_report.probe(client)
+        print(f"Output: {toolchain_report.write(toolchain_report.RELEASE_PATH)}")
 
         print("Loading SBOM for signing...")
-        subprocess.run(
-            ["./build-system/catalyst/stages/stage7-sbom.sh"],
-            check=True,
-        )
+        _run_host("stage7-sbom", ["./build-system/catalyst/stages/stage7-sbom.sh"])
+        artifacts.validate("sbom")
         sbom_path = out_dir / "sbom.spdx.json"
+        run_history.record_artifact("sbom", sbom_path)
 
         squashfs_path = out_dir / "regicide-cosmic.img"
+        if squashfs_input is None or squashfs_input.resolve() != squashfs_path.resolve():
+            _interrupt_cleanup.add(squashfs_path)
+        _interrupt_cleanup.add(Path("/var/tmp/regicide-squashfs-root"))
         if squashfs_input is not None:
             print(f"Using existing SquashFS image: {squashfs_input}")
             if squashfs_input.resolve() != squashfs_path.resolve():
-                subprocess.run(
-                    ["cp", "-f", str(squashfs_input), str(squashfs_path)],
-                    check=True,
-                )
+                _run_host("squashfs", ["cp", "-f", str(squashfs_input), str(squashfs_path)])
             else:
                 print("SquashFS input path matches output path; reusing in place.")
         else:
-            if os.geteuid() != 0:
+            if not host_platform.is_root():
                 # Not root: build the SquashFS inside the Dagger engine (which
                 # is privileged) instead of requiring passwordless host sudo.
                 # This matches the RegicideOSArch pipeline flow.
@@ -589,7 +2264,8 @@ async def main() -> None:
                 print("Creating SquashFS image locally...")
                 # Creating a faithful SquashFS that preserves setuid binaries and
                 # mixed ownership requires root privileges. Use sudo when not root.
-                subprocess.run(
+                _run_host(
+                    "squashfs",
                     [
                         "sh", "-c",
                         # Use /var/tmp for the extracted rootfs so large artifacts do
@@ -609,21 +2285,35 @@ async def main() -> None:
                         f"unsquashfs -s '{squashfs_path}' >/dev/null; "
                         "rm -rf \"$SQUASH_ROOT\" || true",
                     ],
-                    check=True,
                 )
+        _interrupt_cleanup.clear()
+        artifacts.validate("squashfs")
         print(f"Output: {squashfs_path}")
+        run_history.record_artifact("squashfs", squashfs_path)
 
         print("Running stage7 verification on host artifacts...")
-        subprocess.run(
-            ["./build-system/catalyst/stages/stage7-verify.sh"],
-            check=True,
-        )
+        _run_host("stage7-verify", ["./build-system/catalyst/stages/stage7-verify.sh"])
+
+        if args.image_diff:
+            print(f"Listing the stage4 rootfs ({args.arch}) for the image diff...")
+            async with events.stage("image-diff"):
+                listing = await image_diff.listing(client, client.host().file(str(tarball_path)))
+            image = image_diff.manifest(listing, args.arch, {
+                "stage4 tarball": tarball_path.stat().st_size,
+                "SquashFS": squashfs_path.stat().st_size,
+            })
+            print(f"Output: {image_diff.record(image)}")
+            found = image_diff.previous(args.arch)
+            if found is None:
+                print(f"No earlier {args.arch} image to compare against")
+            else:
+                report, file_list = image_diff.report(*found, image)
+                report_path = _write_report(workspace_checks.REPORTS_DIR / "image-diff.md", report)
+                (workspace_checks.REPORTS_DIR / "image-diff-files.txt").write_text(file_list)
+                image_diff.publish(report_path)
 
         if not args.skip_sign:
-            identity = os.environ.get(
-                "REGICIDE_SIGN_IDENTITY",
-                "https://github.com/RegicideOS/RegicideOS/.github/workflows/release.yml@refs/heads/main",
-            )
+            identity = signing.IDENTITY
             print(f"Signing artifacts with identity: {identity}")
             iso_image = client.host().file(str(out_dir / "regicide-cosmic.img"))
             sbom_file = client.host().file(str(sbom_path))
@@ -645,6 +2335,7 @@ async def main() -> None:
             if img_cert is not None:
                 await img_cert.export(str(out_dir / "regicide-cosmic.img.cert"))
                 await sbom_cert.export(str(out_dir / "sbom.spdx.json.cert"))
+            artifacts.validate("sign")
 
             print("Output: build-system/catalyst/output/regicide-cosmic.img.sig")
             print("Output: build-system/catalyst/output/regicide-cosmic.img.bundle")
@@ -655,7 +2346,28 @@ async def main() -> None:
             if sbom_cert is not None:
                 print("Output: build-system/catalyst/output/sbom.spdx.json.cert")
             print("Output: build-system/catalyst/output/regicide-cosmic.img.att")
+
+            tarball_bundle = out_dir / f"{tarball_path.name}.bundle"
+            await (
+                await signing.sign_blob(client, client.host().file(str(tarball_path)), tarball_path.name)
+            ).export(str(tarball_bundle))
+            run_history.record_artifact("stage4-tarball-bundle", tarball_bundle)
+            print(f"Output: {tarball_bundle}")
+
+            signed = [
+                {
+                    "file": out_dir / name,
+                    "bundle": out_dir / f"{name}.bundle",
+                    "signature": out_dir / f"{name}.sig",
+                    "certificate": out_dir / f"{name}.cert" if img_cert is not None else None,
+                }
+                for name in ("regicide-cosmic.img", "sbom.spdx.json")
+            ]
+            signed.append({"file": tarball_path, "bundle": tarball_bundle, "signature": None, "certificate": None})
+            print(f"Output: {signing.record_signed(out_dir, run_history.run_id(), signed)}")
         else:
+            # A listing left by an earlier run would vouch for files this run did not sign.
+            (out_dir / signing.SIGNED).unlink(missing_ok=True)
             print("Skipping Sigstore signing (--skip-sign)")
 
         if args.encrypt:
@@ -676,11 +2388,68 @@ async def main() -> None:
                 encrypt=False,
             )
             print("Running stage8 post-install VM test...")
-            subprocess.run(
-                ["./build-system/catalyst/stages/stage8-vm-test.sh", str(qcow2_path)],
-                check=True,
+            _run_host("stage8-vm-test", ["./build-system/catalyst/stages/stage8-vm-test.sh", str(qcow2_path)])
+
+        if args.upgrade_test:
+            print(f"Running stage9 upgrade-path VM test from {args.upgrade_test}...")
+            _run_host(
+                "stage9-upgrade-test",
+                [
+                    "./build-system/catalyst/stages/stage9-upgrade-test.sh",
+                    str(args.upgrade_test.resolve()),
+                    str(tarball_path),
+                ],
             )
 
+        await run_stages(publishing, args.parallel)
+        print(f"Output: {provenance.write(produced_since)}")
+        await export_dist(client, args, produced_since)
+        attach_release_assets(args, produced_since)
+
 
 if __name__ == "__main__":
-    asyncio.run(main())
+    # CI cancellation sends SIGTERM; treat it like Ctrl-C so the Dagger
+    # session is closed (cancelling in-flight execs) and cleanup runs.
+    signal.signal(signal.SIGTERM, signal.default_int_handler)
+    try:
+        asyncio.run(main())
+        _finish("passed")
+    except KeyboardInterrupt:
+        print("Interrupted; cancelling Dagger execs and cleaning up...", file=sys.stderr)
+        _cleanup_interrupted()
+        _finish("cancelled")
+        sys.exit(exit_codes.CANCELLED)
+    except failure_bundle.StageFailed as exc:
+        _fail(exc, exit_codes.for_failure(exc))
+    except run_lock.Superseded as exc:
+        _finish("superseded")
+        print(f"Skipped: {exc}")
+    except artifacts.MissingArtifact as exc:
+        _fail(exc, exit_codes.STAGE_FAILED)
+    except workspace_checks.MissingLockfile as exc:
+        _fail(exc, exit_codes.STAGE_FAILED)
+    except oci_policy.PolicyViolation as exc:
+        _fail(exc, exit_codes.POLICY_GATE)
+    except exit_codes.RunFailed as exc:
+        _fail(exc, exc.exit_code)
+    except run_lock.Locked as exc:
+        _fail(exc, exit_codes.INFRASTRUCTURE)
+    except subprocess.CalledProcessError as exc:
+        # A host command outside _run_host, which names no step.
+        _fail(exc, exit_codes.STAGE_FAILED)
+    except dagger.ExecError as exc:
+        # An exec outside checked_exec, which records no step.
+        _fail(exc, exit_codes.STAGE_FAILED)
+    except dagger.DaggerError as exc:
+        _fail(exc, exit_codes.INFRASTRUCTURE, f"Dagger engine failure: {exc}")
+    except SystemExit as exc:
+        # A sys.exit() in main() after the run started still finishes it.
+        if events.running():
+            _finish("passed" if exc.code in (None, 0) else "failed")
+        raise
+    except Exception as exc:
+        # A bug in the pipeline itself: record and report it, and keep the traceback.
+        _finish("failed")
+        if os.environ.get("REGICIDE_NIGHTLY") == "1":
+            failure_issues.report_error(exc, exit_codes.STAGE_FAILED)
+        raise
@@ -0,0 +1,103 @@
+"""Declared stages - the interpreter for build-system/stages.toml.
+
+A declared stage is a base image, an optional workspace mount, packages,
+cache volumes, environment and a list of commands.  Each command runs
+through failure_bundle.checked_exec, so a declared stage fails, bundles
+diagnostics and records its timing exactly like a stage written in Python.
+"""
+
+import tomllib
+from pathlib import Path
+
+import dagger
+
+import cache_keys
+import workspace_checks
+from failure_bundle import checked_exec, from_image
+
+
+STAGES_PATH = Path(__file__).parent / "stages.toml"
+WORKSPACES = ("source", "git")
+_KEYS = {
+    "description", "image", "workspace", "paths", "apt", "caches", "shared_caches",
+    "env", "commands", "report", "needs", "privileged",
+}
+
+
+def load(path: Path = STAGES_PATH) -> dict[str, dict]:
+    """Return {stage name: declaration}, raising ValueError on a malformed file."""
+    with path.open("rb") as f:
+        stages = tomllib.load(f).get("stages", {})
+    for name, spec in stages.items():
+        unknown = set(spec) - _KEYS
+        if unknown:
+            raise ValueError(f"{path.name}: stage {name} has unknown keys: {', '.join(sorted(unknown))}")
+        for key in ("image", "commands"):
+            if key not in spec:
+                raise ValueError(f"{path.name}: stage {name} has no {key}")
+        if not all(isinstance(command, list) and command for command in spec["commands"]):
+            raise ValueError(f"{path.name}: stage {name}: each command must be a non-empty argv list")
+        if spec.get("workspace", "source") not in WORKSPACES:
+            raise ValueError(f"{path.name}: stage {name}: workspace must be one of {', '.join(WORKSPACES)}")
+        if "paths" in spec and spec.get("workspace") != "source":
+            raise ValueError(f"{path.name}: stage {name}: paths needs workspace = \"source\"")
+        for need in spec.get("needs", []):
+            if need not in stages:
+                raise ValueError(f"{path.name}: stage {name} needs unknown stage {need}")
+    return stages
+
+
+def order(stages: dict[str, dict], selected: list[str]) -> list[str]:
+    """Return selected plus everything they need, each after its needs.
+
+    Raises ValueError for an unknown stage or a dependency cycle.
+    """
+    ordered: list[str] = []
+    visiting: list[str] = []
+
+    def visit(name: str) -> None:
+        if name in ordered:
+            return
+        if name not in stages:
+            raise ValueError(f"unknown stage {name}; see --list-stages")
+        if name in visiting:
+            cycle = visiting[visiting.index(name):] + [name]
+            raise ValueError(f"stage dependency cycle: {' -> '.join(cycle)}")
+        visiting.append(name)
+        for need in stages[name].get("needs", []):
+            visit(need)
+        visiting.pop()
+        ordered.append(name)
+
+    for name in selected:
+        visit(name)
+    return ordered
+
+
+async def container(client: dagger.Client, name: str, spec: dict) -> dagger.Container:
+    """Return the container the commands of declared stage name run in."""
+    image = workspace_checks.rust_image() if spec["image"] == "rust" else spec["image"]
+    built = from_image(client, image)
+    shared = set(spec.get("shared_caches", []))
+    for path, volume in spec.get("caches", {}).items():
+        built = built.with_mounted_cache(path, cache_keys.volume(client, volume, shared=volume in shared))
+    if "workspace" in spec:
+        source = workspace_checks.workspace_source(
+            client, with_git=spec["workspace"] == "git", paths=spec.get("paths")
+        )
+        built = built.with_directory(workspace_checks.WORKSPACE, source).with_workdir(workspace_checks.WORKSPACE)
+    for name, value in spec.get("env", {}).items():
+        built = built.with_env_variable(name, value)
+    if spec.get("apt"):
+        built = await workspace_checks.with_apt_packages(built, name, *spec["apt"])
+    return built
+
+
+async def run(client: dagger.Client, name: str, spec: dict) -> str:
+    """Run a declared stage and return the last command's stdout."""
+    ran = await container(client, name, spec)
+    for command in spec["commands"]:
+        ran = await checked_exec(
+            ran, command, name, insecure_root_capabilities=spec.get("privileged", False)
+        )
+    return await ran.stdout()
@@ -0,0 +1,103 @@
+"""GitHub dependency submission - report the resolved crate graph to Dependabot.
+
+GitHub's dependency graph only reads Cargo.toml, so without a submission
+Dependabot does not alert on crates the workspace pulls in transitively.
+snapshot() turns `cargo metadata` into a Dependency Submission API
+snapshot of Cargo.lock, and submit() posts it for the commit being built.
+Path crates (the workspace members) are left out; registry and git crates
+are reported as package URLs, direct when a member depends on them, and
+development when only dev-dependencies reach them.
+"""
+
+import json
+import os
+import subprocess
+from datetime import datetime, timezone
+
+import build_info
+import exit_codes
+import run_history
+
+
+DETECTOR = {"name": "regicide-dagger-pipeline", "version": "1", "url": build_info.SOURCE_URL}
+CORRELATOR = "regicide-cargo"
+MANIFEST = "Cargo.lock"
+
+
+def _purl(package: dict) -> str:
+    return f"pkg:cargo/{package['name']}@{package['version']}"
+
+
+def snapshot(metadata: dict, sha: str, ref: str) -> dict:
+    """Return a Dependency Submission API snapshot for cargo metadata output."""
+    packages = {package["id"]: package for package in metadata["packages"]}
+    nodes = {node["id"]: node for node in metadata["resolve"]["nodes"]}
+    members = set(metadata["workspace_members"])
+
+    def edges(node_id: str, runtime_only: bool) -> list[str]:
+        return [
+            dep["pkg"] for dep in nodes[node_id]["deps"]
+            if not runtime_only or any(kind["kind"] != "dev" for kind in dep["dep_kinds"])
+        ]
+
+    # Crates reachable without following a member's dev-dependencies ship.
+    runtime, pending = set(), [dep for member in members for dep in edges(member, True)]
+    while pending:
+        node_id = pending.pop()
+        if node_id not in runtime:
+            runtime.add(node_id)
+            pending += edges(node_id, False)
+    direct = {dep for member in members for dep in edges(member, False)}
+
+    resolved = {}
+    for node_id, node in nodes.items():
+        package = packages[node_id]
+        if node_id in members or package["source"] is None:
+            continue
+        resolved[_purl(package)] = {
+            "package_url": _purl(package),
+            "relationship": "direct" if node_id in direct else "indirect",
+            "scope": "runtime" if node_id in runtime else "development",
+            "dependencies": sorted(
+                _purl(packages[dep]) for dep in edges(node_id, False) if packages[dep]["source"] is not None
+            ),
+        }
+    return {
+        "version": 0,
+        "sha": sha,
+        "ref": ref,
+        "job": {"correlator": CORRELATOR, "id": run_history.run_id()},
+        "detector": DETECTOR,
+        "scanned": datetime.now(timezone.utc).strftime("%Y-%m-%dT%H:%M:%SZ"),
+        "manifests": {
+            MANIFEST: {
+                "name": MANIFEST,
+                "file": {"source_location": MANIFEST},
+                "resolved": dict(sorted(resolved.items())),
+            },
+        },
+    }
+
+
+def submit(body: dict) -> None:
+    """Post a snapshot to the repository's dependency graph.
+
+    Uses the GitHub CLI with a token in GH_TOKEN/GITHUB_TOKEN that can
+    write contents.  Needs GITHUB_REPOSITORY.  Raises exit_codes.RunFailed
+    (infrastructure) with gh's error when the submission fails.
+    """
+    repository = os.environ.get("GITHUB_REPOSITORY")
+    if not repository:
+        print("GITHUB_REPOSITORY not set; not submitting dependencies")
+        return
+    try:
+        subprocess.run(
+            ["gh", "api", "--method", "POST", f"repos/{repository}/dependency-graph/snapshots", "--input", "-"],
+            input=json.dumps(body), check=True, text=True, capture_output=True,
+        )
+    except (OSError, subprocess.CalledProcessError) as exc:
+        detail = (getattr(exc, "stderr", None) or str(exc)).strip()
+        message = f"could not submit dependencies to {repository}: {detail}"
+        raise exit_codes.RunFailed("dependency-submission", exit_codes.INFRASTRUCTURE, message) from exc
+    crates = len(body["manifests"][MANIFEST]["resolved"])
+    print(f"Submitted {crates} crates to the GitHub dependency graph ({repository} {body['ref']})")
@@ -0,0 +1,59 @@
+"""Dist - gather the binaries and reports a run produced into one host directory.
+
+The stages export into build-system/catalyst/output/, next to the run
+history, failure bundles, multi-gigabyte images and whatever earlier runs
+left there.  With --dist DIR, a run that passes ends by exporting the
+files it wrote there, and those it reused through --memoize, to DIR
+(./dist by default) in the same layout: bin/ and static/ hold the
+installer and btrmind, reports/coverage/ the LCOV report, reports/security/
+the scan results, and so on, with provenance.intoto.json describing them
+all (provenance.py).  Disk images are left out.  DIR is replaced, so it
+never mixes two runs; a MARKER file records that it is a dist directory.
+check() refuses a DIR that the wipe could cost data in: a non-empty
+directory without the marker, the source root, $HOME, or a directory
+holding either.
+"""
+
+from pathlib import Path
+
+import dagger
+
+import artifacts
+import stage_memo
+
+
+# Disk images: too large to copy, and published from the output directory.
+IMAGE_SUFFIXES = (".img", ".tar.xz", ".qcow2")
+MARKER = ".regicide-dist"
+
+
+def check(dest: Path) -> None:
+    """Raise ValueError unless export() may replace dest; run from the source root."""
+    dest = dest.resolve()
+    for name, protected in (("the source root", Path.cwd()), ("$HOME", Path.home())):
+        if dest == protected.resolve() or dest in protected.resolve().parents:
+            raise ValueError(f"--dist {dest} would replace {name}")
+    if dest.exists() and not dest.is_dir():
+        raise ValueError(f"--dist {dest} is not a directory")
+    if dest.is_dir() and any(dest.iterdir()) and not (dest / MARKER).is_file():
+        raise ValueError(f"--dist {dest} is not empty and was not written by --dist; remove it or pick another")
+
+
+def produced(before: dict[Path, int]) -> list[Path]:
+    """Return the output files this run wrote since stage_memo.snapshot() returned before, or reused."""
+    files = {*stage_memo.changed(before), *stage_memo.reused()}
+    return sorted(path for path in files if not path.name.endswith(IMAGE_SUFFIXES) and path.is_file())
+
+
+async def export(client: dagger.Client, before: dict[Path, int], dest: Path) -> list[Path]:
+    """Export the files produced() returns to dest, replacing its contents, and return them.
+
+    Raises ValueError when check() refuses dest.
+    """
+    check(dest)
+    files = produced(before)
+    dist = client.directory().with_new_file(MARKER, "Written by dagger_pipeline.py --dist; replaced by each run.\n")
+    for path in files:
+        dist = dist.with_file(path.relative_to(artifacts.OUTPUT_DIR).as_posix(), client.host().file(str(path)))
+    await dist.export(str(dest), wipe=True)
+    return files
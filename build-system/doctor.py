@@ -0,0 +1,255 @@
+"""Doctor - check the host before a run, with a fix for each problem found.
+
+`ci.py doctor` checks what otherwise fails a run minutes in: the container
+runtime the Dagger CLI starts its engine with, the Dagger CLI and engine
+(by running a container), free disk space for the engine's cache volumes
+and the output directory, the privileges and host tools of the OS image
+and VM stages, and whether the registries and package hosts the stages
+pull from can be reached.  --for says what the run will do: workspace
+checks only, the OS image build too, or the VM stages (--encrypt,
+--run-vm-test, --upgrade-test) as well.  What only a bigger run needs
+warns instead of failing.
+"""
+
+import asyncio
+import json
+import os
+import shutil
+import subprocess
+import sys
+import urllib.error
+import urllib.request
+from pathlib import Path
+
+import dagger
+
+import artifacts
+import host_platform
+import image_lock
+import source_layout
+
+
+PURPOSES = ["checks", "image", "vm"]
+# Free GiB needed where the engine keeps its cache volumes and under the output directory.
+MIN_FREE_GIB = {"checks": 20, "image": 80, "vm": 100}
+ENGINE_TIMEOUT = 300
+NETWORK_TIMEOUT = 10
+# Any HTTP response, 401 included, means the host is reachable.
+ENDPOINTS = {
+    "Docker Hub": "https://registry-1.docker.io/v2/",
+    "ghcr.io": "https://ghcr.io/v2/",
+    "quay.io": "https://quay.io/v2/",
+    "crates.io": "https://index.crates.io/config.json",
+    "Gentoo distfiles": "https://distfiles.gentoo.org/",
+    "GitHub": "https://github.com/",
+}
+IMAGE_COMMANDS = ["tar", "xz", "mksquashfs", "unsquashfs"]
+VM_COMMANDS = ["qemu-img", "qemu-system-x86_64", "cpio", "zstd", "cryptsetup", "sshpass"]
+# Where the VM stages (catalyst/stages/vm-common.sh) look for UEFI firmware.
+OVMF_PATHS = [
+    "/usr/share/OVMF/OVMF_CODE.fd",
+    "/usr/share/edk2/ovmf/OVMF_CODE.fd",
+    "/usr/share/qemu/OVMF_CODE.fd",
+    "/usr/share/ovmf/x64/OVMF_CODE.fd",
+]
+
+OK, WARN, FAIL = "ok", "warn", "FAIL"
+
+# (status, check, what was found, how to fix it)
+Result = tuple[str, str, str, str]
+
+
+def _run(*args: str, timeout: int = 30) -> subprocess.CompletedProcess | None:
+    try:
+        return subprocess.run(args, capture_output=True, text=True, timeout=timeout)
+    except (OSError, subprocess.TimeoutExpired):
+        return None
+
+
+def _problem(needed_for: str, purpose: str) -> str:
+    """Return FAIL when this run needs the check to pass, else WARN."""
+    return FAIL if PURPOSES.index(needed_for) <= PURPOSES.index(purpose) else WARN
+
+
+def container_runtime() -> tuple[Result, str | None]:
+    """Check the Docker-compatible runtime; return the result and its data root."""
+    where = os.environ.get("DOCKER_HOST", "the default socket")
+    formats = [
+        ("docker", "{{.ServerVersion}} {{.DockerRootDir}}"),
+        ("podman", "{{.Version.Version}} {{.Store.GraphRoot}}"),
+    ]
+    for cli, root_format in formats:
+        if shutil.which(cli) is None:
+            continue
+        info = _run(cli, "info", "--format", root_format)
+        if info is None or info.returncode != 0:
+            error = (info.stderr.strip().splitlines() or ["timed out"])[-1] if info else "timed out"
+            return (FAIL, "container runtime", f"`{cli} info` failed at {where}: {error}", (
+                "Start Docker Desktop, Colima, OrbStack or Podman, or point DOCKER_HOST at its socket. "
+                "On Linux, add yourself to the docker group (`sudo usermod -aG docker $USER`) and log in again."
+            )), None
+        version, _, root = info.stdout.strip().partition(" ")
+        return (OK, "container runtime", f"{cli} {version} at {where}", ""), root or None
+    return (FAIL, "container runtime", "neither docker nor podman is on PATH", (
+        "Install Docker (https://docs.docker.com/engine/install/) or Podman; the Dagger CLI starts its engine with it."
+    )), None
+
+
+def dagger_cli() -> Result:
+    """Check the Dagger CLI against dagger.json's engineVersion."""
+    if shutil.which("dagger") is None:
+        return (FAIL, "dagger CLI", "dagger is not on PATH", "Install it: https://docs.dagger.io/install")
+    ran = _run("dagger", "version")
+    version = ran.stdout.split()[1] if ran and ran.returncode == 0 and len(ran.stdout.split()) > 1 else "unknown"
+    wanted = json.loads((source_layout.DEFAULT_ROOT / "dagger.json").read_text()).get("engineVersion", "")
+    if wanted and version != wanted:
+        return (WARN, "dagger CLI", f"dagger {version}; dagger.json pins {wanted}", (
+            f"Install {wanted} (https://docs.dagger.io/install) so the engine matches the one CI runs."
+        ))
+    return (OK, "dagger CLI", f"dagger {version}", "")
+
+
+async def dagger_engine() -> Result:
+    """Start (or connect to) the engine and run a container in it."""
+    async def probe() -> str:
+        async with dagger.Connection(dagger.Config(log_output=None)) as client:
+            await client.container().from_(image_lock.pinned("alpine:latest")).with_exec(["true"]).sync()
+            return await client.version()
+
+    try:
+        version = await asyncio.wait_for(probe(), ENGINE_TIMEOUT)
+    except (dagger.DaggerError, OSError, asyncio.TimeoutError) as exc:
+        detail = str(exc).strip().splitlines()[-1][:200] if str(exc).strip() else type(exc).__name__
+        return (FAIL, "dagger engine", f"could not run a container: {detail}", (
+            "Check the engine's logs with `docker logs $(docker ps -q --filter name=dagger-engine)`. "
+            "Remove a wedged engine with `docker rm -f` on that container; the next run starts a new one."
+        ))
+    return (OK, "dagger engine", f"engine {version} ran alpine", "")
+
+
+def _existing(path: Path) -> Path:
+    while not path.exists() and path != path.parent:
+        path = path.parent
+    return path
+
+
+def disk_space(runtime_root: str | None, purpose: str) -> list[Result]:
+    """Check the free space where the cache volumes and the outputs go."""
+    needed = MIN_FREE_GIB[purpose]
+    places = {"output directory": _existing((source_layout.DEFAULT_ROOT / artifacts.OUTPUT_DIR).resolve())}
+    if runtime_root and sys.platform == "linux":
+        places["engine cache volumes"] = _existing(Path(runtime_root))
+    results = []
+    for name, path in places.items():
+        try:
+            free = shutil.disk_usage(path).free / 2**30
+        except OSError:
+            # /var/lib/docker is root-only; its filesystem is usually /var/lib's.
+            free = shutil.disk_usage(path.parent).free / 2**30
+        if free >= needed:
+            results.append((OK, f"disk: {name}", f"{free:.1f} GiB free at {path}", ""))
+        else:
+            results.append((FAIL, f"disk: {name}", f"{free:.1f} GiB free at {path}; {purpose} runs need {needed} GiB", (
+                "Run `python build-system/ci.py gc` for old outputs, `dagger core engine local-cache prune` "
+                "for the engine cache and `docker system prune` for unused images."
+            )))
+    if runtime_root and sys.platform != "linux":
+        results.append((WARN, "disk: engine cache volumes", "the engine runs in a VM on this host", (
+            f"Give the Docker VM at least {needed} GiB of disk (Docker Desktop: Settings > Resources)."
+        )))
+    return results
+
+
+def privileges(purpose: str) -> list[Result]:
+    """Check the host, privileges and tools of the OS image and VM stages."""
+    results = []
+    if not host_platform.builds_images():
+        return [(_problem("image", purpose), "OS image stages", f"{sys.platform} host", (
+            "The OS image stages need a Linux host; run workspace checks only (--checks-only) here."
+        ))]
+    missing = [cmd for cmd in IMAGE_COMMANDS if shutil.which(cmd) is None]
+    if missing:
+        results.append((_problem("image", purpose), "OS image tools", f"missing {', '.join(missing)}", (
+            "Install squashfs-tools, tar and xz-utils with the host's package manager."
+        )))
+    if host_platform.is_root():
+        results.append((OK, "privileges", "running as root", ""))
+    else:
+        # stage7-verify.sh extracts the tarball on the host and checks file ownership.
+        results.append((_problem("image", purpose), "privileges", "not running as root", (
+            "Run the pipeline as root, e.g. `sudo -E python build-system/ci.py all`; "
+            "stage7 needs root to extract the rootfs with its owners."
+        )))
+    if not Path("/proc/sys/fs/binfmt_misc/qemu-aarch64").exists():
+        results.append((WARN, "arm64 emulation", "no qemu-aarch64 binfmt handler", (
+            "Only --arch arm64 needs it: `docker run --privileged --rm tonistiigi/binfmt --install arm64`."
+        )))
+    kvm = Path("/dev/kvm")
+    if not kvm.exists():
+        results.append((_problem("vm", purpose), "KVM", "/dev/kvm does not exist", (
+            "Enable virtualization in the firmware and load kvm_intel or kvm_amd;"
+            " nested VMs need nested virtualization."
+        )))
+    elif not os.access(kvm, os.R_OK | os.W_OK):
+        results.append((_problem("vm", purpose), "KVM", "/dev/kvm is not readable and writable", (
+            "Add yourself to the kvm group (`sudo usermod -aG kvm $USER`) and log in again."
+        )))
+    else:
+        results.append((OK, "KVM", "/dev/kvm is usable", ""))
+    missing = [cmd for cmd in VM_COMMANDS if shutil.which(cmd) is None]
+    if not any(Path(path).is_file() for path in OVMF_PATHS):
+        missing.append("OVMF firmware")
+    if missing:
+        results.append((_problem("vm", purpose), "VM tools", f"missing {', '.join(missing)}", (
+            "Install qemu (system and img), ovmf/edk2-ovmf, cpio, zstd, cryptsetup and sshpass."
+        )))
+    return results
+
+
+def _reach(url: str) -> str | None:
+    """Return None if url answers at all, else the error."""
+    try:
+        urllib.request.urlopen(urllib.request.Request(url, method="HEAD"), timeout=NETWORK_TIMEOUT).close()
+    except urllib.error.HTTPError:
+        return None
+    except (urllib.error.URLError, OSError) as exc:
+        return str(getattr(exc, "reason", exc))
+    return None
+
+
+def network() -> list[Result]:
+    """Check that every registry and package host answers."""
+    results = []
+    for name, url in ENDPOINTS.items():
+        error = _reach(url)
+        if error is None:
+            results.append((OK, f"network: {name}", url, ""))
+        else:
+            results.append((FAIL, f"network: {name}", f"{url}: {error}", (
+                "Check DNS, the firewall and HTTPS_PROXY/NO_PROXY; the engine pulls through the same network. "
+                "Behind a proxy, also pass it to the engine container."
+            )))
+    return results
+
+
+async def run(purpose: str) -> list[Result]:
+    """Run every check for purpose, printing each result as it comes in."""
+    results: list[Result] = []
+
+    def add(*found: Result) -> None:
+        for result in found:
+            results.append(result)
+            print(format_result(result), flush=True)
+
+    runtime, runtime_root = container_runtime()
+    add(runtime, dagger_cli())
+    if runtime[0] == OK:
+        add(await dagger_engine())
+    add(*disk_space(runtime_root, purpose), *privileges(purpose), *network())
+    return results
+
+
+def format_result(result: Result) -> str:
+    status, check, detail, fix = result
+    line = f"{status:<5} {check:<28} {detail}"
+    return f"{line}\n{'':<5} {'':<28} fix: {fix}" if fix and status != OK else line
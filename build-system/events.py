@@ -0,0 +1,125 @@
+"""Progress events - a machine-readable side channel for pipeline progress.
+
+Each run appends one JSON object per line to runs/<run>/events.jsonl as it
+goes, so wrappers and dashboards can follow a run without parsing the
+console.  REGICIDE_EVENTS redirects them: a path writes the file there,
+and unix:/path/to.sock streams them to a listening unix stream socket.
+
+Every event carries "ts" (UTC, ISO 8601 with milliseconds), "run" and
+"event":
+
+    run-started     argv
+    stage-started   stage
+    step-started    stage, step
+    step-finished   stage, step, status, exit_code, seconds
+    stage-finished  stage, status, seconds
+    run-finished    status
+
+run-started follows argument validation, and every started run ends with
+run-finished, whether it passed, failed, exited early or crashed.
+
+A stage is a unit the pipeline schedules (a --flag, or the OS image
+build); a step is one checked_exec inside it.  Steps of concurrent stages
+interleave, so match them on "stage".
+"""
+
+import contextlib
+import contextvars
+import json
+import os
+import socket
+import sys
+import time
+from collections.abc import AsyncIterator
+from datetime import datetime, timezone
+from pathlib import Path
+
+from run_history import RUNS_DIR, run_id
+
+
+_stage: contextvars.ContextVar[str | None] = contextvars.ContextVar("stage", default=None)
+_socket: socket.socket | None = None
+_socket_failed = False
+_running = False
+
+
+def _target() -> str:
+    return os.environ.get("REGICIDE_EVENTS") or str(RUNS_DIR / run_id() / "events.jsonl")
+
+
+def _send(line: str) -> None:
+    global _socket, _socket_failed
+    target = _target()
+    if not target.startswith("unix:"):
+        path = Path(target)
+        path.parent.mkdir(parents=True, exist_ok=True)
+        with path.open("a") as f:
+            f.write(line)
+        return
+    if _socket_failed:
+        return
+    try:
+        if _socket is None:
+            connected = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+            connected.connect(target.removeprefix("unix:"))
+            _socket = connected
+        _socket.sendall(line.encode())
+    except OSError as exc:
+        # Progress reporting must never fail a build.
+        print(f"WARNING: dropping progress events, {target}: {exc}", file=sys.stderr)
+        _socket_failed = True
+
+
+def emit(event: str, **fields) -> None:
+    """Emit one progress event."""
+    record = {
+        "ts": datetime.now(timezone.utc).isoformat(timespec="milliseconds"),
+        "run": run_id(),
+        "event": event,
+        **fields,
+    }
+    _send(json.dumps(record) + "\n")
+
+
+def start_run(argv: list[str]) -> None:
+    """Emit run-started, once the run's arguments have been validated."""
+    global _running
+    _running = True
+    emit("run-started", argv=argv)
+
+
+def finish_run(status: str) -> None:
+    """Emit run-finished for a run start_run() started; runs that never started emit nothing."""
+    global _running
+    if _running:
+        _running = False
+        emit("run-finished", status=status)
+
+
+def running() -> bool:
+    """Return whether a run has started and not finished."""
+    return _running
+
+
+def current_stage() -> str | None:
+    """Return the stage the calling task runs in, if any."""
+    return _stage.get()
+
+
+@contextlib.asynccontextmanager
+async def stage(name: str) -> AsyncIterator[None]:
+    """Emit stage-started/-finished around a block and attribute its steps to name."""
+    token = _stage.set(name)
+    started = time.monotonic()
+    emit("stage-started", stage=name)
+    status = "failed"
+    try:
+        yield
+        status = "passed"
+    except BaseException as exc:
+        if isinstance(exc, (KeyboardInterrupt, SystemExit)) or type(exc).__name__ == "CancelledError":
+            status = "cancelled"
+        raise
+    finally:
+        emit("stage-finished", stage=name, status=status, seconds=round(time.monotonic() - started, 1))
+        _stage.reset(token)
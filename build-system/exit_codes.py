@@ -0,0 +1,88 @@
+"""Exit codes - what a failed run exits with, by failure class.
+
+Wrapping scripts and workflow steps branch on these, so they are a
+contract: add classes, but do not renumber them.  A run stops at its first
+failure, so it has one class; advisory failures (advisory.toml) do not
+fail the run and exit 0.
+"""
+
+import failure_bundle
+
+
+OK = 0
+STAGE_FAILED = 1
+CONFIG_ERROR = 2
+INFRASTRUCTURE = 3
+TEST_FAILURE = 4
+SECURITY_GATE = 5
+POLICY_GATE = 6
+CANCELLED = 130
+
+# Printed by `ci.py --help` and `dagger_pipeline.py --help`.
+HELP = """exit codes:
+  0    passed, possibly with advisory failures, or skipped as superseded
+  1    a build, lint or other stage failed
+  2    configuration error: bad flags, config files or paths (nothing ran)
+  3    infrastructure: Dagger engine or network failure, out of memory, a
+       failed upload, or the run lock is held; re-running may pass
+  4    tests failed
+  5    the security gate failed: scanner findings at or above the threshold
+  6    a policy gate failed: licenses, banned or duplicate crates, ebuild
+       versions, OCI labels
+  130  cancelled (Ctrl-C or SIGTERM)
+"""
+
+
+class RunFailed(Exception):
+    """A check outside failure_bundle.checked_exec failed; the run exits with exit_code.
+
+    Jobs raise it instead of calling sys.exit(), so the run is still
+    recorded and summarized before it exits.
+    """
+
+    def __init__(self, stage: str, exit_code: int, message: str):
+        self.stage = stage
+        self.exit_code = exit_code
+        super().__init__(message)
+
+
+# Step names (see failure_bundle.checked_exec) by failure class.
+TEST_STEPS = (
+    "cargo-tests", "overlay-", "btrmind-", "cli-golden", "installer-tui-snapshots",
+    "locale-matrix", "gpu-tests", "coverage",
+)
+SECURITY_STEPS = ("security-", "rescan-")
+POLICY_STEPS = ("cargo-deny",)
+# Uploads to outside services, including the signatures and attestations
+# cosign pushes next to a published image.  SARIF, dependency and release
+# uploads run on the host and raise RunFailed with INFRASTRUCTURE.
+INFRASTRUCTURE_STEPS = ("coverage-upload", "binpkg-push", "sign-image", "attest-image-")
+# Host-side steps of the OS image build that verify it rather than build it;
+# their scripts failing is a test failure.  Other host steps are STAGE_FAILED.
+HOST_TEST_STEPS = ("stage7-verify", "stage8-vm-test", "stage9-upgrade-test")
+# Exit code per failure_bundle.FAILURE_CLASSES category.  A category says
+# more than the step name: a compile error in a test step is not a test
+# failure, and an OOM kill anywhere is worth a retry.  "unknown" falls
+# back to the step name.
+CATEGORY_CODES = {
+    "oom": INFRASTRUCTURE,
+    "network": INFRASTRUCTURE,
+    "scan-finding": SECURITY_GATE,
+    "compilation": STAGE_FAILED,
+    "ebuild-resolution": STAGE_FAILED,
+}
+
+
+def for_failure(exc: failure_bundle.StageFailed) -> int:
+    """Return the exit code for a failed step, by its failure class, then its step name."""
+    if exc.stage.startswith(INFRASTRUCTURE_STEPS):
+        return INFRASTRUCTURE
+    if exc.category in CATEGORY_CODES:
+        return CATEGORY_CODES[exc.category]
+    if exc.stage.startswith(SECURITY_STEPS):
+        return SECURITY_GATE
+    if exc.stage.startswith(POLICY_STEPS):
+        return POLICY_GATE
+    if exc.stage.startswith(TEST_STEPS):
+        return TEST_FAILURE
+    return STAGE_FAILED
@@ -0,0 +1,402 @@
+"""Failure bundles - keep diagnostics from failed Dagger stages.
+
+A failed withExec normally takes its container with it: the Gentoo build
+logs, /var/log and any core dumps vanish and only the tail of stderr is
+left.  checked_exec runs a stage with expect=ANY so the container survives
+a non-zero exit, exports the interesting paths to
+build-system/catalyst/output/failures/<run>/<stage>/, and only then fails.
+
+Each bundle carries a manifest.json for triage: the run and stage, the
+executed command, digest-pinned base images, redacted environment, the ID
+of the container the command ran in, and the command line that replays
+just that step (`dagger_pipeline.py --repro <run>/<stage>`).
+"""
+
+import asyncio
+import json
+import os
+import re
+import shlex
+import sys
+import threading
+import time
+from pathlib import Path
+from typing import TextIO
+
+import dagger
+
+import events
+import fingerprint
+import image_lock
+import image_overrides
+from run_history import RUNS_DIR, record_stage, record_warning, run_id
+
+
+FAILURES_DIR = Path("build-system/catalyst/output/failures")
+BUNDLE_ROOT = "/tmp/regicide-failure-bundle"
+
+# Paths copied into a failure bundle when they exist in the failed container.
+# The rootfs paths cover the bubblewrap chroot used by the catalyst stages.
+FAILURE_PATHS = [
+    "/var/log",
+    "/var/tmp/portage",
+    "/var/lib/systemd/coredump",
+    "/var/tmp/regicide-build/rootfs/var/log",
+    "/var/tmp/regicide-build/rootfs/var/tmp/portage",
+    "/src/target/debug/build",
+    "/src/target/release/build",
+    "/tmp/soak-report",
+]
+
+# Host environment prefixes worth recording in a triage manifest.
+MANIFEST_ENV_PREFIXES = ("REGICIDE_", "DAGGER_", "GENTOO_", "COSIGN_", "GITHUB_", "CI")
+SECRET_MARKERS = ("TOKEN", "PASSWORD", "PASSPHRASE", "SECRET", "KEY")
+REDACTED = "<redacted>"
+ANSI_ESCAPE = re.compile(r"\x1b\[[0-9;]*[A-Za-z]")
+
+# (category, stderr patterns, remediation hint), checked in order; the first
+# match wins.  Exit code 137 (SIGKILL) is treated as OOM regardless.
+FAILURE_CLASSES = [
+    (
+        "oom",
+        [r"Killed signal terminated program", r"out of memory", r"Cannot allocate memory", r"oom-kill"],
+        "The stage ran out of memory. Lower MAKEOPTS/cargo -j or give the Dagger engine more RAM.",
+    ),
+    (
+        "network",
+        [
+            r"Could not resolve host", r"Temporary failure in name resolution", r"Connection (timed out|reset|refused)",
+            r"!!! Couldn't download", r"failed to download", r"spurious network error", r"TLS handshake",
+        ],
+        "Looks like a network flake. Re-run the stage; if it persists, check GENTOO_MIRRORS and registry reachability.",
+    ),
+    (
+        "ebuild-resolution",
+        [
+            r"emerge: there are no ebuilds", r"!!! All ebuilds that could satisfy", r"slot conflict",
+            r"The following USE changes are necessary", r"masked by:", r"!!! Multiple package instances",
+        ],
+        "Portage could not resolve dependencies. Check package.use/package.accept_keywords in the overlays "
+        "and the Portage snapshot date.",
+    ),
+    (
+        "scan-finding",
+        [r"Total: \d+ \((?:CRITICAL|HIGH)", r"vulnerabilit(y|ies) found", r"security findings at or above", r"error\[(vulnerability|unsound|yanked)\]"],
+        "A security scanner reported findings. Update the affected dependency or record a justified ignore.",
+    ),
+    (
+        "compilation",
+        [r"error\[E\d{4}\]", r"error: could not compile", r"\* ERROR: .* failed \(compile phase\)", r"error: linking with"],
+        "Compilation failed. Reproduce locally with `cargo build --locked` or check build.log in the failure bundle.",
+    ),
+]
+
+# (reference, container) for every base image pulled through from_image().
+_base_images: list[tuple[str, dagger.Container]] = []
+
+
+def from_image(client: dagger.Client, ref: str) -> dagger.Container:
+    """Return client.container().from_(ref), remembering it for triage manifests.
+
+    ref is pulled by the digest locked in images.lock.json when it has one,
+    unless the current stage overrides it (image_overrides.py).
+    """
+    container = client.container().from_(image_overrides.resolve(ref) or image_lock.pinned(ref))
+    _base_images.append((ref, container))
+    return container
+
+
+def pulled_images() -> list[str]:
+    """Return the references of the base images this run has pulled, in pull order."""
+    return list(dict.fromkeys(ref for ref, _ in _base_images))
+
+
+async def resolved_images() -> dict[str, str]:
+    """Return {reference: the image it resolved to, by digest} for the base images this run has pulled."""
+    images = {}
+    for ref, base in _base_images:
+        if ref not in images:
+            images[ref] = await base.image_ref()
+    return images
+
+
+# Reference -> known-good digest, for images whose locked digest failed to pull this run.
+_fallbacks: dict[str, str] = {}
+
+
+def fallbacks() -> dict[str, str]:
+    """Return {reference: known-good digest} for the images this run fell back on."""
+    return dict(_fallbacks)
+
+
+async def from_image_with_fallback(client: dagger.Client, ref: str) -> dagger.Container:
+    """Return from_image(client, ref), pulled, or its known-good digest if the pull fails.
+
+    For third-party images whose upstream can ship a bad release.  The
+    fallback prints and records a warning once per run; an unpinned ref
+    prints a warning, since nothing protects it.  Without a known-good
+    digest (image_lock.known_good()) the pull failure is raised.  An
+    overridden ref is pulled as given, without a fallback.
+    """
+    if image_overrides.resolve(ref) is not None:
+        return await from_image(client, ref).sync()
+    if ref in _fallbacks:
+        return from_image(client, f"{ref}@{_fallbacks[ref]}")
+    if image_lock.pinned(ref) == ref:
+        print(f"WARNING: {ref} is not pinned in {image_lock.LOCK_PATH.name}; run `ci.py images bump`", file=sys.stderr)
+    try:
+        container = await client.container().from_(image_lock.pinned(ref)).sync()
+    except dagger.QueryError as exc:
+        known_good = image_lock.known_good(ref)
+        if known_good is None:
+            raise
+        message = f"pulling {image_lock.pinned(ref)} failed ({exc}); using the known-good digest {known_good}"
+        print(f"WARNING: {message}", file=sys.stderr)
+        record_warning("image-fallback", message)
+        _fallbacks[ref] = known_good
+        return await from_image(client, f"{ref}@{known_good}").sync()
+    _base_images.append((ref, container))
+    return container
+
+
+def classify_failure(stderr: str, exit_code: int) -> tuple[str, str]:
+    """Return (category, remediation hint) for a failed stage."""
+    if exit_code == 137:
+        return FAILURE_CLASSES[0][0], FAILURE_CLASSES[0][2]
+    for category, patterns, hint in FAILURE_CLASSES:
+        if any(re.search(pattern, stderr) for pattern in patterns):
+            return category, hint
+    return "unknown", "No known pattern matched; start with stderr.txt and the logs in the failure bundle."
+
+
+def redact_env(env: dict[str, str]) -> dict[str, str]:
+    """Return env with the values of secret-looking variables replaced."""
+    return {
+        name: REDACTED if any(marker in name.upper() for marker in SECRET_MARKERS) else value
+        for name, value in sorted(env.items())
+    }
+
+
+class StageFailed(Exception):
+    """A pipeline stage exited non-zero; its failure bundle has been exported."""
+
+    def __init__(self, stage: str, exit_code: int, stderr: str, bundle: Path) -> None:
+        self.stage = stage
+        self.exit_code = exit_code
+        self.stderr = stderr
+        self.bundle = bundle
+        self.category, self.hint = classify_failure(stderr, exit_code)
+        super().__init__(
+            f"{stage} failed with exit code {exit_code} [{self.category}] (failure bundle: {bundle})\n"
+            f"Hint: {self.hint}"
+        )
+
+
+def _bundle_script(paths: list[str]) -> str:
+    """Return a shell script copying existing paths and core files into BUNDLE_ROOT."""
+    quoted = " ".join(f"'{path}'" for path in paths)
+    return (
+        f"mkdir -p {BUNDLE_ROOT}; "
+        f"for p in {quoted}; do "
+        f"  [ -e \"$p\" ] || continue; "
+        f"  mkdir -p \"{BUNDLE_ROOT}$(dirname \"$p\")\"; "
+        f"  cp -a \"$p\" \"{BUNDLE_ROOT}$p\" 2>/dev/null || true; "
+        "done; "
+        # Core dumps land in the working directory when no handler is set.
+        f"find . -maxdepth 2 -type f \\( -name core -o -name 'core.[0-9]*' \\) "
+        f"-exec cp -a --parents {{}} {BUNDLE_ROOT}/ \\; 2>/dev/null || true"
+    )
+
+
+async def export_failure_bundle(
+    container: dagger.Container,
+    stage: str,
+    paths: list[str] | None = None,
+) -> Path:
+    """Copy diagnostics out of a failed stage container to FAILURES_DIR/<run>/<stage>."""
+    collected = container.with_exec(
+        ["sh", "-c", _bundle_script(paths or FAILURE_PATHS)],
+        expect=dagger.ReturnType.ANY,
+    )
+    bundle = FAILURES_DIR / run_id() / stage
+    await collected.directory(BUNDLE_ROOT).export(str(bundle))
+    return bundle
+
+
+async def triage_manifest(
+    container: dagger.Container,
+    stage: str,
+    args: list[str],
+    exit_code: int,
+    stderr: str,
+    base: dagger.Container | None = None,
+    options: dict | None = None,
+) -> dict:
+    """Describe a failed stage well enough to file and reproduce a bug.
+
+    base is the container args ran in and options the with_exec options;
+    --repro loads the one and re-runs args in it with the other.
+    """
+    images = await resolved_images()
+    category, hint = classify_failure(stderr, exit_code)
+    container_env = {
+        await var.name(): await var.value()
+        for var in await container.env_variables()
+    }
+    host_env = {
+        name: value
+        for name, value in os.environ.items()
+        if name.startswith(MANIFEST_ENV_PREFIXES)
+    }
+    host_env["REGICIDE_RUN_ID"] = run_id()
+    return {
+        "run": run_id(),
+        "stage": stage,
+        "exit_code": exit_code,
+        "category": category,
+        "hint": hint,
+        "command": args,
+        "workdir": await container.workdir(),
+        "images": images,
+        "container_env": redact_env(container_env),
+        "host_env": redact_env(host_env),
+        "pipeline_argv": sys.argv,
+        "container": str(await base.id()) if base is not None else None,
+        "exec_options": options or {},
+        "repro": (
+            "DAGGER_PROGRESS=plain dagger run python build-system/dagger_pipeline.py "
+            f"--plain --repro {shlex.quote(f'{run_id()}/{stage}')}"
+        ),
+    }
+
+
+def load_manifest(run_stage: str) -> dict:
+    """Load the triage manifest for a "<run>/<stage>" failure bundle."""
+    return json.loads((FAILURES_DIR / run_stage / "manifest.json").read_text())
+
+
+async def write_exec_logs(container: dagger.Container, stage: str) -> Path:
+    """Save an exec's stdout and stderr to runs/<run>/logs/<stage>.log."""
+    log = RUNS_DIR / run_id() / "logs" / f"{stage}.log"
+    log.parent.mkdir(parents=True, exist_ok=True)
+    log.write_text(
+        f"=== stdout ===\n{await container.stdout()}\n=== stderr ===\n{await container.stderr()}"
+    )
+    return log
+
+
+class EngineLog:
+    """A pipe for dagger.Config(log_output=...) that copies engine output to target.
+
+    The copy remembers the last non-blank line, which heartbeats quote.  The
+    SDK only hands over an exec's output once it finishes, so the engine's
+    progress log is the one place to see what a running stage is doing.  It
+    is empty under `dagger run`, whose CLI owns the engine output.
+    """
+
+    def __init__(self, target: TextIO):
+        read_fd, write_fd = os.pipe()
+        self.file = os.fdopen(write_fd, "w", buffering=1)
+        self.last_line = ""
+        source = os.fdopen(read_fd, errors="replace")
+        threading.Thread(target=self._copy, args=(source, target), daemon=True).start()
+
+    def _copy(self, source: TextIO, target: TextIO) -> None:
+        for line in source:
+            target.write(line)
+            target.flush()
+            if line.strip():
+                self.last_line = ANSI_ESCAPE.sub("", line).strip()
+
+
+_engine_log: EngineLog | None = None
+
+
+def engine_log(target: TextIO) -> TextIO:
+    """Return the log_output file for the engine session, tailed for heartbeats."""
+    global _engine_log
+    _engine_log = EngineLog(target)
+    return _engine_log.file
+
+
+def _heartbeat_interval() -> float:
+    """Return seconds between heartbeats (REGICIDE_HEARTBEAT_SECONDS, 0 disables)."""
+    return float(os.environ.get("REGICIDE_HEARTBEAT_SECONDS", "60"))
+
+
+def _heartbeat_threshold() -> float:
+    """Return seconds a step runs before its first heartbeat (REGICIDE_HEARTBEAT_AFTER)."""
+    return float(os.environ.get("REGICIDE_HEARTBEAT_AFTER", "120"))
+
+
+def heartbeat_line(stage: str, elapsed: float, last_output: str) -> str:
+    """Return the heartbeat for stage after elapsed seconds, quoting the last output line."""
+    seconds = int(elapsed)
+    line = f"[heartbeat] {stage} still running ({seconds // 60}m{seconds % 60:02d}s elapsed)"
+    if last_output:
+        snippet = last_output if len(last_output) <= 100 else last_output[:97] + "..."
+        line += f"; last output: {snippet}"
+    return line
+
+
+async def _heartbeat(stage: str, started: float, interval: float, threshold: float) -> None:
+    """Print a progress line every interval seconds, from threshold on, until cancelled.
+
+    Cached or quiet stages can go many minutes without output, which CI
+    runners mistake for a hung job.  Steps shorter than threshold print
+    nothing.
+    """
+    await asyncio.sleep(max(threshold - interval, 0))
+    while True:
+        await asyncio.sleep(interval)
+        last_output = _engine_log.last_line if _engine_log is not None else ""
+        print(heartbeat_line(stage, time.monotonic() - started, last_output), flush=True)
+
+
+async def checked_exec(
+    container: dagger.Container,
+    args: list[str],
+    stage: str,
+    **kwargs,
+) -> dagger.Container:
+    """Run args as stage, exporting a failure bundle before raising on failure.
+
+    Returns the evaluated container on success so callers can keep chaining.
+    Output is saved per exec under runs/<run>/logs/.  With
+    REGICIDE_STREAM_EXEC=1 each exec is first announced as "[stage] $ args",
+    so its live output in Dagger's plain progress log, labelled with the same
+    command, can be traced to the stage.  A heartbeat line is printed
+    while the stage runs, and step-started/-finished progress events are
+    emitted around it.  The stage's input fingerprint is recorded with its
+    outcome.
+    """
+    if os.environ.get("REGICIDE_STREAM_EXEC") == "1":
+        print(f"[{stage}] $ {shlex.join(args)}", flush=True)
+    started = time.monotonic()
+    events.emit("step-started", stage=events.current_stage(), step=stage)
+    ran = container.with_exec(args, expect=dagger.ReturnType.ANY, **kwargs)
+    inputs = await fingerprint.step_inputs(ran)
+    interval = _heartbeat_interval()
+    heartbeat = None
+    if interval > 0:
+        heartbeat = asyncio.create_task(_heartbeat(stage, started, interval, _heartbeat_threshold()))
+    try:
+        exit_code = await ran.exit_code()
+    finally:
+        if heartbeat is not None:
+            heartbeat.cancel()
+    status = "passed" if exit_code == 0 else "failed"
+    record_stage(stage, status, time.monotonic() - started, inputs)
+    events.emit(
+        "step-finished", stage=events.current_stage(), step=stage, status=status,
+        exit_code=exit_code, seconds=round(time.monotonic() - started, 1),
+    )
+    await write_exec_logs(ran, stage)
+    if exit_code == 0:
+        return ran
+    stderr = await ran.stderr()
+    bundle = await export_failure_bundle(ran, stage)
+    (bundle / "stderr.txt").write_text(stderr)
+    manifest = await triage_manifest(ran, stage, args, exit_code, stderr, base=container, options=kwargs)
+    (bundle / "manifest.json").write_text(json.dumps(manifest, indent=2) + "\n")
+    raise StageFailed(stage, exit_code, stderr, bundle)
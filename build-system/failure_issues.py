@@ -0,0 +1,118 @@
+"""File GitHub issues for nightly pipeline failures.
+
+A failure is identified by its signature: the stage name plus a hash of the
+normalized tail of its stderr.  The first nightly failure with a new
+signature opens an issue; later failures with the same signature comment on
+that issue instead of opening duplicates.  Failures outside a stage, such as
+a policy violation or an engine error, are filed under the "pipeline" stage
+with the exception's message as output.  Requires the GitHub CLI with a
+token in GH_TOKEN/GITHUB_TOKEN; when gh fails, a warning is printed and the
+run keeps its own exit code.
+"""
+
+import hashlib
+import json
+import os
+import re
+import subprocess
+import sys
+
+from failure_bundle import StageFailed
+
+
+ISSUE_LABEL = "ci-nightly"
+ISSUE_LABEL_COLOR = "B60205"
+SIGNATURE_MARKER = "regicide-failure-signature"
+# Lines of stderr that make up the error fingerprint.
+SIGNATURE_LINES = 20
+
+
+def _normalize(line: str) -> str:
+    """Strip run-specific noise (hex IDs, numbers, temp paths) from a log line."""
+    line = re.sub(r"/tmp/[^\s'\"]+", "/tmp/X", line)
+    line = re.sub(r"\b[0-9a-f]{8,}\b", "H", line)
+    return re.sub(r"\d+", "N", line).strip()
+
+
+def failure_signature(stage: str, output: str) -> str:
+    """Return "<stage>:<hash>" identifying failures with the same cause."""
+    tail = [line for line in output.splitlines() if line.strip()][-SIGNATURE_LINES:]
+    digest = hashlib.sha256("\n".join(_normalize(line) for line in tail).encode()).hexdigest()
+    return f"{stage}:{digest[:12]}"
+
+
+def _bundle_link() -> str:
+    """Return where the failure bundle artifact can be downloaded."""
+    repo = os.environ.get("GITHUB_REPOSITORY")
+    run = os.environ.get("GITHUB_RUN_ID")
+    if repo and run:
+        server = os.environ.get("GITHUB_SERVER_URL", "https://github.com")
+        return f"{server}/{repo}/actions/runs/{run}"
+    return "(local run; no uploaded artifacts)"
+
+
+def _gh(*args: str) -> str:
+    return subprocess.run(["gh", *args], check=True, capture_output=True, text=True).stdout
+
+
+def find_open_issue(signature: str) -> int | None:
+    """Return the number of the open nightly issue carrying signature, if any."""
+    issues = json.loads(_gh(
+        "issue", "list",
+        "--state", "open",
+        "--label", ISSUE_LABEL,
+        "--search", f'"{SIGNATURE_MARKER}: {signature}" in:body',
+        "--json", "number",
+    ))
+    return issues[0]["number"] if issues else None
+
+
+def _ensure_label() -> None:
+    """Create ISSUE_LABEL in the repository if it does not exist yet."""
+    _gh(
+        "label", "create", ISSUE_LABEL, "--force",
+        "--color", ISSUE_LABEL_COLOR, "--description", "Failure of a scheduled nightly pipeline run",
+    )
+
+
+def _file(stage: str, title: str, details: str, output: str) -> None:
+    """Open or update the issue for a nightly failure of stage with output."""
+    signature = failure_signature(stage, output)
+    tail = "\n".join(output.splitlines()[-SIGNATURE_LINES:])
+    body = f"{details}\n\n```\n{tail}\n```\n\n<!-- {SIGNATURE_MARKER}: {signature} -->\n"
+    try:
+        issue = find_open_issue(signature)
+        if issue is None:
+            _ensure_label()
+            _gh("issue", "create", "--title", f"{title} ({signature})", "--label", ISSUE_LABEL, "--body", body)
+            print(f"Filed nightly failure issue for {signature}")
+        else:
+            _gh("issue", "comment", str(issue), "--body", body)
+            print(f"Recorded recurrence of {signature} on issue #{issue}")
+    except (OSError, subprocess.CalledProcessError) as exc:
+        detail = getattr(exc, "stderr", None) or exc
+        print(f"WARNING: could not file the nightly failure issue for {signature}: {detail}", file=sys.stderr)
+
+
+def report_failure(failure: StageFailed) -> None:
+    """Open or update the GitHub issue tracking this nightly stage failure."""
+    _file(
+        failure.stage,
+        f"Nightly failure: {failure.stage}",
+        f"Nightly stage `{failure.stage}` failed with exit code {failure.exit_code}.\n\n"
+        f"Classified as **{failure.category}**: {failure.hint}\n\n"
+        f"Triage bundle: {_bundle_link()} (`{failure.bundle}`)",
+        failure.stderr,
+    )
+
+
+def report_error(error: BaseException, exit_code: int) -> None:
+    """Open or update the GitHub issue tracking a nightly failure outside any stage."""
+    kind = type(error).__name__
+    _file(
+        "pipeline",
+        f"Nightly failure: {kind}",
+        f"The nightly pipeline failed with exit code {exit_code}: `{kind}`.\n\n"
+        f"Run: {_bundle_link()}",
+        str(error),
+    )
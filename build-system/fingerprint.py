@@ -0,0 +1,127 @@
+"""Input fingerprints - what a run was built from, to explain "it worked yesterday".
+
+environment() records named components of the build environment:
+
+    source/<area>   digest of each top-level directory, and "." for the
+                    files at the top (committed blobs, with uncommitted and
+                    untracked files hashed from disk)
+    image/<ref>     digest each pinned image resolves to
+    tool/<name>     Python, Dagger SDK and Dagger CLI versions
+    config/<file>   digest of the pipeline's config files
+    env/<NAME>      REGICIDE_* variables that change what gets built
+
+and checked_exec records a per-step digest of the step's Dagger container
+definition (base image, mounted sources, env and command), which changes
+exactly when Dagger would have to re-run the step.
+
+run_history stores both in summary.json and diffs them against the previous
+run; a failed run prints that diff.
+"""
+
+import hashlib
+import os
+import platform
+import subprocess
+from collections import defaultdict
+from importlib import metadata
+from pathlib import Path
+
+import dagger
+
+import image_lock
+import image_overrides
+
+
+# The pipeline's own config, next to this file, and the workspace
+# manifests, relative to the source root (see source_layout.py).
+CONFIG_FILES = [
+    *(Path(__file__).parent / name for name in (
+        "images.lock.json", "images.known-good.json", "stages.toml", "duplicate-crates.toml",
+        "oci-label-policy.toml", "layout.toml", "gitleaks.toml", "gitleaks-baseline.json",
+        "security-policy.toml",
+    )),
+    Path(".trivyignore"),
+    Path("Cargo.toml"),
+    Path("Cargo.lock"),
+]
+# Pipeline outputs live in the tree; they are results, not inputs.
+_OUTPUT_PATHS = ("build-system/catalyst/output/", "build-system/catalyst/tmp/", "target/")
+# Per-run or per-user variables that do not change what gets built.
+_IGNORED_ENV = {
+    "REGICIDE_RUN_ID", "REGICIDE_EVENTS", "REGICIDE_HEARTBEAT_SECONDS", "REGICIDE_HEARTBEAT_AFTER",
+    "REGICIDE_STREAM_EXEC", "REGICIDE_MEMOIZE",
+}
+_SECRET_WORDS = ("TOKEN", "PASS", "SECRET", "KEY")
+
+
+def _digest(data: bytes) -> str:
+    return hashlib.sha256(data).hexdigest()[:16]
+
+
+def _run(*argv: str) -> str:
+    return subprocess.run(
+        argv, check=True, capture_output=True, text=True, timeout=60
+    ).stdout
+
+
+def _area(path: str) -> str:
+    return path.split("/", 1)[0] if "/" in path else "."
+
+
+def source_digests() -> dict[str, str]:
+    """Return {top-level directory or ".": digest} of the working tree, or {} outside git."""
+    try:
+        staged = _run("git", "ls-files", "-s", "-z")
+        changed = set(_run("git", "ls-files", "-m", "-o", "--exclude-standard", "-z").split("\0")) - {""}
+    except (OSError, subprocess.SubprocessError):
+        return {}
+    entries: dict[str, list[str]] = defaultdict(list)
+    for line in staged.split("\0"):
+        if line:
+            meta, path = line.split("\t", 1)
+            if path not in changed:
+                entries[_area(path)].append(f"{meta.split()[1]} {path}")
+    for path in changed:
+        if path.startswith(_OUTPUT_PATHS):
+            continue
+        file = Path(path)
+        blob = _digest(file.read_bytes()) if file.is_file() else "deleted"
+        entries[_area(path)].append(f"{blob} {path}")
+    return {area: _digest("\n".join(sorted(lines)).encode()) for area, lines in sorted(entries.items())}
+
+
+def _dagger_cli_version() -> str:
+    try:
+        # "dagger v0.18.0 (registry.dagger.io/engine:v0.18.0) linux/amd64"
+        return _run("dagger", "version").split()[1]
+    except (OSError, subprocess.SubprocessError, IndexError):
+        return "unknown"
+
+
+def tools() -> dict[str, str]:
+    """Return the Python, Dagger SDK and Dagger CLI versions on the host."""
+    try:
+        sdk = metadata.version("dagger-io")
+    except metadata.PackageNotFoundError:
+        sdk = "unknown"
+    return {"python": platform.python_version(), "dagger-sdk": sdk, "dagger-cli": _dagger_cli_version()}
+
+
+def environment() -> dict[str, str]:
+    """Return this run's named environment components."""
+    components = {f"source/{area}": digest for area, digest in source_digests().items()}
+    components |= {f"image/{ref}": digest for ref, digest in image_lock.load().items()}
+    components |= {f"image-override/{target}": image for target, image in image_overrides.configured().items()}
+    components |= {f"tool/{name}": version for name, version in tools().items()}
+    for path in CONFIG_FILES:
+        components[f"config/{path.name}"] = _digest(path.read_bytes()) if path.is_file() else "absent"
+    for name, value in sorted(os.environ.items()):
+        if name.startswith("REGICIDE_") and name not in _IGNORED_ENV:
+            secret = any(word in name for word in _SECRET_WORDS)
+            components[f"env/{name}"] = _digest(value.encode()) if secret else value
+    return components
+
+
+async def step_inputs(container: dagger.Container) -> str:
+    """Return a digest of a step's container definition, command included."""
+    return _digest(str(await container.id()).encode())
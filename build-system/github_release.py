@@ -0,0 +1,42 @@
+"""GitHub releases - attach pipeline outputs to a published release.
+
+The release itself is created by whoever tags it; these helpers only fill
+it in with the GitHub CLI (gh), which needs a token in GH_TOKEN or
+GITHUB_TOKEN and picks the repository from GH_REPO or the git remote.
+A gh failure raises subprocess.CalledProcessError with gh's stderr.
+
+The release assets are the files a passing run attaches with
+--release-tag, under their base names; `ci.py rescan` downloads them
+again to re-scan the release.
+"""
+
+import subprocess
+from pathlib import Path
+
+import artifacts
+
+
+# Relative to artifacts.OUTPUT_DIR.
+ASSETS = [
+    Path("sbom.spdx.json"), Path("static/installer"), Path("static/btrmind"), Path("toolchain-report.json"),
+]
+
+
+def _gh(*args: str) -> str:
+    return subprocess.run(["gh", *args], check=True, capture_output=True, text=True).stdout
+
+
+def set_notes(tag: str, notes: Path) -> None:
+    """Replace the body of release tag with the Markdown in notes."""
+    _gh("release", "edit", tag, "--notes-file", str(notes))
+
+
+def upload(tag: str, paths: list[Path]) -> None:
+    """Attach paths to release tag, replacing assets of the same name."""
+    _gh("release", "upload", tag, *(str(path) for path in paths), "--clobber")
+
+
+def assets(files: list[Path]) -> list[Path]:
+    """Return the release assets among files, the output files a run produced."""
+    wanted = {artifacts.OUTPUT_DIR / asset for asset in ASSETS}
+    return [path for path in files if path in wanted]
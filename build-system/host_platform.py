@@ -0,0 +1,80 @@
+"""Host platform - run the CI from macOS and Windows as well as Linux.
+
+Every stage runs in Linux containers; only ci.py and dagger_pipeline.py run
+on the host.  What differs between hosts is handled here:
+
+- The Dagger CLI starts its engine through Docker, but only looks for
+  the socket at /var/run/docker.sock or in DOCKER_HOST.  Docker Desktop,
+  Colima, OrbStack, Rancher Desktop and Podman on macOS each put it
+  elsewhere; configure() finds it and sets DOCKER_HOST.
+- Windows paths use backslashes, which mean nothing inside a container;
+  paths handed to Dagger directories go through as_posix().
+- A checkout with core.autocrlf turns the shell scripts the stages run
+  into CRLF files that fail in the container.  The root .gitattributes
+  keeps text files LF everywhere; crlf_files() catches checkouts made
+  before it.
+
+The OS image stages also run host tools (sudo, mksquashfs, the stage7
+checks), so they still need a Linux host; the workspace checks do not.
+"""
+
+import os
+import subprocess
+import sys
+from pathlib import Path
+
+
+# Where Docker-compatible runtimes put their socket when it is not
+# /var/run/docker.sock, in order of preference.
+SOCKET_CANDIDATES = [
+    "~/.docker/run/docker.sock",
+    "~/.colima/default/docker.sock",
+    "~/.orbstack/run/docker.sock",
+    "~/.rd/docker.sock",
+    "~/.local/share/containers/podman/machine/podman.sock",
+]
+WINDOWS_PIPE = r"\\.\pipe\docker_engine"
+
+
+def builds_images() -> bool:
+    """Return whether this host can run the OS image stages."""
+    return sys.platform == "linux"
+
+
+def is_root() -> bool:
+    """Return whether the pipeline runs as root; never on Windows."""
+    return hasattr(os, "geteuid") and os.geteuid() == 0
+
+
+def docker_host() -> str | None:
+    """Return the DOCKER_HOST for this host's container runtime, or None for Docker's default."""
+    if sys.platform == "win32":
+        return "npipe:////./pipe/docker_engine" if os.path.exists(WINDOWS_PIPE) else None
+    if Path("/var/run/docker.sock").exists():
+        return None
+    for candidate in SOCKET_CANDIDATES:
+        path = Path(candidate).expanduser()
+        if path.exists():
+            return f"unix://{path}"
+    return None
+
+
+def configure() -> None:
+    """Point the Dagger CLI at the host's container runtime unless DOCKER_HOST says otherwise."""
+    if "DOCKER_HOST" in os.environ or "_EXPERIMENTAL_DAGGER_RUNNER_HOST" in os.environ:
+        return
+    host = docker_host()
+    if host is not None:
+        os.environ["DOCKER_HOST"] = host
+
+
+def crlf_files(root: Path) -> list[str]:
+    """Return the tracked text files under root checked out with CRLF line endings, or [] outside git."""
+    try:
+        listed = subprocess.run(
+            ["git", "-C", str(root), "ls-files", "--eol", "-z"], check=True, capture_output=True, text=True,
+        ).stdout
+    except (OSError, subprocess.CalledProcessError):
+        return []
+    # "i/lf    w/crlf  attr/text eol=lf\tpath"
+    return [entry.split("\t", 1)[1] for entry in listed.split("\0") if "w/crlf" in entry.split("\t", 1)[0]]
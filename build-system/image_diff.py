@@ -0,0 +1,217 @@
+"""Image diff - what changed in the OS image since the previous build.
+
+--image-diff lists the packages (/var/db/pkg) and files of the new stage4
+rootfs, with the tarball and SquashFS sizes, into
+runs/<run>/image-manifest.json.gz.  The newest earlier passed run that
+built an image for the same arch is the previous build; reports/image-diff.md
+summarizes the size changes, the packages added, removed or changed in
+version, and the directories and files that grew or shrank the most, and
+reports/image-diff-files.txt lists every added, removed and resized file.
+The report goes to the GitHub Actions step summary and, on a pull request,
+to a PR comment.  Like the benchmark baseline, the previous build comes
+from this host's run history.
+"""
+
+import gzip
+import json
+import os
+import re
+from pathlib import Path
+
+import dagger
+
+import run_history
+import workspace_checks
+from failure_bundle import checked_exec, from_image
+
+
+MANIFEST = "image-manifest.json.gz"
+# Directory depth the size changes are grouped at (usr/lib64/<name>).
+GROUP_DEPTH = 3
+TOP = 20
+
+# PMS version syntax; package names may contain "-<digits>" but never end
+# in something that parses as a version.
+_VERSION = r"\d+(?:\.\d+)*[a-z]?(?:_(?:alpha|beta|pre|rc|p)\d*)*(?:-r\d+)?"
+
+
+async def listing(client: dagger.Client, tarball: dagger.File) -> str:
+    """Return the package and file listing of the rootfs in tarball.
+
+    One line per installed package ("P\\tcategory/PF") and per regular file
+    or symlink ("F\\tsize\\tpath").
+    """
+    lister = await checked_exec(
+        from_image(client, "alpine:latest"),
+        ["apk", "add", "--no-cache", "tar", "xz", "findutils"],
+        "image-manifest-tools",
+    )
+    lister = lister.with_file("/tmp/stage4.tar.xz", tarball)
+    listed = await checked_exec(
+        lister,
+        [
+            "sh", "-c",
+            "set -eu; mkdir -p /rootfs; tar -C /rootfs -xpJf /tmp/stage4.tar.xz; cd /rootfs; "
+            "for d in var/db/pkg/*/*/; do [ -d \"$d\" ] && printf 'P\\t%s\\n' \"${d#var/db/pkg/}\"; done; "
+            "find . -xdev \\( -type f -o -type l \\) -printf 'F\\t%s\\t%P\\n'",
+        ],
+        "image-manifest",
+    )
+    return await listed.stdout()
+
+
+def split_package(cpf: str) -> tuple[str, str]:
+    """Split category/PF into (category/PN, version)."""
+    match = re.fullmatch(rf"(.+?)-({_VERSION})", cpf.rstrip("/"))
+    return (match.group(1), match.group(2)) if match else (cpf.rstrip("/"), "")
+
+
+def manifest(text: str, arch: str, sizes: dict[str, int]) -> dict:
+    """Return the manifest of a listing() result, with the artifact sizes in bytes."""
+    packages: dict[str, list[str]] = {}
+    files = {}
+    for line in text.splitlines():
+        kind, _, rest = line.partition("\t")
+        if kind == "P":
+            name, version = split_package(rest)
+            packages.setdefault(name, []).append(version)
+        elif kind == "F":
+            size, _, path = rest.partition("\t")
+            files[path] = int(size)
+    return {
+        "arch": arch,
+        "sizes": sizes,
+        "packages": {name: sorted(versions) for name, versions in sorted(packages.items())},
+        "files": files,
+    }
+
+
+def record(image: dict) -> Path:
+    """Store this run's manifest; return runs/<run>/image-manifest.json.gz."""
+    path = run_history.RUNS_DIR / run_history.run_id() / MANIFEST
+    path.parent.mkdir(parents=True, exist_ok=True)
+    with gzip.open(path, "wt") as f:
+        json.dump(image, f)
+    run_history.record_metric("image-files", len(image["files"]))
+    run_history.record_metric("image-installed-mib", round(sum(image["files"].values()) / 2**20, 1))
+    return path
+
+
+def previous(arch: str) -> tuple[dict, dict] | None:
+    """Return (summary, manifest) of the newest earlier passed run that built an image for arch.
+
+    A failed run may have recorded its manifest before a later stage
+    failed; its image was never shipped, so it is no baseline.
+    """
+    for summary in reversed(run_history.recent_summaries(0)):
+        path = run_history.RUNS_DIR / summary["run"] / MANIFEST
+        if summary["run"] == run_history.run_id() or summary["status"] != "passed" or not path.is_file():
+            continue
+        with gzip.open(path, "rt") as f:
+            image = json.load(f)
+        if image["arch"] == arch:
+            return summary, image
+    return None
+
+
+def _mib(size: int) -> str:
+    return f"{size / 2**20:.1f} MiB" if size >= 2**20 else f"{size / 2**10:.1f} KiB"
+
+
+def _change(before: int, after: int) -> str:
+    change = f"{'+' if after >= before else '-'}{_mib(abs(after - before))}"
+    return f"{change} ({(after - before) / before * 100:+.1f}%)" if before else change
+
+
+def _group(path: str) -> str:
+    return "/".join(path.split("/")[:GROUP_DEPTH]) if path.count("/") >= GROUP_DEPTH else path.rpartition("/")[0]
+
+
+def report(previous_summary: dict, before: dict, after: dict) -> tuple[str, str]:
+    """Return the Markdown report and the full file list comparing before with after."""
+    commit = previous_summary.get("commit", "")
+    lines = [
+        "# What changed in this image",
+        "",
+        f"RegicideOS stage4 ({after['arch']}) in run `{run_history.run_id()}`, compared with run "
+        f"`{previous_summary['run']}`" + (f" (commit `{commit[:12]}`)." if commit else "."),
+        "",
+        "## Size",
+        "",
+        "| | previous | this build | change |",
+        "|---|---:|---:|---:|",
+    ]
+    for name in after["sizes"]:
+        if name in before["sizes"]:
+            old, new = before["sizes"][name], after["sizes"][name]
+            lines.append(f"| {name} | {_mib(old)} | {_mib(new)} | {_change(old, new)} |")
+    old_total, new_total = sum(before["files"].values()), sum(after["files"].values())
+    lines.append(f"| installed files | {_mib(old_total)} | {_mib(new_total)} | {_change(old_total, new_total)} |")
+    lines.append(
+        f"| file count | {len(before['files'])} | {len(after['files'])} | "
+        f"{len(after['files']) - len(before['files']):+d} |"
+    )
+
+    old_packages, new_packages = before["packages"], after["packages"]
+    added = sorted(new_packages.keys() - old_packages.keys())
+    removed = sorted(old_packages.keys() - new_packages.keys())
+    common = old_packages.keys() & new_packages.keys()
+    changed = sorted(name for name in common if old_packages[name] != new_packages[name])
+    lines += [
+        "",
+        "## Packages",
+        "",
+        f"{len(new_packages)} installed: {len(added)} added, {len(removed)} removed, {len(changed)} changed version.",
+    ]
+    if changed:
+        lines += ["", "### Changed version", "", "| package | previous | this build |", "|---|---|---|"]
+        lines += [f"| {name} | {', '.join(old_packages[name])} | {', '.join(new_packages[name])} |" for name in changed]
+    for title, names, versions in [("Added", added, new_packages), ("Removed", removed, old_packages)]:
+        if names:
+            lines += ["", f"### {title}", ""]
+            lines += [f"- {name} {', '.join(versions[name])}" for name in names]
+
+    old_files, new_files = before["files"], after["files"]
+    added_files = sorted(new_files.keys() - old_files.keys())
+    removed_files = sorted(old_files.keys() - new_files.keys())
+    resized = sorted(path for path in old_files.keys() & new_files.keys() if old_files[path] != new_files[path])
+    lines += [
+        "",
+        "## Files",
+        "",
+        f"{len(added_files)} added ({_mib(sum(new_files[p] for p in added_files))}), "
+        f"{len(removed_files)} removed ({_mib(sum(old_files[p] for p in removed_files))}), "
+        f"{len(resized)} changed size.  Every one is listed in `image-diff-files.txt`.",
+    ]
+    groups: dict[str, list[int]] = {}
+    for path, size in old_files.items():
+        groups.setdefault(_group(path), [0, 0])[0] += size
+    for path, size in new_files.items():
+        groups.setdefault(_group(path), [0, 0])[1] += size
+    grown = sorted(groups.items(), key=lambda item: abs(item[1][1] - item[1][0]), reverse=True)
+    grown = [(group, sizes) for group, sizes in grown[:TOP] if sizes[0] != sizes[1]]
+    if grown:
+        lines += [
+            "", "### Largest changes by directory", "",
+            "| directory | previous | this build | change |", "|---|---:|---:|---:|",
+        ]
+        lines += [f"| /{group} | {_mib(old)} | {_mib(new)} | {_change(old, new)} |" for group, (old, new) in grown]
+    largest = [("Largest added files", added_files, new_files), ("Largest removed files", removed_files, old_files)]
+    for title, paths, sizes in largest:
+        if paths:
+            lines += ["", f"### {title}", ""]
+            lines += [f"- /{path} ({_mib(sizes[path])})" for path in sorted(paths, key=sizes.get, reverse=True)[:TOP]]
+
+    file_list = [f"added\t{new_files[p]}\t/{p}" for p in added_files]
+    file_list += [f"removed\t{old_files[p]}\t/{p}" for p in removed_files]
+    file_list += [f"resized\t{old_files[p]} -> {new_files[p]}\t/{p}" for p in resized]
+    return "\n".join(lines) + "\n", "\n".join(file_list) + "\n"
+
+
+def publish(report_path: Path) -> None:
+    """Append the report to $GITHUB_STEP_SUMMARY when set, and comment it on the pull request."""
+    step_summary = os.environ.get("GITHUB_STEP_SUMMARY")
+    if step_summary:
+        with open(step_summary, "a") as f:
+            f.write(report_path.read_text() + "\n")
+    workspace_checks.post_pr_comment(report_path)
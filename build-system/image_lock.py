@@ -0,0 +1,82 @@
+"""Pinned container image digests.
+
+build-system/images.lock.json maps each image reference the pipeline pulls
+to the digest of its (multi-arch) manifest.  failure_bundle.from_image()
+pulls locked references by digest, so a retagged upstream image cannot
+change a build until `ci.py images bump` updates the lock in a reviewed PR.
+References missing from the lock, such as a REGICIDE_RUST_IMAGE override,
+are pulled by tag.
+
+images.known-good.json keeps, for each image a bump changed, the digest
+it was locked to before: the last one the pipeline passed with.  When
+pulling a scanner image's locked digest fails, as when upstream ships a
+broken or withdrawn release, failure_bundle.from_image_with_fallback()
+pulls that digest instead and the run records a warning.
+"""
+
+import json
+from pathlib import Path
+
+
+LOCK_PATH = Path(__file__).parent / "images.lock.json"
+KNOWN_GOOD_PATH = Path(__file__).parent / "images.known-good.json"
+
+# Every image the pipeline and ci.py pull; `ci.py images bump` resolves
+# these.  Add new base images here, in order, when a stage starts using them.
+TRACKED_IMAGES = [
+    "alpine:latest",
+    "anchore/syft:v1.14.0",
+    "aquasec/trivy:latest",
+    "debian:bookworm-slim",
+    "gentoo/stage3:amd64-openrc",
+    "gentoo/stage3:amd64-systemd",
+    "gentoo/stage3:arm64-desktop-systemd",
+    "gentoo/stage3:arm64-openrc",
+    "ghcr.io/gitleaks/gitleaks:latest",
+    "ghcr.io/google/osv-scanner:v1.9.1",
+    "ghcr.io/oras-project/oras:v1.2.0",
+    "hadolint/hadolint:latest-debian",
+    "python:3.12-alpine",
+    "quay.io/skopeo/stable:latest",
+    "rust:1.87-bookworm",
+    "rust:1.87-slim-bookworm",
+]
+
+
+def load() -> dict[str, str]:
+    """Return the lock as {reference: "sha256:..."}; empty if there is none."""
+    if not LOCK_PATH.is_file():
+        return {}
+    return json.loads(LOCK_PATH.read_text())
+
+
+def save(lock: dict[str, str]) -> None:
+    """Write the lock, sorted so bumps produce minimal diffs."""
+    LOCK_PATH.write_text(json.dumps(dict(sorted(lock.items())), indent=2) + "\n", newline="\n")
+
+
+def load_known_good() -> dict[str, str]:
+    """Return {reference: "sha256:..."} of the digests locked before the last bump."""
+    if not KNOWN_GOOD_PATH.is_file():
+        return {}
+    return json.loads(KNOWN_GOOD_PATH.read_text())
+
+
+def save_known_good(old: dict[str, str], new: dict[str, str]) -> None:
+    """Record old's digest as known good for every reference new changes."""
+    known_good = load_known_good() | {ref: old[ref] for ref in new if ref in old and old[ref] != new[ref]}
+    KNOWN_GOOD_PATH.write_text(json.dumps(dict(sorted(known_good.items())), indent=2) + "\n", newline="\n")
+
+
+def known_good(ref: str) -> str | None:
+    """Return ref's known-good digest, or None when it has none or it is the locked one."""
+    digest = load_known_good().get(ref)
+    return digest if digest and digest != load().get(ref) else None
+
+
+def pinned(ref: str) -> str:
+    """Return ref pinned to its locked digest ("name:tag@sha256:..."), or ref unchanged."""
+    if "@" in ref:
+        return ref
+    digest = load().get(ref)
+    return f"{ref}@{digest}" if digest else ref
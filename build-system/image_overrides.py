@@ -0,0 +1,86 @@
+"""Image overrides - replace a stage's base image for one run.
+
+The stages pull their base images by the references in the code,
+pinned by images.lock.json.  An override swaps one of those references
+for another image without editing the pipeline: a local Gentoo stage3
+mirror, an internal Rust builder, a patched scanner.  Overrides come
+from a TOML file (--image-overrides FILE):
+
+    [images]
+    "gentoo/stage3:amd64-systemd" = "registry.internal/gentoo/stage3:amd64-systemd"
+
+    [stages.security-scan]
+    "aquasec/trivy:latest" = "registry.internal/trivy:0.56.2"
+
+and from --image-override [STAGE::]REF=IMAGE, which wins over the file.
+[images] applies to every stage, [stages.<stage>] only to the steps of
+that stage (the names in the timing table, e.g. os-image for the OS image
+build).  An override is pulled as given, not pinned and without a
+known-good fallback; add a digest to pin it.  The overrides configured
+are part of the run's fingerprint, and those used are listed in the run
+summary's image_overrides.
+"""
+
+import sys
+import tomllib
+from pathlib import Path
+
+import events
+import run_history
+
+
+# Stage -> {reference: image}; the "" stage applies to every stage.
+_overrides: dict[str, dict[str, str]] = {}
+_used: set[tuple[str, str]] = set()
+
+
+def load(path: Path) -> None:
+    """Add the overrides in TOML file path, raising ValueError if it is malformed."""
+    try:
+        with path.open("rb") as f:
+            config = tomllib.load(f)
+    except (OSError, tomllib.TOMLDecodeError) as exc:
+        raise ValueError(f"--image-overrides {path}: {exc}") from exc
+    unknown = config.keys() - {"images", "stages"}
+    if unknown:
+        raise ValueError(
+            f"--image-overrides {path}: unknown table {', '.join(sorted(unknown))}; use [images] or [stages.<stage>]"
+        )
+    tables = {"": config.get("images", {}), **config.get("stages", {})}
+    for stage, images in tables.items():
+        if not isinstance(images, dict) or not all(isinstance(image, str) and image for image in images.values()):
+            table = f"[stages.{stage}]" if stage else "[images]"
+            raise ValueError(f"--image-overrides {path}: {table} must map references to images")
+        _overrides.setdefault(stage, {}).update(images)
+
+
+def add(spec: str) -> None:
+    """Apply an --image-override [STAGE::]REF=IMAGE, raising ValueError if it is malformed."""
+    target, sep, image = spec.partition("=")
+    stage, _, ref = target.rpartition("::")
+    if not sep or not ref or not image:
+        raise ValueError(f"--image-override expects [STAGE::]REF=IMAGE, got {spec!r}")
+    _overrides.setdefault(stage, {})[ref] = image
+
+
+def configured() -> dict[str, str]:
+    """Return every configured override as {"<stage or *>/<reference>": image}, for the run fingerprint."""
+    return {
+        f"{stage or '*'}/{ref}": image
+        for stage, images in sorted(_overrides.items())
+        for ref, image in sorted(images.items())
+    }
+
+
+def resolve(ref: str) -> str | None:
+    """Return the image overriding ref in the current stage, or None.
+
+    The first use in each stage is printed and recorded in the run summary.
+    """
+    stage = events.current_stage() or ""
+    image = _overrides.get(stage, {}).get(ref) or _overrides.get("", {}).get(ref)
+    if image is not None and (stage, ref) not in _used:
+        _used.add((stage, ref))
+        print(f"{stage or 'pipeline'}: using {image} instead of {ref} (image override)", file=sys.stderr)
+        run_history.record_image_override(stage, ref, image)
+    return image
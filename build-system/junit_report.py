@@ -0,0 +1,63 @@
+"""JUnit XML test reports - summaries for the console and GitHub's job summary.
+
+cargo-nextest writes one <testsuite> per test binary and one <testcase>
+per test, with a <failure> or <error> child for tests that failed and
+<skipped/> for ignored ones.  Sharded runs write one report per shard,
+which merge() combines.  In GitHub Actions the summary is appended to
+$GITHUB_STEP_SUMMARY, which renders on the run's summary page.
+"""
+
+import os
+import xml.etree.ElementTree as ET
+from pathlib import Path
+
+
+def merge(reports: list[str]) -> str:
+    """Return one JUnit document holding the test suites of every report."""
+    merged = ET.Element("testsuites")
+    for report in reports:
+        root = ET.fromstring(report)
+        merged.extend([root] if root.tag == "testsuite" else root.findall("testsuite"))
+    return ET.tostring(merged, encoding="unicode", xml_declaration=True) + "\n"
+
+
+def summarize(report: Path) -> dict:
+    """Return {"tests", "failed", "skipped", "seconds", "failures": [name]} for a JUnit report."""
+    root = ET.parse(report).getroot()
+    suites = [root] if root.tag == "testsuite" else root.findall("testsuite")
+    summary = {"tests": 0, "failed": 0, "skipped": 0, "seconds": 0.0, "failures": []}
+    for suite in suites:
+        for case in suite.findall("testcase"):
+            summary["tests"] += 1
+            summary["seconds"] += float(case.get("time", 0))
+            if case.find("failure") is not None or case.find("error") is not None:
+                summary["failed"] += 1
+                summary["failures"].append(f"{suite.get('name', '')}::{case.get('name', '')}")
+            elif case.find("skipped") is not None:
+                summary["skipped"] += 1
+    summary["seconds"] = round(summary["seconds"], 1)
+    return summary
+
+
+def markdown(title: str, summary: dict) -> str:
+    """Return summary as a Markdown section listing failing tests."""
+    passed = summary["tests"] - summary["failed"] - summary["skipped"]
+    lines = [
+        f"### {title}",
+        "",
+        f"{passed} passed, {summary['failed']} failed, {summary['skipped']} skipped"
+        f" ({summary['seconds']}s)",
+    ]
+    if summary["failures"]:
+        lines += ["", "Failing tests:", "", *(f"- `{name}`" for name in summary["failures"])]
+    return "\n".join(lines) + "\n"
+
+
+def publish(title: str, report: Path) -> dict:
+    """Summarize report, append it to $GITHUB_STEP_SUMMARY when set, and return the summary."""
+    summary = summarize(report)
+    step_summary = os.environ.get("GITHUB_STEP_SUMMARY")
+    if step_summary:
+        with open(step_summary, "a") as f:
+            f.write(markdown(title, summary) + "\n")
+    return summary
@@ -0,0 +1,3 @@
+"""RegicideOS CI stages as a Dagger module."""
+
+from .main import RegicideCi as RegicideCi
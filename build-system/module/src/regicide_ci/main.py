@@ -0,0 +1,119 @@
+"""RegicideOS CI stages as Dagger functions.
+
+The stages are the same code dagger_pipeline.py runs; this module only
+exposes them to `dagger call` and to other modules:
+
+    dagger call cargo-check
+    dagger call release-binaries export --path=./bin
+    dagger call overlay-tests --arch=arm64
+    dagger call security-scan --threshold=critical
+    dagger call stage --name=systemd-declarations
+
+Each function takes the repository as `source`, defaulting to the
+module's context (the checkout dagger.json is in).  The Gentoo OS image
+build, SquashFS and signing need host paths and privileges and stay in
+dagger_pipeline.py.
+"""
+
+import sys
+from pathlib import Path
+from typing import Annotated
+
+import dagger
+from dagger import DefaultPath, Doc, Ignore, dag, function, object_type
+
+# The stage code is build-system/*.py, which dagger.json includes in the
+# module's context next to build-system/module/.
+sys.path.insert(0, str(Path(__file__).resolve().parents[3]))
+
+import dagger_pipeline  # noqa: E402
+import declared_stages  # noqa: E402
+import security_scan  # noqa: E402
+import workspace_checks  # noqa: E402
+
+
+Source = Annotated[
+    dagger.Directory,
+    DefaultPath("/"),
+    Ignore([
+        "build-system/catalyst/tmp/",
+        "build-system/catalyst/output/",
+        "target/",
+        "*.img",
+        "*.tar.xz",
+        "*.qcow2",
+    ]),
+    Doc("RegicideOS checkout (default: the module's context)"),
+]
+
+
+@object_type
+class RegicideCi:
+    @function
+    async def cargo_check(self, source: Source) -> str:
+        """Type-check the Cargo workspace and return cargo's output."""
+        with workspace_checks.module_source(source):
+            return await workspace_checks.cargo_check(dag)
+
+    @function
+    async def release_binaries(
+        self,
+        source: Source,
+        pgo: Annotated[bool, Doc("Train btrmind with the PGO workload first")] = False,
+    ) -> dagger.Directory:
+        """Build installer and btrmind with the release-optimized profile."""
+        with workspace_checks.module_source(source):
+            return await workspace_checks.optimized_binaries(dag, pgo=pgo)
+
+    @function
+    async def overlay_tests(
+        self,
+        source: Source,
+        arch: Annotated[str, Doc("amd64 or arm64")] = "amd64",
+    ) -> str:
+        """Run the regicide-rust overlay tests in a Gentoo container."""
+        with workspace_checks.module_source(source):
+            return await dagger_pipeline.overlay_tests(dag, arch=arch)
+
+    @function
+    async def pkgcheck(
+        self,
+        source: Source,
+        keywords: Annotated[str, Doc("pkgcheck --keywords filter instead of metadata/pkgcheck.conf's")] = "",
+    ) -> str:
+        """Run pkgcheck on the regicide-rust overlay; fail on any error or warning."""
+        with workspace_checks.module_source(source):
+            return await dagger_pipeline.overlay_pkgcheck(dag, keywords=keywords or None)
+
+    @function
+    async def manifest_check(self, source: Source) -> str:
+        """Regenerate the regicide-rust overlay's Manifests; fail if a committed one differs."""
+        with workspace_checks.module_source(source):
+            return await (await dagger_pipeline.overlay_manifest_check(dag)).stdout()
+
+    @function
+    async def security_scan(
+        self,
+        source: Source,
+        threshold: Annotated[str, Doc("Lowest severity that fails the scan")] = "high",
+        history: Annotated[bool, Doc("Also scan every commit for secrets (needs .git in source)")] = False,
+    ) -> str:
+        """Run the security scanners concurrently; fail on findings at or above threshold."""
+        with workspace_checks.module_source(source):
+            _, findings = await security_scan.scan(dag, options={"gitleaks": {"history": history}})
+            await security_scan.gate(dag, findings, threshold)
+        return security_scan.summary(findings, threshold, security_scan.load_policy()["thresholds"])
+
+    @function
+    async def stage(
+        self,
+        source: Source,
+        name: Annotated[str, Doc("Stage declared in build-system/stages.toml")],
+    ) -> str:
+        """Run a declared stage after the stages it needs; return its output."""
+        stages = declared_stages.load()
+        output = ""
+        with workspace_checks.module_source(source):
+            for needed in declared_stages.order(stages, [name]):
+                output = await declared_stages.run(dag, needed, stages[needed])
+        return output
@@ -0,0 +1,58 @@
+"""OCI label policy - required labels for published images.
+
+oci-label-policy.toml lists the labels every published image must carry
+and patterns some values must match.  violations() checks a label set
+against it; image_labels() reads the labels of a published image.
+"""
+
+import re
+import tomllib
+from pathlib import Path
+
+import dagger
+
+
+POLICY_PATH = Path(__file__).parent / "oci-label-policy.toml"
+
+
+class PolicyViolation(Exception):
+    """An image's labels do not satisfy oci-label-policy.toml."""
+
+    def __init__(self, subject: str, problems: list[str]):
+        self.subject = subject
+        self.problems = problems
+        super().__init__(f"{subject} violates {POLICY_PATH.name}: " + "; ".join(problems))
+
+
+def load_policy(path: Path = POLICY_PATH) -> dict:
+    """Return the policy as {"required": {label: why}, "patterns": {label: regex}}."""
+    with path.open("rb") as f:
+        policy = tomllib.load(f)
+    return {"required": policy.get("required", {}), "patterns": policy.get("patterns", {})}
+
+
+def violations(labels: dict[str, str], policy: dict | None = None) -> list[str]:
+    """Return one message per missing, empty or malformed label."""
+    policy = policy or load_policy()
+    problems = []
+    for label, why in policy["required"].items():
+        if not labels.get(label, "").strip():
+            problems.append(f"missing {label} ({why})")
+    for label, pattern in policy["patterns"].items():
+        value = labels.get(label)
+        if value and not re.fullmatch(pattern, value):
+            problems.append(f"{label}={value!r} does not match {pattern}")
+    return problems
+
+
+def enforce(subject: str, labels: dict[str, str]) -> None:
+    """Raise PolicyViolation unless labels satisfy the policy."""
+    problems = violations(labels)
+    if problems:
+        raise PolicyViolation(subject, problems)
+
+
+async def image_labels(client: dagger.Client, ref: str) -> dict[str, str]:
+    """Return the labels in the config of the published image ref."""
+    labels = await client.container().from_(ref).labels()
+    return {await label.name(): await label.value() for label in labels}
@@ -0,0 +1,129 @@
+"""Provenance - SLSA v1 provenance for the files a run produced.
+
+Every run that passes writes build-system/catalyst/output/
+provenance.intoto.json: one in-toto Statement whose subjects are the files
+the run wrote or reused under the output directory (binaries, reports,
+SBOMs, disk images) with their SHA-256, and whose predicate
+(https://slsa.dev/provenance/v1) records
+
+- the builder: the GitHub Actions workflow that ran the pipeline, or the
+  local host, with the tool versions from toolchain_report.py;
+- the source: the repository, ref and commit;
+- the build parameters: the pipeline arguments, and this run's input
+  fingerprint (fingerprint.py) with the non-secret REGICIDE_* variables;
+- the materials: the commit, Cargo.lock when it is committed, and every
+  pinned base image by digest, with any known-good fallback or image
+  override this run used.
+
+--dist exports it with the files, so it can be attached to a release next
+to them.  It is not signed: `cosign attest-blob --predicate` it, or verify
+the artifacts' own signatures, when the builder has to be trusted.
+"""
+
+import getpass
+import json
+import os
+import platform
+import sys
+import time
+from pathlib import Path
+
+import artifacts
+import build_info
+import failure_bundle
+import image_lock
+import run_history
+import stage_memo
+import toolchain_report
+import workspace_checks
+
+
+PATH = artifacts.OUTPUT_DIR / "provenance.intoto.json"
+BUILD_TYPE = f"{build_info.SOURCE_URL}/tree/main/build-system#dagger-pipeline-v1"
+
+
+def subjects(before: dict[Path, int]) -> list[dict]:
+    """Return the in-toto subjects for the files written since stage_memo.snapshot() returned before, or reused."""
+    files = {*stage_memo.changed(before), *stage_memo.reused()} - {PATH}
+    return [
+        {"name": path.relative_to(artifacts.OUTPUT_DIR).as_posix(), "digest": {"sha256": run_history.sha256(path)}}
+        for path in sorted(files)
+        if path.is_file()
+    ]
+
+
+def builder_id() -> str:
+    """Return the workflow that ran this build in GitHub Actions, else the local user and host."""
+    workflow = os.environ.get("GITHUB_WORKFLOW_REF")
+    if workflow:
+        return f"{os.environ.get('GITHUB_SERVER_URL', 'https://github.com')}/{workflow}"
+    return f"local:{getpass.getuser()}@{platform.node()}"
+
+
+def invocation_id() -> str:
+    """Return the GitHub Actions run attempt, else this run's ID."""
+    if os.environ.get("GITHUB_RUN_ID"):
+        return (
+            f"{os.environ.get('GITHUB_SERVER_URL', 'https://github.com')}/{os.environ.get('GITHUB_REPOSITORY', '')}"
+            f"/actions/runs/{os.environ['GITHUB_RUN_ID']}/attempts/{os.environ.get('GITHUB_RUN_ATTEMPT', '1')}"
+        )
+    return run_history.run_id()
+
+
+def materials() -> list[dict]:
+    """Return the resolved dependencies: the commit, Cargo.lock when there is one, and the pinned images.
+
+    A missing Cargo.lock fails the Cargo stages that read it, not the provenance.
+    """
+    source = f"git+{build_info.SOURCE_URL}@{build_info.git_ref()}"
+    dependencies = [{"uri": source, "digest": {"gitCommit": build_info.git_sha()}}]
+    lock = workspace_checks.CARGO_LOCK
+    if lock.is_file():
+        dependencies.append({"uri": f"{source}#{lock.as_posix()}", "digest": {"sha256": run_history.sha256(lock)}})
+    images = image_lock.load() | failure_bundle.fallbacks()
+    for ref, digest in sorted(images.items()):
+        algorithm, _, value = digest.partition(":")
+        dependencies.append({"uri": f"docker://{ref}", "digest": {algorithm: value}})
+    # An override is recorded as given; only one pulled by digest has one.
+    for image in sorted({override["image"] for override in run_history.image_overrides()}):
+        _, _, digest = image.partition("@")
+        algorithm, _, value = digest.partition(":")
+        dependencies.append({"uri": f"docker://{image}", **({"digest": {algorithm: value}} if value else {})})
+    return dependencies
+
+
+def statement(before: dict[Path, int]) -> dict:
+    """Return the SLSA v1 provenance statement for this run."""
+    return {
+        "_type": "https://in-toto.io/Statement/v1",
+        "subject": subjects(before),
+        "predicateType": "https://slsa.dev/provenance/v1",
+        "predicate": {
+            "buildDefinition": {
+                "buildType": BUILD_TYPE,
+                "externalParameters": {
+                    "source": {
+                        "uri": build_info.SOURCE_URL, "ref": build_info.git_ref(), "commit": build_info.git_sha(),
+                    },
+                    "arguments": sys.argv[1:],
+                },
+                "internalParameters": {"fingerprint": run_history.fingerprint()},
+                "resolvedDependencies": materials(),
+            },
+            "runDetails": {
+                "builder": {"id": builder_id(), "version": toolchain_report.tools()},
+                "metadata": {
+                    "invocationId": invocation_id(),
+                    "startedOn": time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime(run_history.started())),
+                    "finishedOn": time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime()),
+                },
+            },
+        },
+    }
+
+
+def write(before: dict[Path, int]) -> Path:
+    """Write PATH for the files produced since before and return it."""
+    PATH.parent.mkdir(parents=True, exist_ok=True)
+    PATH.write_text(json.dumps(statement(before), indent=2) + "\n", newline="\n")
+    return PATH
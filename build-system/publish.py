@@ -0,0 +1,65 @@
+"""Publish - push the btrmind container image to ghcr.io.
+
+btrmind_image() packages the release-optimized btrmind with its config,
+systemd unit, sysusers and tmpfiles entries on debian:bookworm-slim (the
+glibc the binary was built against), labelled with build_info.oci_labels()
+after oci_policy.enforce() has passed them.  push() tags it with the
+commit SHA and the crate version and pushes both to REPOSITORY, logging
+in with the registry token as a Dagger secret.  Only --publish runs it,
+so pull-request runs never push.
+"""
+
+import os
+
+import dagger
+
+import build_info
+import oci_policy
+import source_layout
+import workspace_checks
+from failure_bundle import checked_exec, from_image
+
+
+REGISTRY = "ghcr.io"
+REPOSITORY = os.environ.get("REGICIDE_PUBLISH_REPOSITORY", "ghcr.io/awdemos/btrmind")
+BASE_IMAGE = "debian:bookworm-slim"
+
+
+def credentials() -> tuple[str, str] | None:
+    """Return (user, token) for REGISTRY: GHCR_TOKEN or GITHUB_TOKEN, as GITHUB_ACTOR."""
+    token = os.environ.get("GHCR_TOKEN") or os.environ.get("GITHUB_TOKEN")
+    user = os.environ.get("GHCR_USER") or os.environ.get("GITHUB_ACTOR")
+    return (user, token) if token and user else None
+
+
+async def btrmind_image(client: dagger.Client, version: str) -> dagger.Container:
+    """Return the btrmind image, checked to start and labelled per oci-label-policy.toml."""
+    labels = build_info.oci_labels("release-optimized", version) | {
+        "org.opencontainers.image.title": "btrmind",
+        "org.opencontainers.image.description": "btrmind, the RegicideOS BTRFS storage agent",
+    }
+    oci_policy.enforce(f"{REPOSITORY}:{version}", labels)
+    binaries = await workspace_checks.optimized_binaries(client)
+    source = client.host().directory(str(source_layout.component("btrmind")), include=["config/", "systemd/"])
+    image = (
+        from_image(client, BASE_IMAGE)
+        .with_file("/usr/local/bin/btrmind", binaries.file("btrmind"), permissions=0o755)
+        .with_file("/etc/btrmind/config.toml", source.file("config/btrmind.toml"))
+        .with_file("/usr/lib/systemd/system/btrmind.service", source.file("systemd/btrmind.service"))
+        .with_file("/usr/lib/sysusers.d/btrmind.conf", source.file("systemd/btrmind.sysusers"))
+        .with_file("/usr/lib/tmpfiles.d/btrmind.conf", source.file("systemd/btrmind.tmpfiles"))
+        .with_entrypoint(["/usr/local/bin/btrmind"])
+        .with_default_args(["run"])
+    )
+    for name, value in labels.items():
+        image = image.with_label(name, value)
+    # Catch a binary that does not start on the base image before pushing it.
+    await checked_exec(image, ["/usr/local/bin/btrmind", "--version"], "publish-image-check")
+    return image
+
+
+async def push(client: dagger.Client, image: dagger.Container, version: str) -> list[str]:
+    """Push image as REPOSITORY:<commit> and REPOSITORY:<version>; return the pushed references."""
+    user, token = credentials()
+    image = image.with_registry_auth(REGISTRY, user, client.set_secret("ghcr-token", token))
+    return [await image.publish(f"{REPOSITORY}:{tag}") for tag in (build_info.git_sha(), version)]
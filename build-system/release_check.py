@@ -0,0 +1,82 @@
+"""Release check - the full matrix before a release, and one go/no-go report.
+
+`ci.py release-check` runs each check of its RELEASE_MATRIX as its own
+pipeline run (release-check-<date>-<check>), so one failing check does
+not hide the others; report() turns the results into
+reports/release-readiness.md.  The release is a go only when every check
+passed: a check that could not run, such as the upgrade path without
+--previous-qcow2, is a no-go too.
+
+The OS image checks sign with a throwaway cosign key (the signing dry
+run): nothing reaches Rekor or a registry, but every signature, bundle and
+attestation a release carries is made and then verified with `ci.py
+verify --key`.
+"""
+
+import json
+import os
+import time
+
+import build_info
+import exit_codes
+import run_history
+
+
+REPORT = "release-readiness.md"
+
+
+def _minutes(seconds: float) -> str:
+    return f"{seconds / 60:.0f} min"
+
+
+def report(results: dict[str, dict]) -> tuple[bool, str]:
+    """Return (go, Markdown report) for results: check -> {"covers", "exit_code", "note", "run"}.
+
+    exit_code None means the check did not run; note says why.
+    """
+    go = all(result["exit_code"] == exit_codes.OK for result in results.values())
+    lines = [
+        f"# Release readiness: {'GO' if go else 'NO-GO'}",
+        "",
+        f"Commit `{build_info.git_sha()}` ({build_info.git_ref()}), checked {time.strftime('%Y-%m-%d %H:%M UTC', time.gmtime())}.",
+        "",
+        "| check | covers | result | time | run |",
+        "|---|---|---|---:|---|",
+    ]
+    failures = []
+    for check, result in results.items():
+        try:
+            summary = run_history.load_summary(result["run"])
+        except (FileNotFoundError, json.JSONDecodeError):
+            summary = None
+        if result["exit_code"] is None:
+            status = "not run"
+        elif result["exit_code"] == exit_codes.OK:
+            status = "passed" + (" with warnings" if summary and summary.get("warnings") else "")
+        else:
+            status = f"**failed** (exit {result['exit_code']})"
+        seconds = _minutes(summary["seconds"]) if summary else ""
+        run = f"`{result['run']}`" if result["run"] else ""
+        lines.append(f"| {check} | {result['covers']} | {status} | {seconds} | {run} |")
+        if result["exit_code"] != exit_codes.OK:
+            failed = [s["stage"] for s in (summary or {}).get("stages", []) if s["status"] == "failed"]
+            detail = result["note"] or (f"failed steps: {', '.join(failed)}" if failed else "see the run's logs")
+            failures.append(f"- **{check}**: {detail}")
+        for warning in (summary or {}).get("warnings", []):
+            failures.append(f"- {check} (warning): {warning['stage']}: {warning['message']}")
+    if failures:
+        lines += ["", "## Problems", "", *failures]
+    lines += [
+        "",
+        "Failure bundles are under `build-system/catalyst/output/failures/<run>/`; "
+        "re-run one check with `ci.py release-check --only <check>`.",
+    ]
+    return go, "\n".join(lines) + "\n"
+
+
+def publish(report_text: str) -> None:
+    """Append the report to $GITHUB_STEP_SUMMARY when set."""
+    step_summary = os.environ.get("GITHUB_STEP_SUMMARY")
+    if step_summary:
+        with open(step_summary, "a") as f:
+            f.write(report_text + "\n")
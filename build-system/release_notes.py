@@ -0,0 +1,74 @@
+"""Aggregate component changelogs into one set of release notes.
+
+Each component keeps a Keep a Changelog style CHANGELOG.md
+(https://keepachangelog.com): `## [version]` sections containing
+`### Added` / `### Changed` / `### Fixed` ... subsections.  The notes for a
+release gather that version's section (or `Unreleased`) from every
+component, grouped by change type.
+"""
+
+import re
+
+import source_layout
+
+
+# Heading in the notes -> layout.toml component, in the order they appear.
+COMPONENT_CHANGELOGS = {
+    "Installer": "installer",
+    "BtrMind": "btrmind",
+    "regicide-rust overlay": "overlay",
+}
+CHANGE_TYPES = ["Added", "Changed", "Deprecated", "Removed", "Fixed", "Security"]
+
+
+def changelog_section(text: str, version: str) -> dict[str, list[str]] | None:
+    """Return {change type: [entries]} from the `## [version]` section of text.
+
+    Returns None when text has no section for version.
+    """
+    match = re.search(
+        rf"^## \[{re.escape(version)}\][^\n]*\n(.*?)(?=^## \[|\Z)",
+        text,
+        re.MULTILINE | re.DOTALL,
+    )
+    if match is None:
+        return None
+    changes: dict[str, list[str]] = {}
+    current = "Changed"
+    for line in match.group(1).splitlines():
+        heading = re.match(r"^### (\w+)", line)
+        if heading:
+            current = heading.group(1)
+        elif line.startswith(("- ", "* ")):
+            changes.setdefault(current, []).append(line[2:].strip())
+        elif line.startswith("  ") and changes.get(current):
+            # Continuation of a wrapped entry.
+            changes[current][-1] += " " + line.strip()
+    return changes
+
+
+def release_notes(version: str = "Unreleased") -> str:
+    """Return Markdown release notes for version across all components."""
+    title = "Unreleased changes" if version == "Unreleased" else f"RegicideOS {version}"
+    lines = [f"# {title}", ""]
+    by_type: dict[str, list[str]] = {}
+    missing = []
+    for component, name in COMPONENT_CHANGELOGS.items():
+        path = source_layout.component(name) / "CHANGELOG.md"
+        if not path.is_file():
+            missing.append(f"{component} (`{path}` missing)")
+            continue
+        section = changelog_section(path.read_text(), version)
+        if section is None:
+            missing.append(f"{component} (no `[{version}]` section)")
+            continue
+        for change_type, entries in section.items():
+            by_type.setdefault(change_type, []).extend(f"**{component}:** {entry}" for entry in entries)
+    for change_type in [*CHANGE_TYPES, *sorted(set(by_type) - set(CHANGE_TYPES))]:
+        if change_type in by_type:
+            lines += [f"## {change_type}", "", *(f"- {entry}" for entry in by_type[change_type]), ""]
+    if not by_type:
+        lines += ["No changes recorded.", ""]
+    if missing:
+        lines += ["## Components without notes", "", *(f"- {entry}" for entry in missing), ""]
+    return "\n".join(lines)
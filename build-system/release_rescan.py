@@ -0,0 +1,122 @@
+"""Release re-scan - check published releases against today's vulnerability data.
+
+`ci.py rescan --release vX.Y.Z` downloads the release's SBOM and binaries
+from its GitHub release, plus any published images given with --image,
+and scans them with trivy and a vulnerability DB refreshed today.  With
+--notify, findings at or above the threshold open one GitHub issue per
+release (labelled release-vulnerable), and a comment whenever the set of
+advisories changes, so maintainers learn when an old release becomes
+vulnerable.  Meant to run on a schedule for every supported release.
+Requires Dagger and the GitHub CLI with a token in GH_TOKEN/GITHUB_TOKEN.
+"""
+
+import asyncio
+import hashlib
+import json
+import re
+import subprocess
+import sys
+from pathlib import Path
+
+import dagger
+
+import security_scan
+import workspace_checks
+
+
+# Release assets the re-scan looks for, among those dagger_pipeline.py
+# --release-tag attaches (github_release.ASSETS); a release may carry any
+# subset.
+SBOM_ASSET = "sbom.spdx.json"
+BINARY_ASSETS = ["installer", "btrmind"]
+ISSUE_LABEL = "release-vulnerable"
+MARKER = "regicide-release-rescan"
+REPORTS_DIR = workspace_checks.REPORTS_DIR / "rescan"
+
+
+def _gh(*args: str) -> str:
+    return subprocess.run(["gh", *args], check=True, capture_output=True, text=True).stdout
+
+
+def download(tag: str, dest: Path) -> list[str]:
+    """Download the release assets tag carries into dest; return their names."""
+    dest.mkdir(parents=True, exist_ok=True)
+    downloaded = []
+    for asset in [SBOM_ASSET, *BINARY_ASSETS]:
+        try:
+            _gh("release", "download", tag, "--pattern", asset, "--dir", str(dest), "--clobber")
+        except subprocess.CalledProcessError:
+            continue
+        downloaded.append(asset)
+    return downloaded
+
+
+async def rescan(tag: str, images: list[str], threshold: str) -> tuple[list[dict], list[dict]]:
+    """Scan release tag and images; return (all findings, findings at or above threshold).
+
+    Reports go to reports/rescan/<tag>/.  Raises ValueError when there is
+    nothing to scan.
+    """
+    out_dir = REPORTS_DIR / tag
+    assets = download(tag, out_dir / "assets")
+    if not assets and not images:
+        expected = ", ".join([SBOM_ASSET, *BINARY_ASSETS])
+        raise ValueError(f"release {tag} has none of {expected}, and no --image was given")
+    print(f"Re-scanning {tag}: {', '.join([*assets, *images])}")
+
+    config = dagger.Config(log_output=sys.stderr)
+    async with dagger.Connection(config) as client:
+        scans = {}
+        if SBOM_ASSET in assets:
+            sbom = client.host().directory(str(out_dir / "assets"), include=[SBOM_ASSET])
+            scans["sbom"] = security_scan.trivy_artifacts(client, sbom, SBOM_ASSET)
+        binaries = [asset for asset in assets if asset in BINARY_ASSETS]
+        if binaries:
+            scans["binaries"] = security_scan.trivy_artifacts(
+                client, client.host().directory(str(out_dir / "assets"), include=binaries), None
+            )
+        for ref in images:
+            scans[f"image-{re.sub(r'[^A-Za-z0-9_.-]+', '_', ref)}"] = security_scan.trivy_image(client, ref)
+        reports = dict(zip(scans, await asyncio.gather(*scans.values())))
+
+    findings: dict[tuple, dict] = {}
+    for name, report in reports.items():
+        (out_dir / f"{name}.json").write_text(report)
+        for finding in security_scan.parse_trivy(report):
+            findings.setdefault((finding["id"], finding["package"]), finding)
+    merged = sorted(findings.values(), key=lambda f: (-security_scan.SEVERITIES.index(f["severity"]), f["id"]))
+    (out_dir / "findings.json").write_text(json.dumps(merged, indent=2) + "\n")
+    (out_dir / "summary.txt").write_text(security_scan.summary(merged, threshold))
+    print(f"Output: {out_dir}/")
+    return merged, security_scan.blocking(merged, threshold)
+
+
+def notify(tag: str, blocked: list[dict], threshold: str) -> None:
+    """Open or update the GitHub issue tracking tag's vulnerabilities."""
+    advisories = sorted({f"{f['id']} {f['package']}" for f in blocked})
+    digest = hashlib.sha256("\n".join(advisories).encode()).hexdigest()[:12]
+    body = (
+        f"Release `{tag}` has {len(blocked)} findings at or above {threshold} against today's "
+        "vulnerability data. Consider a point release or an advisory.\n\n"
+        f"```\n{security_scan.summary(blocked, threshold)}```\n\n"
+        f"<!-- {MARKER}: {tag} {digest} -->\n"
+    )
+    issues = json.loads(_gh(
+        "issue", "list",
+        "--state", "open",
+        "--label", ISSUE_LABEL,
+        "--search", f'"{MARKER}: {tag}" in:body',
+        "--json", "number,body,comments",
+    ))
+    if not issues:
+        _gh("issue", "create", "--title", f"Release {tag} is affected by new vulnerabilities",
+            "--label", ISSUE_LABEL, "--body", body)
+        print(f"Filed release vulnerability issue for {tag}")
+        return
+    issue = issues[0]
+    seen = [issue["body"], *(comment["body"] for comment in issue["comments"])]
+    if any(f"{MARKER}: {tag} {digest}" in text for text in seen):
+        print(f"Issue #{issue['number']} already lists these findings")
+        return
+    _gh("issue", "comment", str(issue["number"]), "--body", body)
+    print(f"Updated issue #{issue['number']} for {tag}")
@@ -0,0 +1,96 @@
+"""Retention - garbage-collect old run history, failure bundles and artifacts.
+
+Every run leaves runs/<run>/ (summary, events, logs, timings) and, when
+it fails, failures/<run>/; nightly runs also export images and reports
+that can fill a disk.  collect() keeps the keep_last most recent runs
+and, with keep_releases, every passed run whose commit is tagged, and
+returns the rest for deletion: their run and failure directories, and
+the artifacts whose newest recorder is not kept.  An artifact modified
+since the oldest kept or in-progress run started is never collected,
+whoever recorded it: that run may have overwritten it.  Run directories
+without a summary.json belong to a run still in progress and are never
+collected.  Paths are relative to the source root.
+"""
+
+import calendar
+import shutil
+import subprocess
+import time
+from pathlib import Path
+
+import failure_bundle
+import run_history
+
+
+def release_commits() -> set[str]:
+    """Return the commits that release tags point at."""
+    try:
+        refs = subprocess.run(
+            ["git", "show-ref", "--tags", "--dereference"], check=True, capture_output=True, text=True,
+        ).stdout
+    except (OSError, subprocess.CalledProcessError):
+        # show-ref exits 1 when there are no tags.
+        return set()
+    return {line.split()[0] for line in refs.splitlines()}
+
+
+def window(summaries: list[dict], keep: set[str]) -> float:
+    """Return when the oldest kept or in-progress run started, as a timestamp.
+
+    Returns infinity when there is no such run, so nothing is too new.
+    """
+    starts = [
+        calendar.timegm(time.strptime(s["started"], "%Y-%m-%dT%H:%M:%SZ")) for s in summaries if s["run"] in keep
+    ]
+    if run_history.RUNS_DIR.is_dir():
+        starts += [
+            path.stat().st_mtime for path in run_history.RUNS_DIR.iterdir()
+            if path.is_dir() and not (path / "summary.json").exists()
+        ]
+    return min(starts, default=float("inf"))
+
+
+def collect(keep_last: int, keep_releases: bool = False) -> list[Path]:
+    """Return the paths garbage collection would delete, oldest run first."""
+    summaries = run_history.recent_summaries(0)
+    keep = {summary["run"] for summary in summaries[-keep_last:]} if keep_last else set()
+    if keep_releases:
+        tagged = release_commits()
+        keep |= {s["run"] for s in summaries if s["status"] == "passed" and s.get("commit") in tagged}
+    # Summaries are oldest first, so the last run to record a path wins.
+    recorder = {artifact["path"]: s["run"] for s in summaries for artifact in s["artifacts"].values()}
+    since = window(summaries, keep)
+    doomed = []
+    for summary in summaries:
+        if summary["run"] in keep:
+            continue
+        for artifact in summary["artifacts"].values():
+            path = Path(artifact["path"])
+            if recorder[artifact["path"]] in keep or not path.exists() or path in doomed:
+                continue
+            if path.stat().st_mtime >= since:
+                continue
+            doomed.append(path)
+        for path in (failure_bundle.FAILURES_DIR / summary["run"], run_history.RUNS_DIR / summary["run"]):
+            if path.exists():
+                doomed.append(path)
+    return doomed
+
+
+def size(path: Path) -> int:
+    """Return the bytes path takes up, recursively for directories."""
+    if path.is_file():
+        return path.stat().st_size
+    return sum(child.stat().st_size for child in path.rglob("*") if child.is_file())
+
+
+def delete(paths: list[Path]) -> int:
+    """Delete paths and return the bytes freed."""
+    freed = 0
+    for path in paths:
+        freed += size(path)
+        if path.is_dir():
+            shutil.rmtree(path)
+        else:
+            path.unlink()
+    return freed
@@ -0,0 +1,392 @@
+"""Run history - per-run summaries for comparing pipeline runs.
+
+Every pipeline run writes build-system/catalyst/output/runs/<run>/summary.json
+with the status and duration of each stage, the size and hash of each
+artifact, any numeric metrics (e.g. coverage percent) stages recorded, the
+security findings of a scanning run, the crates Cargo.lock pins, and the
+input fingerprints from fingerprint.py with what changed since the previous
+run.  Each run ends by printing timings(), a table of its stages,
+also saved as runs/<run>/timings.txt.  `dagger_pipeline.py --compare RUN_A
+RUN_B` diffs two summaries as Markdown and `--trends N` tabulates the last N.
+"""
+
+import hashlib
+import json
+import os
+import sys
+import time
+import tomllib
+from pathlib import Path
+
+
+RUNS_DIR = Path("build-system/catalyst/output/runs")
+CARGO_LOCK = Path("Cargo.lock")
+# An exec that returns faster than this with unchanged inputs was almost
+# certainly served from Dagger's cache; the SDK does not report cache hits.
+CACHED_SECONDS = 1.0
+
+_run_id: str | None = None
+_started = time.time()
+_stages: list[dict] = []
+_artifacts: dict[str, Path] = {}
+_metrics: dict[str, float] = {}
+_fingerprint: dict[str, str] = {}
+_warnings: list[dict] = []
+_image_overrides: list[dict] = []
+_memo: dict[str, dict] = {}
+_findings: list[dict] | None = None
+_commit = ""
+_branch = ""
+
+
+def started() -> float:
+    """Return when this run started, as a timestamp."""
+    return _started
+
+
+def run_id() -> str:
+    """Return the ID of this pipeline run (REGICIDE_RUN_ID, GITHUB_RUN_ID, or a timestamp)."""
+    global _run_id
+    if _run_id is None:
+        _run_id = (
+            os.environ.get("REGICIDE_RUN_ID")
+            or os.environ.get("GITHUB_RUN_ID")
+            or time.strftime("%Y%m%dT%H%M%SZ", time.gmtime(_started))
+        )
+    return _run_id
+
+
+def record_stage(stage: str, status: str, seconds: float, inputs: str = "") -> None:
+    """Record the outcome of one stage of this run and the digest of its inputs."""
+    entry = {"stage": stage, "status": status, "seconds": round(seconds, 1)}
+    if inputs:
+        entry["inputs"] = inputs
+    _stages.append(entry)
+
+
+def mark_advisory(stage: str) -> None:
+    """Mark stage's failed steps as advisory: failed, but not failing the run."""
+    for entry in _stages:
+        if entry["stage"] == stage and entry["status"] == "failed":
+            entry["status"] = "advisory"
+
+
+def record_warning(stage: str, message: str) -> None:
+    """Record an advisory failure of this run."""
+    _warnings.append({"stage": stage, "message": message})
+
+
+def record_image_override(stage: str, ref: str, image: str) -> None:
+    """Record that stage ("" for outside any stage) pulled image in place of ref."""
+    _image_overrides.append({"stage": stage, "ref": ref, "image": image})
+
+
+def image_overrides() -> list[dict]:
+    """Return the image overrides this run used, as record_image_override() recorded them."""
+    return list(_image_overrides)
+
+
+def record_artifact(name: str, path: Path) -> None:
+    """Record an artifact produced by this run; it is hashed when the summary is written."""
+    _artifacts[name] = path
+
+
+def record_metric(name: str, value: float) -> None:
+    """Record a numeric metric of this run, such as line coverage percent."""
+    _metrics[name] = value
+
+
+def record_fingerprint(components: dict[str, str]) -> None:
+    """Record the named environment components this run was built from."""
+    _fingerprint.update(components)
+
+
+def fingerprint() -> dict[str, str]:
+    """Return the environment components recorded for this run."""
+    return dict(_fingerprint)
+
+
+def record_memo(stage: str, key: str, outputs: dict[str, str]) -> None:
+    """Record that stage passed under memo key, writing outputs ({path: sha256})."""
+    _memo[stage] = {"key": key, "outputs": outputs}
+
+
+def record_findings(findings: list[dict]) -> None:
+    """Record the security findings of this run (security_scan.scan's normalized list)."""
+    global _findings
+    _findings = sorted(
+        ({key: finding[key] for key in ("scanner", "id", "severity", "package")} for finding in findings),
+        key=lambda finding: (finding["id"], finding["package"], finding["scanner"]),
+    )
+
+
+def locked_dependencies(lock: Path = CARGO_LOCK) -> dict[str, list[str]]:
+    """Return {crate: [versions]} pinned by a Cargo.lock, or {} without one."""
+    if not lock.is_file():
+        return {}
+    with lock.open("rb") as f:
+        packages = tomllib.load(f).get("package", [])
+    versions: dict[str, list[str]] = {}
+    for package in packages:
+        versions.setdefault(package["name"], []).append(package["version"])
+    return {name: sorted(found) for name, found in sorted(versions.items())}
+
+
+def record_commit(sha: str) -> None:
+    """Record the git commit this run built."""
+    global _commit
+    _commit = sha
+
+
+def record_branch(name: str) -> None:
+    """Record the branch this run built."""
+    global _branch
+    _branch = name
+
+
+def sha256(path: Path) -> str:
+    """Return the hex SHA-256 of the file at path."""
+    digest = hashlib.sha256()
+    with path.open("rb") as f:
+        for chunk in iter(lambda: f.read(1 << 20), b""):
+            digest.update(chunk)
+    return digest.hexdigest()
+
+
+def write_summary(status: str) -> Path:
+    """Write runs/<run>/summary.json for this run and return its path."""
+    artifacts = {}
+    for name, path in _artifacts.items():
+        if path.is_file():
+            artifacts[name] = {"path": str(path), "size": path.stat().st_size, "sha256": sha256(path)}
+    summary = {
+        "run": run_id(),
+        "status": status,
+        "commit": _commit,
+        "branch": _branch,
+        "started": time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime(_started)),
+        "seconds": round(time.time() - _started, 1),
+        "argv": sys.argv,
+        "stages": _stages,
+        "artifacts": artifacts,
+        "metrics": _metrics,
+        "fingerprint": _fingerprint,
+        "warnings": _warnings,
+        "image_overrides": _image_overrides,
+        "memo": _memo,
+        "dependencies": locked_dependencies(),
+    }
+    if _findings is not None:
+        summary["vulnerabilities"] = _findings
+    previous = previous_summary()
+    if previous is not None:
+        summary["changes"] = {"since": previous["run"], "changed": changes(previous, summary)}
+    path = RUNS_DIR / run_id() / "summary.json"
+    path.parent.mkdir(parents=True, exist_ok=True)
+    path.write_text(json.dumps(summary, indent=2) + "\n")
+    (path.parent / "timings.txt").write_text(timings(summary))
+    return path
+
+
+def load_summary(run: str) -> dict:
+    """Load the summary of a previous run."""
+    return json.loads((RUNS_DIR / run / "summary.json").read_text())
+
+
+def previous_summary() -> dict | None:
+    """Return the summary of the most recent earlier run, if any."""
+    earlier = [s for s in recent_summaries(0) if s["run"] != run_id()]
+    return earlier[-1] if earlier else None
+
+
+def changes(before: dict, after: dict) -> list[str]:
+    """Return what changed between two runs' fingerprints, one line per change.
+
+    Environment components are listed first, then stages whose step inputs
+    changed; a stage recorded in only one run is not a change.
+    """
+    lines = []
+    fa, fb = before.get("fingerprint", {}), after.get("fingerprint", {})
+    for name in sorted({*fa, *fb}):
+        if fa.get(name) != fb.get(name):
+            lines.append(f"{name}: {fa.get(name, '-')} -> {fb.get(name, '-')}")
+
+    def inputs(summary: dict) -> dict[str, list[str]]:
+        steps: dict[str, list[str]] = {}
+        for stage in summary["stages"]:
+            if stage.get("inputs"):
+                steps.setdefault(stage["stage"], []).append(stage["inputs"])
+        return steps
+
+    sa, sb = inputs(before), inputs(after)
+    for stage in sorted(sa.keys() & sb.keys()):
+        if sorted(sa[stage]) != sorted(sb[stage]):
+            lines.append(f"stage {stage}: inputs changed")
+    return lines
+
+
+def timings(summary: dict) -> str:
+    """Return a plain-text table of a run's stages: status, duration and cache reuse.
+
+    "cached" is inferred: unchanged inputs since the previous run and a
+    duration under CACHED_SECONDS.  "memo" stages were skipped outright
+    by stage_memo.py.
+    """
+    changed = {line.split(": ")[0].removeprefix("stage ") for line in summary.get("changes", {}).get("changed", [])}
+    lines = [f"{'stage':<32} {'status':<9} {'seconds':>9}  cache"]
+    for stage in summary["stages"]:
+        if stage["status"] == "skipped":
+            cache = "-"
+        elif stage["status"] == "reused":
+            cache = "memo"
+        elif stage["seconds"] < CACHED_SECONDS and stage["stage"] not in changed:
+            cache = "cached"
+        else:
+            cache = "ran"
+        lines.append(f"{stage['stage']:<32} {stage['status']:<9} {stage['seconds']:>9}  {cache}")
+    lines.append(f"{'total':<32} {summary['status']:<9} {summary['seconds']:>9}")
+    return "\n".join(lines) + "\n"
+
+
+def _delta(before: float | None, after: float | None) -> str:
+    if before is None or after is None:
+        return ""
+    diff = after - before
+    percent = f" ({diff / before:+.0%})" if before else ""
+    return f"{diff:+.1f}{percent}"
+
+
+def _vulnerability_changes(a: dict, b: dict) -> list[str]:
+    """Return Markdown lines for the findings new in run b and those gone since run a."""
+    if "vulnerabilities" not in a or "vulnerabilities" not in b:
+        unscanned = " and ".join(s["run"] for s in (a, b) if "vulnerabilities" not in s)
+        return [f"Not compared: no security scan in run {unscanned}."]
+
+    def keyed(summary: dict) -> dict[tuple, dict]:
+        return {(f["scanner"], f["id"], f["package"]): f for f in summary["vulnerabilities"]}
+
+    before, after = keyed(a), keyed(b)
+    rows = [
+        f"| {status} | {f['id']} | {f['package'] or '-'} | {f['severity']} | {f['scanner']} |"
+        for status, found, other in (("new", after, before), ("fixed", before, after))
+        for key, f in found.items() if key not in other
+    ]
+    if not rows:
+        return [f"No change ({len(after)} findings in both runs)."]
+    return ["| change | id | package | severity | scanner |", "|---|---|---|---|---|", *rows]
+
+
+def _dependency_changes(a: dict, b: dict) -> list[str]:
+    """Return Markdown lines for the crates added, removed or re-versioned between two runs."""
+    before, after = a.get("dependencies", {}), b.get("dependencies", {})
+    if not before or not after:
+        return ["Not compared: a run recorded no Cargo.lock."]
+    rows = [
+        f"| {name} | {', '.join(before.get(name, [])) or '-'} | {', '.join(after.get(name, [])) or '-'} |"
+        for name in sorted({*before, *after})
+        if before.get(name) != after.get(name)
+    ]
+    if not rows:
+        return [f"No change ({len(after)} crates)."]
+    return ["| crate | A | B |", "|---|---|---|", *rows]
+
+
+def compare(run_a: str, run_b: str) -> str:
+    """Return a Markdown comparison of two runs for release review.
+
+    Covers stage status and durations, artifact sizes, metrics such as
+    coverage, new and fixed security findings, dependency changes, and the
+    inputs that changed between them.
+    """
+    a, b = load_summary(run_a), load_summary(run_b)
+    lines = [
+        f"# Run comparison: {run_a} -> {run_b}",
+        "",
+        "| | A | B | delta |",
+        "|---|---|---|---|",
+        f"| run | {run_a} | {run_b} | |",
+        f"| commit | {a.get('commit', '')[:12]} | {b.get('commit', '')[:12]} | |",
+        f"| status | {a['status']} | {b['status']} | |",
+        f"| seconds | {a['seconds']} | {b['seconds']} | {_delta(a['seconds'], b['seconds'])} |",
+        "",
+        "## Stages",
+        "",
+        "| stage | A status | B status | A s | B s | delta |",
+        "|---|---|---|---:|---:|---:|",
+    ]
+    stages_a = {s["stage"]: s for s in a["stages"]}
+    stages_b = {s["stage"]: s for s in b["stages"]}
+    for stage in dict.fromkeys([*stages_a, *stages_b]):
+        sa, sb = stages_a.get(stage, {}), stages_b.get(stage, {})
+        lines.append(
+            f"| {stage} | {sa.get('status', '-')} | {sb.get('status', '-')} | "
+            f"{sa.get('seconds', '')} | {sb.get('seconds', '')} | {_delta(sa.get('seconds'), sb.get('seconds'))} |"
+        )
+    lines += ["", "## Artifacts", ""]
+    if a["artifacts"] or b["artifacts"]:
+        lines += ["| artifact | A bytes | B bytes | delta | content |", "|---|---:|---:|---:|---|"]
+    else:
+        lines.append("Neither run recorded artifacts.")
+    for name in dict.fromkeys([*a["artifacts"], *b["artifacts"]]):
+        fa, fb = a["artifacts"].get(name, {}), b["artifacts"].get(name, {})
+        if fa and fb:
+            content = "same" if fa["sha256"] == fb["sha256"] else "changed"
+        else:
+            content = "added" if fb else "removed"
+        lines.append(
+            f"| {name} | {fa.get('size', '')} | {fb.get('size', '')} | "
+            f"{_delta(fa.get('size'), fb.get('size'))} | {content} |"
+        )
+    metrics_a, metrics_b = a.get("metrics", {}), b.get("metrics", {})
+    lines += ["", "## Metrics", ""]
+    if metrics_a or metrics_b:
+        lines += ["| metric | A | B | delta |", "|---|---:|---:|---:|"]
+        for name in sorted({*metrics_a, *metrics_b}):
+            ma, mb = metrics_a.get(name), metrics_b.get(name)
+            lines.append(f"| {name} | {'' if ma is None else ma} | {'' if mb is None else mb} | {_delta(ma, mb)} |")
+    else:
+        lines.append("Neither run recorded metrics (coverage, benchmarks, image size).")
+    lines += ["", "## Vulnerabilities", "", *_vulnerability_changes(a, b)]
+    lines += ["", "## Dependencies", "", *_dependency_changes(a, b)]
+    changed = changes(a, b)
+    lines += ["", "## Changed inputs", "", *(f"- {c}" for c in changed)] if changed else [
+        "", "## Changed inputs", "", "None recorded."
+    ]
+    return "\n".join(lines) + "\n"
+
+
+def recent_summaries(limit: int) -> list[dict]:
+    """Return up to limit run summaries (all of them for 0), oldest first."""
+    summaries = [json.loads(path.read_text()) for path in RUNS_DIR.glob("*/summary.json")]
+    summaries.sort(key=lambda summary: summary["started"])
+    return summaries[-limit:]
+
+
+def trends(limit: int = 20) -> str:
+    """Return a Markdown trend report of duration, metrics, and artifact sizes."""
+    summaries = recent_summaries(limit)
+    if not summaries:
+        return "No run summaries found."
+    metrics = sorted({name for s in summaries for name in s.get("metrics", {})})
+    artifacts = sorted({name for s in summaries for name in s["artifacts"]})
+    stages = list(dict.fromkeys(stage["stage"] for s in summaries for stage in s["stages"]))
+
+    def table(title: str, columns: list[str], cell) -> list[str]:
+        rows = [f"## {title}", "", "| run | status | " + " | ".join(columns) + " |",
+                "|---|---|" + "---|" * len(columns)]
+        for s in summaries:
+            rows.append(f"| {s['run']} | {s['status']} | " + " | ".join(cell(s, c) for c in columns) + " |")
+        return rows + [""]
+
+    def stage_seconds(s: dict, stage: str) -> str:
+        return next((str(st["seconds"]) for st in s["stages"] if st["stage"] == stage), "")
+
+    lines = [f"# Pipeline trends (last {len(summaries)} runs)", ""]
+    lines += table("Duration (s)", ["total", *stages],
+                   lambda s, c: str(s["seconds"]) if c == "total" else stage_seconds(s, c))
+    if metrics:
+        lines += table("Metrics", metrics, lambda s, c: str(s.get("metrics", {}).get(c, "")))
+    if artifacts:
+        lines += table("Artifact size (bytes)", artifacts,
+                       lambda s, c: str(s["artifacts"].get(c, {}).get("size", "")))
+    return "\n".join(lines)
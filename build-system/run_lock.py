@@ -0,0 +1,136 @@
+"""Run lock - one pipeline run per set of cache volumes at a time.
+
+Overlapping runs that share cache volumes trample the Gentoo volumes
+mid-stage.  key() names the lock after the cache namespace the run's
+volumes use (cache_keys.py): one lock for every branch under the default
+shared strategy, one per branch or per toolchain otherwise.  acquire()
+takes an exclusive flock on output/locks/<key>.lock for the rest of the
+process; the kernel drops it when the process exits, however it exits.
+By default a second run fails at once, naming the run that holds the
+lock.  With queue=True it waits its turn instead, holding a ticket in
+output/locks/<key>.queue/, and with skip_superseded a run that gets the
+lock while a later run of the same branch is still queued behind it is
+skipped: the later run builds a newer commit, or the same one again.
+"""
+
+import fcntl
+import json
+import os
+import re
+import time
+from pathlib import Path
+from typing import TextIO
+
+import build_info
+import cache_keys
+import run_history
+
+
+LOCK_DIR = run_history.RUNS_DIR.parent / "locks"
+
+# Held for the life of the process once acquired.
+_lock: TextIO | None = None
+
+
+# The lock's name when every branch shares the cache volumes.
+SHARED = "shared"
+
+
+class Locked(Exception):
+    """Another run holds the lock and queueing was not requested."""
+
+
+class Superseded(Exception):
+    """A later run of the same branch queued behind this one."""
+
+
+def key() -> str:
+    """Return the name of this run's lock: its cache namespace, or SHARED."""
+    return cache_keys.namespace() or SHARED
+
+
+def _slug(name: str) -> str:
+    return re.sub(r"[^A-Za-z0-9_.-]+", "_", name)
+
+
+def _alive(pid: int) -> bool:
+    try:
+        os.kill(pid, 0)
+    except ProcessLookupError:
+        return False
+    except PermissionError:
+        pass
+    return True
+
+
+def _waiting(queue_dir: Path) -> list[dict]:
+    """Return the live tickets in queue_dir, oldest first, dropping stale ones."""
+    tickets = []
+    for path in sorted(queue_dir.glob("*.json")):
+        try:
+            ticket = json.loads(path.read_text())
+        except (OSError, json.JSONDecodeError):
+            continue
+        if _alive(ticket["pid"]):
+            tickets.append(ticket | {"path": path})
+        else:
+            path.unlink(missing_ok=True)
+    return tickets
+
+
+def acquire(name: str, queue: bool = False, skip_superseded: bool = False) -> None:
+    """Take run lock name (see key()) for the rest of this process.
+
+    Raises Locked when another run holds it and queue is False, and
+    Superseded when skip_superseded is set and a later run of the same
+    branch queued behind this one while it waited.
+    """
+    global _lock
+    LOCK_DIR.mkdir(parents=True, exist_ok=True)
+    path = LOCK_DIR / f"{_slug(name)}.lock"
+    me = {
+        "run": run_history.run_id(), "commit": build_info.git_sha(), "branch": build_info.branch(), "pid": os.getpid(),
+    }
+    lock = path.open("a+")
+    ticket = None
+    try:
+        try:
+            fcntl.flock(lock, fcntl.LOCK_EX | fcntl.LOCK_NB)
+        except BlockingIOError:
+            lock.seek(0)
+            try:
+                held = json.loads(lock.read())
+                holder = (
+                    f"run {held['run']} of {held.get('branch', 'unknown')} at {held['commit'][:12]}, pid {held['pid']}"
+                )
+            except (json.JSONDecodeError, KeyError):
+                holder = "unknown run"
+            if not queue:
+                raise Locked(f"run lock {name} is held by another run ({holder}); pass --queue to wait")
+            queue_dir = LOCK_DIR / f"{_slug(name)}.queue"
+            queue_dir.mkdir(exist_ok=True)
+            ticket = queue_dir / f"{time.time_ns()}-{os.getpid()}.json"
+            ticket.write_text(json.dumps(me))
+            print(f"Waiting for the {name} run lock ({holder})...")
+            fcntl.flock(lock, fcntl.LOCK_EX)
+            if skip_superseded:
+                later = [
+                    t for t in _waiting(queue_dir)
+                    if t["path"].name > ticket.name and t.get("branch") == me["branch"]
+                ]
+                if later:
+                    raise Superseded(
+                        f"run {me['run']} ({me['commit'][:12]}) superseded by run {later[-1]['run']}"
+                        f" ({later[-1]['commit'][:12]}) queued behind it on {me['branch']}"
+                    )
+    except BaseException:
+        lock.close()
+        raise
+    finally:
+        if ticket is not None:
+            ticket.unlink(missing_ok=True)
+    lock.seek(0)
+    lock.truncate()
+    lock.write(json.dumps(me) + "\n")
+    lock.flush()
+    _lock = lock
@@ -0,0 +1,50 @@
+#!/bin/bash
+# Config migration test: load and validate configs written by released
+# btrmind versions with the current binary.  Checks the committed configs
+# in fixtures/configs/ and, given a git ref of a previous release, also the
+# config that release ships and the default its binary generates.
+# Run from the workspace root.
+set -euo pipefail
+
+BTRMIND="${1:?usage: btrmind-config-migration.sh <btrmind> [previous-ref]}"
+PREVIOUS_REF="${2:-}"
+
+CONFIG_DIR="$(mktemp -d -t regicide-configs-XXXXXX)"
+trap 'rm -rf "${CONFIG_DIR}"; git worktree remove --force /tmp/btrmind-previous 2>/dev/null || true' EXIT
+cp ai-agents/btrmind/fixtures/configs/*.toml "${CONFIG_DIR}/"
+
+if [[ -n "${PREVIOUS_REF}" ]]; then
+    name="${PREVIOUS_REF//\//-}"
+    echo "=== Building btrmind at ${PREVIOUS_REF}"
+    git worktree add --detach /tmp/btrmind-previous "${PREVIOUS_REF}" >/dev/null
+    (
+        cd /tmp/btrmind-previous
+        [[ -f Cargo.lock ]] || cargo generate-lockfile
+        cargo build --quiet -p btrmind
+    )
+    git show "${PREVIOUS_REF}:ai-agents/btrmind/config/btrmind.toml" > "${CONFIG_DIR}/${name}-shipped.toml"
+    # A missing config makes btrmind write its defaults there.
+    /tmp/btrmind-previous/target/debug/btrmind --config "${CONFIG_DIR}/${name}-generated.toml" config >/dev/null
+fi
+
+failures=0
+for config in "${CONFIG_DIR}"/*.toml; do
+    before="$(sha256sum "${config}")"
+    if output="$("${BTRMIND}" --config "${config}" config 2>&1)"; then
+        echo "ok   $(basename "${config}")"
+    else
+        echo "FAIL $(basename "${config}")"
+        echo "${output}" | sed 's/^/     /'
+        failures=$((failures + 1))
+    fi
+    # Validation must never rewrite a user's config.
+    if [[ "$(sha256sum "${config}")" != "${before}" ]]; then
+        echo "FAIL $(basename "${config}") was modified by validation"
+        failures=$((failures + 1))
+    fi
+done
+
+if (( failures > 0 )); then
+    echo "${failures} config(s) from released versions no longer load" >&2
+    exit 1
+fi
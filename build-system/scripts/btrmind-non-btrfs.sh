@@ -0,0 +1,108 @@
+#!/bin/bash
+# Negative tests: point btrmind at ext4 and xfs loopback mounts with dry-run
+# off and check that it degrades to monitor-only mode.  Analysis must still
+# work, while cleanup, even --aggressive, must not delete anything or call
+# btrfs.  A bait file that temp cleanup would normally remove proves it.
+# Needs root for loop mounts.
+set -euo pipefail
+
+BTRMIND="${1:?usage: btrmind-non-btrfs.sh <btrmind> [filesystem...]}"
+shift
+FILESYSTEMS=("$@")
+[[ ${#FILESYSTEMS[@]} -gt 0 ]] || FILESYSTEMS=(ext4 xfs)
+
+WORK_DIR="$(mktemp -d -t regicide-non-btrfs-XXXXXX)"
+MOUNTS=()
+cleanup() {
+    for mnt in "${MOUNTS[@]}"; do
+        umount "${mnt}" 2>/dev/null || true
+    done
+    rm -rf "${WORK_DIR}"
+}
+trap cleanup EXIT
+
+# Containers often lack loop device nodes even with CAP_SYS_ADMIN.
+[[ -e /dev/loop-control ]] || mknod /dev/loop-control c 10 237
+for i in $(seq 0 7); do
+    [[ -e "/dev/loop${i}" ]] || mknod "/dev/loop${i}" b 7 "${i}"
+done
+
+failures=0
+fail() {
+    echo "FAIL (${fs}): $*" >&2
+    failures=$((failures + 1))
+}
+
+for fs in "${FILESYSTEMS[@]}"; do
+    echo "=== ${fs}"
+    image="${WORK_DIR}/${fs}.img"
+    mnt="${WORK_DIR}/mnt-${fs}"
+    config="${WORK_DIR}/${fs}.toml"
+    log="${WORK_DIR}/${fs}.log"
+    mkdir -p "${mnt}" "${WORK_DIR}/model-${fs}"
+    truncate -s 512M "${image}"
+    "mkfs.${fs}" -q "${image}" >/dev/null
+    mount -o loop "${image}" "${mnt}"
+    MOUNTS+=("${mnt}")
+
+    # Temp cleanup deletes files in /tmp not accessed for 7 days.
+    bait="/tmp/regicide-bait-${fs}"
+    echo bait > "${bait}"
+    touch -a -d "-30 days" "${bait}"
+
+    cat > "${config}" <<CONFIG
+dry_run = false
+
+[monitoring]
+target_path = "${mnt}"
+poll_interval = 1
+
+[thresholds]
+warning_level = 1.0
+critical_level = 2.0
+emergency_level = 3.0
+
+[actions]
+enable_compression = true
+enable_balance = true
+enable_snapshot_cleanup = true
+enable_temp_cleanup = true
+temp_paths = ["/tmp"]
+snapshot_keep_count = 1
+
+[learning]
+model_path = "${WORK_DIR}/model-${fs}/model.safetensors"
+model_update_interval = 3600
+reward_smoothing = 0.95
+exploration_rate = 0.1
+learning_rate = 0.001
+discount_factor = 0.99
+CONFIG
+
+    export NO_COLOR=1 RUST_LOG=info
+    if ! "${BTRMIND}" --config "${config}" analyze > "${log}" 2>&1; then
+        fail "analyze failed"
+    fi
+    if ! "${BTRMIND}" --config "${config}" cleanup --aggressive >> "${log}" 2>&1; then
+        fail "cleanup exited non-zero instead of degrading"
+    fi
+    # The daemon must keep running in monitor-only mode, so timeout is the
+    # expected way for it to end.
+    status=0
+    timeout 5 "${BTRMIND}" --config "${config}" run >> "${log}" 2>&1 || status=$?
+    [[ ${status} -eq 124 ]] || fail "daemon exited with ${status} within 5s"
+
+    grep -q "monitor-only mode" "${log}" || fail "no monitor-only warning in the log"
+    grep -qE "Cleaning up temporary files|Compressing files|Balancing BTRFS metadata|Cleaning up old snapshots" \
+        "${log}" && fail "a cleanup action ran"
+    [[ -f "${bait}" ]] || fail "temp cleanup deleted ${bait}"
+    rm -f "${bait}"
+
+    cat "${log}"
+done
+
+if (( failures > 0 )); then
+    echo "${failures} non-BTRFS check(s) failed" >&2
+    exit 1
+fi
+echo "btrmind degrades to monitor-only on: ${FILESYSTEMS[*]}"
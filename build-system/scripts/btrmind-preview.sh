@@ -0,0 +1,63 @@
+#!/bin/bash
+# Interactive preview: install btrmind where regicide-tools/btrmind puts it,
+# point it at a loopback BTRFS laid out like a RegicideOS root, start the
+# daemon, and hand over a shell.  Leaving the shell stops the daemon and
+# unmounts; the container itself is discarded by Dagger.  Needs root for
+# loop mounts.
+set -euo pipefail
+
+BTRMIND="${1:?usage: btrmind-preview.sh <btrmind> <config> [size]}"
+CONFIG="${2:?usage: btrmind-preview.sh <btrmind> <config> [size]}"
+SIZE="${3:-4G}"
+IMAGE=/var/lib/regicide-preview/btrfs.img
+MNT=/mnt/regicide
+LOG=/var/log/btrmind.log
+
+DAEMON=""
+cleanup() {
+    [[ -n "${DAEMON}" ]] && kill "${DAEMON}" 2>/dev/null || true
+    umount "${MNT}" 2>/dev/null || true
+}
+trap cleanup EXIT
+
+# Containers often lack loop device nodes even with CAP_SYS_ADMIN.
+[[ -e /dev/loop-control ]] || mknod /dev/loop-control c 10 237
+for i in $(seq 0 7); do
+    [[ -e "/dev/loop${i}" ]] || mknod "/dev/loop${i}" b 7 "${i}"
+done
+
+mkdir -p "$(dirname "${IMAGE}")" "${MNT}" /etc/btrmind /var/lib/btrmind /usr/lib/systemd/system
+truncate -s "${SIZE}" "${IMAGE}"
+mkfs.btrfs -q -L regicide-preview "${IMAGE}"
+mount -o loop,compress=zstd "${IMAGE}" "${MNT}"
+for subvolume in @ @home @var @snapshots; do
+    btrfs -q subvolume create "${MNT}/${subvolume}"
+done
+mkdir -p "${MNT}/@var/tmp" "${MNT}/@var/cache"
+
+install -m 0755 "${BTRMIND}" /usr/bin/btrmind
+sed "s|^target_path = .*|target_path = \"${MNT}\"|" "${CONFIG}" > /etc/btrmind/btrmind.toml
+install -m 0644 ai-agents/btrmind/systemd/btrmind.service /usr/lib/systemd/system/btrmind.service
+
+RUST_LOG=info btrmind --config /etc/btrmind/btrmind.toml run > "${LOG}" 2>&1 &
+DAEMON=$!
+
+cat <<BANNER
+
+RegicideOS btrmind preview
+  filesystem  ${MNT} (${SIZE} loopback BTRFS: @, @home, @var, @snapshots)
+  config      /etc/btrmind/btrmind.toml
+  daemon      pid ${DAEMON}, log ${LOG}
+
+Try:
+  btrmind --config /etc/btrmind/btrmind.toml analyze
+  fallocate -l 3G ${MNT}/@home/fill && btrmind --config /etc/btrmind/btrmind.toml --dry-run cleanup
+  btrfs filesystem usage ${MNT}
+  tail -f ${LOG}
+
+Exit the shell to tear the preview down.
+BANNER
+
+status=0
+bash -i || status=$?
+exit "${status}"
@@ -0,0 +1,85 @@
+#!/bin/bash
+# Read-only root test: install btrmind and its shipped config, then remount
+# / read-only with tmpfs /var, /tmp and /run, mirroring the immutable
+# RegicideOS layout.  Validates the config, runs analyze, and runs the daemon
+# until it has saved its model, all under strace.  Fails if btrmind writes
+# anywhere outside /var, /tmp and /run, if any call fails with EROFS, or if
+# the model does not land in /var/lib/btrmind.  Needs root for the mounts.
+set -euo pipefail
+
+usage="usage: btrmind-readonly-root.sh <btrmind> <config>"
+BTRMIND="${1:?${usage}}"
+CONFIG="${2:?${usage}}"
+
+# Work in a private mount namespace so the host (or container) root is
+# left writable.
+if [[ -z "${REGICIDE_READONLY_NAMESPACE:-}" ]]; then
+    exec env REGICIDE_READONLY_NAMESPACE=1 unshare --mount --propagation private "$0" "$@"
+fi
+
+# The model is saved every 100 learning steps, one step per poll.
+RUN_SECONDS="${REGICIDE_READONLY_RUN_SECONDS:-130}"
+WRITE_SYSCALLS="open,openat,creat,mkdir,mkdirat,rename,renameat,renameat2,unlink,unlinkat,rmdir,truncate,symlink,symlinkat,link,linkat"
+
+# Install like the ebuild and unit expect, while / is still writable.
+install -Dm755 "${BTRMIND}" /usr/local/bin/btrmind
+install -d /etc/btrmind
+sed -E 's/^poll_interval = .*/poll_interval = 1/' "${CONFIG}" > /etc/btrmind/config.toml
+
+for dir in /var /tmp /run; do
+    mkdir -p "${dir}"
+    mount -t tmpfs tmpfs "${dir}"
+done
+mount -o remount,bind,ro /
+if touch /usr/.regicide-readonly-probe 2>/dev/null; then
+    echo "ERROR: / is still writable after remounting it read-only" >&2
+    exit 1
+fi
+
+traced() {
+    local name="$1"
+    shift
+    strace -f -qq -e trace="${WRITE_SYSCALLS}" -o "/tmp/${name}.trace" \
+        /usr/local/bin/btrmind --config /etc/btrmind/config.toml --dry-run "$@"
+}
+
+export NO_COLOR=1 RUST_LOG=info
+failures=()
+traced config config > /tmp/btrmind.log 2>&1 || failures+=("btrmind config failed")
+traced analyze analyze >> /tmp/btrmind.log 2>&1 || failures+=("btrmind analyze failed")
+# The daemon has no shutdown signal handling, so stop it by name.
+traced run run >> /tmp/btrmind.log 2>&1 &
+TRACER=$!
+sleep "${RUN_SECONDS}"
+pgrep -x btrmind > /dev/null || failures+=("the daemon exited within ${RUN_SECONDS}s")
+pkill -TERM -x btrmind || true
+wait "${TRACER}" || true
+
+cat /tmp/*.trace > /tmp/all.trace
+{
+    grep -E '^[0-9]+ +(open|openat|creat)\(' /tmp/all.trace | grep -E 'O_WRONLY|O_RDWR|O_CREAT' || true
+    grep -E '^[0-9]+ +(mkdir|mkdirat|rename|renameat2?|unlink|unlinkat|rmdir|truncate|symlink|symlinkat|link|linkat)\(' /tmp/all.trace || true
+} | sed -nE 's/^[^"]*"([^"]*)".*/\1/p' | sort -u > /tmp/written.txt
+grep -vE '^/(var|tmp|run|proc|dev)(/|$)' /tmp/written.txt > /tmp/forbidden.txt || true
+grep -h 'EROFS' /tmp/all.trace | sed -E 's/^[0-9]+ +//' | sort -u > /tmp/erofs.txt || true
+
+[[ -s /tmp/forbidden.txt ]] && failures+=("writes outside /var, /tmp and /run: $(paste -sd' ' /tmp/forbidden.txt)")
+[[ -s /tmp/erofs.txt ]] && failures+=("$(wc -l < /tmp/erofs.txt) call(s) failed with EROFS")
+model_path=$(sed -nE 's/^model_path = "(.*)"/\1/p' /etc/btrmind/config.toml)
+[[ -f "${model_path}.json" ]] || failures+=("no model saved at ${model_path}.json")
+grep -q '^/var/lib/btrmind/' /tmp/written.txt || failures+=("btrmind wrote no state under /var/lib/btrmind")
+
+echo "## Paths written"
+cat /tmp/written.txt
+echo
+echo "## EROFS"
+cat /tmp/erofs.txt
+echo
+echo "## btrmind output"
+cat /tmp/btrmind.log
+
+if (( ${#failures[@]} > 0 )); then
+    printf 'FAIL: %s\n' "${failures[@]}" >&2
+    exit 1
+fi
+echo "btrmind runs on a read-only root and writes only to: $(cut -d/ -f2 /tmp/written.txt | sort -u | paste -sd' ')"
@@ -0,0 +1,157 @@
+#!/bin/bash
+# Soak test: run the btrmind daemon in dry-run mode for DURATION seconds
+# against a churn generator that repeatedly fills and drains a small tmpfs.
+# Memory (VmRSS), chosen actions, and monitoring errors are sampled into
+# REPORT_DIR.  Fails if RSS grows past its budget, a monitoring cycle errors
+# more often than allowed, btrmind acts more often than it polls (a runaway
+# loop), or the daemon exits early.  Needs root to mount the tmpfs.
+set -euo pipefail
+
+BTRMIND="${1:?usage: btrmind-soak.sh <btrmind> <duration-seconds> <report-dir>}"
+DURATION="${2:?usage: btrmind-soak.sh <btrmind> <duration-seconds> <report-dir>}"
+REPORT_DIR="${3:?usage: btrmind-soak.sh <btrmind> <duration-seconds> <report-dir>}"
+
+POLL_SECONDS="${REGICIDE_SOAK_POLL_SECONDS:-5}"
+SAMPLE_SECONDS="${REGICIDE_SOAK_SAMPLE_SECONDS:-30}"
+MAX_RSS_GROWTH_KB="${REGICIDE_SOAK_MAX_RSS_GROWTH_KB:-16384}"
+MAX_ERRORS="${REGICIDE_SOAK_MAX_ERRORS:-0}"
+SOAK_DIR=/var/tmp/btrmind-soak
+SOAK_SIZE_MB=256
+
+WORK_DIR="$(mktemp -d -t regicide-soak-XXXXXX)"
+mkdir -p "${SOAK_DIR}" "${REPORT_DIR}" "${WORK_DIR}/model"
+mount -t tmpfs -o "size=${SOAK_SIZE_MB}m" tmpfs "${SOAK_DIR}"
+
+BTRMIND_PID=""
+CHURN_PID=""
+cleanup() {
+    [[ -n "${CHURN_PID}" ]] && kill "${CHURN_PID}" 2>/dev/null || true
+    [[ -n "${BTRMIND_PID}" ]] && kill "${BTRMIND_PID}" 2>/dev/null || true
+    wait 2>/dev/null || true
+    umount "${SOAK_DIR}" 2>/dev/null || true
+    rm -rf "${WORK_DIR}"
+}
+trap cleanup EXIT
+
+cat > "${WORK_DIR}/btrmind.toml" <<CONFIG
+dry_run = true
+
+[monitoring]
+target_path = "${SOAK_DIR}"
+poll_interval = ${POLL_SECONDS}
+
+[thresholds]
+warning_level = 85.0
+critical_level = 95.0
+emergency_level = 98.0
+
+[actions]
+enable_compression = true
+enable_balance = true
+enable_snapshot_cleanup = true
+enable_temp_cleanup = true
+temp_paths = ["${SOAK_DIR}"]
+snapshot_keep_count = 10
+
+[learning]
+model_path = "${WORK_DIR}/model/model.safetensors"
+model_update_interval = 3600
+reward_smoothing = 0.95
+exploration_rate = 0.1
+learning_rate = 0.001
+discount_factor = 0.99
+CONFIG
+
+usage_percent() {
+    df --output=pcent "${SOAK_DIR}" | tail -1 | tr -dc '0-9'
+}
+
+# Fill to a random level between 40% and 99%, then drain to 20-59%, so the
+# agent sees every threshold band over and over.
+churn() {
+    local n=0 fill drain file
+    while true; do
+        fill=$((40 + RANDOM % 60))
+        drain=$((20 + RANDOM % 40))
+        while (( $(usage_percent) < fill )); do
+            n=$((n + 1))
+            head -c 4M /dev/urandom > "${SOAK_DIR}/churn-${n}.bin" 2>/dev/null || break
+            sleep 0.2
+        done
+        sleep "${POLL_SECONDS}"
+        for file in $(ls "${SOAK_DIR}" | shuf); do
+            (( $(usage_percent) <= drain )) && break
+            rm -f "${SOAK_DIR}/${file}"
+            sleep 0.2
+        done
+        sleep "${POLL_SECONDS}"
+    done
+}
+
+action_count() {
+    grep -c 'Would execute action' "${REPORT_DIR}/btrmind.log" || true
+}
+
+error_count() {
+    grep -c 'Monitoring cycle failed' "${REPORT_DIR}/btrmind.log" || true
+}
+
+NO_COLOR=1 RUST_LOG=info "${BTRMIND}" --config "${WORK_DIR}/btrmind.toml" --dry-run run \
+    > "${REPORT_DIR}/btrmind.log" 2>&1 &
+BTRMIND_PID=$!
+churn &
+CHURN_PID=$!
+
+echo "elapsed_seconds,rss_kb,usage_percent,actions,errors" > "${REPORT_DIR}/samples.csv"
+START=${SECONDS}
+status="completed"
+while (( SECONDS - START < DURATION )); do
+    sleep "${SAMPLE_SECONDS}"
+    if ! kill -0 "${BTRMIND_PID}" 2>/dev/null; then
+        status="exited"
+        break
+    fi
+    rss=$(awk '/^VmRSS:/ { print $2 }' "/proc/${BTRMIND_PID}/status")
+    echo "$((SECONDS - START)),${rss},$(usage_percent),$(action_count),$(error_count)" \
+        >> "${REPORT_DIR}/samples.csv"
+done
+ELAPSED=$((SECONDS - START))
+
+# The first sample is the baseline, taken after startup allocations settle.
+first_rss=$(awk -F, 'NR == 2 { print $2 }' "${REPORT_DIR}/samples.csv")
+last_rss=$(awk -F, 'NR > 1 { rss = $2 } END { print rss }' "${REPORT_DIR}/samples.csv")
+rss_growth=$(( ${last_rss:-0} - ${first_rss:-0} ))
+actions=$(action_count)
+errors=$(error_count)
+# One action per poll, plus slack for the immediate first tick.
+max_actions=$(( ELAPSED / POLL_SECONDS + 5 ))
+
+grep -o 'Would execute action: [A-Za-z]*' "${REPORT_DIR}/btrmind.log" \
+    | awk '{ print $NF }' | sort | uniq -c | awk '{ print $2 "," $1 }' \
+    > "${REPORT_DIR}/action-frequency.csv" || true
+
+failures=()
+[[ "${status}" == "exited" ]] && failures+=("btrmind exited after ${ELAPSED}s")
+(( rss_growth > MAX_RSS_GROWTH_KB )) && failures+=("RSS grew ${rss_growth} KiB (budget ${MAX_RSS_GROWTH_KB} KiB)")
+(( errors > MAX_ERRORS )) && failures+=("${errors} monitoring cycle errors (budget ${MAX_ERRORS})")
+(( actions > max_actions )) && failures+=("${actions} actions in ${ELAPSED}s exceeds one per ${POLL_SECONDS}s poll")
+
+cat > "${REPORT_DIR}/summary.json" <<SUMMARY
+{
+  "status": "${status}",
+  "duration_seconds": ${ELAPSED},
+  "poll_seconds": ${POLL_SECONDS},
+  "rss_first_kb": ${first_rss:-0},
+  "rss_last_kb": ${last_rss:-0},
+  "rss_growth_kb": ${rss_growth},
+  "actions": ${actions},
+  "errors": ${errors},
+  "failures": ${#failures[@]}
+}
+SUMMARY
+
+echo "Soak: ${ELAPSED}s, RSS ${first_rss:-?} -> ${last_rss:-?} KiB, ${actions} actions, ${errors} errors"
+if (( ${#failures[@]} > 0 )); then
+    printf 'Soak failure: %s\n' "${failures[@]}" >&2
+    exit 1
+fi
@@ -0,0 +1,131 @@
+#!/bin/bash
+# Syscall audit: trace btrmind under strace while it runs analyze, a dry-run
+# aggressive cleanup, and the daemon, and compare the syscalls it makes with
+# the SystemCallFilter= allowlist in its systemd unit.  Fails if btrmind
+# needs a syscall the unit would kill it for, or if a call fails with EPERM
+# under the unit's empty capability bounding set.  Writes the observed
+# profile to REPORT.  Needs ptrace and systemd-analyze.
+set -euo pipefail
+
+usage="usage: btrmind-syscall-audit.sh <btrmind> <unit-file> <report>"
+BTRMIND="${1:?${usage}}"
+UNIT="${2:?${usage}}"
+REPORT="${3:?${usage}}"
+
+WORK_DIR="$(mktemp -d -t regicide-syscalls-XXXXXX)"
+trap 'rm -rf "${WORK_DIR}"' EXIT
+mkdir -p "${WORK_DIR}/target/tmp" "${WORK_DIR}/model"
+
+# Expand a SystemCallFilter= entry, following nested @groups.
+expand() {
+    local entry="$1"
+    if [[ "${entry}" != @* ]]; then
+        echo "${entry}"
+        return
+    fi
+    systemd-analyze syscall-filter --no-pager "${entry}" \
+        | awk 'NR > 1 && $1 !~ /^#/ && NF { print $1 }' \
+        | while read -r member; do expand "${member}"; done
+}
+
+filters=$(sed -n 's/^SystemCallFilter=//p' "${UNIT}")
+if [[ -z "${filters}" ]]; then
+    echo "ERROR: ${UNIT} has no SystemCallFilter= allowlist" >&2
+    exit 1
+fi
+if grep -q '^~' <<< "${filters}"; then
+    echo "ERROR: ${UNIT} uses a SystemCallFilter= deny list; only allowlists are audited" >&2
+    exit 1
+fi
+for entry in ${filters}; do
+    expand "${entry}"
+done | sort -u > "${WORK_DIR}/allowed.txt"
+
+cat > "${WORK_DIR}/btrmind.toml" <<CONFIG
+dry_run = true
+
+[monitoring]
+target_path = "${WORK_DIR}/target"
+poll_interval = 1
+
+[thresholds]
+warning_level = 1.0
+critical_level = 2.0
+emergency_level = 3.0
+
+[actions]
+enable_compression = true
+enable_balance = true
+enable_snapshot_cleanup = true
+enable_temp_cleanup = true
+temp_paths = ["${WORK_DIR}/target/tmp"]
+snapshot_keep_count = 1
+
+[learning]
+model_path = "${WORK_DIR}/model/model.safetensors"
+model_update_interval = 1
+reward_smoothing = 0.95
+exploration_rate = 0.1
+learning_rate = 0.001
+discount_factor = 0.99
+CONFIG
+
+# Run under the unit's restrictions that do not need systemd: no new
+# privileges and no capabilities at all.
+traced() {
+    local name="$1"
+    shift
+    setpriv --no-new-privs --inh-caps=-all --bounding-set=-all \
+        strace -f -qq -o "${WORK_DIR}/${name}.trace" \
+        "${BTRMIND}" --config "${WORK_DIR}/btrmind.toml" "$@"
+}
+
+export NO_COLOR=1 RUST_LOG=info
+traced analyze analyze > "${WORK_DIR}/btrmind.log" 2>&1
+traced cleanup cleanup --aggressive >> "${WORK_DIR}/btrmind.log" 2>&1
+# The daemon has no shutdown signal handling, so stop it by name; signalling
+# strace would only detach it.
+traced run run >> "${WORK_DIR}/btrmind.log" 2>&1 &
+TRACER=$!
+sleep 5
+pkill -TERM -x "$(basename "${BTRMIND}")" || true
+wait "${TRACER}" || true
+
+cat "${WORK_DIR}"/*.trace \
+    | sed -nE 's/^[0-9]+ +([a-z0-9_]+)\(.*/\1/p' \
+    | sort | uniq -c | sort -rn > "${WORK_DIR}/profile.txt"
+awk '{ print $2 }' "${WORK_DIR}/profile.txt" | sort > "${WORK_DIR}/used.txt"
+comm -23 "${WORK_DIR}/used.txt" "${WORK_DIR}/allowed.txt" > "${WORK_DIR}/outside.txt"
+grep -hE '= -1 EPERM' "${WORK_DIR}"/*.trace | sed -E 's/^[0-9]+ +//' | sort -u > "${WORK_DIR}/eperm.txt" || true
+
+{
+    echo "# btrmind syscall profile"
+    echo "Allowlist: $(echo ${filters})"
+    echo
+    echo "## Calls per syscall"
+    cat "${WORK_DIR}/profile.txt"
+    echo
+    echo "## Not allowed by ${UNIT##*/}"
+    cat "${WORK_DIR}/outside.txt"
+    echo
+    echo "## EPERM without capabilities"
+    cat "${WORK_DIR}/eperm.txt"
+    echo
+    echo "## btrmind output"
+    cat "${WORK_DIR}/btrmind.log"
+} > "${REPORT}"
+
+failures=0
+if [[ -s "${WORK_DIR}/outside.txt" ]]; then
+    echo "btrmind uses syscalls outside SystemCallFilter=: $(paste -sd' ' "${WORK_DIR}/outside.txt")" >&2
+    failures=1
+fi
+if [[ -s "${WORK_DIR}/eperm.txt" ]]; then
+    echo "btrmind needs privileges the unit does not grant:" >&2
+    cat "${WORK_DIR}/eperm.txt" >&2
+    failures=1
+fi
+if (( failures )); then
+    exit 1
+fi
+echo "btrmind made $(wc -l < "${WORK_DIR}/used.txt") distinct syscalls, all allowed by ${UNIT##*/}"
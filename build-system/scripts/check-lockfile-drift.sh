@@ -0,0 +1,40 @@
+#!/bin/bash
+# Lockfile drift: fail unless the workspace Cargo.lock is committed, matches
+# every Cargo.toml, and is left untouched by a build.  Stray Cargo.lock files
+# in member crates are ignored by cargo and only go stale, so they fail too.
+# Dependency updates the lock could take are listed but do not fail.  Run
+# from the workspace root of a git checkout.
+set -euo pipefail
+
+failures=()
+
+if ! git ls-files --error-unmatch Cargo.lock > /dev/null 2>&1; then
+    failures+=("Cargo.lock is not committed; run cargo generate-lockfile and commit it")
+elif ! git diff --quiet HEAD -- Cargo.lock; then
+    failures+=("Cargo.lock has uncommitted changes")
+fi
+if [[ ! -f Cargo.lock ]]; then
+    printf 'FAIL: %s\n' "${failures[@]}" >&2
+    exit 1
+fi
+
+stray=$(git ls-files --cached --others --exclude-standard '*/Cargo.lock')
+[[ -z "${stray}" ]] || failures+=("lockfiles outside the workspace root: $(echo ${stray})")
+
+before=$(sha256sum Cargo.lock)
+echo "## cargo metadata --locked"
+cargo metadata --locked --format-version 1 > /dev/null \
+    || failures+=("Cargo.lock is out of sync with Cargo.toml")
+echo "## cargo check --locked --workspace --all-targets"
+cargo check --locked --workspace --all-targets \
+    || failures+=("cargo check --locked failed")
+[[ "$(sha256sum Cargo.lock)" == "${before}" ]] || failures+=("the build modified Cargo.lock")
+
+echo "## Available updates (informational)"
+cargo update --dry-run 2>&1 | grep -E '^ +(Updating|Adding|Removing|Downgrading) ' || echo "none"
+
+if (( ${#failures[@]} > 0 )); then
+    printf 'FAIL: %s\n' "${failures[@]}" >&2
+    exit 1
+fi
+echo "Cargo.lock is committed, in sync, and unchanged by the build"
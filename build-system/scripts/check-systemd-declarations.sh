@@ -0,0 +1,80 @@
+#!/bin/bash
+# Validate the sysusers.d and tmpfiles.d files the agents ship
+# (ai-agents/*/systemd/*.sysusers and *.tmpfiles).  Checks the sysusers
+# files with systemd-sysusers --dry-run, then applies them and the tmpfiles
+# with --create to a scratch --root, and verifies every "d" entry was
+# created with the declared mode, user and group.  Fails on any parse error
+# or unknown user.
+set -euo pipefail
+
+usage="usage: check-systemd-declarations.sh <workspace>"
+WORKSPACE="$(realpath -e "${1:?${usage}}")"
+ROOT="$(mktemp -d -t regicide-declarations-XXXXXX)"
+trap 'rm -rf "${ROOT}"' EXIT
+mkdir -p "${ROOT}/etc"
+
+shopt -s nullglob
+sysusers=("${WORKSPACE}"/ai-agents/*/systemd/*.sysusers)
+tmpfiles=("${WORKSPACE}"/ai-agents/*/systemd/*.tmpfiles)
+if (( ${#tmpfiles[@]} == 0 )); then
+    echo "ERROR: no tmpfiles.d files under ${WORKSPACE}/ai-agents" >&2
+    exit 1
+fi
+
+failures=0
+fail() {
+    echo "FAIL $1" >&2
+    failures=$((failures + 1))
+}
+
+# systemd only reports some mistakes as warnings; treat them as errors too.
+run() {
+    local name="$1" log
+    shift
+    log="$(mktemp)"
+    if ! "$@" > "${log}" 2>&1; then
+        fail "${name}: $* exited non-zero"
+    elif grep -qiE 'failed|invalid|unknown|ignoring' "${log}"; then
+        fail "${name}: $* warned"
+    fi
+    sed 's/^/    /' "${log}"
+    rm -f "${log}"
+}
+
+for file in "${sysusers[@]}"; do
+    echo "## ${file#"${WORKSPACE}"/}"
+    run "${file##*/}" systemd-sysusers --dry-run "${file}"
+    run "${file##*/}" systemd-sysusers --root="${ROOT}" "${file}"
+done
+
+# Print the numeric id of a user or group in the scratch root; "-" means root.
+id_of() {
+    local db="$1" name="$2"
+    if [[ "${name}" == "-" || "${name}" == root ]]; then
+        echo 0
+        return
+    fi
+    awk -F: -v name="${name}" '$1 == name { print $3 }' "${ROOT}/etc/${db}"
+}
+
+for file in "${tmpfiles[@]}"; do
+    echo "## ${file#"${WORKSPACE}"/}"
+    run "${file##*/}" systemd-tmpfiles --root="${ROOT}" --create "${file}"
+    while read -r type path mode user group _; do
+        [[ "${type}" == d ]] || continue
+        [[ "${mode}" == "-" ]] && mode=0755
+        declared="${mode} $(id_of passwd "${user}") $(id_of group "${group}")"
+        actual="$(stat -c '%04a %u %g' "${ROOT}${path}" 2>/dev/null || echo missing)"
+        if [[ "${actual}" == "${declared}" ]]; then
+            echo "    ${path}: ${mode} ${user}:${group}"
+        else
+            fail "${file##*/}: ${path} is '${actual}', declared '${declared}' (${user}:${group})"
+        fi
+    done < <(grep -vE '^[[:space:]]*(#|$)' "${file}")
+done
+
+if (( failures > 0 )); then
+    echo "${failures} sysusers.d/tmpfiles.d check(s) failed" >&2
+    exit 1
+fi
+echo "Validated ${#sysusers[@]} sysusers.d and ${#tmpfiles[@]} tmpfiles.d file(s)"
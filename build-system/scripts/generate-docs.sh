@@ -0,0 +1,49 @@
+#!/bin/bash
+# Generate man pages and bash/zsh/fish completions from every binary's clap
+# definition, the same way the ebuilds do in src_install, and check them:
+# each file must exist and be non-empty, man pages must render without groff
+# warnings, and bash completions must parse.
+set -euo pipefail
+
+usage="usage: generate-docs.sh <bin-dir> <out-dir>"
+BIN_DIR="${1:?${usage}}"
+OUT_DIR="${2:?${usage}}"
+
+# <installed name>|<command that writes the docs into the directory appended>
+GENERATORS=(
+    "btrmind|${BIN_DIR}/btrmind generate-docs"
+    "regicide-installer|${BIN_DIR}/installer --generate-docs"
+)
+
+failures=0
+for generator in "${GENERATORS[@]}"; do
+    name="${generator%%|*}"
+    read -ra command <<< "${generator#*|}"
+    dir="${OUT_DIR}/${name}"
+    echo "=== ${name}"
+    if ! "${command[@]}" "${dir}"; then
+        echo "FAIL ${name}: generation failed" >&2
+        failures=$((failures + 1))
+        continue
+    fi
+    for file in "man/${name}.1" "completions/${name}.bash" "completions/_${name}" "completions/${name}.fish"; do
+        if [[ ! -s "${dir}/${file}" ]]; then
+            echo "FAIL ${name}: ${file} is missing or empty" >&2
+            failures=$((failures + 1))
+        fi
+    done
+    if ! warnings=$(groff -man -ww -z "${dir}/man/${name}.1" 2>&1) || [[ -n "${warnings}" ]]; then
+        echo "FAIL ${name}: man page does not render cleanly: ${warnings}" >&2
+        failures=$((failures + 1))
+    fi
+    bash -n "${dir}/completions/${name}.bash" || {
+        echo "FAIL ${name}: bash completion does not parse" >&2
+        failures=$((failures + 1))
+    }
+    find "${dir}" -type f | sort
+done
+
+if (( failures > 0 )); then
+    echo "${failures} generated doc check(s) failed" >&2
+    exit 1
+fi
@@ -0,0 +1,111 @@
+#!/bin/bash
+# Locale and timezone matrix: run the installer and btrmind CLIs under
+# non-UTF-8 and bogus locales, unusual and invalid TZ values, and a
+# completely empty environment.  Commands that succeed in a normal
+# environment must still exit 0; the rest may fail but must not panic
+# (exit 101, "panicked at") or die from a signal.  Writes a CSV of every
+# run to REPORT.  Needs the locales and tzdata packages.
+set -euo pipefail
+
+usage="usage: locale-matrix.sh <installer> <btrmind> <report>"
+INSTALLER="$(realpath -e "${1:?${usage}}")"
+BTRMIND="$(realpath -e "${2:?${usage}}")"
+REPORT="${3:?${usage}}"
+
+# NAME|VAR=VALUE ...  Each run starts from env -i, so "empty" has no PATH,
+# HOME, TERM or locale at all.
+ENVIRONMENTS=(
+    "empty|"
+    "posix|LANG=POSIX"
+    "c|LC_ALL=C"
+    "turkish-latin9|LC_ALL=tr_TR.ISO-8859-9"
+    "japanese-eucjp|LC_ALL=ja_JP.EUC-JP"
+    "bogus-locale|LANG=xx_XX.UTF-9 LC_ALL=xx_XX.UTF-9"
+    "tz-chatham|TZ=Pacific/Chatham"
+    "tz-kathmandu|TZ=Asia/Kathmandu"
+    "tz-utc-minus-14|TZ=UTC-14"
+    "tz-posix-dst|TZ=EST5EDT,M3.2.0/2,M11.1.0"
+    "tz-invalid|TZ=Not/AZone"
+    "tz-empty|TZ="
+)
+
+# Compile the non-UTF-8 locales so they are real rather than falling back
+# to C; bogus-locale covers the fallback.
+localedef -i tr_TR -f ISO-8859-9 tr_TR.ISO-8859-9
+localedef -i ja_JP -f EUC-JP ja_JP.EUC-JP
+
+WORK_DIR="$(mktemp -d -t regicide-locale-XXXXXX)"
+trap 'rm -rf "${WORK_DIR}"' EXIT
+TARGET="${WORK_DIR}/target"
+mkdir -p "${TARGET}/tmp" "${WORK_DIR}/model"
+# A config directory whose name is not valid UTF-8 (Latin-1 "é").
+ODD_DIR="${WORK_DIR}/caf$(printf '\xe9')"
+mkdir -p "${ODD_DIR}"
+
+cat > "${WORK_DIR}/btrmind.toml" <<CONFIG
+dry_run = true
+
+[monitoring]
+target_path = "${TARGET}"
+
+[thresholds]
+
+[actions]
+temp_paths = ["${TARGET}/tmp"]
+
+[learning]
+model_path = "${WORK_DIR}/model/model.safetensors"
+CONFIG
+cp "${WORK_DIR}/btrmind.toml" "${ODD_DIR}/btrmind.toml"
+
+# NAME|EXPECT|COMMAND...  EXPECT is "ok" (exit 0) or "no-panic".
+COMMANDS=(
+    "installer-help|ok|${INSTALLER} --help"
+    "installer-missing-config|no-panic|${INSTALLER} --config ${WORK_DIR}/missing.toml"
+    "installer-non-utf8-config|no-panic|${INSTALLER} --config ${ODD_DIR}/missing.toml"
+    "btrmind-help|ok|${BTRMIND} --help"
+    "btrmind-config|ok|${BTRMIND} --config ${WORK_DIR}/btrmind.toml config"
+    "btrmind-non-utf8-config|ok|${BTRMIND} --config ${ODD_DIR}/btrmind.toml config"
+    "btrmind-analyze|ok|${BTRMIND} --config ${WORK_DIR}/btrmind.toml --dry-run analyze"
+)
+
+echo "environment,command,expect,exit_code,result" > "${REPORT}"
+failures=0
+for environment in "${ENVIRONMENTS[@]}"; do
+    env_name="${environment%%|*}"
+    read -ra env_vars <<< "${environment#*|}"
+    for command in "${COMMANDS[@]}"; do
+        cmd_name="${command%%|*}"
+        rest="${command#*|}"
+        expect="${rest%%|*}"
+        read -ra argv <<< "${rest#*|}"
+        log="${WORK_DIR}/${env_name}-${cmd_name}.log"
+
+        code=0
+        timeout 60 env -i "${env_vars[@]}" "${argv[@]}" < /dev/null > "${log}" 2>&1 || code=$?
+
+        result="pass"
+        if grep -q "panicked at" "${log}" || (( code == 101 )); then
+            result="panic"
+        elif (( code == 124 )); then
+            result="timeout"
+        elif (( code > 128 )); then
+            result="signal $((code - 128))"
+        elif [[ "${expect}" == "ok" ]] && (( code != 0 )); then
+            result="failed"
+        fi
+        echo "${env_name},${cmd_name},${expect},${code},${result}" >> "${REPORT}"
+        if [[ "${result}" != "pass" ]]; then
+            echo "FAIL ${cmd_name} under ${env_name} (${result}, exit ${code}):" >&2
+            sed 's/^/    /' "${log}" >&2
+            failures=$((failures + 1))
+        fi
+    done
+done
+
+runs=$(( ${#ENVIRONMENTS[@]} * ${#COMMANDS[@]} ))
+if (( failures > 0 )); then
+    echo "${failures} of ${runs} locale/timezone runs failed" >&2
+    exit 1
+fi
+echo "All ${runs} locale/timezone runs passed"
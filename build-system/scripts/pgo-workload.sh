@@ -0,0 +1,60 @@
+#!/bin/bash
+# PGO training workload: exercise instrumented RegicideOS binaries against a
+# simulated storage tree so llvm-profdata sees representative hot paths.
+# btrmind runs in dry-run mode over a scratch directory, so no BTRFS
+# filesystem or root privileges are needed.
+set -euo pipefail
+
+BIN_DIR="${1:?usage: pgo-workload.sh <bin-dir> [iterations]}"
+ITERATIONS="${2:-20}"
+
+WORK_DIR="$(mktemp -d -t regicide-pgo-XXXXXX)"
+trap 'rm -rf "${WORK_DIR}"' EXIT
+
+# Populate a scratch tree with files of mixed sizes and ages so the temp
+# cleanup and usage scans have something to walk.
+mkdir -p "${WORK_DIR}/data" "${WORK_DIR}/model"
+for i in $(seq 1 200); do
+    head -c $((i * 512)) /dev/urandom > "${WORK_DIR}/data/file-${i}.bin"
+    touch -d "-$((i % 30)) days" "${WORK_DIR}/data/file-${i}.bin"
+done
+
+cat > "${WORK_DIR}/btrmind.toml" <<CONFIG
+dry_run = true
+
+[monitoring]
+target_path = "${WORK_DIR}/data"
+poll_interval = 1
+
+[thresholds]
+warning_level = 1.0
+critical_level = 2.0
+emergency_level = 3.0
+
+[actions]
+enable_compression = true
+enable_balance = true
+enable_snapshot_cleanup = true
+enable_temp_cleanup = true
+temp_paths = ["${WORK_DIR}/data"]
+snapshot_keep_count = 10
+
+[learning]
+model_path = "${WORK_DIR}/model"
+model_update_interval = 1
+reward_smoothing = 0.95
+exploration_rate = 0.5
+learning_rate = 0.001
+discount_factor = 0.99
+CONFIG
+
+BTRMIND="${BIN_DIR}/btrmind"
+for _ in $(seq 1 "${ITERATIONS}"); do
+    "${BTRMIND}" --config "${WORK_DIR}/btrmind.toml" --dry-run analyze >/dev/null || true
+    "${BTRMIND}" --config "${WORK_DIR}/btrmind.toml" --dry-run cleanup >/dev/null || true
+    "${BTRMIND}" --config "${WORK_DIR}/btrmind.toml" --dry-run cleanup --aggressive >/dev/null || true
+    "${BTRMIND}" --config "${WORK_DIR}/btrmind.toml" stats >/dev/null || true
+done
+"${BTRMIND}" --config "${WORK_DIR}/btrmind.toml" config >/dev/null
+
+echo "PGO workload complete (${ITERATIONS} iterations)"
@@ -0,0 +1,655 @@
+"""Security scan - run the scanners concurrently and gate on their merged findings.
+
+Each scanner runs in its own container through checked_exec, so a scanner
+that crashes fails on its own with a failure bundle.  Its JSON output is
+normalized into findings:
+
+    {"scanner", "id", "severity", "package", "title", "location"}
+
+with severity one of SEVERITIES.  The run fails once, in the
+security-gate stage, when any finding is at or above the threshold.
+Scanners listed as advisory in advisory.toml (security-<scanner>) report
+their findings without gating, and a crash of one only warns.
+
+security-policy.toml can set a scanner's own threshold, and acknowledge a
+finding at a lower severity until a date, so an upstream vulnerability
+with no fix yet stays in the report without blocking every run.  trivy
+also applies the repository's .trivyignore, whose entries must expire
+too.  expiring() lists the acknowledgements about to lapse.
+
+- cargo-audit: RustSec advisories for Cargo.lock.  Vulnerabilities count as
+  high (advisories carry a CVSS vector, not a severity); unmaintained and
+  yanked crates as low.
+- trivy: `trivy fs` vulnerability and misconfiguration scan of the tree,
+  with Trivy's own severities and the unexpired entries of .trivyignore.
+  Its report is also converted to SARIF (trivy.sarif), which
+  upload_sarif() sends to GitHub code scanning so findings show as pull
+  request annotations.
+- gitleaks: secrets in the working tree, and with history=True in every
+  commit of the clone too, all critical.  gitleaks.toml extends the default
+  rules with an allowlist, and findings recorded in gitleaks-baseline.json
+  are not reported again.  gitleaks runs once; gitleaks_sarif() converts
+  its JSON report to the SARIF (gitleaks.sarif) that goes to code
+  scanning like trivy's.
+- osv-scanner: every lockfile in the tree (Cargo.lock first) and the
+  crates pinned in the overlay's ebuilds (CRATES), checked against
+  osv.dev, which also carries GitHub and crates.io advisories RustSec
+  lacks.  Findings take the group's CVSS score or the advisory's own
+  severity; advisories with neither count as high, like cargo-audit's.
+  Advisories cargo-audit already reported for Cargo.lock are dropped.
+  The workspace Cargo.lock is required and mounted explicitly, so a
+  source filter cannot leave it out, and a scan that finds no lockfile
+  at all fails instead of passing with no results.
+- hadolint: Dockerfile and Containerfile lint, with the repository's
+  .hadolint.yaml when it has one (so its ignored rules and severity
+  overrides apply); error is high, so it gates at the default threshold,
+  warning medium, anything else low.  hadolint.txt lists the findings per
+  file.  Passes trivially while the tree has no Dockerfiles.
+
+The trivy, gitleaks, osv-scanner and hadolint images are pinned in
+images.lock.json and pulled through from_image_with_fallback(), so a bad
+upstream release that a bump let through falls back to the previous
+known-good digest.
+"""
+
+import asyncio
+import base64
+import datetime
+import gzip
+import json
+import os
+import re
+import subprocess
+import time
+import tomllib
+from collections import Counter
+from pathlib import Path
+
+import dagger
+
+import advisory
+import build_info
+import cache_keys
+import exit_codes
+import source_layout
+import workspace_checks
+from failure_bundle import StageFailed, checked_exec, from_image, from_image_with_fallback
+
+
+SEVERITIES = ["unknown", "low", "medium", "high", "critical"]
+SCANNERS = ["cargo-audit", "trivy", "gitleaks", "osv-scanner", "hadolint"]
+CARGO_AUDIT_VERSION = "0.20.0"
+TRIVY_IMAGE = "aquasec/trivy:latest"
+GITLEAKS_IMAGE = "ghcr.io/gitleaks/gitleaks:latest"
+OSV_SCANNER_IMAGE = "ghcr.io/google/osv-scanner:v1.9.1"
+HADOLINT_IMAGE = "hadolint/hadolint:latest-debian"
+REPORT = "/tmp/report.json"
+SARIF_REPORT = "/tmp/report.sarif"
+GITLEAKS_CONFIG = Path(__file__).parent / "gitleaks.toml"
+GITLEAKS_BASELINE = Path(__file__).parent / "gitleaks-baseline.json"
+POLICY_PATH = Path(__file__).parent / "security-policy.toml"
+# Relative to the source root, like .hadolint.yaml.
+TRIVY_IGNORE = Path(".trivyignore")
+EXPIRY_WARNING_DAYS = 14
+# Where osv-scanner finds a Cargo.lock per overlay ebuild: <category>/<package>/<PF>/Cargo.lock.
+OVERLAY_LOCKFILES = "/overlay-lockfiles"
+
+
+def scan_day() -> str:
+    """Return today's date; set on advisory-database scans so Dagger re-runs them daily."""
+    return time.strftime("%Y-%m-%d", time.gmtime())
+
+
+def _today() -> datetime.date:
+    return datetime.datetime.now(datetime.timezone.utc).date()
+
+
+def load_policy(path: Path = POLICY_PATH) -> dict:
+    """Return the policy as {"thresholds": {scanner: severity}, "acknowledged": [entry]}.
+
+    Raises ValueError if it is malformed.
+    """
+    try:
+        with path.open("rb") as f:
+            policy = tomllib.load(f)
+    except (OSError, tomllib.TOMLDecodeError) as exc:
+        raise ValueError(f"{path.name}: {exc}") from exc
+    thresholds = policy.get("thresholds", {})
+    for scanner, severity in thresholds.items():
+        if scanner not in SCANNERS or severity not in SEVERITIES[1:]:
+            raise ValueError(f"{path.name}: [thresholds] {scanner} = {severity!r}; scanners are {', '.join(SCANNERS)}")
+    acknowledged = policy.get("acknowledged", [])
+    for entry in acknowledged:
+        missing = {"id", "severity", "expires", "reason"} - entry.keys()
+        if missing:
+            raise ValueError(f"{path.name}: [[acknowledged]] {entry.get('id', '')} needs {', '.join(sorted(missing))}")
+        if not isinstance(entry["expires"], datetime.date) or isinstance(entry["expires"], datetime.datetime):
+            raise ValueError(f"{path.name}: [[acknowledged]] {entry['id']}: expires must be a date, e.g. 2026-12-31")
+        if entry["severity"] not in SEVERITIES or entry.get("scanner", SCANNERS[0]) not in SCANNERS:
+            raise ValueError(f"{path.name}: [[acknowledged]] {entry['id']}: unknown severity or scanner")
+    return {"thresholds": thresholds, "acknowledged": acknowledged}
+
+
+def trivy_ignores(path: Path = TRIVY_IGNORE) -> list[dict]:
+    """Return the entries of a .trivyignore as {"id", "expires"}, raising ValueError for one without exp:."""
+    entries = []
+    text = path.read_text() if path.is_file() else ""
+    for number, line in enumerate(text.splitlines(), 1):
+        fields = line.split("#", 1)[0].split()
+        if not fields:
+            continue
+        expiry = next((field.removeprefix("exp:") for field in fields[1:] if field.startswith("exp:")), None)
+        try:
+            expires = datetime.date.fromisoformat(expiry or "")
+        except ValueError:
+            raise ValueError(
+                f"{path}:{number}: {fields[0]} needs an expiry date (exp:YYYY-MM-DD)"
+            ) from None
+        entries.append({"id": fields[0], "expires": expires})
+    return entries
+
+
+def expiring(policy: dict, ignores: list[dict]) -> list[str]:
+    """Return a message per acknowledgement or .trivyignore entry that expired or expires within EXPIRY_WARNING_DAYS."""
+    today = _today()
+    messages = []
+    sources = [(POLICY_PATH.name, entry) for entry in policy["acknowledged"]]
+    sources += [(str(TRIVY_IGNORE), entry) for entry in ignores]
+    for source, entry in sources:
+        days = (entry["expires"] - today).days
+        if days < 0:
+            messages.append(f"{source}: {entry['id']} expired on {entry['expires']} and is reported again")
+        elif days <= EXPIRY_WARNING_DAYS:
+            messages.append(f"{source}: {entry['id']} expires on {entry['expires']} ({days} days)")
+    return messages
+
+
+def apply_policy(findings: list[dict], policy: dict) -> list[dict]:
+    """Return findings with the unexpired acknowledgements' severities, noted in their titles."""
+    today = _today()
+    applied = []
+    for finding in findings:
+        entry = next((
+            entry for entry in policy["acknowledged"]
+            if entry["id"] == finding["id"] and entry.get("scanner", finding["scanner"]) == finding["scanner"]
+            and entry["expires"] >= today
+        ), None)
+        if entry is not None:
+            finding = {
+                **finding,
+                "severity": entry["severity"],
+                "title": (
+                    f"{finding['title']} [acknowledged as {entry['severity']}"
+                    f" until {entry['expires']}: {entry['reason']}]"
+                ),
+            }
+        applied.append(finding)
+    return applied
+
+
+def _finding(scanner: str, rule: str, severity: str, package: str, title: str, location: str) -> dict:
+    severity = severity.lower()
+    return {
+        "scanner": scanner,
+        "id": rule,
+        "severity": severity if severity in SEVERITIES else "unknown",
+        "package": package,
+        "title": title,
+        "location": location,
+    }
+
+
+def parse_cargo_audit(report: str) -> list[dict]:
+    """Normalize `cargo audit --json` output."""
+    data = json.loads(report)
+    findings = [
+        _finding(
+            "cargo-audit", v["advisory"]["id"], "high", f"{v['package']['name']} {v['package']['version']}",
+            v["advisory"]["title"], "Cargo.lock",
+        )
+        for v in data.get("vulnerabilities", {}).get("list", [])
+    ]
+    for kind, warnings in data.get("warnings", {}).items():
+        for w in warnings:
+            advisory = w.get("advisory") or {}
+            findings.append(_finding(
+                "cargo-audit", advisory.get("id", kind), "low", f"{w['package']['name']} {w['package']['version']}",
+                advisory.get("title", kind), "Cargo.lock",
+            ))
+    return findings
+
+
+def parse_trivy(report: str) -> list[dict]:
+    """Normalize `trivy fs --format json` output."""
+    findings = []
+    for result in json.loads(report).get("Results") or []:
+        target = result.get("Target", "")
+        for v in result.get("Vulnerabilities") or []:
+            findings.append(_finding(
+                "trivy", v["VulnerabilityID"], v.get("Severity", "unknown"),
+                f"{v.get('PkgName', '')} {v.get('InstalledVersion', '')}".strip(), v.get("Title", ""), target,
+            ))
+        for m in result.get("Misconfigurations") or []:
+            findings.append(_finding("trivy", m["ID"], m.get("Severity", "unknown"), "", m.get("Title", ""), target))
+    return findings
+
+
+def parse_gitleaks(report: str) -> list[dict]:
+    """Normalize a gitleaks JSON report; history findings are located at file:line@commit."""
+    return [
+        _finding(
+            "gitleaks", leak["RuleID"], "critical", "", leak.get("Description", ""),
+            f"{leak['File']}:{leak['StartLine']}" + (f"@{leak['Commit'][:12]}" if leak.get("Commit") else ""),
+        )
+        for leak in json.loads(report or "[]")
+    ]
+
+
+def gitleaks_sarif(report: str) -> str:
+    """Convert a gitleaks JSON report to SARIF 2.1.0, one error result per leak."""
+    leaks = json.loads(report or "[]")
+    rules: dict[str, str] = {}
+    for leak in leaks:
+        rules[leak["RuleID"]] = rules.get(leak["RuleID"]) or leak.get("Description", "")
+    results = []
+    for leak in leaks:
+        region = {
+            "startLine": leak["StartLine"], "endLine": leak.get("EndLine", leak["StartLine"]),
+            "startColumn": leak.get("StartColumn", 1), "endColumn": leak.get("EndColumn", 1),
+        }
+        result = {
+            "ruleId": leak["RuleID"],
+            "level": "error",
+            "message": {"text": f"{leak['RuleID']} has detected a secret in {leak['File']}"},
+            "locations": [{"physicalLocation": {"artifactLocation": {"uri": leak["File"]}, "region": region}}],
+        }
+        if leak.get("Commit"):
+            result["message"]["text"] += f" at commit {leak['Commit']}"
+            result["partialFingerprints"] = {"commitSha": leak["Commit"]}
+        results.append(result)
+    sarif = {
+        "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+        "version": "2.1.0",
+        "runs": [{
+            "tool": {"driver": {
+                "name": "gitleaks",
+                "informationUri": "https://github.com/gitleaks/gitleaks",
+                "rules": [
+                    {"id": rule, "name": rule, "shortDescription": {"text": description or rule}}
+                    for rule, description in sorted(rules.items())
+                ],
+            }},
+            "results": results,
+        }],
+    }
+    return json.dumps(sarif, indent=2) + "\n"
+
+
+def _osv_severity(vulnerability: dict, score: str) -> str:
+    if (vulnerability.get("database_specific") or {}).get("informational"):
+        return "low"
+    try:
+        cvss = float(score)
+    except ValueError:
+        severity = str((vulnerability.get("database_specific") or {}).get("severity", "high")).lower()
+        return "medium" if severity == "moderate" else severity
+    return "critical" if cvss >= 9 else "high" if cvss >= 7 else "medium" if cvss >= 4 else "low"
+
+
+def parse_osv_scanner(report: str) -> list[dict]:
+    """Normalize `osv-scanner --format json` output, one finding per advisory group."""
+    overlay = source_layout.component("overlay").as_posix()
+    findings = []
+    for result in json.loads(report or "{}").get("results") or []:
+        path = result["source"]["path"]
+        if path.startswith(f"{OVERLAY_LOCKFILES}/"):
+            location = f"{overlay}/{path[len(OVERLAY_LOCKFILES) + 1:].removesuffix('/Cargo.lock')}.ebuild"
+        else:
+            location = path.removeprefix(f"{workspace_checks.WORKSPACE}/")
+        for package in result.get("packages") or []:
+            vulnerabilities = {v["id"]: v for v in package.get("vulnerabilities") or []}
+            for group in package.get("groups") or []:
+                ids = group["ids"]
+                # cargo-audit reports the RustSec ID, so prefer it for de-duplication.
+                rule = next((i for i in ids if i.startswith("RUSTSEC-")), ids[0])
+                vulnerability = vulnerabilities.get(rule) or vulnerabilities.get(ids[0]) or {}
+                findings.append(_finding(
+                    "osv-scanner", rule, _osv_severity(vulnerability, group.get("max_severity", "")),
+                    f"{package['package']['name']} {package['package']['version']}",
+                    vulnerability.get("summary", ""), location,
+                ))
+    return findings
+
+
+def hadolint_by_file(report: str, files: list[str]) -> str:
+    """Return hadolint's findings grouped by file, every linted file included."""
+    lints: dict[str, list[dict]] = {path: [] for path in files}
+    for lint in json.loads(report or "[]"):
+        lints.setdefault(lint["file"].removeprefix("./"), []).append(lint)
+    if not lints:
+        return "No Dockerfiles or Containerfiles found\n"
+    lines = []
+    for path, found in sorted(lints.items()):
+        counts = Counter(lint["level"] for lint in found)
+        levels = ", ".join(f"{counts[level]} {level}" for level in sorted(counts))
+        lines.append(f"{path}: " + (f"{len(found)} findings ({levels})" if found else "clean"))
+        lines += [
+            f"  {lint['line']:>5}  {lint['level']:<8} {lint['code']:<7} {lint['message']}"
+            for lint in sorted(found, key=lambda lint: lint["line"])
+        ]
+    return "\n".join(lines) + "\n"
+
+
+def parse_hadolint(report: str) -> list[dict]:
+    """Normalize `hadolint -f json` output."""
+    levels = {"error": "high", "warning": "medium"}
+    return [
+        _finding(
+            "hadolint", lint["code"], levels.get(lint["level"], "low"), "", lint["message"],
+            f"{lint['file']}:{lint['line']}",
+        )
+        for lint in json.loads(report or "[]")
+    ]
+
+
+async def cargo_audit(client: dagger.Client) -> dict[str, str]:
+    """Audit the workspace's resolved Cargo.lock; return {"cargo-audit.json": report}."""
+    auditor = await checked_exec(
+        workspace_checks.rust_container(client, workspace_checks.cargo_source(client)),
+        ["cargo", "install", "--locked", "cargo-audit", "--version", CARGO_AUDIT_VERSION],
+        "security-cargo-audit-install",
+    )
+    auditor = auditor.with_env_variable("REGICIDE_SCAN_DAY", scan_day())
+    # cargo audit exits 1 when it finds something; the gate decides.
+    ran = await checked_exec(
+        auditor, ["sh", "-c", f"cargo audit --json > {REPORT} || test -s {REPORT}"], "security-cargo-audit"
+    )
+    return {"cargo-audit.json": await ran.file(REPORT).contents()}
+
+
+async def trivy(client: dagger.Client) -> dict[str, str]:
+    """Scan the whole tree with trivy fs; return {"trivy.json": report, "trivy.sarif": SARIF}."""
+    scanner = (await _trivy(client)).with_directory(
+        workspace_checks.WORKSPACE, workspace_checks.workspace_source(client)
+    )
+    ignore = f"{workspace_checks.WORKSPACE}/{TRIVY_IGNORE}"
+    ran = await checked_exec(
+        scanner,
+        [
+            "sh", "-c",
+            f"ignore=; if [ -f {ignore} ]; then ignore='--ignorefile {ignore}'; fi; "
+            f"trivy fs --scanners vuln,misconfig $ignore --format json --output {REPORT} {workspace_checks.WORKSPACE}"
+            f" && trivy convert --format sarif --output {SARIF_REPORT} {REPORT}",
+        ],
+        "security-trivy",
+    )
+    return {"trivy.json": await ran.file(REPORT).contents(), "trivy.sarif": await ran.file(SARIF_REPORT).contents()}
+
+
+async def _trivy(client: dagger.Client) -> dagger.Container:
+    """Return a trivy container with the shared vulnerability DB cache, refreshed daily."""
+    return (
+        (await from_image_with_fallback(client, TRIVY_IMAGE))
+        .with_mounted_cache("/root/.cache/trivy", cache_keys.volume(client, "regicide-trivy-cache", shared=True))
+        .with_env_variable("REGICIDE_SCAN_DAY", scan_day())
+    )
+
+
+async def trivy_artifacts(client: dagger.Client, artifacts: dagger.Directory, sbom: str | None) -> str:
+    """Scan released artifacts with today's trivy DB; return the JSON report.
+
+    Scans sbom (a file name in artifacts) when given, else every binary in
+    artifacts; Rust binaries only yield findings when built with
+    cargo-auditable.
+    """
+    command = (
+        ["trivy", "sbom", "--format", "json", "--output", REPORT, f"/artifacts/{sbom}"] if sbom
+        else ["trivy", "rootfs", "--scanners", "vuln", "--format", "json", "--output", REPORT, "/artifacts"]
+    )
+    scanner = (await _trivy(client)).with_directory("/artifacts", artifacts)
+    ran = await checked_exec(scanner, command, "rescan-artifacts")
+    return await ran.file(REPORT).contents()
+
+
+async def trivy_image(client: dagger.Client, ref: str) -> str:
+    """Scan a published image with today's trivy DB; return the JSON report."""
+    ran = await checked_exec(
+        await _trivy(client),
+        ["trivy", "image", "--scanners", "vuln", "--format", "json", "--output", REPORT, ref],
+        "rescan-image",
+    )
+    return await ran.file(REPORT).contents()
+
+
+async def gitleaks(client: dagger.Client, history: bool = False) -> dict[str, str]:
+    """Scan the working tree for secrets; return {"gitleaks.json": report, "gitleaks.sarif": SARIF}.
+
+    gitleaks runs once, and the SARIF is converted from its JSON report
+    (gitleaks_sarif()).  With history, scan every commit reachable in the clone instead, which
+    also finds secrets that were committed and later deleted.  A shallow
+    clone only has its last commits; fetch with --unshallow first.
+    """
+    scanner = (
+        (await from_image_with_fallback(client, GITLEAKS_IMAGE))
+        .with_directory(workspace_checks.WORKSPACE, workspace_checks.workspace_source(client, with_git=history))
+        .with_new_file("/tmp/gitleaks.toml", GITLEAKS_CONFIG.read_text())
+        .with_new_file("/tmp/gitleaks-baseline.json", GITLEAKS_BASELINE.read_text())
+    )
+    detect = (
+        f"gitleaks detect {'' if history else '--no-git '}--redact --exit-code 0 --config /tmp/gitleaks.toml"
+        f" --baseline-path /tmp/gitleaks-baseline.json --source {workspace_checks.WORKSPACE}"
+    )
+    ran = await checked_exec(
+        scanner,
+        [
+            "sh", "-c",
+            (
+                f"if [ -f {workspace_checks.WORKSPACE}/.git/shallow ]; then "
+                "echo 'warning: shallow clone; gitleaks only sees the fetched commits' >&2; fi; "
+                if history else ""
+            )
+            + f"{detect} --report-format json --report-path {REPORT}",
+        ],
+        "security-gitleaks",
+    )
+    report = await ran.file(REPORT).contents()
+    return {"gitleaks.json": report, "gitleaks.sarif": gitleaks_sarif(report)}
+
+
+def overlay_lockfile(ebuild: str) -> str | None:
+    """Return a Cargo.lock listing the crates in an ebuild's CRATES, or None if it has none.
+
+    Entries are name@version, or name-version in older ebuilds.
+    """
+    match = re.search(r'^CRATES="([^"]*)"', ebuild, re.MULTILINE)
+    packages = []
+    for entry in (match.group(1).split() if match else []):
+        crate = re.fullmatch(r"([A-Za-z0-9_-]+?)[@-](\d+\.\d+\.\d+\S*)", entry)
+        if crate:
+            packages.append(
+                f'[[package]]\nname = "{crate.group(1)}"\nversion = "{crate.group(2)}"\n'
+                'source = "registry+https://github.com/rust-lang/crates.io-index"\n'
+            )
+    return "version = 3\n\n" + "\n".join(packages) if packages else None
+
+
+async def osv_scanner(client: dagger.Client) -> dict[str, str]:
+    """Scan the tree's lockfiles and the overlay ebuilds' crates; return {"osv-scanner.json": report}.
+
+    Raises workspace_checks.MissingLockfile when the workspace has no Cargo.lock.
+    """
+    lock = workspace_checks.require_lockfile("security-osv-scanner").as_posix()
+    source = workspace_checks.workspace_source(client)
+    overlay = source_layout.directory(client, source, "overlay")
+    lockfiles = client.directory()
+    for path in await overlay.glob("**/*.ebuild"):
+        lockfile = overlay_lockfile(await overlay.file(path).contents())
+        if lockfile is not None:
+            lockfiles = lockfiles.with_new_file(f"{path.removesuffix('.ebuild')}/Cargo.lock", lockfile)
+    scanner = (
+        (await from_image_with_fallback(client, OSV_SCANNER_IMAGE))
+        .with_directory(workspace_checks.WORKSPACE, source)
+        .with_file(
+            f"{workspace_checks.WORKSPACE}/{lock}", workspace_checks.workspace_source(client, paths=[lock]).file(lock)
+        )
+        .with_directory(OVERLAY_LOCKFILES, lockfiles)
+        .with_env_variable("REGICIDE_SCAN_DAY", scan_day())
+    )
+    # osv-scanner exits 1 when it finds something (the gate decides) and 128 when there is nothing to scan.
+    ran = await checked_exec(
+        scanner,
+        [
+            "sh", "-c",
+            f"/root/osv-scanner --format json --output {REPORT}"
+            f" --recursive {workspace_checks.WORKSPACE} {OVERLAY_LOCKFILES}; "
+            "rc=$?; if [ $rc -eq 128 ]; then echo 'osv-scanner found no lockfiles to scan' >&2; fi;"
+            " if [ $rc -gt 1 ]; then exit $rc; fi",
+        ],
+        "security-osv-scanner",
+    )
+    return {"osv-scanner.json": await ran.file(REPORT).contents()}
+
+
+async def hadolint(client: dagger.Client) -> dict[str, str]:
+    """Lint every Dockerfile and Containerfile in the tree.
+
+    Returns {"hadolint.json": report, "hadolint.txt": findings per file}.
+    """
+    scanner = (
+        (await from_image_with_fallback(client, HADOLINT_IMAGE))
+        .with_directory(workspace_checks.WORKSPACE, workspace_checks.workspace_source(client))
+        .with_workdir(workspace_checks.WORKSPACE)
+    )
+    ran = await checked_exec(
+        scanner,
+        [
+            "sh", "-c",
+            "files=$(find . -type f \\( -name 'Dockerfile*' -o -name 'Containerfile*' -o -name '*.dockerfile' \\) "
+            "-not -path './target/*' | sed 's|^\\./||' | sort); "
+            "config=; if [ -f .hadolint.yaml ]; then config='--config .hadolint.yaml'; fi; "
+            f"if [ -z \"$files\" ]; then echo 'no Dockerfiles or Containerfiles to lint' >&2; echo '[]' > {REPORT}; "
+            # --no-fail: the gate decides, not hadolint's exit code.
+            f"else hadolint $config -f json --no-fail $files > {REPORT}; fi; "
+            "printf '%s\\n' $files",
+        ],
+        "security-hadolint",
+    )
+    report = await ran.file(REPORT).contents()
+    return {"hadolint.json": report, "hadolint.txt": hadolint_by_file(report, (await ran.stdout()).split())}
+
+
+_RUNNERS = {
+    "cargo-audit": cargo_audit, "trivy": trivy, "gitleaks": gitleaks, "osv-scanner": osv_scanner, "hadolint": hadolint,
+}
+_PARSERS = {
+    "cargo-audit": parse_cargo_audit, "trivy": parse_trivy, "gitleaks": parse_gitleaks,
+    "osv-scanner": parse_osv_scanner, "hadolint": parse_hadolint,
+}
+
+
+async def scan(
+    client: dagger.Client, scanners: list[str] = SCANNERS, options: dict[str, dict] | None = None
+) -> tuple[dict[str, str], list[dict]]:
+    """Run scanners concurrently; return ({report file name: contents}, merged findings).
+
+    options holds keyword arguments for a scanner's runner, e.g.
+    {"gitleaks": {"history": True}}.
+    """
+    async def run(name: str) -> dict[str, str]:
+        try:
+            return await _RUNNERS[name](client, **(options or {}).get(name, {}))
+        except StageFailed as exc:
+            if not advisory.excuse(f"security-{name}", exc):
+                raise
+            return {}
+
+    raw = {}
+    for reports in await asyncio.gather(*(run(name) for name in scanners)):
+        raw |= reports
+    findings = [
+        finding for name in scanners if f"{name}.json" in raw for finding in _PARSERS[name](raw[f"{name}.json"])
+    ]
+    audited = {(f["id"], f["location"]) for f in findings if f["scanner"] == "cargo-audit"}
+    findings = [f for f in findings if f["scanner"] != "osv-scanner" or (f["id"], f["location"]) not in audited]
+    findings = apply_policy(findings, load_policy())
+    findings.sort(key=lambda f: (-SEVERITIES.index(f["severity"]), f["scanner"], f["id"]))
+    return raw, findings
+
+
+def blocking(findings: list[dict], threshold: str, thresholds: dict[str, str] | None = None) -> list[dict]:
+    """Return the findings at or above their scanner's threshold from scanners that are not advisory.
+
+    thresholds maps scanners to their own threshold; the rest use threshold.
+    """
+    thresholds = thresholds or {}
+    return [
+        f for f in findings
+        if SEVERITIES.index(f["severity"]) >= SEVERITIES.index(thresholds.get(f["scanner"], threshold))
+        and not advisory.is_advisory(f"security-{f['scanner']}")
+    ]
+
+
+def summary(findings: list[dict], threshold: str, thresholds: dict[str, str] | None = None) -> str:
+    """Return a plain-text table of findings with a count line per severity."""
+    lines = [
+        f"{f['severity']:<9} {f['scanner']:<12} {f['id']:<24} {f['package'] or f['location']}  {f['title']}"
+        for f in findings
+    ]
+    counts = ", ".join(
+        f"{sum(f['severity'] == s for f in findings)} {s}" for s in reversed(SEVERITIES)
+    )
+    own = "".join(f", {scanner} at {severity}" for scanner, severity in sorted((thresholds or {}).items()))
+    lines.append(f"Total: {len(findings)} ({counts}); gating at {threshold} and above{own}")
+    return "\n".join(lines) + "\n"
+
+
+def upload_sarif(sarif: str, tool: str) -> None:
+    """Upload a SARIF report to GitHub code scanning for the commit being built.
+
+    Uses the GitHub CLI with a token in GH_TOKEN/GITHUB_TOKEN that has the
+    security_events scope.  Needs GITHUB_REPOSITORY; the ref is GITHUB_REF
+    in Actions, else the checked-out branch.  Raises exit_codes.RunFailed
+    (infrastructure) with gh's error when the upload fails.
+    """
+    repository = os.environ.get("GITHUB_REPOSITORY")
+    if not repository:
+        print("GITHUB_REPOSITORY not set; not uploading SARIF")
+        return
+    ref = build_info.git_ref()
+    body = {
+        "commit_sha": build_info.git_sha(),
+        "ref": ref,
+        "sarif": base64.b64encode(gzip.compress(sarif.encode())).decode(),
+        "tool_name": tool,
+    }
+    try:
+        subprocess.run(
+            ["gh", "api", "--method", "POST", f"repos/{repository}/code-scanning/sarifs", "--input", "-"],
+            input=json.dumps(body), check=True, text=True, capture_output=True,
+        )
+    except (OSError, subprocess.CalledProcessError) as exc:
+        detail = (getattr(exc, "stderr", None) or str(exc)).strip()
+        raise exit_codes.RunFailed(
+            "sarif-upload", exit_codes.INFRASTRUCTURE, f"could not upload {tool} SARIF to {repository}: {detail}"
+        ) from exc
+    print(f"Uploaded {tool} SARIF to GitHub code scanning ({repository} {ref})")
+
+
+async def gate(client: dagger.Client, findings: list[dict], threshold: str) -> None:
+    """Fail the security-gate stage when any finding is at or above threshold, or its scanner's threshold in the policy.
+
+    Failing through checked_exec gives the gate a failure bundle, the
+    scan-finding classification and nightly issue filing like any stage.
+    """
+    thresholds = load_policy()["thresholds"]
+    blocked = blocking(findings, threshold, thresholds)
+    if not blocked:
+        return
+    await checked_exec(
+        from_image(client, "alpine:latest").with_new_file("/tmp/summary.txt", summary(blocked, threshold, thresholds)),
+        [
+            "sh", "-c",
+            f"cat /tmp/summary.txt >&2; echo '{len(blocked)} security findings at or above {threshold}' >&2; exit 1",
+        ],
+        "security-gate",
+    )
@@ -0,0 +1,238 @@
+"""Signing - cosign signatures for published images and release files, and their verification.
+
+Two modes, as for the SquashFS and SBOM signatures in dagger_pipeline.py:
+
+- keyless: in GitHub Actions, cosign signs with the workflow's OIDC
+  identity through Fulcio and records the signature in Rekor;
+  verification pins that identity (IDENTITY, REGICIDE_SIGN_IDENTITY) and
+  ISSUER.
+- key-based: COSIGN_KEY (the PEM) or COSIGN_KEY_PATH (a file) holds a
+  cosign private key, with COSIGN_PASSWORD.  The key reaches the signer
+  only as a Dagger secret, and nothing is uploaded to the transparency
+  log, so verification with the public key skips it.
+
+sign_image() signs a pushed image by digest, and attest_image() attaches a
+signed in-toto attestation (an SBOM) to it; sign_blob() returns a cosign
+bundle for a file.  verify_image() and verify_blobs() back `ci.py verify`,
+and generate_key_pair() the throwaway key of `ci.py release-check`.
+verify_blobs() checks both forms a file can be signed in: a cosign bundle
+(<file>.bundle) and a detached signature (<file>.sig, with <file>.cert
+when keyless), as the SquashFS image and SBOM are.  A run that signs
+files lists them, with the paths of their bundles, signatures and
+certificates, in SIGNED next to them (record_signed()), and `ci.py verify`
+checks exactly those (signed_files()).
+"""
+
+import json
+import os
+from pathlib import Path
+
+import dagger
+
+from failure_bundle import checked_exec, from_image
+
+
+COSIGN_VERSION = "2.4.0"
+COSIGN_SHA256 = "cd7636b3586a3bdac2d9c8f3b421ed119edcb20499107887fd929211110e8418"
+IDENTITY = os.environ.get(
+    "REGICIDE_SIGN_IDENTITY",
+    "https://github.com/RegicideOS/RegicideOS/.github/workflows/release.yml@refs/heads/main",
+)
+ISSUER = "https://token.actions.githubusercontent.com"
+KEY = "/secrets/cosign.key"
+PUBLIC_KEY = "/secrets/cosign.pub"
+SIGNED = "signed.json"
+# The signature files of a signed file, with their suffix in verify_blobs()'s directory.
+SIGNATURE_FILES = {"bundle": "bundle", "signature": "sig", "certificate": "cert"}
+
+
+async def with_cosign(container: dagger.Container, stage: str) -> dagger.Container:
+    """Install cosign COSIGN_VERSION into an Alpine container from the official release, as step <stage>-cosign."""
+    cosign_url = f"https://github.com/sigstore/cosign/releases/download/v{COSIGN_VERSION}/cosign-linux-amd64"
+    return await checked_exec(
+        container,
+        [
+            "sh", "-c",
+            "apk add --no-cache curl ca-certificates coreutils && "
+            f"curl -sL -o /usr/local/bin/cosign '{cosign_url}' && "
+            f"echo '{COSIGN_SHA256}  /usr/local/bin/cosign' | sha256sum -c - && "
+            "chmod +x /usr/local/bin/cosign",
+        ],
+        f"{stage}-cosign",
+    )
+
+
+def key_based() -> bool:
+    """Return whether a cosign private key is configured."""
+    return bool(os.environ.get("COSIGN_KEY") or os.environ.get("COSIGN_KEY_PATH"))
+
+
+def with_key(client: dagger.Client, container: dagger.Container) -> dagger.Container:
+    """Mount the configured private key at KEY as a secret, with its password."""
+    pem = os.environ.get("COSIGN_KEY") or Path(os.environ["COSIGN_KEY_PATH"]).read_text()
+    return (
+        container
+        .with_mounted_secret(KEY, client.set_secret("cosign-key", pem))
+        .with_secret_variable(
+            "COSIGN_PASSWORD", client.set_secret("cosign-password", os.environ.get("COSIGN_PASSWORD", ""))
+        )
+    )
+
+
+async def signer(client: dagger.Client, stage: str) -> dagger.Container:
+    """Return a cosign container for the configured mode."""
+    container = (await with_cosign(from_image(client, "alpine:latest"), stage)).with_env_variable("COSIGN_YES", "true")
+    return with_key(client, container) if key_based() else container
+
+
+def _sign_flags() -> list[str]:
+    return [f"--key={KEY}", "--tlog-upload=false"] if key_based() else []
+
+
+async def _registry_signer(
+    client: dagger.Client, stage: str, registry: str, user: str, token: str
+) -> tuple[dagger.Container, str]:
+    """Return a signer with the registry token, and the shell command that logs cosign in."""
+    container = (await signer(client, stage)).with_secret_variable(
+        "REGISTRY_TOKEN", client.set_secret("cosign-registry-token", token)
+    )
+    return container, f'echo "$REGISTRY_TOKEN" | cosign login {registry} -u {user} --password-stdin >&2'
+
+
+async def sign_image(client: dagger.Client, ref: str, registry: str, user: str, token: str) -> None:
+    """Sign the pushed image ref (REPOSITORY@sha256:...), storing the signature next to it."""
+    container, login = await _registry_signer(client, "sign-image", registry, user, token)
+    await checked_exec(
+        container,
+        ["sh", "-c", f"{login} && cosign sign {' '.join(_sign_flags())} {ref} >&2"],
+        "sign-image",
+    )
+
+
+async def attest_image(
+    client: dagger.Client,
+    ref: str,
+    predicate: dagger.File,
+    predicate_type: str,
+    registry: str,
+    user: str,
+    token: str,
+) -> None:
+    """Attach predicate to the pushed image ref as a signed attestation of predicate_type (cosign --type)."""
+    container, login = await _registry_signer(client, f"attest-image-{predicate_type}", registry, user, token)
+    await checked_exec(
+        container.with_file("/predicate.json", predicate),
+        [
+            "sh", "-c",
+            f"{login} && cosign attest {' '.join(_sign_flags())} --type {predicate_type}"
+            f" --predicate /predicate.json {ref} >&2",
+        ],
+        f"attest-image-{predicate_type}",
+    )
+
+
+async def sign_blob(client: dagger.Client, file: dagger.File, name: str) -> dagger.File:
+    """Return the cosign bundle signing file, to publish as <name>.bundle."""
+    container = (await signer(client, "sign-blob")).with_file(f"/artifacts/{name}", file)
+    signed = await checked_exec(
+        container,
+        ["cosign", "sign-blob", *_sign_flags(), f"--bundle=/artifacts/{name}.bundle", f"/artifacts/{name}"],
+        "sign-blob",
+    )
+    return signed.file(f"/artifacts/{name}.bundle")
+
+
+async def generate_key_pair(client: dagger.Client) -> dagger.Directory:
+    """Return a new cosign.key (with an empty password) and cosign.pub."""
+    cosign = await with_cosign(from_image(client, "alpine:latest"), "generate-key-pair")
+    generated = await checked_exec(
+        cosign.with_workdir("/keys").with_env_variable("COSIGN_PASSWORD", ""),
+        ["cosign", "generate-key-pair"],
+        "generate-key-pair",
+    )
+    return generated.directory("/keys")
+
+
+def _verify_flags(public_key: dagger.File | None, identity: str) -> list[str]:
+    if public_key is not None:
+        return [f"--key={PUBLIC_KEY}", "--insecure-ignore-tlog=true"]
+    return [f"--certificate-identity={identity}", f"--certificate-oidc-issuer={ISSUER}"]
+
+
+async def verifier(client: dagger.Client, stage: str, public_key: dagger.File | None) -> dagger.Container:
+    """Return a cosign container, with public_key at PUBLIC_KEY when given."""
+    container = await with_cosign(from_image(client, "alpine:latest"), stage)
+    return container.with_mounted_file(PUBLIC_KEY, public_key) if public_key is not None else container
+
+
+async def verify_image(
+    client: dagger.Client, ref: str, identity: str = IDENTITY, public_key: dagger.File | None = None
+) -> None:
+    """Verify ref's cosign signature; raises StageFailed when it is missing or does not match."""
+    await checked_exec(
+        await verifier(client, "verify-image", public_key),
+        ["sh", "-c", f"cosign verify {' '.join(_verify_flags(public_key, identity))} {ref} >&2"],
+        "verify-image",
+    )
+
+
+def _signature_flags(name: str, public_key: dagger.File | None) -> list[str]:
+    """Return the verify-blob flags for name's detached signature, and its certificate when keyless."""
+    flags = [f"--signature='/artifacts/{name}.sig'"]
+    return flags if public_key is not None else [*flags, f"--certificate='/artifacts/{name}.cert'"]
+
+
+async def verify_blobs(
+    client: dagger.Client,
+    directory: dagger.Directory,
+    bundles: list[str],
+    signatures: list[str],
+    identity: str = IDENTITY,
+    public_key: dagger.File | None = None,
+) -> None:
+    """Verify each of bundles against <name>.bundle and each of signatures against <name>.sig.
+
+    Raises StageFailed on the first mismatch.
+    """
+    container = (await verifier(client, "verify-blobs", public_key)).with_mounted_directory("/artifacts", directory)
+    checks = [(name, [f"--bundle='/artifacts/{name}.bundle'"], "") for name in bundles]
+    checks += [(name, _signature_flags(name, public_key), "-sig") for name in signatures]
+    for name, flags, suffix in checks:
+        flags = [*_verify_flags(public_key, identity), *flags]
+        await checked_exec(
+            container,
+            ["sh", "-c", f"cosign verify-blob {' '.join(flags)} '/artifacts/{name}' >&2"],
+            f"verify-{name}{suffix}",
+        )
+
+
+def record_signed(directory: Path, run: str, files: list[dict[str, Path | None]]) -> Path:
+    """Write SIGNED in directory, listing the files run signed, and return its path.
+
+    Each of files maps "file" and the keys of SIGNATURE_FILES to a path, or
+    None for a signature it does not have.  Paths under directory are
+    stored relative to it, so the listing survives a copy of the directory.
+    """
+    def stored(path: Path | None) -> str | None:
+        if path is None:
+            return None
+        return str(path.relative_to(directory)) if path.is_relative_to(directory) else str(path)
+
+    manifest_path = directory / SIGNED
+    manifest_path.write_text(json.dumps(
+        {"run": run, "files": [{key: stored(path) for key, path in entry.items()} for entry in files]}, indent=2
+    ) + "\n")
+    return manifest_path
+
+
+def signed_files(directory: Path) -> tuple[str, list[dict[str, Path | None]]]:
+    """Return the run and the files listed in directory's SIGNED, with their paths resolved.
+
+    Raises FileNotFoundError when directory has no SIGNED.
+    """
+    manifest = json.loads((directory / SIGNED).read_text())
+    files = [
+        {key: directory / path if path is not None else None for key, path in entry.items()}
+        for entry in manifest["files"]
+    ]
+    return manifest["run"], files
@@ -0,0 +1,79 @@
+"""Source layout - the repository root the pipeline builds and where its components are.
+
+The pipeline runs with the source root as its working directory, so every
+repository-relative path in the stages resolves against it.  The root
+defaults to the checkout this file is in, so the pipeline can be started
+from any subdirectory; --source points it at another checkout (a worktree,
+a monorepo that vendors RegicideOS).  layout.toml maps component names to
+subpaths, overridable per run with --component NAME=PATH.
+"""
+
+import os
+import tomllib
+from pathlib import Path
+
+import dagger
+
+
+LAYOUT_PATH = Path(__file__).parent / "layout.toml"
+DEFAULT_ROOT = Path(__file__).resolve().parent.parent
+
+_overrides: dict[str, Path] = {}
+
+
+def use_root(root: Path) -> None:
+    """Make root the source root: the working directory every stage resolves paths against."""
+    if not root.is_dir():
+        raise ValueError(f"source root {root} is not a directory")
+    os.chdir(root)
+
+
+def components() -> dict[str, Path]:
+    """Return {component: path}; paths outside the source root are absolute."""
+    with LAYOUT_PATH.open("rb") as f:
+        layout = {name: Path(path) for name, path in tomllib.load(f)["components"].items()}
+    # Keep overrides inside the source root relative, so stages can take
+    # them from the workspace directory they already loaded.
+    root = Path.cwd().resolve()
+    for name, path in _overrides.items():
+        layout[name] = path.relative_to(root) if path.is_relative_to(root) else path
+    return layout
+
+
+def override(spec: str) -> None:
+    """Apply a --component NAME=PATH override, raising ValueError if it is malformed.
+
+    PATH is resolved against the current directory, so apply overrides
+    before use_root().
+    """
+    name, sep, path = spec.partition("=")
+    if not sep or not path:
+        raise ValueError(f"--component expects NAME=PATH, got {spec!r}")
+    if name not in components():
+        raise ValueError(f"unknown component {name}; {LAYOUT_PATH.name} has {', '.join(components())}")
+    resolved = Path(path).resolve()
+    if not resolved.is_dir():
+        raise ValueError(f"component {name}: {path} is not a directory")
+    _overrides[name] = resolved
+
+
+def component(name: str) -> Path:
+    """Return the path of component name."""
+    return components()[name]
+
+
+def source_paths(*names: str) -> list[str]:
+    """Return the repository paths of the named components inside the source root.
+
+    For workspace_source(paths=...): a component outside the root is read
+    from the host by directory() instead.
+    """
+    return [path.as_posix() for path in map(component, names) if not path.is_absolute()]
+
+
+def directory(client: dagger.Client, src: dagger.Directory, name: str) -> dagger.Directory:
+    """Return component name's directory, from src when it is inside the source root."""
+    path = component(name)
+    if path.is_absolute():
+        return client.host().directory(str(path), exclude=[".git/"])
+    return src.directory(path.as_posix())
@@ -0,0 +1,123 @@
+"""Stage memoization - skip stages whose inputs match an earlier passing run.
+
+Dagger's layer cache still has to look up every exec and re-export every
+output, so repeating an unchanged full pipeline takes minutes.  With
+--memoize (REGICIDE_MEMOIZE=1), each workspace check stage and the OS
+image build is keyed by this run's input fingerprint (fingerprint.py:
+sources, pinned images, tools, config and REGICIDE_* variables) and the
+pipeline arguments.  A stage whose key matches one an earlier run recorded
+when the stage passed, and whose output files are still in place and
+unchanged, is skipped and its outputs reused; it shows as "reused" in the
+run's timings.  The key is deliberately coarse: any source change re-runs
+every stage.  A reused stage does not repeat its side effects (PR
+comments, uploads, submissions).  The vulnerability and license gates
+(security-scan, cargo-deny) are never memoized: their verdict also
+depends on advisory databases that change without any input changing.
+A stage's outputs are the files it
+left under the output directory; with --parallel above 1 that can include
+files a concurrent stage wrote, which only makes reuse stricter.
+"""
+
+import hashlib
+import json
+import os
+import sys
+from pathlib import Path
+from typing import Awaitable, Callable
+
+import artifacts
+import run_history
+
+
+# Per-run bookkeeping kept under output/, never a stage's output.
+_UNTRACKED = ("runs", "failures", "locks")
+# Arguments that change how a run is scheduled or displayed, not what it builds.
+_IGNORED_ARGS = {"--memoize", "--queue", "--skip-superseded", "--no-lock", "--plain", "--stream"}
+# Stages that check sources against advisory databases fetched at run time.
+UNMEMOIZED = ("security-scan", "cargo-deny")
+
+_reused: list[Path] = []
+
+
+def enabled() -> bool:
+    """Return whether --memoize was given."""
+    return os.environ.get("REGICIDE_MEMOIZE") == "1"
+
+
+def key(stage: str) -> str:
+    """Return the memo key of stage in this run."""
+    inputs = {
+        "stage": stage,
+        "fingerprint": run_history.fingerprint(),
+        "argv": [arg for arg in sys.argv[1:] if arg not in _IGNORED_ARGS],
+    }
+    return hashlib.sha256(json.dumps(inputs, sort_keys=True).encode()).hexdigest()[:16]
+
+
+def snapshot() -> dict[Path, int]:
+    """Return {path: mtime} of the files under the output directory."""
+    files = {}
+    for path in artifacts.OUTPUT_DIR.rglob("*"):
+        relative = path.relative_to(artifacts.OUTPUT_DIR)
+        if relative.parts[0] not in _UNTRACKED and path.is_file():
+            files[path] = path.stat().st_mtime_ns
+    return files
+
+
+def changed(before: dict[Path, int]) -> list[Path]:
+    """Return the output files written since snapshot() returned before."""
+    return sorted(path for path, mtime in snapshot().items() if before.get(path) != mtime)
+
+
+def lookup(stage: str, stage_key: str) -> tuple[str, dict[str, str]] | None:
+    """Return (run, {path: sha256}) of the newest run that memoized stage under stage_key.
+
+    Runs whose recorded outputs have since been deleted or overwritten do
+    not count.
+    """
+    for summary in reversed(run_history.recent_summaries(0)):
+        memo = summary.get("memo", {}).get(stage)
+        if summary["run"] == run_history.run_id() or memo is None or memo["key"] != stage_key:
+            continue
+        outputs = memo["outputs"]
+        if all(Path(path).is_file() and run_history.sha256(Path(path)) == sha for path, sha in outputs.items()):
+            return summary["run"], outputs
+    return None
+
+
+def reuse(stage: str) -> list[Path] | None:
+    """Reuse stage's outputs from an earlier run if its key matches; return them, or None."""
+    if stage in UNMEMOIZED:
+        return None
+    stage_key = key(stage)
+    hit = lookup(stage, stage_key)
+    if hit is None:
+        return None
+    run, outputs = hit
+    print(f"Reusing {stage} from run {run} (inputs unchanged)")
+    run_history.record_stage(stage, "reused", 0)
+    run_history.record_memo(stage, stage_key, outputs)
+    paths = [Path(path) for path in outputs]
+    _reused.extend(paths)
+    return paths
+
+
+def reused() -> list[Path]:
+    """Return the output files this run reused from earlier runs."""
+    return list(_reused)
+
+
+def remember(stage: str, outputs: list[Path]) -> None:
+    """Record that stage passed in this run and wrote outputs."""
+    if stage in UNMEMOIZED:
+        return
+    run_history.record_memo(stage, key(stage), {str(path): run_history.sha256(path) for path in outputs})
+
+
+async def run(stage: str, job: Callable[[], Awaitable[None]]) -> None:
+    """Run job as stage unless an earlier run's outputs can be reused."""
+    if reuse(stage) is not None:
+        return
+    before = snapshot()
+    await job()
+    remember(stage, changed(before))
@@ -0,0 +1,93 @@
+"""Stage selection - run or skip pipeline stages by name (--stage, --skip).
+
+Every stage the pipeline runs has a name.  A Python stage is named after
+the flag that turns it on (--security-scan runs security-scan), and a
+declared stage after its stages.toml entry.  Two stages run unless turned
+off: cargo-check (--skip-cargo-check) and os-image, the Gentoo OS image
+build and everything after it (--checks-only).
+
+--stage NAME[,NAME...] runs only the named stages, each as if its flag
+were given, so cargo-check and os-image run only when named too.  --skip
+NAME[,NAME...] drops stages the other flags selected.  A stage whose flag
+needs a value, such as --smoke-test-image REF, can be skipped but not
+selected by name.
+"""
+
+import argparse
+
+
+BUILTIN_STAGES = {
+    "cargo-check": "cargo check of the workspace (runs unless --skip-cargo-check)",
+    "os-image": "the Gentoo OS image build, SquashFS, signing and VM tests (run unless --checks-only)",
+}
+# Python stages --stage can turn on: their flags take no value or an
+# optional one.  run_workspace_checks runs each as job_<name>, apart from
+# the rustfmt and ebuild-versions gates.
+FLAG_STAGES = (
+    "benchmarks", "binpkg-channel", "btrmind-simulation", "build-timings", "cargo-deny", "cargo-tests",
+    "cli-golden", "clippy", "config-migration", "coverage", "cross-build", "dependency-trees",
+    "duplicate-budget", "ebuild-versions", "feature-powerset", "generate-docs", "gpu-tests",
+    "installer-tui-tests", "locale-matrix", "manifest-check", "non-btrfs-tests", "overlay-deep-tests",
+    "overlay-openrc-tests", "overlay-tests", "pkgcheck", "public-api-diff", "publish", "readonly-root-tests",
+    "release-optimized", "rustfmt", "sbom", "security-scan", "soak", "static-binaries", "syscall-audit",
+)
+# Python stages whose flags need a value; --skip only.
+VALUE_STAGES = ("check-image-labels", "smoke-test-image")
+
+
+def names(values: list[str]) -> list[str]:
+    """Split repeated, comma-separated --stage or --skip values into stage names."""
+    return [name for value in values for name in value.split(",") if name]
+
+
+def all_stages(declared: dict[str, dict]) -> list[str]:
+    """Return the name of every stage, declared ones included."""
+    return sorted({*BUILTIN_STAGES, *FLAG_STAGES, *VALUE_STAGES, *declared})
+
+
+def describe(name: str, declared: dict[str, dict]) -> str:
+    """Return the --list-stages line for stage name."""
+    if name in declared:
+        needs = ", ".join(declared[name].get("needs", []))
+        return f"{name:<24} {declared[name].get('description', '')}" + (f" (needs {needs})" if needs else "")
+    if name in BUILTIN_STAGES:
+        return f"{name:<24} {BUILTIN_STAGES[name]}"
+    if name in VALUE_STAGES:
+        return f"{name:<24} --{name} (--skip only: the flag needs a value)"
+    return f"{name:<24} --{name}"
+
+
+def _dest(name: str) -> str:
+    return name.replace("-", "_")
+
+
+def apply(parser: argparse.ArgumentParser, args: argparse.Namespace, declared: dict[str, dict]) -> list[str]:
+    """Apply --stage and --skip to args; return the declared stages selected, before ordering.
+
+    A selected Python stage gets the value its flag alone would give it;
+    a skipped one goes back to its default.  Raises ValueError for an
+    unknown stage or one that --stage cannot select.
+    """
+    selected, skipped = names(args.stage), names(args.skip)
+    known = all_stages(declared)
+    for name in [*selected, *skipped]:
+        if name not in known:
+            raise ValueError(f"unknown stage {name}; see --list-stages")
+    for name in selected:
+        if name in VALUE_STAGES:
+            raise ValueError(f"--stage cannot select {name}; pass --{name} with its value instead")
+    if selected:
+        args.skip_cargo_check = "cargo-check" not in selected
+        args.checks_only = args.checks_only or "os-image" not in selected
+        for name in selected:
+            if name in FLAG_STAGES:
+                setattr(args, _dest(name), getattr(parser.parse_args([f"--{name}"]), _dest(name)))
+    for name in skipped:
+        if name == "cargo-check":
+            args.skip_cargo_check = True
+        elif name == "os-image":
+            args.checks_only = True
+        elif name not in declared:
+            setattr(args, _dest(name), parser.get_default(_dest(name)))
+    wanted = [*args.declared, *(name for name in selected if name in declared)]
+    return [name for name in dict.fromkeys(wanted) if name not in skipped]
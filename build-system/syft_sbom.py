@@ -0,0 +1,78 @@
+"""Syft SBOMs - CycloneDX and SPDX documents for the Rust binaries and the published image.
+
+The OS image's SPDX SBOM comes from the Portage database (stage7-sbom.sh);
+these cover what the Cargo workspace ships.  --sbom scans the
+release-optimized binaries together with Cargo.lock: a Rust binary built
+without cargo-auditable records no crate list that syft could read, so the
+crates are the workspace's locked dependencies, dev-dependencies included.
+With --publish, the pushed btrmind image is scanned by digest too, and
+unless --skip-sign is given its documents are attached to it as cosign
+attestations (signing.attest_image()).
+"""
+
+import dagger
+
+import artifacts
+import build_info
+import publish
+import signing
+import workspace_checks
+from failure_bundle import checked_exec, from_image
+
+
+SYFT_IMAGE = "anchore/syft:v1.14.0"
+OUTPUT_DIR = artifacts.OUTPUT_DIR / "sbom"
+# File suffix -> (syft output format, cosign attestation type).
+FORMATS = {
+    "cdx.json": ("cyclonedx-json", "cyclonedx"),
+    "spdx.json": ("spdx-json", "spdxjson"),
+}
+
+
+def _syft(client: dagger.Client) -> dagger.Container:
+    return from_image(client, SYFT_IMAGE).with_directory("/sbom", client.directory())
+
+
+def _outputs(name: str) -> list[str]:
+    return [
+        arg for suffix, (syft_format, _) in FORMATS.items() for arg in ("-o", f"{syft_format}=/sbom/{name}.{suffix}")
+    ]
+
+
+async def rust_binaries(client: dagger.Client) -> dagger.Directory:
+    """Return rust-binaries.<suffix> for each of FORMATS."""
+    path = workspace_checks.require_lockfile("sbom-rust-binaries").as_posix()
+    binaries = await workspace_checks.optimized_binaries(client)
+    lock = workspace_checks.workspace_source(client, paths=[path]).file(path)
+    scanned = await checked_exec(
+        _syft(client).with_directory("/scan/bin", binaries).with_file("/scan/Cargo.lock", lock),
+        [
+            "/syft", "scan", "dir:/scan",
+            "--source-name", "regicideos-rust-binaries",
+            "--source-version", build_info.git_sha(),
+            *_outputs("rust-binaries"),
+        ],
+        "sbom-rust-binaries",
+    )
+    return scanned.directory("/sbom")
+
+
+async def image(client: dagger.Client, ref: str, name: str) -> dagger.Directory:
+    """Return <name>.<suffix> for each of FORMATS, scanning the pushed image ref."""
+    user, token = publish.credentials()
+    scanner = (
+        _syft(client)
+        .with_env_variable("SYFT_REGISTRY_AUTH_AUTHORITY", publish.REGISTRY)
+        .with_env_variable("SYFT_REGISTRY_AUTH_USERNAME", user)
+        .with_secret_variable("SYFT_REGISTRY_AUTH_PASSWORD", client.set_secret("syft-registry-token", token))
+    )
+    scanned = await checked_exec(scanner, ["/syft", "scan", f"registry:{ref}", *_outputs(name)], f"sbom-{name}")
+    return scanned.directory("/sbom")
+
+
+async def attest(client: dagger.Client, ref: str, documents: dagger.Directory, name: str) -> None:
+    """Attach each of image()'s documents to ref as a cosign attestation."""
+    for suffix, (_, predicate_type) in FORMATS.items():
+        await signing.attest_image(
+            client, ref, documents.file(f"{name}.{suffix}"), predicate_type, publish.REGISTRY, *publish.credentials()
+        )
@@ -0,0 +1,134 @@
+"""Test impact - run only the tests a change can affect.
+
+--test-impact diffs the checkout against the pull request's base and maps
+each changed file to the workspace crate whose directory holds it.  The
+crates that depend on a changed crate, through normal, build or dev
+dependencies in the `cargo metadata` resolve graph, are impacted too, and
+--cargo-tests then builds and runs only the impacted crates' test targets.
+
+Anything every test shares (the workspace manifests, Cargo.lock, the
+nextest config, the Rust stage code) forces a full run, as does a run on
+the base branch itself or without a base to diff against: main always
+runs everything.  Changes outside the crates (docs, overlays, catalyst)
+impact no tests.
+"""
+
+import os
+import subprocess
+from pathlib import PurePosixPath
+
+import run_history
+import workspace_checks
+
+
+# Changes to these run every test: cargo_tests() mounts them, or they define its container.
+FULL_RUN_PATHS = [*workspace_checks.CARGO_PATHS, ".config/nextest.toml", "build-system/workspace_checks.py"]
+
+
+def base_ref(requested: str) -> str | None:
+    """Return the ref to diff against, or None when this run should test everything.
+
+    "auto" is the pull request's base branch in GitHub Actions
+    (GITHUB_BASE_REF), and origin/main elsewhere, except on main itself.
+    """
+    if requested != "auto":
+        return requested
+    if os.environ.get("GITHUB_BASE_REF"):
+        return f"origin/{os.environ['GITHUB_BASE_REF']}"
+    if os.environ.get("GITHUB_ACTIONS") == "true" or _git("rev-parse", "--abbrev-ref", "HEAD") == "main":
+        return None
+    return "origin/main"
+
+
+def _git(*args: str) -> str:
+    return subprocess.run(["git", *args], check=True, capture_output=True, text=True).stdout.strip()
+
+
+def changed_files(base: str) -> list[str]:
+    """Return the files changed since base's merge base with HEAD, uncommitted changes included."""
+    merge_base = _git("merge-base", base, "HEAD")
+    changed = _git("diff", "--name-only", merge_base).splitlines()
+    untracked = _git("ls-files", "--others", "--exclude-standard").splitlines()
+    return sorted({*changed, *untracked})
+
+
+def workspace_crates(metadata: dict) -> dict[str, dict]:
+    """Return {package id: package} for the workspace members in metadata."""
+    members = set(metadata["workspace_members"])
+    return {package["id"]: package for package in metadata["packages"] if package["id"] in members}
+
+
+def _crate_dir(metadata: dict, package: dict) -> str:
+    root = PurePosixPath(metadata["workspace_root"])
+    return PurePosixPath(package["manifest_path"]).parent.relative_to(root).as_posix()
+
+
+def impacted(metadata: dict, changed: list[str]) -> tuple[list[str], dict[str, list[str]], str | None]:
+    """Return (impacted crates, {changed crate: its changed files}, reason for a full run or None).
+
+    On a full run every workspace crate is impacted.
+    """
+    crates = workspace_crates(metadata)
+    directories = {package["id"]: _crate_dir(metadata, package) for package in crates.values()}
+    names = {package_id: package["name"] for package_id, package in crates.items()}
+    shared = [path for path in changed if path in FULL_RUN_PATHS]
+    if shared:
+        return sorted(names.values()), {}, f"{', '.join(shared)} changed"
+    direct: dict[str, list[str]] = {}
+    for path in changed:
+        owners = [package_id for package_id, directory in directories.items() if path.startswith(f"{directory}/")]
+        if owners:
+            # The innermost crate owns a file in a nested crate's directory.
+            owner = max(owners, key=lambda package_id: len(directories[package_id]))
+            direct.setdefault(names[owner], []).append(path)
+    dependents: dict[str, set[str]] = {package_id: set() for package_id in crates}
+    for node in metadata["resolve"]["nodes"]:
+        if node["id"] not in crates:
+            continue
+        for dependency in node["deps"]:
+            if dependency["pkg"] in crates:
+                dependents[dependency["pkg"]].add(node["id"])
+    pending = [package_id for package_id, name in names.items() if name in direct]
+    reached = set(pending)
+    while pending:
+        for dependent in dependents[pending.pop()] - reached:
+            reached.add(dependent)
+            pending.append(dependent)
+    return sorted(names[package_id] for package_id in reached), direct, None
+
+
+def test_targets(metadata: dict, crates: list[str]) -> list[str]:
+    """Return "<crate> <kind> <target>" for the test targets of crates."""
+    return [
+        f"{package['name']} {'/'.join(target['kind'])} {target['name']}"
+        for package in workspace_crates(metadata).values()
+        if package["name"] in crates
+        for target in package["targets"]
+        if target.get("test", True) and not {"custom-build", "bench", "example"} & set(target["kind"])
+    ]
+
+
+def plan(metadata: dict, requested: str) -> tuple[list[str], str]:
+    """Return (crates whose tests to run, plain-text report) for --test-impact requested."""
+    base = base_ref(requested)
+    every = sorted(package["name"] for package in workspace_crates(metadata).values())
+    if base is None:
+        crates, lines = every, ["Full run: on the base branch, or no base to diff against."]
+    else:
+        try:
+            changed = changed_files(base)
+        except subprocess.CalledProcessError as exc:
+            # A shallow clone, or a base that was never fetched.
+            changed, full = [], f"cannot diff against it ({exc.stderr.strip() or exc})"
+            crates, direct = every, {}
+        else:
+            crates, direct, full = impacted(metadata, changed)
+        if full is not None:
+            lines = [f"Full run against {base}: {full}."]
+        else:
+            lines = [f"Compared with {base}: {len(changed)} files changed, {len(crates)} of {len(every)} crates impacted."]
+            for crate, files in sorted(direct.items()):
+                lines += ["", f"{crate} changed:", *(f"  {path}" for path in files)]
+    run_history.record_metric("test-impact-crates", len(crates))
+    lines += ["", "Test targets:", *(f"  {target}" for target in test_targets(metadata, crates) or ["none"])]
+    return crates, "\n".join(lines) + "\n"
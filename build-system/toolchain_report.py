@@ -0,0 +1,132 @@
+"""Toolchain report - the exact tool versions a run used, for rebuilding it later.
+
+Every run writes runs/<run>/toolchain-report.json, and a run that produces
+release artifacts also writes build-system/catalyst/output/
+toolchain-report.json next to build-info.json, to be attached to the
+release (--release-tag attaches it).  It lists the Dagger engine, CLI
+and SDK, Python, the Portage snapshot the OS image was synced to, and
+rustc, cargo, trivy and hadolint as reported by their images, and maps
+every image the run pulled to the digest it resolved to.  Only tools
+whose image the run pulled are listed, so a run of the overlay tests
+reports no Rust toolchain.  A tool the run could not query is "unknown";
+the Portage snapshot is missing unless the run built the OS image.
+"""
+
+import asyncio
+import contextlib
+import json
+from collections.abc import AsyncIterator
+from datetime import datetime, timezone
+from pathlib import Path
+
+import dagger
+
+import build_info
+import failure_bundle
+import fingerprint
+import run_history
+import security_scan
+import workspace_checks
+from failure_bundle import from_image, from_image_with_fallback
+
+
+RELEASE_PATH = Path("build-system/catalyst/output/toolchain-report.json")
+
+_tools: dict[str, str] = {}
+_images: dict[str, str] = {}
+
+
+def record(tool: str, version: str) -> None:
+    """Record the version of a tool this run used."""
+    _tools[tool] = version.strip()
+
+
+def tools() -> dict[str, str]:
+    """Return {tool: version} for the tools recorded so far, sorted by tool."""
+    return dict(sorted(_tools.items()))
+
+
+def probed() -> bool:
+    """Return whether probe() has run."""
+    return bool(_tools)
+
+
+async def _version(client: dagger.Client, image: str, *args: str, fallback: bool = False) -> str:
+    try:
+        container = await from_image_with_fallback(client, image) if fallback else from_image(client, image)
+        return (await container.with_exec(list(args)).stdout()).splitlines()[0]
+    except (dagger.DaggerError, IndexError):
+        return "unknown"
+
+
+def _tool_images() -> dict[str, tuple[str, list[str]]]:
+    """Return {tool: (image, version command)} for the tools probe() can query."""
+    rust = workspace_checks.rust_image()
+    return {
+        "rustc": (rust, ["rustc", "--version"]),
+        "cargo": (rust, ["cargo", "--version"]),
+        "trivy": (security_scan.TRIVY_IMAGE, ["trivy", "--version"]),
+        "hadolint": (security_scan.HADOLINT_IMAGE, ["hadolint", "--version"]),
+    }
+
+
+async def _engine_version(client: dagger.Client) -> str:
+    try:
+        return await client.version()
+    except dagger.DaggerError:
+        return "unknown"
+
+
+async def probe(client: dagger.Client) -> None:
+    """Record the versions of the tools in the images this run has pulled, and what those images resolved to.
+
+    Tools already recorded are not queried again.
+    """
+    pulled = set(failure_bundle.pulled_images())
+    probes = {
+        tool: _version(client, image, *command, fallback=image != workspace_checks.rust_image())
+        for tool, (image, command) in _tool_images().items()
+        if image in pulled and tool not in _tools
+    }
+    if "dagger-engine" not in _tools:
+        probes["dagger-engine"] = _engine_version(client)
+    for tool, version in zip(probes, await asyncio.gather(*probes.values())):
+        record(tool, version)
+    for tool, version in fingerprint.tools().items():
+        record(tool, version)
+    try:
+        _images.update(await failure_bundle.resolved_images())
+    except dagger.DaggerError:
+        pass
+
+
+@contextlib.asynccontextmanager
+async def probing(client: dagger.Client) -> AsyncIterator[None]:
+    """Probe the toolchain when the block ends, passed or failed, unless it was cancelled."""
+    try:
+        yield
+    except asyncio.CancelledError:
+        raise
+    except BaseException:
+        await probe(client)
+        raise
+    await probe(client)
+
+
+def write(path: Path) -> Path:
+    """Write the report to path and return it."""
+    path.parent.mkdir(parents=True, exist_ok=True)
+    report = {
+        "run": run_history.run_id(),
+        "commit": build_info.git_sha(),
+        "generated": datetime.now(timezone.utc).strftime("%Y-%m-%dT%H:%M:%SZ"),
+        "tools": tools(),
+        "images": dict(sorted(_images.items())),
+    }
+    path.write_text(json.dumps(report, indent=2) + "\n", newline="\n")
+    return path
+
+
+def write_run() -> Path:
+    """Write runs/<run>/toolchain-report.json and return its path."""
+    return write(run_history.RUNS_DIR / run_history.run_id() / "toolchain-report.json")
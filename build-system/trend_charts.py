@@ -0,0 +1,121 @@
+"""Trend charts - render run history as SVG line charts.
+
+write() draws one chart per series group (stage durations, coverage,
+other metrics, artifact sizes) from the run summaries, saves each as
+reports/trends-<group>.svg and embeds them all in reports/trends.html.
+The SVG is written by hand so the charts need no plotting library and
+open in any browser or in a GitHub Markdown preview.  Runs are evenly
+spaced along the x axis, oldest first; a run without a value for a
+series leaves a gap in its line.
+"""
+
+from html import escape
+from pathlib import Path
+
+import run_history
+
+WIDTH = 720
+HEIGHT = 280
+MARGIN = 48
+MAX_SERIES = 8
+COLORS = ["#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"]
+
+
+def series(summaries: list[dict]) -> dict[str, tuple[str, dict[str, list[float | None]]]]:
+    """Return {group: (unit, {name: values})} with one value per summary."""
+
+    def stage_seconds(summary: dict, stage: str) -> float | None:
+        return next((st["seconds"] for st in summary["stages"] if st["stage"] == stage), None)
+
+    def slowest(values: dict[str, list[float | None]]) -> dict[str, list[float | None]]:
+        present = {name: [v for v in vals if v is not None] for name, vals in values.items()}
+        names = sorted(present, key=lambda name: -sum(present[name]) / max(len(present[name]), 1))
+        return {name: values[name] for name in names[:MAX_SERIES]}
+
+    stages = list(dict.fromkeys(stage["stage"] for s in summaries for stage in s["stages"]))
+    metrics = sorted({name for s in summaries for name in s.get("metrics", {})})
+    artifacts = sorted({name for s in summaries for name in s["artifacts"]})
+    durations = {"total": [s["seconds"] for s in summaries]}
+    durations |= slowest({stage: [stage_seconds(s, stage) for s in summaries] for stage in stages})
+    groups = {"durations": ("seconds", durations)}
+    coverage = [name for name in metrics if name.startswith("coverage")]
+    if coverage:
+        groups["coverage"] = ("percent", {name: [s.get("metrics", {}).get(name) for s in summaries]
+                                          for name in coverage})
+    other = [name for name in metrics if name not in coverage]
+    if other:
+        groups["metrics"] = ("value", slowest({name: [s.get("metrics", {}).get(name) for s in summaries]
+                                               for name in other}))
+    if artifacts:
+        sizes = {name: [(s["artifacts"].get(name) or {}).get("size") for s in summaries] for name in artifacts}
+        groups["artifacts"] = ("MiB", slowest({name: [None if v is None else v / 2**20 for v in vals]
+                                               for name, vals in sizes.items()}))
+    return groups
+
+
+def chart(title: str, unit: str, runs: list[str], lines: dict[str, list[float | None]]) -> str:
+    """Return an SVG line chart of lines over runs."""
+    values = [v for vals in lines.values() for v in vals if v is not None]
+    top = max(values, default=0) or 1
+    plot_width, plot_height = WIDTH - 2 * MARGIN, HEIGHT - 2 * MARGIN
+    step = plot_width / max(len(runs) - 1, 1)
+
+    def point(index: int, value: float) -> str:
+        return f"{MARGIN + index * step:.1f},{MARGIN + plot_height * (1 - value / top):.1f}"
+
+    parts = [
+        f'<svg xmlns="http://www.w3.org/2000/svg" width="{WIDTH}" height="{HEIGHT + 16 * len(lines)}"'
+        f' font-family="sans-serif" font-size="11">',
+        f'<text x="{MARGIN}" y="20" font-size="14">{escape(title)} ({escape(unit)})</text>',
+        f'<line x1="{MARGIN}" y1="{HEIGHT - MARGIN}" x2="{WIDTH - MARGIN}" y2="{HEIGHT - MARGIN}" stroke="#888"/>',
+        f'<line x1="{MARGIN}" y1="{MARGIN}" x2="{MARGIN}" y2="{HEIGHT - MARGIN}" stroke="#888"/>',
+        f'<text x="{MARGIN - 4}" y="{MARGIN + 4}" text-anchor="end">{top:g}</text>',
+        f'<text x="{MARGIN - 4}" y="{HEIGHT - MARGIN + 4}" text-anchor="end">0</text>',
+        f'<text x="{MARGIN}" y="{HEIGHT - MARGIN + 16}">{escape(runs[0])}</text>',
+        f'<text x="{WIDTH - MARGIN}" y="{HEIGHT - MARGIN + 16}" text-anchor="end">{escape(runs[-1])}</text>',
+    ]
+    for index, (name, vals) in enumerate(lines.items()):
+        color = COLORS[index % len(COLORS)]
+        segments = [[]]
+        for position, value in enumerate(vals):
+            if value is None:
+                segments.append([])
+            else:
+                segments[-1].append(point(position, value))
+        for segment in segments:
+            if not segment:
+                continue
+            if len(segment) == 1:
+                x, y = segment[0].split(",")
+                parts.append(f'<circle cx="{x}" cy="{y}" r="2.5" fill="{color}"/>')
+            else:
+                parts.append(
+                    f'<polyline points="{" ".join(segment)}" fill="none" stroke="{color}" stroke-width="1.5"/>'
+                )
+        legend_y = HEIGHT + 16 * index
+        parts.append(f'<rect x="{MARGIN}" y="{legend_y - 9}" width="10" height="10" fill="{color}"/>')
+        parts.append(f'<text x="{MARGIN + 16}" y="{legend_y}">{escape(name)}</text>')
+    parts.append("</svg>")
+    return "\n".join(parts)
+
+
+def write(limit: int, reports_dir: Path) -> list[Path]:
+    """Write the trend charts of the last limit runs; return the files written."""
+    summaries = run_history.recent_summaries(limit)
+    if not summaries:
+        return []
+    reports_dir.mkdir(parents=True, exist_ok=True)
+    runs = [s["run"] for s in summaries]
+    written, figures = [], []
+    for group, (unit, lines) in series(summaries).items():
+        path = reports_dir / f"trends-{group}.svg"
+        svg = chart(group.capitalize(), unit, runs, lines)
+        path.write_text(svg + "\n")
+        written.append(path)
+        figures.append(f"<figure>{svg}</figure>")
+    page = reports_dir / "trends.html"
+    page.write_text(
+        f"<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>Pipeline trends</title></head>\n"
+        f"<body><h1>Pipeline trends (last {len(summaries)} runs)</h1>\n" + "\n".join(figures) + "\n</body></html>\n"
+    )
+    return [page, *written]
@@ -0,0 +1,1166 @@
+"""RegicideOS workspace checks - Dagger stages for the Rust Cargo workspace.
+
+These stages run against the Cargo workspace (installer, ai-agents/btrmind)
+in a plain Rust container.  They are independent of the Gentoo stage4 build
+in dagger_pipeline.py, which wires them up behind their own flags and writes
+their reports under build-system/catalyst/output/reports/.
+"""
+
+import asyncio
+import contextlib
+import contextvars
+import functools
+import json
+import os
+import re
+import shlex
+import shutil
+import subprocess
+import tomllib
+from pathlib import Path
+
+import dagger
+
+import build_info
+import cache_keys
+import source_layout
+from failure_bundle import checked_exec, from_image
+
+
+RUST_IMAGE = "rust:1.87-bookworm"
+RUSTFMT_IMAGE = "rust:1.87-slim-bookworm"
+REPORTS_DIR = Path("build-system/catalyst/output/reports")
+DUPLICATE_ALLOWLIST = Path(__file__).parent / "duplicate-crates.toml"
+WORKSPACE = "/src"
+# Rust target of the build containers, and the targets optimized_binaries()
+# can cross-compile to: target -> (Debian cross gcc package, linker).
+HOST_TARGET = "x86_64-unknown-linux-gnu"
+CROSS_TARGETS = {
+    "aarch64-unknown-linux-gnu": ("gcc-aarch64-linux-gnu", "aarch64-linux-gnu-gcc"),
+    "riscv64gc-unknown-linux-gnu": ("gcc-riscv64-linux-gnu", "riscv64-linux-gnu-gcc"),
+}
+# Fully static builds for rescue environments, linked against musl.
+STATIC_TARGET = "x86_64-unknown-linux-musl"
+# Workspace members built as shipped components (see the root Cargo.toml).
+WORKSPACE_PACKAGES = ["installer", "btrmind"]
+# Workspace crate (a layout.toml component) -> regicide-rust overlay package.
+CRATE_EBUILDS = {
+    "installer": "regicide-tools/regicide-installer",
+    "btrmind": "regicide-tools/btrmind",
+}
+# Workspace library crates (layout.toml components) the member crates depend on.
+WORKSPACE_LIBRARIES = ["cli"]
+LIVE_VERSION = "9999"
+SNAPSHOT_DIR = Path("tests/installer/snapshots")
+CLI_GOLDEN_DIR = Path("tests/cli/golden")
+BTRMIND_TRACES = "ai-agents/btrmind/fixtures/traces"
+SOAK_REPORT = "/tmp/soak-report"
+NEXTEST_VERSION = "0.9.72"
+# Written by the ci profile in .config/nextest.toml, relative to WORKSPACE.
+JUNIT_REPORT = "target/nextest/ci/junit.xml"
+LLVM_COV_VERSION = "0.6.11"
+COVERAGE_REPORT = "/tmp/lcov.info"
+CARGO_DENY_VERSION = "0.14.24"
+DENY_REPORT = "/tmp/cargo-deny.json"
+# cargo-deny diagnostic code -> deny.toml check; other codes are license errors.
+DENY_CHECKS = {
+    "banned": "ban",
+    "not-allowed": "ban",
+    "wildcard": "ban",
+    "build-script-not-allowed": "ban",
+    "duplicate": "duplicate",
+    "workspace-duplicate": "duplicate",
+}
+# Never uploaded from the host: build outputs and disk images.
+SOURCE_EXCLUDE = [
+    "build-system/catalyst/tmp/",
+    "build-system/catalyst/output/",
+    "target/",
+    "*.img",
+    "*.tar.xz",
+    "*.qcow2",
+]
+# What every Cargo stage mounts besides the member crates: the workspace
+# manifests.  Stages add the scripts and test data they use, so changes to
+# docs, the Gentoo overlays or catalyst specs keep their cached results.
+CARGO_PATHS = ["Cargo.toml", "Cargo.lock"]
+# The committed workspace lockfile, relative to the source root.
+CARGO_LOCK = Path("Cargo.lock")
+
+
+class MissingLockfile(Exception):
+    """A stage that reads the committed Cargo.lock ran in a tree without one."""
+
+    def __init__(self, stage: str):
+        self.stage = stage
+        super().__init__(
+            f"{stage} needs the workspace {CARGO_LOCK}, which is not committed;"
+            " run `cargo generate-lockfile` and commit it"
+        )
+
+
+def require_lockfile(stage: str) -> Path:
+    """Return CARGO_LOCK, raising MissingLockfile for stage when the source root has none."""
+    if not CARGO_LOCK.is_file():
+        raise MissingLockfile(stage)
+    return CARGO_LOCK
+
+
+def rust_image() -> str:
+    """Return the Rust container image used for workspace stages."""
+    return os.environ.get("REGICIDE_RUST_IMAGE", RUST_IMAGE)
+
+
+# Set by module_source() when running as a Dagger module, which cannot read the host.
+_module_source: contextvars.ContextVar[dagger.Directory | None] = contextvars.ContextVar("module_source", default=None)
+
+
+@contextlib.contextmanager
+def module_source(source: dagger.Directory):
+    """Within the block, make workspace_source() return source (with .git) instead of reading the host."""
+    token = _module_source.set(source)
+    try:
+        yield
+    finally:
+        _module_source.reset(token)
+
+
+def workspace_source(
+    client: dagger.Client, with_git: bool = False, paths: list[str] | None = None
+) -> dagger.Directory:
+    """Load the Cargo workspace from the host.
+
+    .git is excluded unless a stage needs history (e.g. diffing against the
+    base branch), so unrelated commits do not bust cache keys.  So are
+    SOURCE_EXCLUDE, whatever .gitignore ignores (unless
+    REGICIDE_SOURCE_GITIGNORE=0) and the comma-separated globs in
+    REGICIDE_SOURCE_EXCLUDE, which also keeps them out of the upload to the
+    engine.  REGICIDE_SOURCE_INCLUDE or paths limits the load to those
+    globs or repository paths; stages with history always get the whole
+    tree, or git would see the rest as deleted.
+    """
+    if with_git:
+        include = []
+    else:
+        include = paths if paths is not None else _env_globs("REGICIDE_SOURCE_INCLUDE")
+    given = _module_source.get()
+    if given is not None:
+        source = given if with_git else given.without_directory(".git")
+        return client.directory().with_directory(".", source, include=include) if include else source
+    exclude = [*SOURCE_EXCLUDE, *_env_globs("REGICIDE_SOURCE_EXCLUDE")]
+    if os.environ.get("REGICIDE_SOURCE_GITIGNORE") != "0":
+        exclude += _gitignored()
+    if not with_git:
+        exclude.insert(0, ".git/")
+    return client.host().directory(".", exclude=exclude, include=include)
+
+
+def _env_globs(name: str) -> list[str]:
+    """Return the comma-separated globs in environment variable name."""
+    return [glob.strip() for glob in os.environ.get(name, "").split(",") if glob.strip()]
+
+
+@functools.cache
+def _gitignored() -> list[str]:
+    """Return the paths .gitignore excludes, directories collapsed, or [] outside git."""
+    try:
+        listed = subprocess.run(
+            ["git", "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory"],
+            check=True, capture_output=True, text=True,
+        ).stdout
+    except (OSError, subprocess.CalledProcessError):
+        return []
+    return [path for path in listed.split("\0") if path]
+
+
+def cargo_source(client: dagger.Client, *extra: str, with_git: bool = False) -> dagger.Directory:
+    """Load CARGO_PATHS, the member crates and the extra repository paths a Cargo stage uses."""
+    crates = [source_layout.component(crate).as_posix() for crate in [*CRATE_EBUILDS, *WORKSPACE_LIBRARIES]]
+    return workspace_source(client, with_git=with_git, paths=[*CARGO_PATHS, *crates, *extra])
+
+
+def dev_mode() -> bool:
+    """Return whether this is a local --dev run (REGICIDE_DEV=1)."""
+    return os.environ.get("REGICIDE_DEV") == "1"
+
+
+def rust_container(client: dagger.Client, src: dagger.Directory) -> dagger.Container:
+    """Return a Rust container with the workspace mounted at /src.
+
+    Every stage resolves dependencies from the committed Cargo.lock and
+    passes --locked, so a lockfile that is missing or out of date with
+    Cargo.toml fails the stage instead of being resolved afresh.  The cargo
+    registry lives in a cache volume; workspace stages are cheap to re-run,
+    so losing exec caching on them is an acceptable trade for fast fetches.
+    """
+    container = (
+        from_image(client, rust_image())
+        .with_mounted_cache(
+            "/usr/local/cargo/registry", cache_keys.volume(client, "regicide-cargo-registry", shared=True)
+        )
+        .with_directory(WORKSPACE, src)
+        .with_workdir(WORKSPACE)
+    )
+    if dev_mode():
+        # Keep target/ between runs so debug builds are incremental.  Stages
+        # that export files out of target/ are release-only and rejected
+        # in dev mode.
+        container = (
+            container
+            .with_mounted_cache(f"{WORKSPACE}/target", cache_keys.volume(client, "regicide-cargo-target-dev"))
+            .with_env_variable("CARGO_INCREMENTAL", "1")
+        )
+    return container
+
+
+async def with_apt_packages(container: dagger.Container, stage: str, *packages: str) -> dagger.Container:
+    """Install Debian packages into a workspace container, as step <stage>-packages."""
+    return await checked_exec(
+        container,
+        ["sh", "-c", f"apt-get update -qq && apt-get install -y -qq {shlex.join(packages)}"],
+        f"{stage}-packages",
+    )
+
+
+async def with_rust_target(container: dagger.Container, stage: str, target: str) -> dagger.Container:
+    """Add the standard library and cross linker for target to a Rust container."""
+    if target == HOST_TARGET:
+        return container
+    package, linker = CROSS_TARGETS[target]
+    added = await checked_exec(
+        await with_apt_packages(container, stage, package),
+        ["rustup", "target", "add", target],
+        f"{stage}-target",
+    )
+    return added.with_env_variable(f"CARGO_TARGET_{target.upper().replace('-', '_')}_LINKER", linker)
+
+
+def _library_crates_script() -> str:
+    """Return a shell snippet listing workspace packages that have a lib target."""
+    return (
+        "cargo metadata --no-deps --format-version 1"
+        " | jq -r '.packages[] | select(any(.targets[]; .kind | index(\"lib\"))) | .name'"
+        " | sort -u"
+    )
+
+
+async def public_api_diff(
+    client: dagger.Client,
+    base_ref: str = "origin/main",
+) -> dagger.File:
+    """Diff the public API of every library crate between base_ref and HEAD.
+
+    Uses cargo-public-api (which needs a nightly toolchain for rustdoc JSON)
+    and returns a Markdown report with one section per library crate.
+    """
+    src = workspace_source(client, with_git=True)
+    checker = await with_apt_packages(rust_container(client, src), "public-api-diff", "jq")
+    checker = await checked_exec(
+        checker, ["rustup", "toolchain", "install", "nightly", "--profile", "minimal"], "public-api-diff-nightly"
+    )
+    checker = await checked_exec(
+        checker, ["cargo", "install", "--locked", "cargo-public-api"], "public-api-diff-install"
+    )
+    checker = await checked_exec(
+        checker,
+        [
+            "sh", "-c",
+            "set -eu; "
+            "out=/tmp/public-api-diff.md; "
+            "echo '## Public API changes' > \"$out\"; "
+            f"echo 'Compared `{base_ref}` to `HEAD`.' >> \"$out\"; "
+            f"for crate in $({_library_crates_script()}); do "
+            "  echo >> \"$out\"; "
+            "  echo \"### $crate\" >> \"$out\"; "
+            "  echo '```diff' >> \"$out\"; "
+            f"  cargo public-api -p \"$crate\" diff --force '{base_ref}..HEAD' >> \"$out\" 2>&1"
+            "    || echo \"cargo public-api failed for $crate\" >> \"$out\"; "
+            "  echo '```' >> \"$out\"; "
+            "done",
+        ],
+        "public-api-diff",
+    )
+    return checker.file("/tmp/public-api-diff.md")
+
+
+def post_pr_comment(body_path: Path) -> None:
+    """Post body_path as a comment on the pull request in REGICIDE_PR_NUMBER.
+
+    Does nothing outside pull-request runs.  Requires the GitHub CLI with a
+    token in GH_TOKEN/GITHUB_TOKEN.
+    """
+    pr_number = os.environ.get("REGICIDE_PR_NUMBER")
+    if not pr_number:
+        print(f"REGICIDE_PR_NUMBER not set; not commenting ({body_path})")
+        return
+    subprocess.run(
+        ["gh", "pr", "comment", pr_number, "--body-file", str(body_path)],
+        check=True,
+    )
+
+
+async def dependency_trees(client: dagger.Client) -> dagger.Directory:
+    """Export `cargo tree --locked` for the workspace and each feature variant.
+
+    Produces workspace.txt (default features), all-features.txt,
+    no-default-features.txt, plus <package>--<feature>.txt for every feature
+    a workspace package declares, so dependency changes can be diffed across
+    releases.  Raises MissingLockfile when the workspace has no Cargo.lock.
+    """
+    require_lockfile("dependency-trees")
+    tree = "cargo tree --locked --workspace --edges normal,build --prefix depth"
+    exporter = await checked_exec(
+        await with_apt_packages(rust_container(client, cargo_source(client)), "dependency-trees", "jq"),
+        [
+            "sh", "-c",
+            "set -eu; "
+            "out=/tmp/dependency-trees; mkdir -p \"$out\"; "
+            f"{tree} > \"$out/workspace.txt\"; "
+            f"{tree} --all-features > \"$out/all-features.txt\"; "
+            f"{tree} --no-default-features > \"$out/no-default-features.txt\"; "
+            "cargo metadata --no-deps --format-version 1"
+            " | jq -r '.packages[] | .name as $p | .features | keys[] | select(. != \"default\") | \"\\($p) \\(.)\"'"
+            " | while read -r pkg feature; do "
+            "  cargo tree --locked -p \"$pkg\" --edges normal,build --prefix depth"
+            "    --features \"$feature\" > \"$out/$pkg--$feature.txt\"; "
+            "done",
+        ],
+        "dependency-trees",
+    )
+    return exporter.directory("/tmp/dependency-trees")
+
+
+async def dependency_graph(client: dagger.Client) -> dict:
+    """Return `cargo metadata` for the workspace with the resolved dependency graph."""
+    ran = await checked_exec(
+        rust_container(client, cargo_source(client)),
+        ["cargo", "metadata", "--locked", "--format-version", "1"],
+        "dependency-graph",
+    )
+    return json.loads(await ran.stdout())
+
+
+async def duplicate_crates(client: dagger.Client, target: str = "x86_64-unknown-linux-gnu") -> dict[str, list[str]]:
+    """Return {crate: [versions]} for crates resolved more than once for target."""
+    ran = await checked_exec(
+        rust_container(client, cargo_source(client)),
+        ["cargo", "metadata", "--locked", "--format-version", "1", "--filter-platform", target],
+        f"duplicate-crates-{target}",
+    )
+    versions: dict[str, set[str]] = {}
+    for package in json.loads(await ran.stdout())["packages"]:
+        versions.setdefault(package["name"], set()).add(package["version"])
+    return {name: sorted(v) for name, v in sorted(versions.items()) if len(v) > 1}
+
+
+def duplicate_budget_violations(
+    duplicates: dict[str, list[str]],
+    allowlist_path: Path = DUPLICATE_ALLOWLIST,
+) -> list[str]:
+    """Return one message per duplicated crate that exceeds its allowlist budget."""
+    with allowlist_path.open("rb") as f:
+        allowed = tomllib.load(f).get("allowed", {})
+    violations = []
+    for name, found in duplicates.items():
+        budget = allowed.get(name, 1)
+        if len(found) > budget:
+            violations.append(f"{name}: {len(found)} versions ({', '.join(found)}), budget {budget}")
+    return violations
+
+
+async def cargo_check(client: dagger.Client) -> str:
+    """Type-check every crate and target in the workspace.
+
+    Runs first, before any release or OS build, so a type error fails the
+    pipeline in a minute or two instead of twenty.  Returns cargo's output.
+    """
+    ran = await checked_exec(
+        rust_container(client, cargo_source(client)),
+        ["cargo", "check", "--locked", "--workspace", "--all-targets"],
+        "cargo-check",
+    )
+    return await ran.stderr()
+
+
+async def rustfmt(client: dagger.Client) -> None:
+    """Check that every workspace crate is formatted with rustfmt.
+
+    Only the crate sources and any rustfmt.toml are mounted into the slim
+    Rust image, with no registry or lockfile, so the check fails in
+    seconds, ahead of cargo check and the build.  rustfmt's diff goes to
+    stderr, where the failure bundle records it.
+    """
+    formatter = await checked_exec(
+        from_image(client, RUSTFMT_IMAGE)
+        .with_directory(WORKSPACE, cargo_source(client, "rustfmt.toml", ".rustfmt.toml"))
+        .with_workdir(WORKSPACE),
+        ["rustup", "component", "add", "rustfmt"],
+        "rustfmt-install",
+    )
+    await checked_exec(formatter, ["sh", "-c", "cargo fmt --all --check >&2"], "rustfmt")
+
+
+async def clippy(client: dagger.Client, deny_warnings: bool = True) -> str:
+    """Lint installer and btrmind, tests and examples included, with cargo clippy.
+
+    target/ lives in its own cache volume, so crates that did not change
+    are not re-linted on the next run.  With deny_warnings, any warning
+    fails the stage; without it they are only reported.  Returns clippy's
+    output.
+    """
+    linter = await checked_exec(
+        rust_container(client, cargo_source(client))
+        .with_mounted_cache(f"{WORKSPACE}/target", cache_keys.volume(client, "regicide-clippy-target")),
+        ["rustup", "component", "add", "clippy"],
+        "clippy-install",
+    )
+    args = ["cargo", "clippy", "--locked", "-p", "installer", "-p", "btrmind", "-p", "regicide-cli", "--all-targets"]
+    if deny_warnings:
+        args += ["--", "-D", "warnings"]
+    ran = await checked_exec(linter, args, "clippy")
+    return await ran.stderr()
+
+
+async def build_timings(client: dagger.Client, package: str) -> dagger.File:
+    """Build package in release mode with --timings and return the HTML report."""
+    builder = await checked_exec(
+        rust_container(client, cargo_source(client)),
+        ["cargo", "build", "--locked", "--release", "-p", package, "--timings"],
+        f"build-timings-{package}",
+    )
+    return builder.file(f"{WORKSPACE}/target/cargo-timings/cargo-timing.html")
+
+
+def timings_units(html: str) -> list[dict]:
+    """Extract per-unit timing data from a cargo --timings HTML report.
+
+    Stable cargo only emits HTML; the unit table is embedded in it as the
+    UNIT_DATA JavaScript array, which is plain JSON.
+    """
+    match = re.search(r"const UNIT_DATA = (\[.*?\]);\n", html, re.DOTALL)
+    if match is None:
+        raise ValueError("UNIT_DATA not found in cargo timings report")
+    return json.loads(match.group(1))
+
+
+def slowest_units(units: list[dict], limit: int = 10) -> list[dict]:
+    """Return the limit slowest units, slowest first."""
+    return sorted(units, key=lambda unit: unit["duration"], reverse=True)[:limit]
+
+
+async def optimized_binaries(
+    client: dagger.Client, pgo: bool = False, target: str = HOST_TARGET
+) -> dagger.Directory:
+    """Build the shipped binaries with the release-optimized (thin-LTO) profile.
+
+    With pgo, btrmind is first built instrumented, trained with
+    scripts/pgo-workload.sh, and rebuilt against the merged profile; the
+    training run needs target to be HOST_TARGET.  An explicit --target
+    keeps RUSTFLAGS off build scripts and proc macros.
+    """
+    out_dir = f"{WORKSPACE}/target/{target}/release-optimized"
+    build = ["cargo", "build", "--locked", "--profile", "release-optimized", "--target", target]
+    packages = [arg for package in WORKSPACE_PACKAGES for arg in ("-p", package)]
+
+    builder = await with_rust_target(
+        rust_container(client, cargo_source(client, "build-system/scripts/pgo-workload.sh")),
+        "release-optimized",
+        target,
+    )
+    if pgo:
+        profdata = (
+            f"$(rustc --print sysroot)/lib/rustlib/{target}/bin/llvm-profdata"
+        )
+        builder = await checked_exec(builder, ["rustup", "component", "add", "llvm-tools"], "pgo-install")
+        builder = await checked_exec(
+            builder.with_env_variable("RUSTFLAGS", "-Cprofile-generate=/tmp/pgo-data"),
+            [*build, "-p", "btrmind"],
+            "pgo-instrumented-build",
+        )
+        builder = await checked_exec(builder, ["./build-system/scripts/pgo-workload.sh", out_dir], "pgo-workload")
+        builder = await checked_exec(
+            builder, ["sh", "-c", f"{profdata} merge -o /tmp/pgo.profdata /tmp/pgo-data"], "pgo-merge"
+        )
+        builder = builder.with_env_variable(
+            "RUSTFLAGS", "-Cprofile-use=/tmp/pgo.profdata -Cllvm-args=-pgo-warn-missing-function"
+        )
+    # Stamp only the shipped build; the PGO training build above stays cacheable.
+    for name, value in build_info.env("release-optimized+pgo" if pgo else "release-optimized").items():
+        builder = builder.with_env_variable(name, value)
+    builder = await checked_exec(builder, [*build, *packages], "release-optimized")
+    binaries = " ".join(f"{out_dir}/{package}" for package in WORKSPACE_PACKAGES)
+    builder = await checked_exec(
+        builder, ["sh", "-c", f"mkdir -p /tmp/bin && cp {binaries} /tmp/bin/"], "release-optimized-collect"
+    )
+    return builder.directory("/tmp/bin")
+
+
+async def cross_binaries(client: dagger.Client, target: str) -> dagger.Directory:
+    """Build installer and btrmind in the release profile for a CROSS_TARGETS triple.
+
+    Each target keeps target/ in its own cache volume, so rebuilding one
+    target after a change does not evict another's objects.  Returns the
+    directory holding the two binaries.
+    """
+    out_dir = f"{WORKSPACE}/target/{target}/release"
+    packages = " ".join(f"-p {package}" for package in WORKSPACE_PACKAGES)
+    builder = await with_rust_target(rust_container(client, cargo_source(client)), f"cross-build-{target}", target)
+    builder = builder.with_mounted_cache(
+        f"{WORKSPACE}/target", cache_keys.volume(client, f"regicide-cross-target-{target}")
+    )
+    # target/ is a cache mount, so the binaries are copied out in the same exec.
+    ran = await checked_exec(
+        builder,
+        [
+            "sh", "-c",
+            f"cargo build --locked --release --target {target} {packages} && mkdir -p /tmp/bin && "
+            f"cp {' '.join(f'{out_dir}/{package}' for package in WORKSPACE_PACKAGES)} /tmp/bin/",
+        ],
+        f"cross-build-{target}",
+    )
+    return ran.directory("/tmp/bin")
+
+
+async def static_binaries(client: dagger.Client) -> dagger.Directory:
+    """Build installer and btrmind as fully static STATIC_TARGET release binaries.
+
+    Each binary must be reported static by `file` and link no shared
+    library according to `ldd`, or the static-verify step fails.  Returns
+    the directory holding the binaries and their SHA256SUMS.
+    """
+    out_dir = f"{WORKSPACE}/target/{STATIC_TARGET}/release"
+    packages = " ".join(f"-p {package}" for package in WORKSPACE_PACKAGES)
+    builder = await checked_exec(
+        await with_apt_packages(rust_container(client, cargo_source(client)), "static-build", "musl-tools", "file"),
+        ["rustup", "target", "add", STATIC_TARGET],
+        "static-build-target",
+    )
+    builder = (
+        builder
+        .with_env_variable(f"CC_{STATIC_TARGET.replace('-', '_')}", "musl-gcc")
+        .with_env_variable("RUSTFLAGS", "-C target-feature=+crt-static")
+        .with_mounted_cache(f"{WORKSPACE}/target", cache_keys.volume(client, f"regicide-cross-target-{STATIC_TARGET}"))
+    )
+    for name, value in build_info.env("release-static").items():
+        builder = builder.with_env_variable(name, value)
+    # target/ is a cache mount, so the binaries are copied out in the same exec.
+    built = await checked_exec(
+        builder,
+        [
+            "sh", "-c",
+            f"cargo build --locked --release --target {STATIC_TARGET} {packages} && mkdir -p /tmp/bin && "
+            f"cp {' '.join(f'{out_dir}/{package}' for package in WORKSPACE_PACKAGES)} /tmp/bin/",
+        ],
+        "static-build",
+    )
+    verified = await checked_exec(
+        built,
+        [
+            "sh", "-c",
+            "cd /tmp/bin && for bin in " + " ".join(WORKSPACE_PACKAGES) + "; do"
+            ' info=$(file -b "$bin");'
+            ' case "$info" in *"statically linked"*|*"static-pie linked"*) ;;'
+            ' *) echo "$bin is not static: $info" >&2; exit 1;; esac;'
+            ' if ldd "$bin" 2>&1 | grep -q "=>"; then'
+            ' echo "$bin links shared libraries:" >&2; ldd "$bin" >&2; exit 1; fi;'
+            ' echo "$bin: $info" >&2;'
+            " done && sha256sum " + " ".join(WORKSPACE_PACKAGES) + " > SHA256SUMS",
+        ],
+        "static-verify",
+    )
+    return verified.directory("/tmp/bin")
+
+
+async def feature_powerset(client: dagger.Client, depth: int = 2) -> str:
+    """Check every workspace crate under each feature combination up to depth.
+
+    Runs cargo-hack per package so a failure names the crate; returns the
+    combined output.  Raises StageFailed when any combination fails.
+    """
+    checker = await checked_exec(
+        rust_container(client, cargo_source(client)),
+        ["cargo", "install", "--locked", "cargo-hack"],
+        "feature-powerset-install",
+    )
+    output = []
+    for package in WORKSPACE_PACKAGES:
+        ran = await checked_exec(
+            checker,
+            [
+                "cargo", "hack", "check", "--locked", "-p", package,
+                "--feature-powerset", "--depth", str(depth), "--all-targets",
+            ],
+            f"feature-powerset-{package}",
+        )
+        output.append(await ran.stdout())
+    return "".join(output)
+
+
+def _shard_stage(stage: str, shard: int, shards: int) -> str:
+    return stage if shards == 1 else f"{stage}-{shard}"
+
+
+async def cargo_tests(
+    client: dagger.Client, shards: int = 1, packages: list[str] | None = None
+) -> list[dagger.Container]:
+    """Run the installer and btrmind tests with cargo-nextest, recording JUnit XML.
+
+    The tests are built once, then split by hash across shards containers
+    that run in parallel; one container per shard is returned.  packages
+    limits both to those crates' tests (see test_impact.py); by default
+    the whole workspace is tested.  Failing tests do not raise here: each container holds its report at
+    JUNIT_REPORT either way, so the reports can be exported before
+    cargo_tests_gate() fails the stage.
+    """
+    selection = ["--workspace"] if packages is None else [arg for package in packages for arg in ("-p", package)]
+    tester = await checked_exec(
+        rust_container(client, cargo_source(client, ".config/nextest.toml")),
+        ["cargo", "install", "--locked", "cargo-nextest", "--version", NEXTEST_VERSION],
+        "cargo-tests-install",
+    )
+    tester = await checked_exec(
+        tester, ["cargo", "nextest", "run", "--locked", "--profile", "ci", *selection, "--no-run"], "cargo-tests-build"
+    )
+
+    async def shard(index: int) -> dagger.Container:
+        partition = "" if shards == 1 else f" --partition hash:{index}/{shards}"
+        return await checked_exec(
+            tester,
+            [
+                "sh", "-c",
+                f"cargo nextest run --locked --profile ci {' '.join(selection)}{partition} > /tmp/nextest.log 2>&1; "
+                f"echo $? > /tmp/nextest-status; cat /tmp/nextest.log; test -s {JUNIT_REPORT}",
+            ],
+            _shard_stage("cargo-tests-run", index, shards),
+        )
+
+    return list(await asyncio.gather(*(shard(index) for index in range(1, shards + 1))))
+
+
+async def cargo_tests_gate(tested: list[dagger.Container]) -> None:
+    """Fail the cargo-tests stage if any cargo_tests() shard recorded failing tests."""
+    for index, container in enumerate(tested, start=1):
+        await checked_exec(
+            container,
+            [
+                "sh", "-c",
+                "status=$(cat /tmp/nextest-status); "
+                '[ "$status" -eq 0 ] || tail -n 200 /tmp/nextest.log >&2; exit "$status"',
+            ],
+            _shard_stage("cargo-tests", index, len(tested)),
+        )
+
+
+async def coverage(client: dagger.Client) -> tuple[dagger.File, float]:
+    """Measure installer and btrmind line coverage with cargo-llvm-cov under nextest.
+
+    Returns the LCOV report, with paths relative to the workspace root, and
+    the line coverage percent.  Raises StageFailed if a test fails.
+    """
+    tester = await checked_exec(
+        rust_container(client, cargo_source(client, ".config/nextest.toml")),
+        [
+            "sh", "-c",
+            "rustup component add llvm-tools-preview"
+            f" && cargo install --locked cargo-nextest --version {NEXTEST_VERSION}"
+            f" && cargo install --locked cargo-llvm-cov --version {LLVM_COV_VERSION}",
+        ],
+        "coverage-install",
+    )
+    ran = await checked_exec(
+        tester,
+        [
+            "cargo", "llvm-cov", "nextest", "--locked", "--workspace", "--profile", "ci",
+            "--remap-path-prefix", "--lcov", "--output-path", COVERAGE_REPORT,
+        ],
+        "coverage",
+    )
+    totals = await (
+        await checked_exec(ran, ["cargo", "llvm-cov", "report", "--json", "--summary-only"], "coverage-report")
+    ).stdout()
+    return ran.file(COVERAGE_REPORT), json.loads(totals)["data"][0]["totals"]["lines"]["percent"]
+
+
+async def cargo_deny(client: dagger.Client) -> dagger.Container:
+    """Check installer and btrmind licenses and banned or duplicate crates against deny.toml.
+
+    Violations do not raise here: the returned container holds cargo-deny's
+    JSON diagnostics at DENY_REPORT either way, so they can be reported one
+    by one before cargo_deny_gate() fails the stage.
+    """
+    checker = await checked_exec(
+        rust_container(client, cargo_source(client, "deny.toml")),
+        ["cargo", "install", "--locked", "cargo-deny", "--version", CARGO_DENY_VERSION],
+        "cargo-deny-install",
+    )
+    return await checked_exec(
+        checker,
+        [
+            "sh", "-c",
+            f"cargo deny --format json check licenses bans 2> {DENY_REPORT}; echo $? > /tmp/cargo-deny-status",
+        ],
+        "cargo-deny-run",
+    )
+
+
+def deny_violations(report: str) -> list[dict]:
+    """Return {"check", "code", "crate", "message"} for each error in cargo-deny's JSON output.
+
+    check is "license", "ban" or "duplicate"; crate is name@version, or
+    empty for diagnostics about the policy itself.
+    """
+    violations = []
+    for line in report.splitlines():
+        try:
+            diagnostic = json.loads(line)
+        except json.JSONDecodeError:
+            continue
+        fields = diagnostic.get("fields", {})
+        if diagnostic.get("type") != "diagnostic" or fields.get("severity") != "error":
+            continue
+        code = fields.get("code") or ""
+        crates = [graph["Krate"] for graph in fields.get("graphs", []) if "Krate" in graph]
+        labels = [label["message"] for label in fields.get("labels", []) if label.get("message")]
+        violations.append({
+            "check": DENY_CHECKS.get(code, "license"),
+            "code": code,
+            "crate": ", ".join(f"{krate['name']}@{krate['version']}" for krate in crates),
+            "message": "; ".join([fields.get("message", ""), *labels]),
+        })
+    return violations
+
+
+async def cargo_deny_gate(checked: dagger.Container) -> None:
+    """Fail the cargo-deny stage if cargo_deny() recorded violations."""
+    await checked_exec(
+        checked,
+        [
+            "sh", "-c",
+            f'status=$(cat /tmp/cargo-deny-status); [ "$status" -eq 0 ] || cat {DENY_REPORT} >&2; exit "$status"',
+        ],
+        "cargo-deny",
+    )
+
+
+async def installer_tui_snapshots(client: dagger.Client) -> dagger.Container:
+    """Drive the interactive installer on a PTY and diff its screens with golden files.
+
+    Runs tests/installer/integration/test_tui_snapshots.py against a debug
+    build; the scenarios never get as far as touching a disk.  With
+    REGICIDE_UPDATE_SNAPSHOTS=1 the golden files are rewritten instead, and
+    the returned container holds them under SNAPSHOT_DIR.  Raises
+    StageFailed when a screen differs from its snapshot.
+    """
+    tester = await checked_exec(
+        await with_apt_packages(
+            rust_container(client, cargo_source(client, "tests/installer")), "installer-tui-snapshots", "python3"
+        ),
+        ["cargo", "build", "--locked", "-p", "installer"],
+        "installer-tui-snapshots-build",
+    )
+    tester = tester.with_env_variable("REGICIDE_INSTALLER_BIN", f"{WORKSPACE}/target/debug/installer")
+    if os.environ.get("REGICIDE_UPDATE_SNAPSHOTS") == "1":
+        tester = tester.with_env_variable("REGICIDE_UPDATE_SNAPSHOTS", "1")
+    return await checked_exec(
+        tester,
+        ["python3", "-m", "unittest", "-v", "tests/installer/integration/test_tui_snapshots.py"],
+        "installer-tui-snapshots",
+    )
+
+
+async def cli_golden(client: dagger.Client) -> dagger.Container:
+    """Diff --help, --version and error output of every binary with golden files.
+
+    Runs tests/cli/test_cli_golden.py against debug builds of the workspace.
+    With REGICIDE_UPDATE_SNAPSHOTS=1 the golden files are rewritten instead,
+    and the returned container holds them under CLI_GOLDEN_DIR.  Raises
+    StageFailed when any output differs.
+    """
+    tester = await checked_exec(
+        await with_apt_packages(rust_container(client, cargo_source(client, "tests/cli")), "cli-golden", "python3"),
+        ["cargo", "build", "--locked", "--workspace", "--bins"],
+        "cli-golden-build",
+    )
+    tester = tester.with_env_variable("REGICIDE_BIN_DIR", f"{WORKSPACE}/target/debug")
+    if os.environ.get("REGICIDE_UPDATE_SNAPSHOTS") == "1":
+        tester = tester.with_env_variable("REGICIDE_UPDATE_SNAPSHOTS", "1")
+    return await checked_exec(
+        tester,
+        ["python3", "-m", "unittest", "-v", "tests/cli/test_cli_golden.py"],
+        "cli-golden",
+    )
+
+
+async def generated_docs(client: dagger.Client) -> dagger.Directory:
+    """Generate man pages and shell completions from the clap definitions.
+
+    scripts/generate-docs.sh runs each binary's hidden docs generator, as
+    the ebuilds do, and checks the output renders and parses.  Returns the
+    directory with one man/ and completions/ tree per installed binary name.
+    """
+    tester = await checked_exec(
+        await with_apt_packages(
+            rust_container(client, cargo_source(client, "build-system/scripts/generate-docs.sh")),
+            "generate-docs",
+            "groff-base",
+        ),
+        ["cargo", "build", "--locked", "--workspace", "--bins"],
+        "generate-docs-build",
+    )
+    ran = await checked_exec(
+        tester,
+        ["./build-system/scripts/generate-docs.sh", f"{WORKSPACE}/target/debug", "/tmp/docs"],
+        "generate-docs",
+    )
+    return ran.directory("/tmp/docs")
+
+
+async def btrmind_simulation(client: dagger.Client) -> str:
+    """Replay the recorded disk-pressure traces through btrmind's decision loop.
+
+    Each trace in BTRMIND_TRACES carries the actions allowed at each step;
+    `btrmind simulate --check` fails on any decision outside them, so a
+    change to the learning heuristics that alters behavior shows up here.
+    Returns the chosen actions per trace.  Raises StageFailed on a violation.
+    """
+    simulator = await checked_exec(
+        rust_container(client, cargo_source(client)),
+        ["cargo", "build", "--locked", "-p", "btrmind"],
+        "btrmind-simulation-build",
+    )
+    script = (
+        "status=0; "
+        f"for trace in {BTRMIND_TRACES}/*.json; do "
+        '  echo "== $trace"; '
+        "  target/debug/btrmind --config ai-agents/btrmind/config/btrmind.toml "
+        '    simulate --check "$trace" || status=1; '
+        "done; exit $status"
+    )
+    ran = await checked_exec(simulator, ["sh", "-c", script], "btrmind-simulation")
+    return await ran.stdout()
+
+
+async def btrmind_benchmarks(client: dagger.Client, runs: int = 10) -> dagger.File:
+    """Time `btrmind simulate` on each trace in BTRMIND_TRACES with hyperfine.
+
+    A release build replays each trace runs times after two warmups.
+    Returns hyperfine's JSON export, with one result per trace named after
+    the trace file.
+    """
+    benchmark = ["hyperfine", "--shell=none", "--warmup", "2", "--runs", str(runs), "--export-json", "/tmp/bench.json"]
+    for trace in sorted(Path(BTRMIND_TRACES).glob("*.json")):
+        benchmark += [
+            "-n", trace.stem,
+            f"target/release/btrmind --config ai-agents/btrmind/config/btrmind.toml simulate {trace.as_posix()}",
+        ]
+    runner = await checked_exec(
+        await with_apt_packages(rust_container(client, cargo_source(client)), "btrmind-bench", "hyperfine"),
+        ["cargo", "build", "--locked", "--release", "-p", "btrmind"],
+        "btrmind-bench-build",
+    )
+    ran = await checked_exec(runner, benchmark, "btrmind-bench")
+    return ran.file("/tmp/bench.json")
+
+
+async def btrmind_soak(client: dagger.Client, seconds: int) -> dagger.Directory:
+    """Run the btrmind daemon against a churn generator for seconds.
+
+    scripts/btrmind-soak.sh fills and drains a tmpfs while sampling RSS,
+    action frequency, and monitoring errors; it needs root capabilities to
+    mount the tmpfs.  REGICIDE_SOAK_* budgets are passed through from the
+    host.  Returns the report directory.  Raises StageFailed when a budget
+    is exceeded, with the partial report in the failure bundle.
+    """
+    soaker = await checked_exec(
+        rust_container(client, cargo_source(client, "build-system/scripts/btrmind-soak.sh")),
+        ["cargo", "build", "--locked", "--release", "-p", "btrmind"],
+        "btrmind-soak-build",
+    )
+    for name, value in sorted(os.environ.items()):
+        if name.startswith("REGICIDE_SOAK_"):
+            soaker = soaker.with_env_variable(name, value)
+    ran = await checked_exec(
+        soaker,
+        [
+            "./build-system/scripts/btrmind-soak.sh",
+            f"{WORKSPACE}/target/release/btrmind", str(seconds), SOAK_REPORT,
+        ],
+        "btrmind-soak",
+        insecure_root_capabilities=True,
+    )
+    return ran.directory(SOAK_REPORT)
+
+
+async def btrmind_non_btrfs(client: dagger.Client) -> str:
+    """Check that btrmind degrades to monitor-only mode off BTRFS.
+
+    scripts/btrmind-non-btrfs.sh mounts ext4 and xfs loopback images, runs
+    analyze, an aggressive cleanup and the daemon against each with dry-run
+    off, and fails if any cleanup action runs.  Loop mounts need root
+    capabilities.  Returns the script output.
+    """
+    tester = await checked_exec(
+        await with_apt_packages(
+            rust_container(client, cargo_source(client, "build-system/scripts/btrmind-non-btrfs.sh")),
+            "btrmind-non-btrfs",
+            "xfsprogs",
+        ),
+        ["cargo", "build", "--locked", "-p", "btrmind"],
+        "btrmind-non-btrfs-build",
+    )
+    ran = await checked_exec(
+        tester,
+        ["./build-system/scripts/btrmind-non-btrfs.sh", f"{WORKSPACE}/target/debug/btrmind", "ext4", "xfs"],
+        "btrmind-non-btrfs",
+        insecure_root_capabilities=True,
+    )
+    return await ran.stdout()
+
+
+async def btrmind_preview(client: dagger.Client) -> None:
+    """Open an interactive shell next to a running btrmind on a loopback BTRFS.
+
+    scripts/btrmind-preview.sh installs a debug btrmind and its shipped
+    config and unit at the paths the ebuild uses, mounts a BTRFS image with
+    RegicideOS's subvolumes, starts the daemon and runs bash.  The userland
+    is the Debian of the Rust image, not Gentoo.  Loop mounts need root
+    capabilities, and the terminal needs Dagger's interactive TUI.  The
+    container is discarded when the shell exits.
+    """
+    preview = await checked_exec(
+        await with_apt_packages(
+            rust_container(client, cargo_source(client, "build-system/scripts/btrmind-preview.sh")),
+            "btrmind-preview",
+            "btrfs-progs", "procps", "less",
+        ),
+        ["cargo", "build", "--locked", "-p", "btrmind"],
+        "btrmind-preview-build",
+    )
+    await preview.terminal(
+        cmd=[
+            "./build-system/scripts/btrmind-preview.sh",
+            f"{WORKSPACE}/target/debug/btrmind",
+            "ai-agents/btrmind/config/btrmind.toml",
+        ],
+        insecure_root_capabilities=True,
+    ).sync()
+
+
+async def btrmind_syscall_audit(client: dagger.Client) -> str:
+    """Compare btrmind's syscalls with the allowlist in its systemd unit.
+
+    scripts/btrmind-syscall-audit.sh traces analyze, cleanup and the daemon
+    with strace, without capabilities, and fails on any syscall outside the
+    unit's SystemCallFilter= or any EPERM.  ptrace needs root capabilities
+    in the container.  Returns the syscall profile report.
+    """
+    tester = await checked_exec(
+        await with_apt_packages(
+            rust_container(client, cargo_source(client, "build-system/scripts/btrmind-syscall-audit.sh")),
+            "btrmind-syscall-audit",
+            "strace", "systemd",
+        ),
+        ["cargo", "build", "--locked", "-p", "btrmind"],
+        "btrmind-syscall-audit-build",
+    )
+    ran = await checked_exec(
+        tester,
+        [
+            "./build-system/scripts/btrmind-syscall-audit.sh",
+            f"{WORKSPACE}/target/debug/btrmind",
+            "ai-agents/btrmind/systemd/btrmind.service",
+            "/tmp/btrmind-syscalls.txt",
+        ],
+        "btrmind-syscall-audit",
+        insecure_root_capabilities=True,
+    )
+    return await ran.file("/tmp/btrmind-syscalls.txt").contents()
+
+
+async def btrmind_readonly_root(client: dagger.Client) -> str:
+    """Run btrmind with its shipped config on a read-only root.
+
+    scripts/btrmind-readonly-root.sh remounts / read-only with tmpfs /var,
+    /tmp and /run in a private mount namespace and traces every write.
+    Mounts need root capabilities.  Returns the paths written and the
+    btrmind output.
+    """
+    tester = await checked_exec(
+        await with_apt_packages(
+            rust_container(client, cargo_source(client, "build-system/scripts/btrmind-readonly-root.sh")),
+            "btrmind-readonly-root",
+            "strace",
+        ),
+        ["cargo", "build", "--locked", "-p", "btrmind"],
+        "btrmind-readonly-root-build",
+    )
+    ran = await checked_exec(
+        tester,
+        [
+            "./build-system/scripts/btrmind-readonly-root.sh",
+            f"{WORKSPACE}/target/debug/btrmind",
+            "ai-agents/btrmind/config/btrmind.toml",
+        ],
+        "btrmind-readonly-root",
+        insecure_root_capabilities=True,
+    )
+    return await ran.stdout()
+
+
+async def locale_matrix(client: dagger.Client) -> str:
+    """Run the installer and btrmind CLIs across locales and timezones.
+
+    scripts/locale-matrix.sh runs each command under non-UTF-8 and bogus
+    locales, unusual and invalid TZ values, and an empty environment, and
+    fails on panics, signals, or commands that stop succeeding.  Returns the
+    CSV of results.
+    """
+    tester = await checked_exec(
+        await with_apt_packages(
+            rust_container(client, cargo_source(client, "build-system/scripts/locale-matrix.sh")),
+            "locale-matrix",
+            "locales", "tzdata",
+        ),
+        ["cargo", "build", "--locked", "-p", "installer", "-p", "btrmind"],
+        "locale-matrix-build",
+    )
+    ran = await checked_exec(
+        tester,
+        [
+            "./build-system/scripts/locale-matrix.sh",
+            f"{WORKSPACE}/target/debug/installer",
+            f"{WORKSPACE}/target/debug/btrmind",
+            "/tmp/locale-matrix.csv",
+        ],
+        "locale-matrix",
+    )
+    return await ran.file("/tmp/locale-matrix.csv").contents()
+
+
+def previous_btrmind_release() -> str | None:
+    """Return the most recent btrmind-v* tag, or None before the first release."""
+    result = subprocess.run(
+        ["git", "describe", "--tags", "--abbrev=0", "--match", "btrmind-v*"],
+        capture_output=True,
+        text=True,
+    )
+    return result.stdout.strip() if result.returncode == 0 else None
+
+
+async def btrmind_config_migration(client: dagger.Client, previous_ref: str | None) -> str:
+    """Load configs written by released btrmind versions with the current binary.
+
+    scripts/btrmind-config-migration.sh validates the committed configs in
+    ai-agents/btrmind/fixtures/configs/ and, when previous_ref is given, the
+    config shipped at that ref and the default its binary generates.
+    Returns the per-config results.  Raises StageFailed if any fail to load.
+    """
+    src = cargo_source(client, "build-system/scripts/btrmind-config-migration.sh", with_git=previous_ref is not None)
+    tester = await checked_exec(
+        rust_container(client, src), ["cargo", "build", "--locked", "-p", "btrmind"], "btrmind-config-migration-build"
+    )
+    args = ["./build-system/scripts/btrmind-config-migration.sh", f"{WORKSPACE}/target/debug/btrmind"]
+    if previous_ref:
+        args.append(previous_ref)
+    ran = await checked_exec(tester, args, "btrmind-config-migration")
+    return await ran.stdout()
+
+
+def gpu_available() -> bool:
+    """Return whether this runner has a GPU to pass through to containers.
+
+    REGICIDE_GPU=1/0 overrides detection, e.g. when the Dagger engine runs
+    on a different machine than the pipeline.
+    """
+    override = os.environ.get("REGICIDE_GPU")
+    if override is not None:
+        return override == "1"
+    if shutil.which("nvidia-smi") is None:
+        return False
+    return subprocess.run(["nvidia-smi", "-L"], capture_output=True).returncode == 0
+
+
+async def gpu_tests(client: dagger.Client) -> str:
+    """Run the AI agents' tests, including GPU-only ones, with every GPU attached.
+
+    Tests that need a GPU are marked #[ignore = "requires a GPU"] so plain
+    `cargo test` skips them; this stage runs them with --include-ignored.
+    nvidia-smi runs first so a runner whose engine lacks GPU support fails
+    clearly instead of silently testing on the CPU.  Needs a Dagger engine
+    started with _EXPERIMENTAL_DAGGER_GPU_SUPPORT=1.
+    """
+    tester = rust_container(client, cargo_source(client)).experimental_with_all_gpus()
+    tester = await checked_exec(tester, ["nvidia-smi"], "gpu-detect")
+    ran = await checked_exec(
+        tester.with_env_variable("REGICIDE_GPU", "1"),
+        ["cargo", "test", "--locked", "-p", "btrmind", "--", "--include-ignored"],
+        "gpu-tests",
+    )
+    return await tester.stdout() + await ran.stdout()
+
+
+def _ebuild_versions(package: str) -> list[str]:
+    """Return the versions of package's ebuilds in the overlay, revisions stripped."""
+    category_dir = source_layout.component("overlay") / package
+    name = package.split("/")[1]
+    versions = []
+    for ebuild in category_dir.glob(f"{name}-*.ebuild"):
+        version = ebuild.stem.removeprefix(f"{name}-")
+        versions.append(re.sub(r"-r\d+$", "", version))
+    return versions
+
+
+def crate_version(crate: str) -> str:
+    """Return the version in a workspace crate's Cargo.toml."""
+    with (source_layout.component(crate) / "Cargo.toml").open("rb") as f:
+        return tomllib.load(f)["package"]["version"]
+
+
+def crate_version_at(crate: str, ref: str) -> str | None:
+    """Return the version in a workspace crate's Cargo.toml at git ref, or None if it has none there."""
+    manifest = (source_layout.component(crate) / "Cargo.toml").as_posix()
+    result = subprocess.run(["git", "show", f"{ref}:{manifest}"], capture_output=True, text=True)
+    if result.returncode != 0:
+        return None
+    return tomllib.loads(result.stdout).get("package", {}).get("version")
+
+
+def latest_tag() -> str | None:
+    """Return the most recent tag reachable from HEAD, or None before the first one."""
+    result = subprocess.run(["git", "describe", "--tags", "--abbrev=0"], capture_output=True, text=True)
+    return result.stdout.strip() if result.returncode == 0 else None
+
+
+def ebuild_version_drift(base: str | None) -> tuple[list[str], list[str]]:
+    """Compare overlay ebuild versions with workspace crate versions.
+
+    Returns (errors, warnings).  A crate whose version changed since git ref
+    base needs a released (non-live) ebuild for the new version.  Once a
+    package has released ebuilds, one must match the crate's version and
+    none may be newer.  A package with only a live 9999 ebuild and an
+    unchanged crate is reported as a warning.
+    """
+    errors, warnings = [], []
+    for crate, package in CRATE_EBUILDS.items():
+        version = crate_version(crate)
+        released = [v for v in _ebuild_versions(package) if v != LIVE_VERSION]
+        previous = crate_version_at(crate, base) if base else None
+        if version not in released:
+            if previous is not None and previous != version:
+                name = package.split("/")[1]
+                errors.append(
+                    f"{package}: {crate} was bumped from {previous} to {version} without {name}-{version}.ebuild"
+                )
+            elif released:
+                errors.append(f"{package}: no ebuild for {crate} {version} (have {', '.join(sorted(released))})")
+            else:
+                warnings.append(f"{package}: only a live ebuild; {crate} is at {version}")
+        newer = [v for v in released if _version_key(v) > _version_key(version)]
+        if newer:
+            errors.append(f"{package}: ebuild {', '.join(newer)} is ahead of {crate} {version}")
+    return errors, warnings
+
+
+def _version_key(version: str) -> tuple:
+    """Sort key for dotted numeric versions ("1.10.0" > "1.9.2")."""
+    return tuple(int(part) if part.isdigit() else 0 for part in re.split(r"[._]", version))
@@ -0,0 +1,48 @@
+/// The `--version` text for `version`.
+///
+/// Release builds from the pipeline are compiled with REGICIDE_BUILD_RUN_ID,
+/// REGICIDE_BUILD_GIT_SHA and REGICIDE_BUILD_PROFILE set (see
+/// build-system/build_info.py), and report them below the version so a
+/// deployed binary can be traced to the CI run that built it.  Other builds
+/// print just the version.
+pub fn describe(version: &str) -> String {
+    match (
+        option_env!("REGICIDE_BUILD_RUN_ID"),
+        option_env!("REGICIDE_BUILD_GIT_SHA"),
+        option_env!("REGICIDE_BUILD_PROFILE"),
+    ) {
+        (Some(run), Some(commit), Some(profile)) => {
+            format!("{version}\nrun: {run}\ncommit: {commit}\nprofile: {profile}")
+        }
+        _ => version.to_string(),
+    }
+}
+
+/// The `--version` text of the calling crate, as a `&'static str` for clap.
+///
+/// A macro so that `CARGO_PKG_VERSION` is the caller's version, not this
+/// crate's.
+#[macro_export]
+macro_rules! long_version {
+    () => {{
+        static LONG_VERSION: std::sync::OnceLock<String> = std::sync::OnceLock::new();
+        LONG_VERSION
+            .get_or_init(|| $crate::build_info::describe(env!("CARGO_PKG_VERSION")))
+            .as_str()
+    }};
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn describe_starts_with_version() {
+        assert!(describe("1.2.3").starts_with("1.2.3"));
+    }
+
+    #[test]
+    fn long_version_is_the_calling_crates() {
+        assert!(crate::long_version!().starts_with(env!("CARGO_PKG_VERSION")));
+    }
+}
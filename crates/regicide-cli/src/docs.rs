@@ -0,0 +1,54 @@
+use anyhow::{Context, Result};
+use clap::Command;
+use clap_complete::Shell;
+use std::path::Path;
+
+/// Write the man page and shell completions for `cmd` into `out_dir`.
+///
+/// The man page goes to `man/<name>.1` and the completions to
+/// `completions/` under the file names each shell loads them by
+/// (`<name>.bash`, `_<name>`, `<name>.fish`).  Packaging installs them from
+/// there, so generation runs in the build instead of being committed.
+pub fn generate(cmd: Command, name: &'static str, out_dir: &Path) -> Result<()> {
+    let mut cmd = cmd.name(name).bin_name(name);
+    let man_dir = out_dir.join("man");
+    let completion_dir = out_dir.join("completions");
+    for dir in [&man_dir, &completion_dir] {
+        std::fs::create_dir_all(dir).with_context(|| format!("Failed to create {dir:?}"))?;
+    }
+
+    let mut page = Vec::new();
+    clap_mangen::Man::new(cmd.clone())
+        .render(&mut page)
+        .context("Failed to render man page")?;
+    let page_path = man_dir.join(format!("{name}.1"));
+    std::fs::write(&page_path, page).with_context(|| format!("Failed to write {page_path:?}"))?;
+
+    for shell in [Shell::Bash, Shell::Zsh, Shell::Fish] {
+        clap_complete::generate_to(shell, &mut cmd, name, &completion_dir)
+            .with_context(|| format!("Failed to generate {shell} completions"))?;
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use clap::Arg;
+
+    #[test]
+    fn test_generate_writes_man_page_and_completions() {
+        let dir = tempfile::tempdir().unwrap();
+        let cmd = Command::new("example").arg(Arg::new("verbose").long("verbose"));
+        generate(cmd, "example", dir.path()).unwrap();
+        for file in [
+            "man/example.1",
+            "completions/example.bash",
+            "completions/_example",
+            "completions/example.fish",
+        ] {
+            let path = dir.path().join(file);
+            assert!(path.metadata().unwrap().len() > 0, "{path:?} is empty");
+        }
+    }
+}
@@ -0,0 +1,4 @@
+//! Command-line support shared by the installer and btrmind.
+
+pub mod build_info;
+pub mod docs;
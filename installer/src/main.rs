@@ -21,8 +21,6 @@ use filesystem::{
 };
 use logging::{die, info, print_banner, warn, Colours};
 
-
-
 // Execute commands with full error output
 fn execute_with_output(command: &str) -> Result<String> {
     let output = ProcessCommand::new("sh")
@@ -78,10 +76,8 @@ fn execute(command: &str) -> Result<String> {
 
         // Filesystem commands
         "mkfs.vfat" | "mkfs.ext4" | "mkfs.btrfs" | "fsck.fat" | "fsck.ext4" | "btrfs"
-        | "wipefs" | "file" | "lsof" | "sync" | "dd" | "ls" | "fdisk" | "dmsetup"
-        | "losetup" | "nvme" => {
-            execute_safe_command(program, args)
-        }
+        | "wipefs" | "file" | "lsof" | "sync" | "dd" | "ls" | "fdisk" | "dmsetup" | "losetup"
+        | "nvme" => execute_safe_command(program, args),
 
         // Mount/unmount commands
         "mount" | "umount" => execute_safe_command(program, args),
@@ -643,9 +639,7 @@ fn wait_for_partitions(drive: &str, expected_count: usize) -> Result<Vec<String>
     }
 
     if partition_names.len() == expected_count {
-        info(&format!(
-            "Found {expected_count} partitions after refresh"
-        ));
+        info(&format!("Found {expected_count} partitions after refresh"));
         return Ok(partition_names);
     }
 
@@ -991,9 +985,7 @@ fn format_drive(drive: &str, layout: &[Partition]) -> Result<()> {
         let _ = execute(&format!("wipefs -af {current_name}"));
 
         // Step 2: Zero out the first 1MB to clear partition table and filesystem metadata
-        let _ = execute(&format!(
-            "dd if=/dev/zero of={current_name} bs=1M count=1"
-        ));
+        let _ = execute(&format!("dd if=/dev/zero of={current_name} bs=1M count=1"));
 
         // Step 3: For NVMe drives, also try nvme sanitize if available (safer than format)
         if current_name.contains("nvme") && execute("which nvme").is_ok() {
@@ -1006,9 +998,7 @@ fn format_drive(drive: &str, layout: &[Partition]) -> Result<()> {
 
             // Try nvme sanitize - this is safer than format and works on individual namespaces
             info(&format!("Attempting NVMe sanitize on {base_device}"));
-            let _ = execute(&format!(
-                "nvme sanitize --no-flush --force {base_device}"
-            ));
+            let _ = execute(&format!("nvme sanitize --no-flush --force {base_device}"));
         }
 
         // Step 6: Sync and wait
@@ -1068,9 +1058,7 @@ fn format_drive(drive: &str, layout: &[Partition]) -> Result<()> {
 
                         // Try with different options
                         let alt_cmd = if let Some(ref label) = partition.label {
-                            format!(
-                                "mkfs.ext4 -F -L {label} -E lazy_itable_init {current_name}"
-                            )
+                            format!("mkfs.ext4 -F -L {label} -E lazy_itable_init {current_name}")
                         } else {
                             format!("mkfs.ext4 -F -E lazy_itable_init {current_name}")
                         };
@@ -1140,8 +1128,7 @@ fn format_drive(drive: &str, layout: &[Partition]) -> Result<()> {
                     for subvolume in subvolumes {
                         let subvol_path = format!("{temp_mount}{subvolume}");
                         info(&format!("Creating BTRFS subvolume: {subvolume}"));
-                        if let Err(e) = execute(&format!("btrfs subvolume create {subvol_path}"))
-                        {
+                        if let Err(e) = execute(&format!("btrfs subvolume create {subvol_path}")) {
                             // Attempt cleanup on failure
                             let _ = execute(&format!("umount {temp_mount}"));
                             bail!("Failed to create BTRFS subvolume '{}': {}", subvolume, e);
@@ -1195,9 +1182,7 @@ fn format_drive(drive: &str, layout: &[Partition]) -> Result<()> {
                 let _ = execute(&format!("wipefs -af {current_name}"));
 
                 // Step 2: Zero out the first 1MB to clear partition table and filesystem metadata
-                let _ = execute(&format!(
-                    "dd if=/dev/zero of={current_name} bs=1M count=1"
-                ));
+                let _ = execute(&format!("dd if=/dev/zero of={current_name} bs=1M count=1"));
 
                 // Step 3: For NVMe drives, also try nvme sanitize if available (safer than format)
                 if current_name.contains("nvme") && execute("which nvme").is_ok() {
@@ -1210,9 +1195,7 @@ fn format_drive(drive: &str, layout: &[Partition]) -> Result<()> {
 
                     // Try nvme sanitize - this is safer than format and works on individual namespaces
                     info(&format!("Attempting NVMe sanitize on {base_device}"));
-                    let _ = execute(&format!(
-                        "nvme sanitize --no-flush --force {base_device}"
-                    ));
+                    let _ = execute(&format!("nvme sanitize --no-flush --force {base_device}"));
                 }
 
                 // Wait longer for all operations to complete
@@ -1312,9 +1295,7 @@ fn chroot(command: &str) -> Result<()> {
         ));
     }
 
-    info(&format!(
-        "Successfully executed chroot command: {command}"
-    ));
+    info(&format!("Successfully executed chroot command: {command}"));
     Ok(())
 }
 
@@ -1462,7 +1443,11 @@ async fn get_url(config: &Config) -> Result<String> {
             config.repository, arch, config.release_branch, filename
         ))
     } else {
-        bail!("Could not find 'url' or 'filename' in manifest for flavour '{}' branch '{}'", config.flavour, config.release_branch)
+        bail!(
+            "Could not find 'url' or 'filename' in manifest for flavour '{}' branch '{}'",
+            config.flavour,
+            config.release_branch
+        )
     }
 }
 
@@ -1774,9 +1759,7 @@ fn verify_grub_environment() -> Result<()> {
                     Ok(direct_output) => {
                         let direct_result = direct_output.trim();
                         if direct_result != "not found" && !direct_result.is_empty() {
-                            info(&format!(
-                                "✓ GRUB probe found in /usr/sbin: {direct_result}"
-                            ));
+                            info(&format!("✓ GRUB probe found in /usr/sbin: {direct_result}"));
                             true
                         } else {
                             false
@@ -2042,9 +2025,7 @@ fn install_bootloader(platform: &str, device: &str) -> Result<()> {
                 ) {
                     Ok(files) if !files.trim().is_empty() => {
                         kernel_path = files.trim().to_string();
-                        info(&format!(
-                            "Found kernel on attempt {attempt}: {kernel_path}"
-                        ));
+                        info(&format!("Found kernel on attempt {attempt}: {kernel_path}"));
                         found = true;
                         break;
                     }
@@ -2104,9 +2085,7 @@ fn install_bootloader(platform: &str, device: &str) -> Result<()> {
                 ) {
                     Ok(files) if !files.trim().is_empty() => {
                         initrd_path = files.trim().to_string();
-                        info(&format!(
-                            "Found initrd on attempt {attempt}: {initrd_path}"
-                        ));
+                        info(&format!("Found initrd on attempt {attempt}: {initrd_path}"));
                         found = true;
                         break;
                     }
@@ -2325,9 +2304,7 @@ fn create_grub_configuration() -> Result<()> {
             match chroot_with_output("find /boot -name 'vmlinuz-*' -type f 2>/dev/null | head -1") {
                 Ok(files) if !files.trim().is_empty() => {
                     kernel_path = files.trim().to_string();
-                    info(&format!(
-                        "Found kernel on attempt {attempt}: {kernel_path}"
-                    ));
+                    info(&format!("Found kernel on attempt {attempt}: {kernel_path}"));
                     found = true;
                     break;
                 }
@@ -2370,9 +2347,7 @@ fn create_grub_configuration() -> Result<()> {
             match chroot_with_output("find /boot -name 'initrd-*' -type f 2>/dev/null | head -1") {
                 Ok(files) if !files.trim().is_empty() => {
                     initrd_path = files.trim().to_string();
-                    info(&format!(
-                        "Found initrd on attempt {attempt}: {initrd_path}"
-                    ));
+                    info(&format!("Found initrd on attempt {attempt}: {initrd_path}"));
                     found = true;
                     break;
                 }
@@ -2996,10 +2971,7 @@ async fn parse_config(mut config: Config, interactive: bool) -> Result<Config> {
                         e
                     ));
                 } else {
-                    die(&format!(
-                        "Failed to fetch flavours from repository: {}",
-                        e
-                    ));
+                    die(&format!("Failed to fetch flavours from repository: {}", e));
                 }
             }
         }
@@ -3029,10 +3001,7 @@ async fn parse_config(mut config: Config, interactive: bool) -> Result<Config> {
                         config.release_branch = "main".to_string();
                     }
                 } else {
-                    die(&format!(
-                        "Failed to fetch releases from repository: {}",
-                        e
-                    ));
+                    die(&format!("Failed to fetch releases from repository: {}", e));
                 }
             }
         }
@@ -3104,21 +3073,10 @@ fn cleanup_on_failure() {
     info("Cleanup completed");
 }
 
-#[tokio::main]
-async fn main() -> Result<()> {
-    // Set up cleanup handler
-    let cleanup_flag = Arc::new(AtomicBool::new(false));
-    let cleanup_flag_clone = cleanup_flag.clone();
-
-    ctrlc::set_handler(move || {
-        if !cleanup_flag_clone.load(Ordering::Relaxed) {
-            cleanup_flag_clone.store(true, Ordering::Relaxed);
-            cleanup_on_failure();
-            std::process::exit(1);
-        }
-    })
-    .expect("Error setting Ctrl-C handler");
-    let matches = Command::new("RegicideOS Installer")
+fn cli() -> Command {
+    Command::new("RegicideOS Installer")
+        .version(env!("CARGO_PKG_VERSION"))
+        .long_version(regicide_cli::long_version!())
         .about("Program to install RegicideOS")
         .arg(
             Arg::new("config")
@@ -3134,7 +3092,35 @@ async fn main() -> Result<()> {
                 .value_name("PATH")
                 .help("Install from a local SquashFS image instead of downloading from a remote repository"),
         )
-        .get_matches();
+        .arg(
+            Arg::new("generate-docs")
+                .long("generate-docs")
+                .value_name("OUT_DIR")
+                .hide(true)
+                .help("Write the man page and shell completions to OUT_DIR (used by packaging)"),
+        )
+}
+
+#[tokio::main]
+async fn main() -> Result<()> {
+    // Set up cleanup handler
+    let cleanup_flag = Arc::new(AtomicBool::new(false));
+    let cleanup_flag_clone = cleanup_flag.clone();
+
+    ctrlc::set_handler(move || {
+        if !cleanup_flag_clone.load(Ordering::Relaxed) {
+            cleanup_flag_clone.store(true, Ordering::Relaxed);
+            cleanup_on_failure();
+            std::process::exit(1);
+        }
+    })
+    .expect("Error setting Ctrl-C handler");
+    let matches = cli().get_matches();
+
+    if let Some(out_dir) = matches.get_one::<String>("generate-docs") {
+        // The ebuild installs the binary as regicide-installer
+        return regicide_cli::docs::generate(cli(), "regicide-installer", Path::new(out_dir));
+    }
 
     let config_file = matches.get_one::<String>("config");
     let image_path = matches.get_one::<String>("image").cloned();
@@ -3334,7 +3320,8 @@ mod tests_main {
         // Test that validate_safe_path works for existing paths
         std::fs::create_dir_all("/tmp/test_base/existing_dir")?;
 
-        let result = filesystem::validate_safe_path("/tmp/test_base/existing_dir", "/tmp/test_base");
+        let result =
+            filesystem::validate_safe_path("/tmp/test_base/existing_dir", "/tmp/test_base");
         assert!(result.is_ok());
 
         // Cleanup
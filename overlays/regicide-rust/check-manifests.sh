@@ -0,0 +1,61 @@
+#!/bin/bash
+# Manifest check: regenerate the Manifest of every package in the overlay
+# from freshly fetched distfiles and compare it with the committed one.  A
+# missing or stale DIST entry, or a size or hash that no longer matches
+# what upstream serves, fails the check with the diff.  Runs inside the
+# Gentoo container set up by the overlay tests.  With
+# REGICIDE_UPDATE_MANIFESTS=1 differences are reported but do not fail, and
+# the pipeline copies the regenerated Manifests back into the checkout.
+set -euo pipefail
+
+OVERLAY_DIR="$(cd "$(dirname "$0")" && pwd)"
+UPDATE="${REGICIDE_UPDATE_MANIFESTS:-0}"
+COMMITTED="$(mktemp -d)"
+
+failures=0
+fail() {
+    echo "FAIL $1: $2" >&2
+    failures=$((failures + 1))
+}
+
+cd "${OVERLAY_DIR}"
+for ebuild_dir in */*/; do
+    pkg="${ebuild_dir%/}"
+    ebuilds=("${pkg}"/*.ebuild)
+    [[ -e "${ebuilds[0]}" ]] || continue
+
+    # Without the committed Manifest every distfile is fetched and hashed
+    # anew, instead of being checked against the entries under test.
+    committed=/dev/null
+    if [[ -f "${pkg}/Manifest" ]]; then
+        mkdir -p "${COMMITTED}/${pkg}"
+        mv "${pkg}/Manifest" "${COMMITTED}/${pkg}/Manifest"
+        committed="${COMMITTED}/${pkg}/Manifest"
+    fi
+    if ! ebuild "${ebuilds[0]}" manifest > "/tmp/manifest.log" 2>&1; then
+        sed 's/^/    /' /tmp/manifest.log >&2
+        fail "${pkg}" "could not regenerate the Manifest; a distfile failed to fetch"
+        continue
+    fi
+    regenerated="${pkg}/Manifest"
+    [[ -f "${regenerated}" ]] || regenerated=/dev/null
+
+    if [[ "${committed}" == /dev/null && "${regenerated}" == /dev/null ]]; then
+        echo "${pkg}: no distfiles"
+    elif diff -u --label "${pkg}/Manifest (committed)" --label "${pkg}/Manifest (regenerated)" \
+        "${committed}" "${regenerated}" >&2; then
+        echo "${pkg}: Manifest is current"
+    elif [[ "${UPDATE}" == "1" && "${regenerated}" == /dev/null ]]; then
+        echo "${pkg}: no distfiles any more; delete its Manifest"
+    elif [[ "${UPDATE}" == "1" ]]; then
+        echo "${pkg}: Manifest regenerated"
+    else
+        fail "${pkg}" "the committed Manifest differs from the regenerated one (re-run with REGICIDE_UPDATE_MANIFESTS=1 to update it)"
+    fi
+done
+
+if (( failures > 0 )); then
+    echo "${failures} Manifest check(s) failed" >&2
+    exit 1
+fi
+echo "Every Manifest matches its distfiles"
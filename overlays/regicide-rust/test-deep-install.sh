@@ -0,0 +1,151 @@
+#!/bin/bash
+# Deep install test: build and emerge every regicide-tools package from the
+# workspace mounted at /regicide, then compare the files each one installed
+# with installed-files/<category>/<package>.txt.  Catches ebuilds that
+# silently stop installing a binary, unit, config, man page or completion.
+# Each package is then reinstalled and uninstalled, and every path fails if
+# emerge fails, a maintainer hook prints an error, or the package's
+# check_<package> function finds the wrong system state afterwards.
+# Runs inside the Gentoo container set up by the overlay tests; /regicide
+# must be a git checkout, since the live ebuilds clone it with git-r3.
+set -euo pipefail
+
+OVERLAY_DIR="$(cd "$(dirname "$0")" && pwd)"
+LIST_DIR="${OVERLAY_DIR}/installed-files"
+SOURCE_REPO="${REGICIDE_SOURCE_REPO:-/regicide}"
+UPDATE="${REGICIDE_UPDATE_SNAPSHOTS:-0}"
+
+# The live ebuilds have empty KEYWORDS, and btrmind's unit is behind
+# USE=systemd; the list covers the full install.
+mkdir -p /etc/portage/package.accept_keywords /etc/portage/package.use
+echo "regicide-tools/* **" > /etc/portage/package.accept_keywords/regicide-tools
+echo "regicide-tools/btrmind systemd" > /etc/portage/package.use/regicide-tools
+
+# Clone the mounted workspace instead of GitHub, and let cargo fetch crates.
+export EGIT_OVERRIDE_REPO_AWDEMOS_REGICIDEOS="file://${SOURCE_REPO}"
+export FEATURES="${FEATURES:-} -network-sandbox"
+
+# Print the files a package installed, normalised so the list does not
+# change with the version or PORTAGE_COMPRESS.
+installed_files() {
+    local atom="$1" vdb
+    vdb=$(find "/var/db/pkg/${atom%/*}" -maxdepth 1 -name "${atom#*/}-[0-9]*" | head -n1)
+    if [[ -z "${vdb}" ]]; then
+        echo "ERROR: ${atom} is not installed" >&2
+        return 1
+    fi
+    awk '$1 == "obj" || $1 == "sym" { print $2 }' "${vdb}/CONTENTS" \
+        | sed -E 's#^/usr/share/doc/[^/]+/#/usr/share/doc/${PF}/#' \
+        | sed -E 's#^(/usr/share/(doc|man)/.*)\.(bz2|gz|xz|zst)$#\1#' \
+        | LC_ALL=C sort -u
+}
+
+failures=0
+fail() {
+    echo "FAIL $1: $2" >&2
+    failures=$((failures + 1))
+}
+
+# Compare a package's installed files with its committed list, or rewrite
+# the list in update mode.
+check_file_list() {
+    local atom="$1" pkg="${1#*/}" list="${LIST_DIR}/$1.txt" missing unexpected
+    installed_files "${atom}" > "/tmp/${pkg}.installed"
+
+    if [[ "${UPDATE}" == "1" ]]; then
+        mkdir -p "$(dirname "${list}")"
+        { grep '^#' "${list}" 2>/dev/null || true; cat "/tmp/${pkg}.installed"; } > "/tmp/${pkg}.list"
+        mv "/tmp/${pkg}.list" "${list}"
+        echo "Updated ${list}"
+        return
+    fi
+    if [[ ! -f "${list}" ]]; then
+        fail "${atom}" "no committed file list at ${list#"${OVERLAY_DIR}"/}"
+        return
+    fi
+
+    grep -v '^#' "${list}" | LC_ALL=C sort -u > "/tmp/${pkg}.expected"
+    missing=$(LC_ALL=C comm -23 "/tmp/${pkg}.expected" "/tmp/${pkg}.installed")
+    unexpected=$(LC_ALL=C comm -13 "/tmp/${pkg}.expected" "/tmp/${pkg}.installed")
+    if [[ -n "${missing}" ]]; then
+        fail "${atom}" "no longer installs (re-run with REGICIDE_UPDATE_SNAPSHOTS=1 if intended):"
+        sed 's/^/    /' <<< "${missing}" >&2
+    fi
+    if [[ -n "${unexpected}" ]]; then
+        fail "${atom}" "installs files missing from ${list#"${OVERLAY_DIR}"/}:"
+        sed 's/^/    /' <<< "${unexpected}" >&2
+    fi
+    if [[ -z "${missing}" && -z "${unexpected}" ]]; then
+        echo "${atom} installed all $(wc -l < "/tmp/${pkg}.installed") listed files"
+    fi
+}
+
+# Run one lifecycle path (install, reinstall or uninstall) of a package.
+# Hooks that fail without dying only show up in the output, so scan it too.
+run_path() {
+    local path="$1" atom="$2" log="/tmp/${2#*/}-$1.log"
+    shift 2
+    echo "--- ${path} ${atom}"
+    if ! emerge "$@" "${atom}" 2>&1 | tee "${log}"; then
+        fail "${atom}" "${path} failed"
+        return 1
+    fi
+    if grep -E 'command not found|^ \* ERROR: |^(chown|chmod|systemctl|systemd-tmpfiles|useradd|groupadd): ' "${log}" > "/tmp/hook-errors.txt"; then
+        fail "${atom}" "hook errors during ${path}:"
+        sed 's/^/    /' /tmp/hook-errors.txt >&2
+    fi
+}
+
+expect() {
+    local atom="$1" what="$2" actual="$3" wanted="$4"
+    [[ "${actual}" == "${wanted}" ]] || fail "${atom}" "${what} is '${actual}', expected '${wanted}'"
+}
+
+# btrmind: acct-user/acct-group create btrmind, tmpfiles_process creates its
+# state and log directories, and the service is never enabled or disabled
+# behind the admin's back.  State survives a reinstall.
+check_btrmind() {
+    local path="$1" atom="regicide-tools/btrmind" dir
+    if [[ "${path}" == "uninstall" ]]; then
+        [[ ! -e /usr/bin/btrmind ]] || fail "${atom}" "/usr/bin/btrmind left behind"
+        [[ ! -e /usr/lib/systemd/system/btrmind.service ]] || fail "${atom}" "btrmind.service left behind"
+        [[ -e /var/lib/btrmind/.deep-test-state ]] || fail "${atom}" "uninstall removed state in /var/lib/btrmind"
+        return
+    fi
+
+    getent passwd btrmind > /dev/null || fail "${atom}" "user btrmind missing after ${path}"
+    getent group btrmind > /dev/null || fail "${atom}" "group btrmind missing after ${path}"
+    for dir in /var/lib/btrmind /var/log/btrmind; do
+        expect "${atom}" "owner of ${dir} after ${path}" "$(stat -c %U:%G "${dir}" 2>/dev/null)" "btrmind:btrmind"
+    done
+    if [[ "${path}" == "install" ]]; then
+        expect "${atom}" "btrmind.service after install" "$(systemctl is-enabled btrmind 2>/dev/null)" "disabled"
+        # Give the reinstall something to preserve.
+        systemctl enable btrmind || fail "${atom}" "could not enable btrmind.service"
+        install -o btrmind -g btrmind /dev/null /var/lib/btrmind/.deep-test-state
+    else
+        expect "${atom}" "btrmind.service after reinstall" "$(systemctl is-enabled btrmind 2>/dev/null)" "enabled"
+        [[ -e /var/lib/btrmind/.deep-test-state ]] || fail "${atom}" "reinstall removed state in /var/lib/btrmind"
+    fi
+}
+
+for ebuild_dir in "${OVERLAY_DIR}"/regicide-tools/*/; do
+    pkg="$(basename "${ebuild_dir}")"
+    atom="regicide-tools/${pkg}"
+    check="check_${pkg//-/_}"
+    declare -F "${check}" > /dev/null || check=true
+
+    echo "=== ${atom} ==="
+    run_path install "${atom}" --oneshot --quiet-build=y || continue
+    check_file_list "${atom}"
+    [[ "${UPDATE}" == "1" ]] && continue
+    "${check}" install
+    run_path reinstall "${atom}" --oneshot --quiet-build=y && "${check}" reinstall
+    run_path uninstall "${atom}" --unmerge && "${check}" uninstall
+done
+
+if (( failures > 0 )); then
+    echo "${failures} deep install check(s) failed" >&2
+    exit 1
+fi
+echo "All regicide-tools packages installed, reinstalled and uninstalled cleanly"
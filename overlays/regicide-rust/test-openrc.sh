@@ -0,0 +1,66 @@
+#!/bin/bash
+# OpenRC test: emerge every regicide-tools package on an OpenRC stage3.  A
+# package that ships a systemd unit must also install an OpenRC init script
+# that OpenRC can describe, resolve dependencies for and add to a runlevel.
+# A package that cannot work without systemd must refuse to install with a
+# message naming systemd; any other emerge failure fails the test.  Runs
+# inside the OpenRC container set up by the overlay tests; /regicide must be
+# a git checkout, since the live ebuilds clone it with git-r3.
+set -euo pipefail
+
+OVERLAY_DIR="$(cd "$(dirname "$0")" && pwd)"
+SOURCE_REPO="${REGICIDE_SOURCE_REPO:-/regicide}"
+
+mkdir -p /etc/portage/package.accept_keywords
+echo "regicide-tools/* **" > /etc/portage/package.accept_keywords/regicide-tools
+export EGIT_OVERRIDE_REPO_AWDEMOS_REGICIDEOS="file://${SOURCE_REPO}"
+export FEATURES="${FEATURES:-} -network-sandbox"
+
+# OpenRC was not booted in the container; let its tools run anyway.
+mkdir -p /run/openrc
+touch /run/openrc/softlevel
+
+failures=0
+fail() {
+    echo "FAIL $1: $2" >&2
+    failures=$((failures + 1))
+}
+
+for ebuild_dir in "${OVERLAY_DIR}"/regicide-tools/*/; do
+    pkg="$(basename "${ebuild_dir}")"
+    atom="regicide-tools/${pkg}"
+    log="/tmp/${pkg}-openrc.log"
+
+    echo "=== ${atom} ==="
+    if ! emerge --oneshot --quiet-build=y "${atom}" 2>&1 | tee "${log}"; then
+        if grep -qE '^ \* .*systemd' "${log}"; then
+            echo "${atom} declares that it needs systemd"
+        else
+            fail "${atom}" "failed to install without saying it needs systemd"
+        fi
+        continue
+    fi
+
+    if ! grep -qE 'systemd_(do|new)unit' "${ebuild_dir}"*.ebuild; then
+        echo "${atom} ships no services"
+        continue
+    fi
+    if [[ ! -x "/etc/init.d/${pkg}" ]]; then
+        fail "${atom}" "ships a systemd unit but installed no /etc/init.d/${pkg}"
+        continue
+    fi
+    rc-service "${pkg}" describe || fail "${atom}" "rc-service ${pkg} describe failed"
+    rc-depend "${pkg}" > /dev/null || fail "${atom}" "rc-depend ${pkg} failed"
+    if rc-update add "${pkg}" default && rc-update show default | grep -qw "${pkg}"; then
+        rc-update del "${pkg}" default
+        echo "${atom} installed an OpenRC init script"
+    else
+        fail "${atom}" "could not add ${pkg} to the default runlevel"
+    fi
+done
+
+if (( failures > 0 )); then
+    echo "${failures} OpenRC check(s) failed" >&2
+    exit 1
+fi
+echo "All regicide-tools packages install cleanly on OpenRC"
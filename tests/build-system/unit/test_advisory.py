@@ -0,0 +1,54 @@
+"""
+Unit tests for advisory stages (build-system/advisory.py).
+"""
+
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import advisory  # noqa: E402
+from failure_bundle import StageFailed  # noqa: E402
+
+
+class TestAdvisory(unittest.TestCase):
+    """A failing advisory stage is excused with a warning; any other is not."""
+
+    def setUp(self):
+        added = mock.patch.object(advisory, "_added", set())
+        added.start()
+        self.addCleanup(added.stop)
+        self.failure = StageFailed("overlay-openrc-tests", 1, "", Path("bundle.tar.gz"))
+
+    def test_committed_file_loads(self):
+        self.assertIsInstance(advisory.stages(), frozenset)
+
+    def test_added_stage(self):
+        self.assertFalse(advisory.is_advisory("overlay-openrc-tests"))
+        advisory.add("overlay-openrc-tests")
+        self.assertTrue(advisory.is_advisory("overlay-openrc-tests"))
+
+    @mock.patch.object(advisory.run_history, "record_warning")
+    @mock.patch.object(advisory.run_history, "mark_advisory")
+    def test_excuse(self, mark_advisory, record_warning):
+        self.assertFalse(advisory.excuse("overlay-openrc-tests", self.failure))
+        mark_advisory.assert_not_called()
+        advisory.add("overlay-openrc-tests")
+        with mock.patch("sys.stderr"):
+            self.assertTrue(advisory.excuse("overlay-openrc-tests", self.failure))
+        mark_advisory.assert_called_once_with("overlay-openrc-tests")
+        self.assertIn("failed with exit code 1", record_warning.call_args.args[1])
+
+    def test_yellow(self):
+        with mock.patch.dict(os.environ, {"NO_COLOR": "1"}):
+            self.assertEqual(advisory.yellow("warn"), "warn")
+        with mock.patch.dict(os.environ):
+            os.environ.pop("NO_COLOR", None)
+            self.assertEqual(advisory.yellow("warn"), f"{advisory.YELLOW}warn{advisory.RESET}")
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,49 @@
+"""
+Unit tests for the stage artifact contracts (build-system/artifacts.py).
+"""
+
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import artifacts  # noqa: E402
+
+
+class TestValidate(unittest.TestCase):
+    """validate() requires every contracted file to exist and be non-empty."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.root = Path(self.dir.name)
+
+    def write(self, relative: str, content: str = "x") -> None:
+        path = self.root / relative
+        path.parent.mkdir(parents=True, exist_ok=True)
+        path.write_text(content)
+
+    def test_complete_contract(self):
+        self.write("static/installer")
+        self.write("static/btrmind")
+        self.write("static/SHA256SUMS")
+        artifacts.validate("static-binaries", self.root)
+
+    def test_missing_and_empty_files(self):
+        self.write("bin/installer", "")
+        with self.assertRaises(artifacts.MissingArtifact) as raised:
+            artifacts.validate("release-optimized", self.root)
+        self.assertEqual(raised.exception.missing, [self.root / "bin/installer", self.root / "bin/btrmind"])
+        self.assertIn("stage release-optimized did not produce", str(raised.exception))
+
+    def test_parameters(self):
+        self.write("stage4-arm64-systemd-cosmic.tar.xz")
+        artifacts.validate("stage4", self.root, arch="arm64")
+        with self.assertRaises(artifacts.MissingArtifact):
+            artifacts.validate("stage4", self.root, arch="amd64")
+
+
+if __name__ == "__main__":
+    unittest.main()
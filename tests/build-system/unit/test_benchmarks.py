@@ -0,0 +1,62 @@
+"""
+Unit tests for the benchmark comparison (build-system/benchmarks.py).
+"""
+
+import math
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import benchmarks  # noqa: E402
+
+
+def result(mean, stddev=0.0, runs=10):
+    return {"mean": mean, "stddev": stddev, "runs": runs}
+
+
+class TestWelchT(unittest.TestCase):
+    """welch_t() measures a change in mean against the runs' spread."""
+
+    def test_statistic(self):
+        # error = sqrt(0.1**2 / 10 + 0.2**2 / 10) = sqrt(0.005)
+        self.assertAlmostEqual(benchmarks.welch_t(result(1.0, 0.1), result(1.5, 0.2)), 0.5 / math.sqrt(0.005))
+
+    def test_sign_follows_the_change(self):
+        self.assertLess(benchmarks.welch_t(result(1.5, 0.1), result(1.0, 0.1)), 0)
+
+    def test_no_spread(self):
+        self.assertEqual(benchmarks.welch_t(result(1.0), result(1.0)), 0.0)
+        self.assertEqual(benchmarks.welch_t(result(1.0), result(2.0)), math.inf)
+
+
+class TestComparison(unittest.TestCase):
+    """comparison() marks only significant changes."""
+
+    def test_markers(self):
+        table = benchmarks.comparison(
+            "20260101-000000",
+            {"steady": result(1.0, 0.1), "busy": result(1.0, 0.01), "gone": result(1.0)},
+            {"steady": result(1.01, 0.1), "busy": result(1.5, 0.01), "new": result(1.0)},
+        )
+        self.assertIn("| busy | 1000.00 ± 10.00 | 1500.00 ± 10.00 | +50.0% | **slower** |", table)
+        self.assertIn("| steady | 1000.00 ± 100.00 | 1010.00 ± 100.00 | +1.0% |  |", table)
+        self.assertIn("| new | - | 1000.00 ± 0.00 | | new |", table)
+        self.assertIn("| gone | 1000.00 ± 0.00 | - | | removed |", table)
+
+
+class TestHostedRunner(unittest.TestCase):
+    """hosted_runner() tells GitHub-hosted runners from self-hosted ones and local runs."""
+
+    def test_environment(self):
+        for environ, hosted in (({"RUNNER_ENVIRONMENT": "github-hosted"}, True),
+                                ({"RUNNER_ENVIRONMENT": "self-hosted"}, False), ({}, False)):
+            with self.subTest(environ=environ), mock.patch.dict(os.environ, environ, clear=True):
+                self.assertEqual(benchmarks.hosted_runner(), hosted)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,70 @@
+"""
+Unit tests for the binpkg channel (build-system/binpkg_channel.py).
+"""
+
+import asyncio
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import binpkg_channel  # noqa: E402
+
+
+class TestBuildpkg(unittest.TestCase):
+    """buildpkg() makes merges write one binpkg each to BUILD_PKGDIR."""
+
+    def test_environment(self):
+        container = mock.MagicMock()
+        binpkg_channel.buildpkg(container)
+        container.with_env_variable.assert_called_once_with("FEATURES", "buildpkg -binpkg-multi-instance")
+        container.with_env_variable.return_value.with_env_variable.assert_called_once_with(
+            "PKGDIR", binpkg_channel.BUILD_PKGDIR
+        )
+
+
+class TestPush(unittest.TestCase):
+    """push() uploads the PKGDIR under both tags and returns the manifest digest."""
+
+    def setUp(self):
+        self.commands = []
+
+        async def checked_exec(container, args, stage):
+            self.commands.append((stage, args))
+            pushed = mock.MagicMock()
+            pushed.stdout = mock.AsyncMock(return_value="f00d\n")
+            return pushed
+
+        for patcher in (
+            mock.patch.object(binpkg_channel, "checked_exec", checked_exec),
+            mock.patch.object(binpkg_channel, "from_image", return_value=mock.MagicMock()),
+            mock.patch.object(binpkg_channel.build_info, "git_sha", return_value="0123abc"),
+            mock.patch.object(binpkg_channel.build_info, "oci_labels", return_value={"a": "b c"}),
+            mock.patch.object(binpkg_channel.oci_policy, "enforce"),
+            mock.patch.dict(os.environ, {"GITHUB_ACTOR": "me", "GITHUB_TOKEN": "t"}, clear=True),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def test_push(self):
+        ref = asyncio.run(binpkg_channel.push(mock.MagicMock(), mock.MagicMock(), "amd64"))
+        self.assertEqual(ref, f"{binpkg_channel.REPOSITORY}@sha256:f00d")
+        (stage, args), = self.commands
+        self.assertEqual(stage, "binpkg-push")
+        script = args[-1]
+        self.assertIn(f"{binpkg_channel.REPOSITORY}:amd64,amd64-0123abc $files", script)
+        self.assertIn("--annotation 'a=b c'", script)
+        self.assertIn('echo "$REGISTRY_TOKEN" | oras login', script)
+        self.assertNotIn(" t ", script)
+
+    def test_annotations_pass_the_label_policy(self):
+        labels = binpkg_channel.annotations("arm64")
+        binpkg_channel.oci_policy.enforce.assert_called_once_with(f"{binpkg_channel.REPOSITORY}:arm64", labels)
+        self.assertEqual(labels["org.opencontainers.image.title"], "regicide-rust binpkgs (arm64)")
+
+
+if __name__ == "__main__":
+    unittest.main()
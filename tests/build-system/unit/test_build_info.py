@@ -0,0 +1,51 @@
+"""
+Unit tests for the build metadata (build-system/build_info.py).
+"""
+
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+ROOT = Path(__file__).parent.parent.parent.parent
+sys.path.insert(0, str(ROOT / "build-system"))
+
+import build_info  # noqa: E402
+
+
+class TestOciLabels(unittest.TestCase):
+    """oci_labels() carries the workspace's license and the version when given."""
+
+    def setUp(self):
+        cwd = Path.cwd()
+        os.chdir(ROOT)
+        self.addCleanup(os.chdir, cwd)
+
+    def test_license_is_the_workspace_license(self):
+        self.assertEqual(build_info.license(), "GPL-3.0")
+        self.assertEqual(build_info.oci_labels("release")["org.opencontainers.image.licenses"], "GPL-3.0")
+
+    def test_version_only_when_given(self):
+        self.assertNotIn("org.opencontainers.image.version", build_info.oci_labels("release"))
+        self.assertEqual(build_info.oci_labels("release", "1.2.3")["org.opencontainers.image.version"], "1.2.3")
+
+
+
+class TestBranch(unittest.TestCase):
+    """branch() prefers the pull request's head branch; git_ref() the full ref."""
+
+    def test_pull_request(self):
+        variables = {"GITHUB_HEAD_REF": "feature", "GITHUB_REF_NAME": "12/merge", "GITHUB_REF": "refs/pull/12/merge"}
+        with mock.patch.dict(os.environ, variables):
+            self.assertEqual(build_info.branch(), "feature")
+            self.assertEqual(build_info.git_ref(), "refs/pull/12/merge")
+
+    def test_push(self):
+        with mock.patch.dict(os.environ, {"GITHUB_HEAD_REF": "", "GITHUB_REF_NAME": "main", "GITHUB_REF": ""}):
+            self.assertEqual(build_info.branch(), "main")
+            self.assertEqual(build_info.git_ref(), "refs/heads/main")
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,49 @@
+"""
+Unit tests for cache volume naming (build-system/cache_keys.py).
+"""
+
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import cache_keys  # noqa: E402
+
+
+def env(**values):
+    return mock.patch.dict(os.environ, values)
+
+
+class TestNamespace(unittest.TestCase):
+    """namespace() and volume_name() follow REGICIDE_CACHE_NAMESPACE."""
+
+    def test_shared_by_default(self):
+        with mock.patch.dict(os.environ, {}, clear=True):
+            self.assertEqual(cache_keys.strategy(), "shared")
+            self.assertEqual(cache_keys.volume_name("regicide-clippy-target"), "regicide-clippy-target")
+
+    def test_branch(self):
+        with env(REGICIDE_CACHE_NAMESPACE="branch", GITHUB_HEAD_REF="Feature/Fast_Builds!"):
+            self.assertEqual(cache_keys.namespace(), "feature-fast-builds")
+            self.assertEqual(cache_keys.volume_name("target"), "target-feature-fast-builds")
+            self.assertEqual(cache_keys.volume_name("registry", shared=True), "registry")
+
+    def test_toolchain_follows_the_rust_image(self):
+        with env(REGICIDE_CACHE_NAMESPACE="toolchain", REGICIDE_RUST_IMAGE="rust:1.87"):
+            first = cache_keys.namespace()
+        with env(REGICIDE_CACHE_NAMESPACE="toolchain", REGICIDE_RUST_IMAGE="rust:1.88"):
+            second = cache_keys.namespace()
+        self.assertRegex(first, r"^tc-[0-9a-f]{12}$")
+        self.assertNotEqual(first, second)
+
+    def test_unknown_strategy(self):
+        with env(REGICIDE_CACHE_NAMESPACE="per-user"):
+            with self.assertRaisesRegex(ValueError, "expected one of shared, branch, toolchain"):
+                cache_keys.namespace()
+
+
+if __name__ == "__main__":
+    unittest.main()
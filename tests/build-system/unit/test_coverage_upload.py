@@ -0,0 +1,67 @@
+"""
+Unit tests for the coverage upload (build-system/coverage_upload.py).
+"""
+
+import asyncio
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import coverage_upload  # noqa: E402
+
+
+class TestUpload(unittest.TestCase):
+    """upload() runs a pinned uploader for the commit, or skips without a token."""
+
+    def setUp(self):
+        self.commands = []
+
+        async def checked_exec(container, args, stage):
+            self.commands.append((stage, args))
+            return container
+
+        for patcher in (
+            mock.patch.object(coverage_upload, "checked_exec", checked_exec),
+            mock.patch.object(coverage_upload, "from_image", return_value=mock.MagicMock()),
+            mock.patch.object(coverage_upload.build_info, "git_sha", return_value="0123456789abcdef"),
+            mock.patch.object(coverage_upload.build_info, "branch", return_value="main"),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def upload(self, service, **environ):
+        with mock.patch.dict(os.environ, environ, clear=True):
+            asyncio.run(coverage_upload.upload(mock.MagicMock(), service, mock.MagicMock()))
+
+    def test_skips_without_token(self):
+        self.upload("codecov")
+        self.assertEqual(self.commands, [])
+
+    def test_codecov_pins_cli_and_passes_slug(self):
+        self.upload("codecov", CODECOV_TOKEN="t", GITHUB_REPOSITORY="RegicideOS/RegicideOS")
+        (_, install), (stage, upload) = self.commands
+        self.assertIn(f"codecov-cli=={coverage_upload.CODECOV_CLI_VERSION}", install)
+        self.assertEqual(stage, "coverage-upload")
+        self.assertIn("--slug RegicideOS/RegicideOS", upload[-1])
+        self.assertIn("--commit-sha 0123456789abcdef --branch main", upload[-1])
+        self.assertIn('--token "$CODECOV_TOKEN"', upload[-1])
+
+    def test_codecov_without_repository_omits_slug(self):
+        self.upload("codecov", CODECOV_TOKEN="t")
+        self.assertNotIn("--slug", self.commands[-1][1][-1])
+
+    def test_coveralls_checks_the_pinned_release(self):
+        self.upload("coveralls", COVERALLS_REPO_TOKEN="t")
+        (_, install), (_, upload) = self.commands
+        self.assertIn(f"/v{coverage_upload.COVERALLS_VERSION}/coveralls-linux.tar.gz", install[-1])
+        self.assertIn("sha256sum -c -", install[-1])
+        self.assertLess(install[-1].index("sha256sum"), install[-1].index("tar -xzf"))
+        self.assertEqual(upload[:2], ["coveralls", "report"])
+
+
+if __name__ == "__main__":
+    unittest.main()
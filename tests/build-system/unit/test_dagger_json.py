@@ -0,0 +1,48 @@
+"""
+Unit tests that the Dagger module's context (dagger.json include) holds every
+file the stage code reads next to itself.
+"""
+
+import fnmatch
+import json
+import re
+import unittest
+from pathlib import Path
+
+ROOT = Path(__file__).parent.parent.parent.parent
+BUILD_SYSTEM = ROOT / "build-system"
+# Stage code that reads files next to itself: Path(__file__).parent / "name".
+READ_NEXT_TO_CODE = re.compile(r'Path\(__file__\)\.parent / "([^"]+)"')
+# fingerprint.CONFIG_FILES lists its names in a tuple instead.
+FINGERPRINT_NAMES = re.compile(r'"([\w.-]+\.(?:json|toml))"')
+
+
+def read_files() -> set[str]:
+    """Return the build-system files the stage modules read, as repository paths."""
+    names = set()
+    for path in BUILD_SYSTEM.glob("*.py"):
+        names |= set(READ_NEXT_TO_CODE.findall(path.read_text()))
+    fingerprint = (BUILD_SYSTEM / "fingerprint.py").read_text()
+    config = fingerprint[fingerprint.index("CONFIG_FILES"):fingerprint.index("_OUTPUT_PATHS")]
+    names |= set(FINGERPRINT_NAMES.findall(config)) - {"Cargo.toml", "Cargo.lock"}
+    # catalyst/ holds host-only scripts the module never runs.
+    return {f"build-system/{name}" for name in names if not name.startswith("catalyst")}
+
+
+class TestInclude(unittest.TestCase):
+    """dagger.json include matches exactly the files the module needs."""
+
+    def setUp(self):
+        self.include = json.loads((ROOT / "dagger.json").read_text())["include"]
+
+    def test_every_read_file_is_included(self):
+        for path in sorted(read_files()):
+            self.assertTrue(any(fnmatch.fnmatch(path, pattern) for pattern in self.include), path)
+
+    def test_every_include_exists(self):
+        for pattern in self.include:
+            self.assertTrue(list(ROOT.glob(pattern)), f"{pattern} matches nothing")
+
+
+if __name__ == "__main__":
+    unittest.main()
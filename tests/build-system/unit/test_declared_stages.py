@@ -0,0 +1,68 @@
+"""
+Unit tests for the declared stage interpreter (build-system/declared_stages.py).
+"""
+
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import declared_stages  # noqa: E402
+
+
+class TestLoad(unittest.TestCase):
+    """load() accepts stages.toml and rejects malformed declarations."""
+
+    def load(self, text: str) -> dict:
+        with tempfile.TemporaryDirectory() as tmp:
+            path = Path(tmp) / "stages.toml"
+            path.write_text(text)
+            return declared_stages.load(path)
+
+    def test_committed_file_loads(self):
+        stages = declared_stages.load()
+        self.assertEqual(sorted(declared_stages.order(stages, list(stages))), sorted(stages))
+
+    def test_minimal_stage(self):
+        stages = self.load('[stages.lint]\nimage = "rust"\ncommands = [["cargo", "fmt"]]\n')
+        self.assertEqual(stages["lint"]["commands"], [["cargo", "fmt"]])
+
+    def test_rejects(self):
+        cases = {
+            "unknown keys": '[stages.a]\nimage = "x"\ncommands = [["true"]]\ncolour = "red"\n',
+            "has no image": '[stages.a]\ncommands = [["true"]]\n',
+            "non-empty argv": '[stages.a]\nimage = "x"\ncommands = [[]]\n',
+            "workspace must be": '[stages.a]\nimage = "x"\ncommands = [["true"]]\nworkspace = "home"\n',
+            "paths needs": '[stages.a]\nimage = "x"\ncommands = [["true"]]\nworkspace = "git"\npaths = ["a"]\n',
+            "unknown stage b": '[stages.a]\nimage = "x"\ncommands = [["true"]]\nneeds = ["b"]\n',
+        }
+        for message, text in cases.items():
+            with self.subTest(message), self.assertRaisesRegex(ValueError, message):
+                self.load(text)
+
+
+class TestOrder(unittest.TestCase):
+    """order() puts each stage after what it needs."""
+
+    STAGES = {"a": {}, "b": {"needs": ["a"]}, "c": {"needs": ["b", "a"]}}
+
+    def test_needs_come_first(self):
+        self.assertEqual(declared_stages.order(self.STAGES, ["c"]), ["a", "b", "c"])
+
+    def test_each_stage_once(self):
+        self.assertEqual(declared_stages.order(self.STAGES, ["b", "c", "a"]), ["a", "b", "c"])
+
+    def test_unknown(self):
+        with self.assertRaisesRegex(ValueError, "unknown stage d"):
+            declared_stages.order(self.STAGES, ["d"])
+
+    def test_cycle(self):
+        stages = {"a": {"needs": ["b"]}, "b": {"needs": ["a"]}}
+        with self.assertRaisesRegex(ValueError, "a -> b -> a"):
+            declared_stages.order(stages, ["a"])
+
+
+if __name__ == "__main__":
+    unittest.main()
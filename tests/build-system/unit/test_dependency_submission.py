@@ -0,0 +1,93 @@
+"""
+Unit tests for the dependency submission snapshot (build-system/dependency_submission.py).
+"""
+
+import os
+import subprocess
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import dependency_submission  # noqa: E402
+
+
+REGISTRY = "registry+https://github.com/rust-lang/crates.io-index"
+
+
+def package(name: str, source: str | None = REGISTRY) -> dict:
+    return {"id": name, "name": name, "version": "1.0.0", "source": source}
+
+
+def dep(name: str, *kinds: str | None) -> dict:
+    return {"pkg": name, "dep_kinds": [{"kind": kind} for kind in kinds or (None,)]}
+
+
+# installer -> clap -> strsim; installer -(dev)-> tempfile -> fastrand;
+# installer -> regicide-cli (a path crate) -> anyhow.
+METADATA = {
+    "workspace_members": ["installer"],
+    "packages": [
+        package("installer", None), package("regicide-cli", None), package("clap"), package("strsim"),
+        package("tempfile"), package("fastrand"), package("anyhow"),
+    ],
+    "resolve": {"nodes": [
+        {"id": "installer", "deps": [dep("clap"), dep("tempfile", "dev"), dep("regicide-cli")]},
+        {"id": "regicide-cli", "deps": [dep("anyhow")]},
+        {"id": "clap", "deps": [dep("strsim")]},
+        {"id": "strsim", "deps": []},
+        {"id": "tempfile", "deps": [dep("fastrand")]},
+        {"id": "fastrand", "deps": []},
+        {"id": "anyhow", "deps": []},
+    ]},
+}
+
+
+@mock.patch.object(dependency_submission.run_history, "run_id", return_value="run-1")
+class TestSnapshot(unittest.TestCase):
+    """snapshot() reports registry crates with their relationship and scope."""
+
+    def resolved(self) -> dict:
+        body = dependency_submission.snapshot(METADATA, "abc", "refs/heads/main")
+        self.assertEqual((body["sha"], body["ref"], body["job"]["id"]), ("abc", "refs/heads/main", "run-1"))
+        return body["manifests"]["Cargo.lock"]["resolved"]
+
+    def test_path_crates_are_left_out(self, _run_id):
+        self.assertNotIn("pkg:cargo/installer@1.0.0", self.resolved())
+        self.assertNotIn("pkg:cargo/regicide-cli@1.0.0", self.resolved())
+
+    def test_relationship_and_scope(self, _run_id):
+        shape = {
+            purl.removeprefix("pkg:cargo/").removesuffix("@1.0.0"): (entry["relationship"], entry["scope"])
+            for purl, entry in self.resolved().items()
+        }
+        self.assertEqual(shape, {
+            "anyhow": ("indirect", "runtime"),
+            "clap": ("direct", "runtime"),
+            "fastrand": ("indirect", "development"),
+            "strsim": ("indirect", "runtime"),
+            "tempfile": ("direct", "development"),
+        })
+
+    def test_dependencies(self, _run_id):
+        self.assertEqual(self.resolved()["pkg:cargo/clap@1.0.0"]["dependencies"], ["pkg:cargo/strsim@1.0.0"])
+
+
+
+class TestSubmit(unittest.TestCase):
+    """A failed submission is an infrastructure failure carrying gh's error."""
+
+    @mock.patch.dict(os.environ, {"GITHUB_REPOSITORY": "awdemos/RegicideOS"})
+    def test_gh_failure(self):
+        error = subprocess.CalledProcessError(1, "gh", stderr="HTTP 403: Resource not accessible\n")
+        with mock.patch.object(dependency_submission.subprocess, "run", side_effect=error):
+            with self.assertRaises(dependency_submission.exit_codes.RunFailed) as raised:
+                dependency_submission.submit({"ref": "refs/heads/main", "manifests": {}})
+        self.assertEqual(raised.exception.exit_code, dependency_submission.exit_codes.INFRASTRUCTURE)
+        self.assertIn("HTTP 403: Resource not accessible", str(raised.exception))
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,81 @@
+"""
+Unit tests for the --dist export (build-system/dist.py).
+"""
+
+import asyncio
+import os
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import dist  # noqa: E402
+
+
+class TestCheck(unittest.TestCase):
+    """check() refuses destinations the wipe could cost data in."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.root = Path(self.dir.name).resolve() / "checkout"
+        self.root.mkdir()
+        cwd = os.getcwd()
+        os.chdir(self.root)
+        self.addCleanup(os.chdir, cwd)
+        patcher = mock.patch.object(dist.Path, "home", return_value=Path(self.dir.name).resolve() / "home")
+        patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def test_new_empty_and_marked_directories_pass(self):
+        dist.check(self.root / "dist")
+        (self.root / "empty").mkdir()
+        dist.check(self.root / "empty")
+        (self.root / "dist").mkdir()
+        (self.root / "dist" / dist.MARKER).touch()
+        (self.root / "dist" / "bin").mkdir()
+        dist.check(self.root / "dist")
+
+    def test_refuses_unmarked_non_empty_directory(self):
+        (self.root / "notes").mkdir()
+        (self.root / "notes" / "todo.txt").write_text("keep me")
+        with self.assertRaisesRegex(ValueError, "not empty"):
+            dist.check(self.root / "notes")
+
+    def test_refuses_source_root_home_and_their_parents(self):
+        for dest in (self.root, self.root.parent, Path.home(), Path("/")):
+            with self.subTest(dest=dest), self.assertRaisesRegex(ValueError, "would replace"):
+                dist.check(dest)
+
+    def test_refuses_file(self):
+        (self.root / "dist").write_text("")
+        with self.assertRaisesRegex(ValueError, "not a directory"):
+            dist.check(self.root / "dist")
+
+
+class TestExport(unittest.TestCase):
+    """export() checks the destination before wiping it and leaves the marker."""
+
+    def test_refused_destination_is_not_touched(self):
+        client = mock.MagicMock()
+        with tempfile.TemporaryDirectory() as name:
+            (Path(name) / "keep.txt").write_text("")
+            with self.assertRaises(ValueError):
+                asyncio.run(dist.export(client, {}, Path(name)))
+        client.directory.assert_not_called()
+
+    def test_writes_marker(self):
+        client = mock.MagicMock()
+        directory = client.directory.return_value.with_new_file.return_value
+        directory.export = mock.AsyncMock()
+        with tempfile.TemporaryDirectory() as name, mock.patch.object(dist, "produced", return_value=[]):
+            asyncio.run(dist.export(client, {}, Path(name) / "dist"))
+            directory.export.assert_awaited_once_with(str(Path(name) / "dist"), wipe=True)
+        self.assertEqual(client.directory.return_value.with_new_file.call_args.args[0], dist.MARKER)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,51 @@
+"""
+Unit tests for the progress events (build-system/events.py).
+"""
+
+import json
+import os
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import events  # noqa: E402
+
+
+class TestRunEvents(unittest.TestCase):
+    """start_run() and finish_run() bracket a run exactly once."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.path = Path(self.dir.name) / "events.jsonl"
+        patcher = mock.patch.dict(os.environ, {"REGICIDE_EVENTS": str(self.path)})
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        self.addCleanup(setattr, events, "_running", False)
+
+    def emitted(self) -> list[dict]:
+        if not self.path.exists():
+            return []
+        return [json.loads(line) for line in self.path.read_text().splitlines()]
+
+    def test_finish_without_start_emits_nothing(self):
+        events.finish_run("cancelled")
+        self.assertEqual(self.emitted(), [])
+
+    def test_run_is_bracketed_once(self):
+        events.start_run(["dagger_pipeline.py", "--rustfmt"])
+        self.assertTrue(events.running())
+        events.finish_run("failed")
+        events.finish_run("failed")
+        self.assertFalse(events.running())
+        self.assertEqual([(e["event"], e.get("status")) for e in self.emitted()],
+                         [("run-started", None), ("run-finished", "failed")])
+        self.assertEqual(self.emitted()[0]["argv"], ["dagger_pipeline.py", "--rustfmt"])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,88 @@
+"""
+Unit tests for the exit code contract (build-system/exit_codes.py).
+"""
+
+import sys
+import unittest
+from pathlib import Path
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import dagger_pipeline  # noqa: E402
+import exit_codes  # noqa: E402
+
+
+def failed(stage, stderr="", exit_code=1):
+    return exit_codes.failure_bundle.StageFailed(stage, exit_code, stderr, Path("bundle"))
+
+
+class TestForFailure(unittest.TestCase):
+    """for_failure() maps a failed step to its class: uploads first, then category, then step name."""
+
+    def test_uploads_are_infrastructure(self):
+        for stage in ("coverage-upload", "coverage-upload-install", "binpkg-push", "sign-image",
+                      "attest-image-slsaprovenance"):
+            with self.subTest(stage=stage):
+                self.assertEqual(exit_codes.for_failure(failed(stage, "error: compilation failed")),
+                                 exit_codes.INFRASTRUCTURE)
+
+    def test_category_beats_step_name(self):
+        self.assertEqual(exit_codes.for_failure(failed("cargo-tests", exit_code=137)), exit_codes.INFRASTRUCTURE)
+        self.assertEqual(
+            exit_codes.for_failure(failed("clippy", "Could not resolve host: crates.io")), exit_codes.INFRASTRUCTURE
+        )
+
+    def test_step_names(self):
+        for stage, code in (
+            ("security-trivy", exit_codes.SECURITY_GATE),
+            ("rescan-artifacts", exit_codes.SECURITY_GATE),
+            ("cargo-deny", exit_codes.POLICY_GATE),
+            ("cargo-tests-2", exit_codes.TEST_FAILURE),
+            ("overlay-openrc", exit_codes.TEST_FAILURE),
+            ("static-verify", exit_codes.STAGE_FAILED),
+        ):
+            with self.subTest(stage=stage):
+                self.assertEqual(exit_codes.for_failure(failed(stage)), code)
+
+
+class TestRunFailed(unittest.TestCase):
+    """RunFailed carries its step and exit code next to the message."""
+
+    def test_fields(self):
+        exc = exit_codes.RunFailed("release-upload", exit_codes.INFRASTRUCTURE, "gh: HTTP 502")
+        self.assertEqual((exc.stage, exc.exit_code, str(exc)), ("release-upload", 3, "gh: HTTP 502"))
+
+    def test_codes_are_stable(self):
+        self.assertEqual(
+            [exit_codes.OK, exit_codes.STAGE_FAILED, exit_codes.CONFIG_ERROR, exit_codes.INFRASTRUCTURE,
+             exit_codes.TEST_FAILURE, exit_codes.SECURITY_GATE, exit_codes.POLICY_GATE, exit_codes.CANCELLED],
+            [0, 1, 2, 3, 4, 5, 6, 130],
+        )
+        for code in (0, 1, 2, 3, 4, 5, 6, 130):
+            self.assertRegex(exit_codes.HELP, rf"\n  {code} ")
+
+
+
+class TestRunHost(unittest.TestCase):
+    """A failed host-side step of the image build exits with its class instead of a traceback."""
+
+    def run_host(self, stage):
+        with self.assertRaises(exit_codes.RunFailed) as raised:
+            dagger_pipeline._run_host(stage, ["sh", "-c", "exit 3"])
+        self.assertEqual(raised.exception.stage, stage)
+        return raised.exception.exit_code
+
+    def test_verification_steps_are_test_failures(self):
+        for stage in exit_codes.HOST_TEST_STEPS:
+            with self.subTest(stage=stage):
+                self.assertEqual(self.run_host(stage), exit_codes.TEST_FAILURE)
+
+    def test_build_steps_are_stage_failures(self):
+        self.assertEqual(self.run_host("squashfs"), exit_codes.STAGE_FAILED)
+
+    def test_success(self):
+        dagger_pipeline._run_host("squashfs", ["true"])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,50 @@
+"""
+Unit tests for the heartbeat and engine-log helpers in build-system/failure_bundle.py.
+"""
+
+import io
+import sys
+import time
+import unittest
+from pathlib import Path
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import failure_bundle  # noqa: E402
+
+
+class TestHeartbeatLine(unittest.TestCase):
+    """heartbeat_line() names the stage and the elapsed time, then quotes the output."""
+
+    def test_without_output(self):
+        self.assertEqual(
+            failure_bundle.heartbeat_line("stage3", 185.7, ""),
+            "[heartbeat] stage3 still running (3m05s elapsed)",
+        )
+
+    def test_quotes_last_output(self):
+        line = failure_bundle.heartbeat_line("stage3", 60, ">>> Compiling source in /var/tmp/portage")
+        self.assertTrue(line.endswith("; last output: >>> Compiling source in /var/tmp/portage"))
+
+    def test_truncates_long_output(self):
+        line = failure_bundle.heartbeat_line("stage3", 60, "x" * 300)
+        self.assertTrue(line.endswith("x" * 97 + "..."))
+
+
+class TestEngineLog(unittest.TestCase):
+    """EngineLog copies engine output through and keeps its last non-blank line."""
+
+    def test_copies_and_tails(self):
+        target = io.StringIO()
+        log = failure_bundle.EngineLog(target)
+        log.file.write("\x1b[1m5: exec emerge @world\x1b[0m\n\n")
+        log.file.flush()
+        deadline = time.monotonic() + 5
+        while not log.last_line and time.monotonic() < deadline:
+            time.sleep(0.01)
+        self.assertEqual(log.last_line, "5: exec emerge @world")
+        self.assertIn("emerge @world", target.getvalue())
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,49 @@
+"""
+Unit tests for nightly failure signatures (build-system/failure_issues.py).
+"""
+
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import failure_issues  # noqa: E402
+
+
+class TestFailureSignature(unittest.TestCase):
+    """Failures with the same cause share a signature across runs."""
+
+    def test_run_specific_noise_is_ignored(self):
+        first = "error: linking /tmp/cargo-abc123/out failed\ncontainer 3f9a2c7d8e1b exited with 101"
+        second = "error: linking /tmp/cargo-zzz999/out failed\ncontainer 0011aabbccdd exited with 137"
+        self.assertEqual(
+            failure_issues.failure_signature("clippy", first), failure_issues.failure_signature("clippy", second)
+        )
+
+    def test_stage_and_cause_matter(self):
+        signature = failure_issues.failure_signature("clippy", "error: unused variable")
+        self.assertTrue(signature.startswith("clippy:"))
+        self.assertNotEqual(signature, failure_issues.failure_signature("coverage", "error: unused variable"))
+        self.assertNotEqual(signature, failure_issues.failure_signature("clippy", "error: mismatched types"))
+
+    def test_only_the_tail_counts(self):
+        tail = "\n".join(f"line {chr(97 + i)}" for i in range(failure_issues.SIGNATURE_LINES))
+        self.assertEqual(
+            failure_issues.failure_signature("soak", f"early noise\n{tail}"),
+            failure_issues.failure_signature("soak", tail),
+        )
+
+    def test_bundle_link(self):
+        variables = {"GITHUB_REPOSITORY": "awdemos/RegicideOS", "GITHUB_RUN_ID": "42", "GITHUB_SERVER_URL": ""}
+        with mock.patch.dict(os.environ, variables):
+            del os.environ["GITHUB_SERVER_URL"]
+            self.assertEqual(failure_issues._bundle_link(), "https://github.com/awdemos/RegicideOS/actions/runs/42")
+        with mock.patch.dict(os.environ, {"GITHUB_RUN_ID": ""}):
+            self.assertIn("local run", failure_issues._bundle_link())
+
+
+if __name__ == "__main__":
+    unittest.main()
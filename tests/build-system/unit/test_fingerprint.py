@@ -0,0 +1,82 @@
+"""
+Unit tests for the input fingerprints (build-system/fingerprint.py).
+"""
+
+import os
+import subprocess
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import fingerprint  # noqa: E402
+
+
+def git(*argv: str) -> None:
+    subprocess.run(["git", *argv], check=True, capture_output=True)
+
+
+class TestSourceDigests(unittest.TestCase):
+    """source_digests() hashes each top-level area of the working tree."""
+
+    def setUp(self):
+        self.cwd = os.getcwd()
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        os.chdir(self.dir.name)
+        self.addCleanup(os.chdir, self.cwd)
+        git("init", "-q")
+        Path("installer").mkdir()
+        Path("installer/main.rs").write_text("fn main() {}\n")
+        Path("README.md").write_text("readme\n")
+        git("add", ".")
+
+    def test_areas(self):
+        self.assertEqual(sorted(fingerprint.source_digests()), [".", "installer"])
+
+    def test_edit_changes_only_its_area(self):
+        before = fingerprint.source_digests()
+        Path("installer/main.rs").write_text("fn main() { todo!() }\n")
+        after = fingerprint.source_digests()
+        self.assertNotEqual(before["installer"], after["installer"])
+        self.assertEqual(before["."], after["."])
+
+    def test_outputs_are_ignored(self):
+        before = fingerprint.source_digests()
+        Path("target").mkdir()
+        Path("target/debug.bin").write_text("build output\n")
+        self.assertEqual(fingerprint.source_digests(), before)
+
+    def test_outside_git(self):
+        with mock.patch.object(fingerprint, "_run", side_effect=subprocess.CalledProcessError(128, "git")):
+            self.assertEqual(fingerprint.source_digests(), {})
+
+
+class TestEnvironment(unittest.TestCase):
+    """environment() names every component and hides secrets."""
+
+    @mock.patch.object(fingerprint, "source_digests", return_value={".": "aaaa"})
+    @mock.patch.object(fingerprint.image_lock, "load", return_value={"debian:bookworm": "sha256:1"})
+    @mock.patch.object(fingerprint.image_overrides, "configured", return_value={})
+    @mock.patch.object(fingerprint, "tools", return_value={"python": "3.11"})
+    def test_components(self, *_mocks):
+        variables = {"REGICIDE_ARCH": "arm64", "REGICIDE_SIGNING_KEY": "hunter2", "REGICIDE_RUN_ID": "7"}
+        with mock.patch.dict(os.environ, variables):
+            components = fingerprint.environment()
+        self.assertEqual(components["source/."], "aaaa")
+        self.assertEqual(components["image/debian:bookworm"], "sha256:1")
+        self.assertEqual(components["tool/python"], "3.11")
+        self.assertEqual(components["env/REGICIDE_ARCH"], "arm64")
+        self.assertEqual(components["env/REGICIDE_SIGNING_KEY"], fingerprint._digest(b"hunter2"))
+        self.assertNotIn("env/REGICIDE_RUN_ID", components)
+        self.assertEqual(
+            {name for name in components if name.startswith("config/")},
+            {f"config/{path.name}" for path in fingerprint.CONFIG_FILES},
+        )
+
+
+if __name__ == "__main__":
+    unittest.main()
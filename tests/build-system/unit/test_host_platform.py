@@ -0,0 +1,71 @@
+"""
+Unit tests for host platform support (build-system/host_platform.py).
+"""
+
+import os
+import subprocess
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import host_platform  # noqa: E402
+
+
+class TestDockerHost(unittest.TestCase):
+    """configure() points DOCKER_HOST at the first runtime socket found."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.present = set()
+        self.home = Path(self.dir.name)
+        candidates = [str(self.home / "a.sock"), str(self.home / "b.sock")]
+        for patcher in (
+            mock.patch.object(host_platform.sys, "platform", "darwin"),
+            mock.patch.object(host_platform, "SOCKET_CANDIDATES", candidates),
+            mock.patch.object(host_platform.Path, "exists", autospec=True, side_effect=self.exists),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def exists(self, path):
+        return str(path) in self.present
+
+    def test_default_socket_needs_nothing(self):
+        self.present = {"/var/run/docker.sock", str(self.home / "a.sock")}
+        self.assertIsNone(host_platform.docker_host())
+
+    def test_first_candidate_wins(self):
+        self.present = {str(self.home / "a.sock"), str(self.home / "b.sock")}
+        self.assertEqual(host_platform.docker_host(), f"unix://{self.home / 'a.sock'}")
+
+    def test_configure_keeps_an_explicit_docker_host(self):
+        self.present = {str(self.home / "b.sock")}
+        with mock.patch.dict(os.environ, {"DOCKER_HOST": "tcp://remote:2375"}, clear=True):
+            host_platform.configure()
+            self.assertEqual(os.environ["DOCKER_HOST"], "tcp://remote:2375")
+        with mock.patch.dict(os.environ, {}, clear=True):
+            host_platform.configure()
+            self.assertEqual(os.environ["DOCKER_HOST"], f"unix://{self.home / 'b.sock'}")
+
+
+class TestCrlfFiles(unittest.TestCase):
+    """crlf_files() lists checked-out files with CRLF line endings."""
+
+    def test_parses_ls_files(self):
+        listed = "i/lf    w/crlf  attr/text eol=lf\tci.sh\0i/lf    w/lf    attr/text eol=lf\tok.sh\0"
+        with mock.patch.object(host_platform.subprocess, "run", return_value=mock.Mock(stdout=listed)):
+            self.assertEqual(host_platform.crlf_files(Path(".")), ["ci.sh"])
+
+    def test_outside_git(self):
+        error = subprocess.CalledProcessError(128, "git")
+        with mock.patch.object(host_platform.subprocess, "run", side_effect=error):
+            self.assertEqual(host_platform.crlf_files(Path(".")), [])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,104 @@
+"""
+Unit tests for the image diff (build-system/image_diff.py).
+"""
+
+import gzip
+import json
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import image_diff  # noqa: E402
+
+
+def image(packages, files, sizes=None, arch="amd64"):
+    return {"arch": arch, "sizes": sizes or {}, "packages": packages, "files": files}
+
+
+class TestSplitPackage(unittest.TestCase):
+    """split_package() splits category/PF at the Gentoo version."""
+
+    def test_versions(self):
+        for cpf, expected in (
+            ("sys-apps/systemd-256.7", ("sys-apps/systemd", "256.7")),
+            ("dev-lang/rust-bin-1.83.0-r1/", ("dev-lang/rust-bin", "1.83.0-r1")),
+            ("app-misc/foo-2-1.0_rc2_p1", ("app-misc/foo-2", "1.0_rc2_p1")),
+            ("sys-libs/glibc-2.40a", ("sys-libs/glibc", "2.40a")),
+            ("virtual/no-version", ("virtual/no-version", "")),
+        ):
+            with self.subTest(cpf=cpf):
+                self.assertEqual(image_diff.split_package(cpf), expected)
+
+
+class TestPrevious(unittest.TestCase):
+    """previous() only compares against earlier passed runs of the same arch."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.summaries = []
+        for patcher in (
+            mock.patch.object(image_diff.run_history, "RUNS_DIR", Path(self.dir.name)),
+            mock.patch.object(image_diff.run_history, "recent_summaries", side_effect=lambda limit: self.summaries),
+            mock.patch.object(image_diff.run_history, "run_id", return_value="4"),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def run_with_image(self, run, status, arch="amd64"):
+        path = Path(self.dir.name) / run / image_diff.MANIFEST
+        path.parent.mkdir()
+        with gzip.open(path, "wt") as f:
+            json.dump(image({}, {}, arch=arch), f)
+        summary = {"run": run, "status": status}
+        self.summaries.append(summary)
+        return summary
+
+    def test_skips_failed_other_arch_and_current_runs(self):
+        passed = self.run_with_image("1", "passed")
+        self.run_with_image("2", "failed")
+        self.run_with_image("3", "passed", arch="arm64")
+        self.run_with_image("4", "passed")
+        self.assertEqual(image_diff.previous("amd64")[0], passed)
+
+    def test_none_without_a_passed_build(self):
+        self.run_with_image("1", "failed")
+        self.assertIsNone(image_diff.previous("amd64"))
+
+
+class TestReport(unittest.TestCase):
+    """report() summarizes size, package and file changes."""
+
+    def test_report(self):
+        before = image(
+            {"sys-apps/systemd": ["255"], "app-misc/gone": ["1"]},
+            {"usr/bin/systemctl": 1000, "usr/bin/gone": 2048},
+            {"squashfs": 4096},
+        )
+        after = image(
+            {"sys-apps/systemd": ["256"], "app-misc/new": ["2"]},
+            {"usr/bin/systemctl": 3000, "usr/bin/new": 10},
+            {"squashfs": 2048},
+        )
+        with mock.patch.object(image_diff.run_history, "run_id", return_value="2"):
+            markdown, files = image_diff.report({"run": "1", "commit": "0123456789abcdef"}, before, after)
+        self.assertIn("compared with run `1` (commit `0123456789ab`).", markdown)
+        self.assertIn("| squashfs | 4.0 KiB | 2.0 KiB | -2.0 KiB (-50.0%) |", markdown)
+        self.assertIn("2 installed: 1 added, 1 removed, 1 changed version.", markdown)
+        self.assertIn("| sys-apps/systemd | 255 | 256 |", markdown)
+        self.assertIn("- app-misc/new 2", markdown)
+        self.assertIn("- app-misc/gone 1", markdown)
+        self.assertIn("1 added (0.0 KiB), 1 removed (2.0 KiB), 1 changed size.", markdown)
+        self.assertEqual(files.splitlines(), [
+            "added\t10\t/usr/bin/new",
+            "removed\t2048\t/usr/bin/gone",
+            "resized\t1000 -> 3000\t/usr/bin/systemctl",
+        ])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,125 @@
+"""
+Unit tests for the pinned image digests (build-system/image_lock.py).
+"""
+
+import json
+import os
+import subprocess
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import ci  # noqa: E402
+import image_lock  # noqa: E402
+
+DIGEST = "sha256:" + "a" * 64
+OLD_DIGEST = "sha256:" + "b" * 64
+
+
+class TestTrackedImages(unittest.TestCase):
+    """TRACKED_IMAGES stays sorted and free of duplicates."""
+
+    def test_sorted(self):
+        self.assertEqual(image_lock.TRACKED_IMAGES, sorted(set(image_lock.TRACKED_IMAGES)))
+
+
+class TestLock(unittest.TestCase):
+    """pinned() and known_good() read the lock files."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        root = Path(self.dir.name)
+        for name, path in [("LOCK_PATH", root / "images.lock.json"),
+                           ("KNOWN_GOOD_PATH", root / "images.known-good.json")]:
+            patcher = mock.patch.object(image_lock, name, path)
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def test_pinned(self):
+        image_lock.save({"alpine:latest": DIGEST})
+        self.assertEqual(image_lock.pinned("alpine:latest"), f"alpine:latest@{DIGEST}")
+        self.assertEqual(image_lock.pinned("rust:1"), "rust:1")
+        self.assertEqual(image_lock.pinned(f"rust:1@{OLD_DIGEST}"), f"rust:1@{OLD_DIGEST}")
+
+    def test_known_good_keeps_the_digest_a_bump_replaced(self):
+        old = {"alpine:latest": OLD_DIGEST, "rust:1": DIGEST}
+        new = {"alpine:latest": DIGEST, "rust:1": DIGEST}
+        image_lock.save_known_good(old, new)
+        image_lock.save(new)
+        self.assertEqual(json.loads(image_lock.KNOWN_GOOD_PATH.read_text()), {"alpine:latest": OLD_DIGEST})
+        self.assertEqual(image_lock.known_good("alpine:latest"), OLD_DIGEST)
+        self.assertIsNone(image_lock.known_good("rust:1"))
+
+
+
+class TestBump(unittest.TestCase):
+    """ci.images_bump() writes the lock on its own branch and returns to the one checked out."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        root = Path(self.dir.name)
+        origin, self.clone = root / "origin.git", root / "clone"
+        git = ["git", "-c", "init.defaultBranch=main"]
+        subprocess.run([*git, "init", "--quiet", "--bare", str(origin)], check=True)
+        subprocess.run([*git, "clone", "--quiet", str(origin), str(self.clone)], check=True, capture_output=True)
+        self.git("config", "user.email", "ci@example.com")
+        self.git("config", "user.name", "CI")
+        (self.clone / "images.lock.json").write_text(json.dumps({"alpine:latest": OLD_DIGEST}) + "\n")
+        (self.clone / "images.known-good.json").write_text("{}\n")
+        self.git("add", ".")
+        self.git("commit", "--quiet", "-m", "lock")
+        self.git("push", "--quiet", "origin", "main")
+        self.git("switch", "--quiet", "--create", "work")
+
+        cwd = os.getcwd()
+        os.chdir(self.clone)
+        self.addCleanup(os.chdir, cwd)
+        self.gh = mock.MagicMock(return_value="https://example.com/pr/1\n")
+        for patcher in (
+            mock.patch.object(image_lock, "LOCK_PATH", self.clone / "images.lock.json"),
+            mock.patch.object(image_lock, "KNOWN_GOOD_PATH", self.clone / "images.known-good.json"),
+            mock.patch.object(ci, "resolve_digests", mock.AsyncMock(return_value={"alpine:latest": DIGEST})),
+            mock.patch.object(ci, "run_pipeline", return_value=0),
+            mock.patch.object(ci, "_gh", self.gh),
+            mock.patch.object(ci.run_history, "RUNS_DIR", root / "runs"),
+            mock.patch.object(ci.run_history, "recent_summaries", return_value=[]),
+            mock.patch("builtins.print"),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def git(self, *args):
+        return subprocess.run(["git", *args], cwd=self.clone, check=True, capture_output=True, text=True).stdout
+
+    def test_bump_branch_leaves_the_checkout_alone(self):
+        self.assertEqual(ci.images_bump([], "main"), 0)
+        self.assertEqual(self.git("rev-parse", "--abbrev-ref", "HEAD").strip(), "work")
+        self.assertEqual(self.git("status", "--porcelain"), "")
+        branch = self.gh.call_args.args[self.gh.call_args.args.index("--head") + 1]
+        self.assertIn(DIGEST, self.git("show", f"origin/{branch}:images.lock.json"))
+        self.assertIn(OLD_DIGEST, self.git("show", f"origin/{branch}:images.known-good.json"))
+
+    def test_second_bump_of_the_day_gets_its_own_branch(self):
+        ci.images_bump([], "main")
+        first = self.gh.call_args.args[self.gh.call_args.args.index("--head") + 1]
+        ci.images_bump([], "main")
+        second = self.gh.call_args.args[self.gh.call_args.args.index("--head") + 1]
+        self.assertEqual(second, f"{first}-2")
+
+    def test_failed_bump_leaves_no_branch(self):
+        with mock.patch.object(ci, "run_pipeline", side_effect=OSError("no dagger")):
+            with self.assertRaises(OSError):
+                ci.images_bump([], "main")
+        self.assertEqual(self.git("rev-parse", "--abbrev-ref", "HEAD").strip(), "work")
+        self.assertEqual(self.git("status", "--porcelain"), "")
+        self.assertEqual(self.git("branch", "--list", f"{ci.BUMP_BRANCH_PREFIX}*"), "")
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,83 @@
+"""
+Unit tests for per-run image overrides (build-system/image_overrides.py).
+"""
+
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import image_overrides  # noqa: E402
+
+
+class TestImageOverrides(unittest.TestCase):
+    """Overrides apply to every stage or one; --image-override wins over the file."""
+
+    def setUp(self):
+        for patcher in (
+            mock.patch.object(image_overrides, "_overrides", {}),
+            mock.patch.object(image_overrides, "_used", set()),
+            mock.patch.object(image_overrides.run_history, "record_image_override"),
+            mock.patch("sys.stderr"),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+        self.record = image_overrides.run_history.record_image_override
+
+    def in_stage(self, stage: str | None, ref: str) -> str | None:
+        with mock.patch.object(image_overrides.events, "current_stage", return_value=stage):
+            return image_overrides.resolve(ref)
+
+    def load(self, text: str) -> None:
+        with tempfile.TemporaryDirectory() as tmp:
+            path = Path(tmp) / "overrides.toml"
+            path.write_text(text)
+            image_overrides.load(path)
+
+    def test_file_and_flag(self):
+        self.load(
+            '[images]\n"debian:bookworm" = "mirror/debian:bookworm"\n'
+            '[stages.security-scan]\n"aquasec/trivy:latest" = "mirror/trivy:0.56.2"\n'
+        )
+        image_overrides.add("debian:bookworm=local/debian")
+        self.assertEqual(image_overrides.configured(), {
+            "*/debian:bookworm": "local/debian",
+            "security-scan/aquasec/trivy:latest": "mirror/trivy:0.56.2",
+        })
+
+    def test_stage_override_wins_over_images(self):
+        image_overrides.add("rust:1=global/rust")
+        image_overrides.add("clippy::rust:1=clippy/rust")
+        self.assertEqual(self.in_stage("clippy", "rust:1"), "clippy/rust")
+        self.assertEqual(self.in_stage("os-image", "rust:1"), "global/rust")
+        self.assertEqual(self.in_stage(None, "rust:1"), "global/rust")
+        self.assertIsNone(self.in_stage("clippy", "debian:bookworm"))
+
+    def test_first_use_per_stage_is_recorded(self):
+        image_overrides.add("rust:1=global/rust")
+        self.in_stage("clippy", "rust:1")
+        self.in_stage("clippy", "rust:1")
+        self.in_stage("coverage", "rust:1")
+        self.assertEqual(
+            [call.args for call in self.record.call_args_list],
+            [("clippy", "rust:1", "global/rust"), ("coverage", "rust:1", "global/rust")],
+        )
+
+    def test_reference_with_port(self):
+        image_overrides.add("scan::registry:5000/trivy:1=mirror/trivy")
+        self.assertEqual(image_overrides.configured(), {"scan/registry:5000/trivy:1": "mirror/trivy"})
+
+    def test_malformed(self):
+        for spec in ("rust:1", "rust:1=", "clippy::=img"):
+            with self.subTest(spec), self.assertRaisesRegex(ValueError, "expects"):
+                image_overrides.add(spec)
+        for text in ('[registry]\n"a" = "b"\n', '[images]\n"a" = ""\n', "not toml ["):
+            with self.subTest(text), self.assertRaises(ValueError):
+                self.load(text)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,61 @@
+"""
+Unit tests for the JUnit report helpers (build-system/junit_report.py).
+"""
+
+import os
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import junit_report  # noqa: E402
+
+
+SHARD_1 = """<?xml version="1.0"?>
+<testsuites>
+  <testsuite name="btrmind">
+    <testcase name="learns" time="1.25"/>
+    <testcase name="acts" time="0.5"><failure message="boom"/></testcase>
+  </testsuite>
+</testsuites>
+"""
+SHARD_2 = """<testsuite name="installer">
+  <testcase name="partitions" time="2"><error/></testcase>
+  <testcase name="tui" time="0"><skipped/></testcase>
+</testsuite>
+"""
+
+
+class TestJunitReport(unittest.TestCase):
+    """merge() combines shards; summarize() and markdown() report on them."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.report = Path(self.dir.name) / "junit.xml"
+        self.report.write_text(junit_report.merge([SHARD_1, SHARD_2]))
+
+    def test_summarize_merged(self):
+        self.assertEqual(junit_report.summarize(self.report), {
+            "tests": 4, "failed": 2, "skipped": 1, "seconds": 3.8,
+            "failures": ["btrmind::acts", "installer::partitions"],
+        })
+
+    def test_markdown(self):
+        text = junit_report.markdown("Tests", junit_report.summarize(self.report))
+        self.assertIn("1 passed, 2 failed, 1 skipped (3.8s)", text)
+        self.assertIn("- `installer::partitions`", text)
+
+    def test_publish_appends_to_step_summary(self):
+        step_summary = Path(self.dir.name) / "summary.md"
+        step_summary.write_text("earlier\n")
+        with mock.patch.dict(os.environ, {"GITHUB_STEP_SUMMARY": str(step_summary)}):
+            junit_report.publish("Tests", self.report)
+        self.assertTrue(step_summary.read_text().startswith("earlier\n### Tests\n"))
+
+
+if __name__ == "__main__":
+    unittest.main()
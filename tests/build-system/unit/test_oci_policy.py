@@ -0,0 +1,56 @@
+"""
+Unit tests for the OCI label policy (build-system/oci_policy.py).
+"""
+
+import sys
+import unittest
+from pathlib import Path
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import oci_policy  # noqa: E402
+
+
+GOOD = {
+    "org.opencontainers.image.source": "https://github.com/awdemos/RegicideOS",
+    "org.opencontainers.image.revision": "0123456789abcdef0123456789abcdef01234567",
+    "org.opencontainers.image.licenses": "GPL-3.0",
+    "org.opencontainers.image.description": "RegicideOS build image",
+}
+
+
+class TestViolations(unittest.TestCase):
+    """violations() reports missing, empty and malformed labels."""
+
+    def test_committed_policy_loads(self):
+        policy = oci_policy.load_policy()
+        self.assertIn("org.opencontainers.image.source", policy["required"])
+        self.assertIn("org.opencontainers.image.revision", policy["patterns"])
+
+    def test_good_labels(self):
+        self.assertEqual(oci_policy.violations(GOOD), [])
+        oci_policy.enforce("image", GOOD)
+
+    def test_missing_and_empty(self):
+        labels = {**GOOD, "org.opencontainers.image.licenses": "  "}
+        del labels["org.opencontainers.image.description"]
+        problems = oci_policy.violations(labels)
+        self.assertEqual(len(problems), 2)
+        self.assertTrue(all(problem.startswith("missing ") for problem in problems))
+
+    def test_pattern_mismatch(self):
+        labels = {**GOOD, "org.opencontainers.image.revision": "main"}
+        problems = oci_policy.violations(labels)
+        self.assertEqual(len(problems), 1)
+        self.assertIn("does not match", problems[0])
+        with self.assertRaises(oci_policy.PolicyViolation) as raised:
+            oci_policy.enforce("image", labels)
+        self.assertEqual(raised.exception.problems, problems)
+
+    def test_explicit_policy(self):
+        policy = {"required": {"a": "why"}, "patterns": {}}
+        self.assertEqual(oci_policy.violations({}, policy), ["missing a (why)"])
+
+
+if __name__ == "__main__":
+    unittest.main()
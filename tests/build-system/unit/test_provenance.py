@@ -0,0 +1,84 @@
+"""
+Unit tests for the SLSA provenance (build-system/provenance.py).
+"""
+
+import os
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import provenance  # noqa: E402
+
+
+class TestProvenance(unittest.TestCase):
+    """statement() describes the produced files, the builder and the materials."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.output = Path(self.dir.name)
+        self.lock = self.output / "Cargo.lock"
+        self.lock.write_text("# lock\n")
+        (self.output / "bin").mkdir()
+        self.binary = self.output / "bin" / "btrmind"
+        self.binary.write_text("elf")
+        for patcher in (
+            mock.patch.object(provenance.artifacts, "OUTPUT_DIR", self.output),
+            mock.patch.object(provenance, "PATH", self.output / "provenance.intoto.json"),
+            mock.patch.object(provenance.stage_memo, "changed", return_value=[self.binary]),
+            mock.patch.object(provenance.stage_memo, "reused", return_value=[]),
+            mock.patch.object(provenance.build_info, "git_sha", return_value="0123abc"),
+            mock.patch.object(provenance.build_info, "git_ref", return_value="refs/heads/main"),
+            mock.patch.object(provenance.workspace_checks, "CARGO_LOCK", self.lock),
+            mock.patch.object(
+                provenance.image_lock, "load", return_value={"rust:1": "sha256:aaa", "trivy:1": "sha256:bbb"}
+            ),
+            mock.patch.object(provenance.failure_bundle, "fallbacks", return_value={"trivy:1": "sha256:ccc"}),
+            mock.patch.object(provenance.run_history, "image_overrides", return_value=[
+                {"stage": "clippy", "ref": "rust:1", "image": "rust:2@sha256:ddd"},
+                {"stage": "os-image", "ref": "rust:1", "image": "rust:nightly"},
+            ]),
+            mock.patch.object(provenance.run_history, "started", return_value=0.0),
+            mock.patch.object(provenance.run_history, "fingerprint", return_value={"source": "1"}),
+            mock.patch.object(provenance.toolchain_report, "tools", return_value={"rustc": "1.83.0"}),
+            mock.patch.dict(os.environ, {"GITHUB_WORKFLOW_REF": "o/r/.github/workflows/ci.yml@refs/heads/main",
+                                         "GITHUB_RUN_ID": "7"}, clear=True),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def test_subjects(self):
+        self.assertEqual(provenance.statement({})["subject"], [
+            {"name": "bin/btrmind", "digest": {"sha256": provenance.run_history.sha256(self.binary)}},
+        ])
+
+    def test_materials_prefer_fallbacks_and_list_overrides(self):
+        uris = {entry["uri"]: entry.get("digest") for entry in provenance.materials()}
+        self.assertEqual(uris["docker://rust:1"], {"sha256": "aaa"})
+        self.assertEqual(uris["docker://trivy:1"], {"sha256": "ccc"})
+        self.assertEqual(uris["docker://rust:2@sha256:ddd"], {"sha256": "ddd"})
+        self.assertIsNone(uris["docker://rust:nightly"])
+        self.assertEqual(uris[f"git+{provenance.build_info.SOURCE_URL}@refs/heads/main"], {"gitCommit": "0123abc"})
+
+    def test_materials_record_the_lockfile_only_when_committed(self):
+        source = f"git+{provenance.build_info.SOURCE_URL}@refs/heads/main"
+        uris = {entry["uri"]: entry.get("digest") for entry in provenance.materials()}
+        self.assertEqual(uris[f"{source}#{self.lock.as_posix()}"], {"sha256": provenance.run_history.sha256(self.lock)})
+        self.lock.unlink()
+        self.assertNotIn(f"{source}#{self.lock.as_posix()}", [entry["uri"] for entry in provenance.materials()])
+
+    def test_run_details(self):
+        details = provenance.statement({})["predicate"]["runDetails"]
+        self.assertEqual(details["builder"], {
+            "id": "https://github.com/o/r/.github/workflows/ci.yml@refs/heads/main", "version": {"rustc": "1.83.0"},
+        })
+        self.assertEqual(details["metadata"]["startedOn"], "1970-01-01T00:00:00Z")
+        self.assertTrue(details["metadata"]["invocationId"].endswith("/actions/runs/7/attempts/1"))
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,53 @@
+"""
+Unit tests for the btrmind image push (build-system/publish.py).
+"""
+
+import asyncio
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import publish  # noqa: E402
+
+
+class TestCredentials(unittest.TestCase):
+    """credentials() prefers GHCR_* and needs both a user and a token."""
+
+    def credentials(self, **environ):
+        with mock.patch.dict(os.environ, environ, clear=True):
+            return publish.credentials()
+
+    def test_prefers_ghcr_variables(self):
+        self.assertEqual(
+            self.credentials(GHCR_USER="bot", GHCR_TOKEN="g", GITHUB_ACTOR="me", GITHUB_TOKEN="t"), ("bot", "g")
+        )
+
+    def test_falls_back_to_github_variables(self):
+        self.assertEqual(self.credentials(GITHUB_ACTOR="me", GITHUB_TOKEN="t"), ("me", "t"))
+
+    def test_needs_both(self):
+        self.assertIsNone(self.credentials(GITHUB_TOKEN="t"))
+        self.assertIsNone(self.credentials(GITHUB_ACTOR="me"))
+
+
+class TestPush(unittest.TestCase):
+    """push() tags the image with the commit and the version, authenticated by a secret."""
+
+    def test_tags(self):
+        client, image = mock.MagicMock(), mock.MagicMock()
+        authed = image.with_registry_auth.return_value
+        authed.publish = mock.AsyncMock(side_effect=lambda ref: f"{ref}@sha256:abc")
+        with mock.patch.dict(os.environ, {"GITHUB_ACTOR": "me", "GITHUB_TOKEN": "t"}, clear=True), \
+                mock.patch.object(publish.build_info, "git_sha", return_value="0123abc"):
+            refs = asyncio.run(publish.push(client, image, "1.2.0"))
+        self.assertEqual(refs, [f"{publish.REPOSITORY}:0123abc@sha256:abc", f"{publish.REPOSITORY}:1.2.0@sha256:abc"])
+        client.set_secret.assert_called_once_with("ghcr-token", "t")
+        image.with_registry_auth.assert_called_once_with(publish.REGISTRY, "me", client.set_secret.return_value)
+
+
+if __name__ == "__main__":
+    unittest.main()
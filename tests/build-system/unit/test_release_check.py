@@ -0,0 +1,130 @@
+"""
+Unit tests for the release check and signature verification (build-system/release_check.py and ci.py).
+"""
+
+import asyncio
+import contextlib
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import ci  # noqa: E402
+import exit_codes  # noqa: E402
+import release_check  # noqa: E402
+import signing  # noqa: E402
+
+
+class TestMatrix(unittest.TestCase):
+    """The signed checks are image checks that sign."""
+
+    def test_signed_checks(self):
+        for check in ci.SIGNED_CHECKS:
+            covers, flags = ci.RELEASE_MATRIX[check]
+            self.assertIn("signing", covers)
+            self.assertNotIn("--checks-only", flags)
+            self.assertNotIn("--skip-sign", flags)
+
+
+class TestVerify(unittest.TestCase):
+    """ci.verify() checks exactly the files the run's signing.SIGNED lists."""
+
+    def setUp(self):
+        tmp = tempfile.TemporaryDirectory()
+        self.addCleanup(tmp.cleanup)
+        self.directory = Path(tmp.name)
+        for name in ("sbom.spdx.json", "sbom.spdx.json.sig", "sbom.spdx.json.bundle", "stray", "stray.bundle"):
+            (self.directory / name).write_text(name)
+        self.files = [{
+            "file": self.directory / "sbom.spdx.json", "bundle": self.directory / "sbom.spdx.json.bundle",
+            "signature": self.directory / "sbom.spdx.json.sig", "certificate": None,
+        }]
+        self.verify_blobs = mock.AsyncMock()
+
+        @contextlib.asynccontextmanager
+        async def connection(config):
+            yield mock.MagicMock()
+
+        for patcher in (
+            mock.patch.object(ci.dagger, "Config", mock.MagicMock()),
+            mock.patch.object(ci.dagger, "Connection", connection),
+            mock.patch.object(ci.signing, "verify_blobs", self.verify_blobs),
+            mock.patch("builtins.print"),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def verify(self, run=None):
+        return asyncio.run(ci.verify(self.directory, [], signing.IDENTITY, None, run))
+
+    def test_verifies_the_listed_files_only(self):
+        signing.record_signed(self.directory, "run-1", self.files)
+        self.assertEqual(self.verify("run-1"), exit_codes.OK)
+        _, _, bundles, signatures, _, _ = self.verify_blobs.call_args.args
+        self.assertEqual((bundles, signatures), (["sbom.spdx.json"], ["sbom.spdx.json"]))
+
+    def test_no_listing(self):
+        self.assertEqual(self.verify(), exit_codes.CONFIG_ERROR)
+        self.verify_blobs.assert_not_called()
+
+    def test_listing_of_another_run(self):
+        signing.record_signed(self.directory, "run-0", self.files)
+        self.assertEqual(self.verify("run-1"), exit_codes.SECURITY_GATE)
+        self.verify_blobs.assert_not_called()
+
+    def test_missing_signature(self):
+        signing.record_signed(self.directory, "run-1", self.files)
+        (self.directory / "sbom.spdx.json.sig").unlink()
+        self.assertEqual(self.verify(), exit_codes.SECURITY_GATE)
+        self.verify_blobs.assert_not_called()
+
+
+class TestReleaseReadiness(unittest.TestCase):
+    """release_readiness() verifies each signed check's own run and reports a single go/no-go."""
+
+    def setUp(self):
+        tmp = tempfile.TemporaryDirectory()
+        self.addCleanup(tmp.cleanup)
+        self.verified = []
+
+        async def verify(artifacts_dir, images, identity, key, run=None):
+            self.verified.append(run)
+            return self.verify_exit
+
+        async def generate_key_pair(directory):
+            (directory / "cosign.key").write_text("key")
+
+        self.verify_exit = exit_codes.OK
+        for patcher in (
+            mock.patch.object(ci, "run_pipeline", return_value=exit_codes.OK),
+            mock.patch.object(ci, "verify", verify),
+            mock.patch.object(ci, "_generate_key_pair", generate_key_pair),
+            mock.patch.object(ci.workspace_checks, "REPORTS_DIR", Path(tmp.name)),
+            mock.patch.object(ci.release_check, "publish"),
+            mock.patch.object(release_check.run_history, "load_summary", side_effect=FileNotFoundError),
+            mock.patch("builtins.print"),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def test_go(self):
+        self.assertEqual(ci.release_readiness(["debug", "image-arm64"], None, [], False), exit_codes.OK)
+        self.assertEqual(len(self.verified), 1)
+        self.assertTrue(self.verified[0].endswith("-image-arm64"))
+
+    def test_unverified_signatures_are_a_no_go(self):
+        self.verify_exit = exit_codes.SECURITY_GATE
+        self.assertEqual(ci.release_readiness(["image-arm64"], None, [], False), exit_codes.SECURITY_GATE)
+        report = (ci.workspace_checks.REPORTS_DIR / release_check.REPORT).read_text()
+        self.assertIn("NO-GO", report)
+        self.assertIn("did not verify", report)
+
+    def test_upgrade_without_previous_image_is_a_no_go(self):
+        self.assertEqual(ci.release_readiness(["image-amd64"], None, [], False), exit_codes.CONFIG_ERROR)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,71 @@
+"""
+Unit tests for release note aggregation (build-system/release_notes.py).
+"""
+
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import release_notes  # noqa: E402
+
+
+CHANGELOG = """# Changelog
+
+## [Unreleased]
+
+### Added
+- Dry-run mode for partitioning,
+  with a summary of the planned layout.
+
+### Fixed
+* Keyboard layout selection on arm64.
+
+## [0.2.0] - 2026-01-10
+
+### Added
+- Something older.
+"""
+
+
+class TestChangelogSection(unittest.TestCase):
+    """changelog_section() reads one version's entries by change type."""
+
+    def test_unreleased(self):
+        self.assertEqual(release_notes.changelog_section(CHANGELOG, "Unreleased"), {
+            "Added": ["Dry-run mode for partitioning, with a summary of the planned layout."],
+            "Fixed": ["Keyboard layout selection on arm64."],
+        })
+
+    def test_version(self):
+        self.assertEqual(release_notes.changelog_section(CHANGELOG, "0.2.0"), {"Added": ["Something older."]})
+
+    def test_missing_version(self):
+        self.assertIsNone(release_notes.changelog_section(CHANGELOG, "1.0.0"))
+
+
+class TestReleaseNotes(unittest.TestCase):
+    """release_notes() groups every component's entries by change type."""
+
+    def test_aggregate(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            root = Path(tmp)
+            (root / "installer").mkdir()
+            (root / "installer/CHANGELOG.md").write_text(CHANGELOG)
+            (root / "btrmind").mkdir()
+            (root / "btrmind/CHANGELOG.md").write_text("## [0.2.0]\n- Old.\n")
+            layout = {"installer": root / "installer", "btrmind": root / "btrmind", "overlay": root / "overlay"}
+            with mock.patch.object(release_notes.source_layout, "component", side_effect=layout.__getitem__):
+                notes = release_notes.release_notes()
+        self.assertTrue(notes.startswith("# Unreleased changes\n"))
+        self.assertLess(notes.index("## Added"), notes.index("## Fixed"))
+        self.assertIn("- **Installer:** Keyboard layout selection on arm64.", notes)
+        self.assertIn("- BtrMind (no `[Unreleased]` section)", notes)
+        self.assertIn("- regicide-rust overlay (`", notes)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,99 @@
+"""
+Unit tests for release re-scans (build-system/release_rescan.py and ci.py rescan).
+"""
+
+import json
+import subprocess
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import ci  # noqa: E402
+import exit_codes  # noqa: E402
+import github_release  # noqa: E402
+import release_rescan  # noqa: E402
+from failure_bundle import StageFailed  # noqa: E402
+
+
+FINDING = {
+    "scanner": "trivy", "id": "CVE-1", "severity": "high", "package": "openssl 3.0.0", "title": "", "location": "",
+}
+
+
+class TestAssets(unittest.TestCase):
+    """The re-scan downloads what --release-tag attaches."""
+
+    def test_rescanned_assets_are_attached(self):
+        attached = {asset.name for asset in github_release.ASSETS}
+        self.assertLessEqual({release_rescan.SBOM_ASSET, *release_rescan.BINARY_ASSETS}, attached)
+
+    def test_release_assets_among_produced_files(self):
+        output = github_release.artifacts.OUTPUT_DIR
+        produced = [output / "sbom.spdx.json", output / "bin/installer", output / "static/installer"]
+        self.assertEqual(github_release.assets(produced), [output / "sbom.spdx.json", output / "static/installer"])
+
+    def test_download_skips_missing_assets(self):
+        def gh(*args):
+            if args[4] == "btrmind":
+                raise subprocess.CalledProcessError(1, "gh")
+            return ""
+        with tempfile.TemporaryDirectory() as tmp, mock.patch.object(release_rescan, "_gh", side_effect=gh):
+            self.assertEqual(release_rescan.download("v1.0.0", Path(tmp)), ["sbom.spdx.json", "installer"])
+
+
+class TestNotify(unittest.TestCase):
+    """notify() opens one issue per release and comments only on new findings."""
+
+    def test_new_issue(self):
+        with mock.patch.object(release_rescan, "_gh", return_value="[]") as gh, mock.patch("builtins.print"):
+            release_rescan.notify("v1.0.0", [FINDING], "high")
+        self.assertEqual(gh.call_args.args[:2], ("issue", "create"))
+
+    def test_same_findings_are_not_repeated(self):
+        calls = []
+
+        def gh(*args):
+            calls.append(args)
+            if args[:2] == ("issue", "create"):
+                body = args[args.index("--body") + 1]
+                issues.append({"number": 7, "body": body, "comments": []})
+            return json.dumps(issues)
+
+        issues: list[dict] = []
+        with mock.patch.object(release_rescan, "_gh", side_effect=gh), mock.patch("builtins.print"):
+            release_rescan.notify("v1.0.0", [FINDING], "high")
+            release_rescan.notify("v1.0.0", [FINDING], "high")
+            release_rescan.notify("v1.0.0", [FINDING, {**FINDING, "id": "CVE-2"}], "high")
+        self.assertEqual([call[:2] for call in calls if call[1] != "list"], [("issue", "create"), ("issue", "comment")])
+
+
+class TestRescanExitCode(unittest.TestCase):
+    """ci.py rescan exits with the security gate's code when findings reach the threshold."""
+
+    def exit_code(self, result=None, error=None, notify=False) -> int:
+        rescan = mock.AsyncMock(return_value=result, side_effect=error)
+        with mock.patch.object(ci.release_rescan, "rescan", rescan), mock.patch("builtins.print"):
+            return ci.rescan_release("v1.0.0", [], "high", notify)
+
+    def test_clean(self):
+        self.assertEqual(self.exit_code(([FINDING], [])), exit_codes.OK)
+
+    def test_blocked(self):
+        self.assertEqual(self.exit_code(([FINDING], [FINDING])), exit_codes.SECURITY_GATE)
+
+    def test_scanner_failure(self):
+        failure = StageFailed("rescan-sbom", 1, "connection reset by peer", Path("bundle"))
+        self.assertEqual(self.exit_code(error=failure), exit_codes.for_failure(failure))
+
+    def test_notify_failure(self):
+        error = subprocess.CalledProcessError(1, "gh", stderr="HTTP 401")
+        with mock.patch.object(ci.release_rescan, "notify", side_effect=error):
+            self.assertEqual(self.exit_code(([FINDING], [FINDING]), notify=True), exit_codes.INFRASTRUCTURE)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,88 @@
+"""
+Unit tests for garbage collection (build-system/retention.py).
+"""
+
+import json
+import os
+import sys
+import tempfile
+import time
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import retention  # noqa: E402
+
+
+def started(seconds):
+    return time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime(seconds))
+
+
+class TestCollect(unittest.TestCase):
+    """collect() only dooms artifacts no kept, newer or in-progress run may still own."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.root = Path(self.dir.name)
+        patcher = mock.patch.object(retention.run_history, "RUNS_DIR", self.root / "runs")
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        patcher = mock.patch.object(retention.failure_bundle, "FAILURES_DIR", self.root / "failures")
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        self.now = time.time()
+
+    def run_summary(self, run, age, artifacts=()):
+        """Record run as started age seconds ago, recording artifacts (names under the temp root)."""
+        directory = self.root / "runs" / run
+        directory.mkdir(parents=True)
+        summary = {
+            "run": run, "started": started(self.now - age), "status": "passed", "commit": "abc",
+            "artifacts": {name: {"path": str(self.root / name)} for name in artifacts},
+        }
+        (directory / "summary.json").write_text(json.dumps(summary))
+        return directory
+
+    def artifact(self, name, age):
+        path = self.root / name
+        path.write_text(name)
+        os.utime(path, (self.now - age, self.now - age))
+        return path
+
+    def test_dooms_old_runs_and_their_artifacts(self):
+        old = self.run_summary("1", 300, ["old.img"])
+        self.run_summary("2", 200)
+        image = self.artifact("old.img", 250)
+        self.assertEqual(retention.collect(keep_last=1), [image, old])
+
+    def test_keeps_artifacts_whose_newest_recorder_is_kept(self):
+        self.run_summary("1", 300, ["shared.img"])
+        self.run_summary("2", 200, ["shared.img"])
+        self.artifact("shared.img", 250)
+        self.assertEqual(retention.collect(keep_last=1), [self.root / "runs" / "1"])
+
+    def test_keeps_artifacts_rewritten_within_the_window(self):
+        self.run_summary("1", 300, ["rewritten.img"])
+        self.run_summary("2", 200)
+        self.artifact("rewritten.img", 100)
+        self.assertEqual(retention.collect(keep_last=1), [self.root / "runs" / "1"])
+
+    def test_keeps_artifacts_newer_than_a_run_in_progress(self):
+        self.run_summary("1", 300, ["building.img"])
+        in_progress = self.root / "runs" / "2"
+        in_progress.mkdir()
+        os.utime(in_progress, (self.now - 200, self.now - 200))
+        self.artifact("building.img", 100)
+        self.assertEqual(retention.collect(keep_last=0), [self.root / "runs" / "1"])
+
+    def test_without_kept_runs_nothing_is_too_new(self):
+        old = self.run_summary("1", 300, ["old.img"])
+        image = self.artifact("old.img", 10)
+        self.assertEqual(retention.collect(keep_last=0), [image, old])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,120 @@
+"""
+Unit tests for the run summaries (build-system/run_history.py).
+"""
+
+import json
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import run_history  # noqa: E402
+
+
+def summary(run, **fields):
+    return {"run": run, "started": run, "status": "passed", "seconds": 10.0, "commit": "abc",
+            "stages": [], "artifacts": {}, "metrics": {}, "fingerprint": {}, **fields}
+
+
+class TestChanges(unittest.TestCase):
+    """changes() lists environment components first, then stages whose inputs changed."""
+
+    def test_fingerprint_and_stage_inputs(self):
+        before = summary("a", fingerprint={"image/rust": "1", "config/x": "2"},
+                         stages=[{"stage": "clippy", "inputs": "i1"}, {"stage": "gone", "inputs": "g"}])
+        after = summary("b", fingerprint={"image/rust": "3", "tool/new": "4"},
+                        stages=[{"stage": "clippy", "inputs": "i2"}, {"stage": "added", "inputs": "n"}])
+        self.assertEqual(run_history.changes(before, after), [
+            "config/x: 2 -> -",
+            "image/rust: 1 -> 3",
+            "tool/new: - -> 4",
+            "stage clippy: inputs changed",
+        ])
+
+    def test_no_change(self):
+        same = summary("a", fingerprint={"x": "1"}, stages=[{"stage": "s", "inputs": "i"}])
+        self.assertEqual(run_history.changes(same, same), [])
+
+
+class TestCompare(unittest.TestCase):
+    """compare() renders two stored summaries as Markdown."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        patcher = mock.patch.object(run_history, "RUNS_DIR", Path(self.dir.name))
+        patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def store(self, data):
+        path = run_history.RUNS_DIR / data["run"] / "summary.json"
+        path.parent.mkdir(parents=True)
+        path.write_text(json.dumps(data))
+
+    def test_sections(self):
+        finding = {"scanner": "osv-scanner", "id": "RUSTSEC-1", "package": "foo", "severity": "high"}
+        self.store(summary(
+            "a", stages=[{"stage": "clippy", "status": "passed", "seconds": 4.0}],
+            artifacts={"iso": {"size": 100, "sha256": "x"}}, metrics={"coverage-lines": 70.0},
+            vulnerabilities=[finding], dependencies={"foo": ["1.0.0"]},
+        ))
+        self.store(summary(
+            "b", seconds=15.0, stages=[{"stage": "clippy", "status": "failed", "seconds": 2.0}],
+            artifacts={"iso": {"size": 150, "sha256": "y"}}, metrics={"coverage-lines": 72.5},
+            vulnerabilities=[], dependencies={"foo": ["1.1.0"], "bar": ["0.1.0"]},
+        ))
+        report = run_history.compare("a", "b")
+        self.assertIn("| seconds | 10.0 | 15.0 | +5.0 (+50%) |", report)
+        self.assertIn("| clippy | passed | failed | 4.0 | 2.0 | -2.0 (-50%) |", report)
+        self.assertIn("| iso | 100 | 150 | +50.0 (+50%) | changed |", report)
+        self.assertIn("| coverage-lines | 70.0 | 72.5 | +2.5 (+4%) |", report)
+        self.assertIn("| fixed | RUSTSEC-1 | foo | high | osv-scanner |", report)
+        self.assertIn("| bar | - | 0.1.0 |", report)
+        self.assertIn("| foo | 1.0.0 | 1.1.0 |", report)
+        self.assertTrue(report.endswith("None recorded.\n"))
+
+    def test_unscanned_and_unlocked_runs(self):
+        self.store(summary("a"))
+        self.store(summary("b", vulnerabilities=[]))
+        report = run_history.compare("a", "b")
+        self.assertIn("Not compared: no security scan in run a.", report)
+        self.assertIn("Not compared: a run recorded no Cargo.lock.", report)
+        self.assertIn("Neither run recorded artifacts.", report)
+
+
+class TestTimings(unittest.TestCase):
+    """timings() infers the cache column from status, duration and changes."""
+
+    def test_cache_column(self):
+        table = run_history.timings(summary("b", stages=[
+            {"stage": "fast", "status": "passed", "seconds": 0.2},
+            {"stage": "changed", "status": "passed", "seconds": 0.2},
+            {"stage": "memo", "status": "reused", "seconds": 0.0},
+            {"stage": "slow", "status": "passed", "seconds": 30.0},
+            {"stage": "skip", "status": "skipped", "seconds": 0},
+        ], changes={"since": "a", "changed": ["stage changed: inputs changed"]}))
+        cache = {line.split()[0]: line.split()[-1] for line in table.splitlines()[1:-1]}
+        self.assertEqual(cache, {"fast": "cached", "changed": "ran", "memo": "memo", "slow": "ran", "skip": "-"})
+
+
+class TestLockedDependencies(unittest.TestCase):
+    """locked_dependencies() groups a Cargo.lock's versions per crate."""
+
+    def test_versions(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            lock = Path(tmp) / "Cargo.lock"
+            lock.write_text(
+                'version = 3\n'
+                '[[package]]\nname = "syn"\nversion = "2.0.1"\n'
+                '[[package]]\nname = "syn"\nversion = "1.0.9"\n'
+                '[[package]]\nname = "anyhow"\nversion = "1.0.0"\n'
+            )
+            self.assertEqual(run_history.locked_dependencies(lock), {"anyhow": ["1.0.0"], "syn": ["1.0.9", "2.0.1"]})
+            self.assertEqual(run_history.locked_dependencies(Path(tmp) / "missing.lock"), {})
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,95 @@
+"""
+Unit tests for the run lock (build-system/run_lock.py).
+"""
+
+import json
+import os
+import subprocess
+import sys
+import tempfile
+import textwrap
+import unittest
+from pathlib import Path
+from unittest import mock
+
+BUILD_SYSTEM = Path(__file__).parent.parent.parent.parent / "build-system"
+sys.path.insert(0, str(BUILD_SYSTEM))
+
+import run_lock  # noqa: E402
+
+
+# Holds the lock in another process until its stdin closes.
+HOLDER = textwrap.dedent("""
+    import sys
+    sys.path.insert(0, sys.argv[1])
+    import run_lock
+    from pathlib import Path
+    run_lock.LOCK_DIR = Path(sys.argv[2])
+    run_lock.acquire(sys.argv[3])
+    print("locked", flush=True)
+    sys.stdin.read()
+""")
+
+
+class TestKey(unittest.TestCase):
+    """Runs that share cache volumes share a lock."""
+
+    def test_shared_strategy_has_one_lock(self):
+        with mock.patch.dict(os.environ, {"REGICIDE_CACHE_NAMESPACE": "shared", "GITHUB_HEAD_REF": "feature"}):
+            self.assertEqual(run_lock.key(), run_lock.SHARED)
+
+    def test_branch_strategy_locks_per_branch(self):
+        with mock.patch.dict(os.environ, {"REGICIDE_CACHE_NAMESPACE": "branch", "GITHUB_HEAD_REF": "Feature/X"}):
+            self.assertEqual(run_lock.key(), "feature-x")
+
+
+class TestAcquire(unittest.TestCase):
+    """A second run fails at once, naming the holder, unless it queues."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        patcher = mock.patch.object(run_lock, "LOCK_DIR", Path(self.dir.name))
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        variables = {"GITHUB_HEAD_REF": "main", "GITHUB_SHA": "0123456789abcdef", "REGICIDE_RUN_ID": "run-2"}
+        patcher = mock.patch.dict(os.environ, variables)
+        patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def hold(self, name: str) -> subprocess.Popen:
+        holder = subprocess.Popen(
+            [sys.executable, "-c", HOLDER, str(BUILD_SYSTEM), self.dir.name, name],
+            stdin=subprocess.PIPE, stdout=subprocess.PIPE, text=True,
+            env={**os.environ, "GITHUB_HEAD_REF": "other", "REGICIDE_RUN_ID": "run-1"},
+        )
+        self.addCleanup(holder.stdout.close)
+        self.addCleanup(holder.wait)
+        self.addCleanup(holder.stdin.close)
+        self.assertEqual(holder.stdout.readline().strip(), "locked")
+        return holder
+
+    def release(self) -> None:
+        if run_lock._lock is not None:
+            run_lock._lock.close()
+            run_lock._lock = None
+
+    def test_free_lock_records_the_holder(self):
+        self.addCleanup(self.release)
+        run_lock.acquire("shared")
+        held = json.loads((Path(self.dir.name) / "shared.lock").read_text())
+        self.assertEqual((held["run"], held["branch"], held["commit"]), ("run-2", "main", "0123456789abcdef"))
+
+    def test_held_lock_fails_at_once(self):
+        self.hold("shared")
+        with self.assertRaisesRegex(run_lock.Locked, "run lock shared is held by another run \\(run run-1 of other"):
+            run_lock.acquire("shared")
+
+    def test_other_lock_is_independent(self):
+        self.addCleanup(self.release)
+        self.hold("feature-x")
+        run_lock.acquire("feature-y")
+
+
+if __name__ == "__main__":
+    unittest.main()
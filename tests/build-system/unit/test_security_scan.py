@@ -0,0 +1,262 @@
+"""
+Unit tests for the report parsers and policy of build-system/security_scan.py.
+"""
+
+import asyncio
+import datetime
+import json
+import os
+import subprocess
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import security_scan  # noqa: E402
+
+
+TODAY = datetime.date(2026, 6, 1)
+
+
+class TestParsers(unittest.TestCase):
+    """Each parser normalizes its scanner's report to findings."""
+
+    def test_cargo_audit(self):
+        report = {
+            "vulnerabilities": {"list": [{
+                "advisory": {"id": "RUSTSEC-2024-0001", "title": "Bad"},
+                "package": {"name": "foo", "version": "1.0.0"},
+            }]},
+            "warnings": {"unmaintained": [{"advisory": None, "package": {"name": "bar", "version": "0.1.0"}}]},
+        }
+        findings = security_scan.parse_cargo_audit(json.dumps(report))
+        self.assertEqual(
+            [(f["id"], f["severity"], f["package"]) for f in findings],
+            [("RUSTSEC-2024-0001", "high", "foo 1.0.0"), ("unmaintained", "low", "bar 0.1.0")],
+        )
+
+    def test_trivy(self):
+        report = {"Results": [{
+            "Target": "Dockerfile",
+            "Vulnerabilities": [{"VulnerabilityID": "CVE-1", "Severity": "MEDIUM", "PkgName": "libc"}],
+            "Misconfigurations": [{"ID": "DS002", "Severity": "weird", "Title": "Root user"}],
+        }]}
+        findings = security_scan.parse_trivy(json.dumps(report))
+        self.assertEqual([(f["id"], f["severity"]) for f in findings], [("CVE-1", "medium"), ("DS002", "unknown")])
+        self.assertEqual(findings[0]["package"], "libc")
+
+    def test_gitleaks_locations(self):
+        report = [
+            {"RuleID": "aws", "File": "a.env", "StartLine": 3},
+            {"RuleID": "aws", "File": "b.env", "StartLine": 1, "Commit": "0123456789abcdef"},
+        ]
+        findings = security_scan.parse_gitleaks(json.dumps(report))
+        self.assertEqual([f["location"] for f in findings], ["a.env:3", "b.env:1@0123456789ab"])
+        self.assertEqual(security_scan.parse_gitleaks(""), [])
+
+    def test_gitleaks_sarif(self):
+        report = [
+            {"RuleID": "aws", "Description": "AWS key", "File": "a.env", "StartLine": 3, "EndLine": 3,
+             "StartColumn": 5, "EndColumn": 24},
+            {"RuleID": "aws", "File": "b.env", "StartLine": 1, "Commit": "0123456789abcdef"},
+        ]
+        run, = json.loads(security_scan.gitleaks_sarif(json.dumps(report)))["runs"]
+        self.assertEqual(run["tool"]["driver"]["rules"], [
+            {"id": "aws", "name": "aws", "shortDescription": {"text": "AWS key"}},
+        ])
+        first, second = run["results"]
+        self.assertEqual(first["locations"][0]["physicalLocation"], {
+            "artifactLocation": {"uri": "a.env"},
+            "region": {"startLine": 3, "endLine": 3, "startColumn": 5, "endColumn": 24},
+        })
+        self.assertEqual(first["level"], "error")
+        self.assertEqual(second["partialFingerprints"], {"commitSha": "0123456789abcdef"})
+        self.assertEqual(json.loads(security_scan.gitleaks_sarif(""))["runs"][0]["results"], [])
+
+    def test_osv_scanner_prefers_rustsec(self):
+        report = {"results": [{
+            "source": {"path": f"{security_scan.workspace_checks.WORKSPACE}/Cargo.lock"},
+            "packages": [{
+                "package": {"name": "foo", "version": "1.0.0"},
+                "vulnerabilities": [{"id": "RUSTSEC-2024-0001", "summary": "Bad"}],
+                "groups": [{"ids": ["GHSA-xxxx", "RUSTSEC-2024-0001"], "max_severity": "9.8"}],
+            }],
+        }]}
+        [finding] = security_scan.parse_osv_scanner(json.dumps(report))
+        self.assertEqual(
+            (finding["id"], finding["severity"], finding["location"]),
+            ("RUSTSEC-2024-0001", "critical", "Cargo.lock"),
+        )
+
+    def test_osv_severity(self):
+        self.assertEqual(security_scan._osv_severity({}, "5.0"), "medium")
+        self.assertEqual(security_scan._osv_severity({"database_specific": {"severity": "MODERATE"}}, ""), "medium")
+        self.assertEqual(security_scan._osv_severity({"database_specific": {"informational": True}}, "9"), "low")
+
+    def test_hadolint(self):
+        report = [{"code": "DL3008", "level": "warning", "message": "Pin", "file": "./Dockerfile", "line": 4}]
+        [finding] = security_scan.parse_hadolint(json.dumps(report))
+        self.assertEqual((finding["severity"], finding["location"]), ("medium", "./Dockerfile:4"))
+        text = security_scan.hadolint_by_file(json.dumps(report), ["Containerfile"])
+        self.assertIn("Containerfile: clean", text)
+        self.assertIn("Dockerfile: 1 findings (1 warning)", text)
+
+    def test_overlay_lockfile(self):
+        ebuild = 'EAPI=8\nCRATES="\n\tfoo@1.2.3\n\tbar-baz-0.1.0\n"\n'
+        lockfile = security_scan.overlay_lockfile(ebuild)
+        self.assertIn('name = "foo"\nversion = "1.2.3"', lockfile)
+        self.assertIn('name = "bar-baz"\nversion = "0.1.0"', lockfile)
+        self.assertIsNone(security_scan.overlay_lockfile("EAPI=8\n"))
+
+
+@mock.patch.object(security_scan, "_today", return_value=TODAY)
+class TestPolicy(unittest.TestCase):
+    """Acknowledgements re-rate findings until they expire."""
+
+    FINDING = security_scan._finding("cargo-audit", "RUSTSEC-1", "high", "foo 1.0.0", "Bad", "Cargo.lock")
+
+    def policy(self, expires: datetime.date, scanner: str = "cargo-audit") -> dict:
+        entry = {"id": "RUSTSEC-1", "scanner": scanner, "severity": "low", "expires": expires, "reason": "no fix"}
+        return {"thresholds": {}, "acknowledged": [entry]}
+
+    def test_unexpired_acknowledgement(self, _today):
+        [finding] = security_scan.apply_policy([self.FINDING], self.policy(TODAY))
+        self.assertEqual(finding["severity"], "low")
+        self.assertIn("acknowledged as low until 2026-06-01: no fix", finding["title"])
+
+    def test_expired_or_other_scanner(self, _today):
+        expired = self.policy(TODAY - datetime.timedelta(days=1))
+        self.assertEqual(security_scan.apply_policy([self.FINDING], expired), [self.FINDING])
+        other = self.policy(TODAY, scanner="osv-scanner")
+        self.assertEqual(security_scan.apply_policy([self.FINDING], other), [self.FINDING])
+
+    def test_expiring(self, _today):
+        soon = self.policy(TODAY + datetime.timedelta(days=3))
+        ignores = [{"id": "CVE-1", "expires": TODAY - datetime.timedelta(days=1)}]
+        messages = security_scan.expiring(soon, ignores)
+        self.assertEqual(len(messages), 2)
+        self.assertIn("RUSTSEC-1 expires on 2026-06-04 (3 days)", messages[0])
+        self.assertIn("CVE-1 expired on 2026-05-31", messages[1])
+
+    def test_load_policy_rejects(self, _today):
+        cases = {
+            "scanners are": '[thresholds]\nnmap = "high"\n',
+            "needs expires, reason": '[[acknowledged]]\nid = "X"\nseverity = "low"\n',
+            "must be a date": '[[acknowledged]]\nid = "X"\nseverity = "low"\nexpires = "soon"\nreason = "r"\n',
+        }
+        for message, text in cases.items():
+            with self.subTest(message), tempfile.TemporaryDirectory() as tmp:
+                path = Path(tmp) / "security-policy.toml"
+                path.write_text(text)
+                with self.assertRaisesRegex(ValueError, message):
+                    security_scan.load_policy(path)
+
+    def test_committed_policy_loads(self, _today):
+        security_scan.load_policy()
+
+
+class TestTrivyIgnores(unittest.TestCase):
+    """Every .trivyignore entry needs an expiry date."""
+
+    def test_entries(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            path = Path(tmp) / ".trivyignore"
+            path.write_text("# comment\n\nCVE-1 exp:2026-12-31  # upstream\n")
+            self.assertEqual(
+                security_scan.trivy_ignores(path), [{"id": "CVE-1", "expires": datetime.date(2026, 12, 31)}]
+            )
+            path.write_text("CVE-2\n")
+            with self.assertRaisesRegex(ValueError, ":1: CVE-2 needs an expiry date"):
+                security_scan.trivy_ignores(path)
+
+    def test_missing_file(self):
+        self.assertEqual(security_scan.trivy_ignores(Path("/nonexistent/.trivyignore")), [])
+
+
+class TestBlocking(unittest.TestCase):
+    """blocking() applies per-scanner thresholds."""
+
+    def test_thresholds(self):
+        findings = [
+            security_scan._finding("trivy", "CVE-1", "medium", "", "", ""),
+            security_scan._finding("hadolint", "DL1", "high", "", "", ""),
+        ]
+        with mock.patch.object(security_scan.advisory, "is_advisory", return_value=False):
+            self.assertEqual(security_scan.blocking(findings, "medium"), findings)
+            self.assertEqual(security_scan.blocking(findings, "medium", {"hadolint": "critical"}), findings[:1])
+        summary = security_scan.summary(findings, "medium", {"hadolint": "critical"})
+        self.assertIn("Total: 2 (0 critical, 1 high, 1 medium, 0 low, 0 unknown)", summary)
+        self.assertIn("hadolint at critical", summary)
+
+
+
+class TestScanDay(unittest.TestCase):
+    """scan_day() changes once a day, in UTC."""
+
+    def test_utc_date(self):
+        last_second = security_scan.time.gmtime(86400 * 365 - 1)
+        with mock.patch.object(security_scan.time, "gmtime", return_value=last_second):
+            self.assertEqual(security_scan.scan_day(), "1970-12-31")
+
+
+class TestOsvScanner(unittest.TestCase):
+    """osv_scanner() always scans the workspace Cargo.lock and fails on an empty scan."""
+
+    def setUp(self):
+        self.commands = []
+
+        async def checked_exec(container, args, stage):
+            self.commands.append((stage, args[-1]))
+            ran = mock.MagicMock()
+            ran.file.return_value.contents = mock.AsyncMock(return_value='{"results": []}')
+            return ran
+
+        overlay = mock.MagicMock()
+        overlay.glob = mock.AsyncMock(return_value=[])
+        self.scanner = mock.MagicMock()
+        for patcher in (
+            mock.patch.object(security_scan, "checked_exec", checked_exec),
+            mock.patch.object(security_scan, "from_image_with_fallback", mock.AsyncMock(return_value=self.scanner)),
+            mock.patch.object(security_scan.source_layout, "directory", return_value=overlay),
+            mock.patch.object(security_scan.workspace_checks, "workspace_source"),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def test_mounts_the_workspace_lockfile(self):
+        with mock.patch.object(security_scan.workspace_checks, "require_lockfile", return_value=Path("Cargo.lock")):
+            asyncio.run(security_scan.osv_scanner(mock.MagicMock()))
+        mounted = self.scanner.with_directory.return_value.with_file
+        mounted.assert_called_once_with(f"{security_scan.workspace_checks.WORKSPACE}/Cargo.lock", mock.ANY)
+        (stage, script), = self.commands
+        self.assertEqual(stage, "security-osv-scanner")
+        self.assertNotIn('"results": []', script)
+        self.assertIn("if [ $rc -gt 1 ]; then exit $rc; fi", script)
+
+    def test_requires_the_workspace_lockfile(self):
+        missing = security_scan.workspace_checks.MissingLockfile("security-osv-scanner")
+        with mock.patch.object(security_scan.workspace_checks, "require_lockfile", side_effect=missing):
+            with self.assertRaises(security_scan.workspace_checks.MissingLockfile):
+                asyncio.run(security_scan.osv_scanner(mock.MagicMock()))
+        self.assertEqual(self.commands, [])
+
+
+class TestUploadSarif(unittest.TestCase):
+    """A failed SARIF upload is an infrastructure failure carrying gh's error."""
+
+    @mock.patch.dict(os.environ, {"GITHUB_REPOSITORY": "awdemos/RegicideOS", "GITHUB_REF": "refs/heads/main"})
+    def test_gh_failure(self):
+        error = subprocess.CalledProcessError(1, "gh", stderr="HTTP 404: Advanced Security must be enabled\n")
+        with mock.patch.object(security_scan.subprocess, "run", side_effect=error), \
+                mock.patch.object(security_scan.build_info, "git_sha", return_value="abc"):
+            with self.assertRaises(security_scan.exit_codes.RunFailed) as raised:
+                security_scan.upload_sarif("{}", "trivy")
+        self.assertEqual(raised.exception.exit_code, security_scan.exit_codes.INFRASTRUCTURE)
+        self.assertIn("Advanced Security must be enabled", str(raised.exception))
+
+
+if __name__ == "__main__":
+    unittest.main()
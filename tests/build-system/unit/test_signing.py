@@ -0,0 +1,101 @@
+"""
+Unit tests for cosign signing and verification (build-system/signing.py).
+"""
+
+import asyncio
+import json
+import os
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import signing  # noqa: E402
+
+
+class TestVerifyBlobs(unittest.TestCase):
+    """verify_blobs() checks every bundle and every detached signature it is given."""
+
+    def setUp(self):
+        self.commands = []
+
+        async def checked_exec(container, args, stage):
+            self.commands.append((stage, args[-1]))
+            return container
+
+        async def with_cosign(container, stage):
+            return container
+
+        for patcher in (
+            mock.patch.object(signing, "checked_exec", checked_exec),
+            mock.patch.object(signing, "with_cosign", with_cosign),
+            mock.patch.object(signing, "from_image", return_value=mock.MagicMock()),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def verify(self, bundles, signatures, public_key=None):
+        asyncio.run(signing.verify_blobs(
+            mock.MagicMock(), mock.MagicMock(), bundles, signatures, "https://example/id", public_key
+        ))
+        return dict(self.commands)
+
+    def test_keyless(self):
+        commands = self.verify(["stage4.tar.xz", "sbom.spdx.json"], ["sbom.spdx.json"])
+        self.assertEqual(list(commands), ["verify-stage4.tar.xz", "verify-sbom.spdx.json", "verify-sbom.spdx.json-sig"])
+        self.assertIn("--bundle='/artifacts/stage4.tar.xz.bundle' '/artifacts/stage4.tar.xz'",
+                      commands["verify-stage4.tar.xz"])
+        detached = commands["verify-sbom.spdx.json-sig"]
+        self.assertIn("--signature='/artifacts/sbom.spdx.json.sig'", detached)
+        self.assertIn("--certificate='/artifacts/sbom.spdx.json.cert'", detached)
+        self.assertIn("--certificate-identity=https://example/id", detached)
+        self.assertNotIn("--bundle", detached)
+
+    def test_key_based_needs_no_certificate(self):
+        commands = self.verify([], ["regicide-cosmic.img"], public_key=mock.MagicMock())
+        detached = commands["verify-regicide-cosmic.img-sig"]
+        self.assertIn(f"--key={signing.PUBLIC_KEY}", detached)
+        self.assertNotIn("--certificate", detached)
+
+
+class TestMode(unittest.TestCase):
+    """key_based() picks the mode, and the sign flags follow it."""
+
+    def test_modes(self):
+        with mock.patch.dict(os.environ, {}, clear=True):
+            self.assertFalse(signing.key_based())
+            self.assertEqual(signing._sign_flags(), [])
+        with mock.patch.dict(os.environ, {"COSIGN_KEY_PATH": "/keys/cosign.key"}, clear=True):
+            self.assertTrue(signing.key_based())
+            self.assertEqual(signing._sign_flags(), [f"--key={signing.KEY}", "--tlog-upload=false"])
+
+
+
+class TestSignedListing(unittest.TestCase):
+    """record_signed() and signed_files() round-trip the files a run signed."""
+
+    def test_round_trip(self):
+        with tempfile.TemporaryDirectory() as tmp, tempfile.TemporaryDirectory() as elsewhere:
+            directory, tarball = Path(tmp), Path(elsewhere) / "stage4.tar.xz"
+            files = [
+                {"file": directory / "sbom.spdx.json", "bundle": directory / "sbom.spdx.json.bundle",
+                 "signature": directory / "sbom.spdx.json.sig", "certificate": None},
+                {"file": tarball, "bundle": directory / "stage4.tar.xz.bundle", "signature": None, "certificate": None},
+            ]
+            manifest_path = signing.record_signed(directory, "run-1", files)
+            self.assertEqual(manifest_path, directory / signing.SIGNED)
+            stored = json.loads(manifest_path.read_text())["files"]
+            self.assertEqual(stored[0]["bundle"], "sbom.spdx.json.bundle")
+            self.assertEqual(stored[1]["file"], str(tarball))
+            self.assertEqual(signing.signed_files(directory), ("run-1", files))
+
+    def test_no_listing(self):
+        with tempfile.TemporaryDirectory() as tmp, self.assertRaises(FileNotFoundError):
+            signing.signed_files(Path(tmp))
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,70 @@
+"""
+Unit tests for the source root and component layout (build-system/source_layout.py).
+"""
+
+import os
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import source_layout  # noqa: E402
+
+
+class TestSourceLayout(unittest.TestCase):
+    """Components come from layout.toml unless overridden with --component."""
+
+    def setUp(self):
+        self.cwd = os.getcwd()
+        self.addCleanup(os.chdir, self.cwd)
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.root = Path(self.dir.name).resolve()
+        os.chdir(self.root)
+        overrides = mock.patch.dict(source_layout._overrides, clear=True)
+        overrides.start()
+        self.addCleanup(overrides.stop)
+
+    def test_default_layout(self):
+        self.assertEqual(source_layout.component("btrmind"), Path("ai-agents/btrmind"))
+        self.assertEqual(set(source_layout.components()), {"installer", "btrmind", "cli", "overlay"})
+
+    def test_override_inside_root_stays_relative(self):
+        (self.root / "vendor/overlay").mkdir(parents=True)
+        source_layout.override("overlay=vendor/overlay")
+        self.assertEqual(source_layout.component("overlay"), Path("vendor/overlay"))
+
+    def test_override_outside_root_is_absolute(self):
+        with tempfile.TemporaryDirectory() as elsewhere:
+            source_layout.override(f"overlay={elsewhere}")
+            self.assertEqual(source_layout.component("overlay"), Path(elsewhere).resolve())
+
+    def test_source_paths_skip_components_outside_root(self):
+        self.assertEqual(source_layout.source_paths("cli", "overlay"), ["crates/regicide-cli", "overlays/regicide-rust"])
+        with tempfile.TemporaryDirectory() as elsewhere:
+            source_layout.override(f"overlay={elsewhere}")
+            self.assertEqual(source_layout.source_paths("cli", "overlay"), ["crates/regicide-cli"])
+
+    def test_malformed_overrides(self):
+        cases = {
+            "expects NAME=PATH": "overlay",
+            "unknown component kernel": "kernel=.",
+            "is not a directory": "overlay=missing",
+        }
+        for message, spec in cases.items():
+            with self.subTest(spec), self.assertRaisesRegex(ValueError, message):
+                source_layout.override(spec)
+
+    def test_use_root(self):
+        with self.assertRaisesRegex(ValueError, "is not a directory"):
+            source_layout.use_root(self.root / "missing")
+        (self.root / "checkout").mkdir()
+        source_layout.use_root(self.root / "checkout")
+        self.assertEqual(Path.cwd(), self.root / "checkout")
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,84 @@
+"""
+Unit tests for stage memoization (build-system/stage_memo.py).
+"""
+
+import asyncio
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import stage_memo  # noqa: E402
+
+
+class TestMemo(unittest.TestCase):
+    """run() reuses a passing stage's unchanged outputs, except for the advisory gates."""
+
+    def setUp(self):
+        self.dir = tempfile.TemporaryDirectory()
+        self.addCleanup(self.dir.cleanup)
+        self.output = Path(self.dir.name)
+        self.summaries = []
+        self.memos = {}
+        for patcher in (
+            mock.patch.object(stage_memo.artifacts, "OUTPUT_DIR", self.output),
+            mock.patch.object(stage_memo, "_reused", []),
+            mock.patch.object(stage_memo.run_history, "fingerprint", return_value={"source": "1"}),
+            mock.patch.object(stage_memo.run_history, "recent_summaries", side_effect=lambda limit: self.summaries),
+            mock.patch.object(stage_memo.run_history, "run_id", return_value="2"),
+            mock.patch.object(stage_memo.run_history, "record_stage"),
+            mock.patch.object(
+                stage_memo.run_history, "record_memo",
+                side_effect=lambda stage, key, outputs: self.memos.update({stage: {"key": key, "outputs": outputs}}),
+            ),
+            mock.patch.object(stage_memo.sys, "argv", ["dagger_pipeline.py", "--clippy", "--memoize"]),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+        self.ran = []
+
+    def job(self, stage):
+        async def job():
+            self.ran.append(stage)
+            (self.output / f"{stage}.txt").write_text(stage)
+        return job
+
+    def run_twice(self, stage):
+        asyncio.run(stage_memo.run(stage, self.job(stage)))
+        self.summaries = [{"run": "1", "memo": dict(self.memos)}]
+        self.memos.clear()
+        asyncio.run(stage_memo.run(stage, self.job(stage)))
+
+    def test_reuses_unchanged_outputs(self):
+        self.run_twice("clippy")
+        self.assertEqual(self.ran, ["clippy"])
+        self.assertEqual(stage_memo.reused(), [self.output / "clippy.txt"])
+
+    def test_reruns_when_outputs_changed(self):
+        asyncio.run(stage_memo.run("clippy", self.job("clippy")))
+        self.summaries = [{"run": "1", "memo": dict(self.memos)}]
+        (self.output / "clippy.txt").write_text("edited")
+        asyncio.run(stage_memo.run("clippy", self.job("clippy")))
+        self.assertEqual(self.ran, ["clippy", "clippy"])
+
+    def test_ignored_arguments_do_not_change_the_key(self):
+        key = stage_memo.key("clippy")
+        with mock.patch.object(stage_memo.sys, "argv", ["dagger_pipeline.py", "--clippy", "--plain"]):
+            self.assertEqual(stage_memo.key("clippy"), key)
+        with mock.patch.object(stage_memo.sys, "argv", ["dagger_pipeline.py", "--clippy", "--arch", "arm64"]):
+            self.assertNotEqual(stage_memo.key("clippy"), key)
+
+    def test_advisory_gates_always_run(self):
+        for stage in stage_memo.UNMEMOIZED:
+            with self.subTest(stage=stage):
+                self.ran.clear()
+                self.run_twice(stage)
+                self.assertEqual(self.ran, [stage, stage])
+                self.assertEqual(self.memos, {})
+
+
+if __name__ == "__main__":
+    unittest.main()
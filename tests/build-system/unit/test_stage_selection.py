@@ -0,0 +1,101 @@
+"""
+Unit tests for --stage and --skip (build-system/stage_selection.py).
+"""
+
+import argparse
+import re
+import sys
+import unittest
+from pathlib import Path
+
+BUILD_SYSTEM = Path(__file__).parent.parent.parent.parent / "build-system"
+sys.path.insert(0, str(BUILD_SYSTEM))
+
+import stage_selection  # noqa: E402
+
+DECLARED = {
+    "lockfile-drift": {"description": "Cargo.lock drift"},
+    "systemd-declarations": {"description": "sysusers.d and tmpfiles.d", "needs": ["lockfile-drift"]},
+}
+
+
+def parser() -> argparse.ArgumentParser:
+    """Return a parser with the shapes of the pipeline's stage flags."""
+    built = argparse.ArgumentParser()
+    built.add_argument("--checks-only", action="store_true")
+    built.add_argument("--skip-cargo-check", action="store_true")
+    built.add_argument("--clippy", action="store_true")
+    built.add_argument("--overlay-tests", action="store_true")
+    built.add_argument("--benchmarks", nargs="?", type=int, const=5)
+    built.add_argument("--smoke-test-image", metavar="REF")
+    built.add_argument("--lockfile-drift", action="append_const", dest="declared", const="lockfile-drift", default=[])
+    built.add_argument("--stage", action="append", default=[])
+    built.add_argument("--skip", action="append", default=[])
+    return built
+
+
+def apply(*argv: str) -> tuple[argparse.Namespace, list[str]]:
+    built = parser()
+    args = built.parse_args(argv)
+    return args, stage_selection.apply(built, args, DECLARED)
+
+
+class TestApply(unittest.TestCase):
+    """apply() turns stage names into the flags that run them."""
+
+    def test_no_selection_changes_nothing(self):
+        args, declared = apply("--clippy")
+        self.assertTrue(args.clippy)
+        self.assertFalse(args.checks_only)
+        self.assertFalse(args.skip_cargo_check)
+        self.assertEqual(declared, [])
+
+    def test_stage_runs_only_the_named_stages(self):
+        args, declared = apply("--stage", "overlay-tests,benchmarks", "--stage", "systemd-declarations")
+        self.assertTrue(args.overlay_tests)
+        self.assertEqual(args.benchmarks, 5)
+        self.assertFalse(args.clippy)
+        self.assertTrue(args.checks_only)
+        self.assertTrue(args.skip_cargo_check)
+        self.assertEqual(declared, ["systemd-declarations"])
+
+    def test_builtin_stages_run_when_named(self):
+        args, _ = apply("--stage", "cargo-check,os-image")
+        self.assertFalse(args.skip_cargo_check)
+        self.assertFalse(args.checks_only)
+
+    def test_skip_drops_selected_stages(self):
+        args, declared = apply("--clippy", "--benchmarks", "3", "--lockfile-drift", "--smoke-test-image", "x@sha256:0",
+                               "--skip", "clippy,benchmarks,lockfile-drift,smoke-test-image,cargo-check,os-image")
+        self.assertFalse(args.clippy)
+        self.assertIsNone(args.benchmarks)
+        self.assertIsNone(args.smoke_test_image)
+        self.assertTrue(args.skip_cargo_check)
+        self.assertTrue(args.checks_only)
+        self.assertEqual(declared, [])
+
+    def test_rejects_unknown_and_value_stages(self):
+        with self.assertRaisesRegex(ValueError, "unknown stage rust-build"):
+            apply("--stage", "rust-build")
+        with self.assertRaisesRegex(ValueError, "unknown stage nope"):
+            apply("--skip", "nope")
+        with self.assertRaisesRegex(ValueError, "cannot select smoke-test-image"):
+            apply("--stage", "smoke-test-image")
+
+
+class TestStageList(unittest.TestCase):
+    """The stage list matches the pipeline's flags and jobs."""
+
+    def test_every_stage_has_a_flag(self):
+        source = (BUILD_SYSTEM / "dagger_pipeline.py").read_text()
+        for name in [*stage_selection.FLAG_STAGES, *stage_selection.VALUE_STAGES]:
+            self.assertIn(f'"--{name}"', source)
+
+    def test_every_job_is_a_stage(self):
+        source = (BUILD_SYSTEM / "dagger_pipeline.py").read_text()
+        jobs = {job.replace("_", "-") for job in re.findall(r"async def job_(\w+)\(", source)} - {"declared-stages"}
+        self.assertLessEqual(jobs, {*stage_selection.FLAG_STAGES, *stage_selection.VALUE_STAGES})
+
+
+if __name__ == "__main__":
+    unittest.main()
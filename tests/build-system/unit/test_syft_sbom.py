@@ -0,0 +1,72 @@
+"""
+Unit tests for the syft SBOMs (build-system/syft_sbom.py).
+"""
+
+import asyncio
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import syft_sbom  # noqa: E402
+
+
+class TestSyftSbom(unittest.TestCase):
+    """Both formats come out of one syft scan, and both are attested."""
+
+    def setUp(self):
+        self.commands = []
+
+        async def checked_exec(container, args, stage):
+            self.commands.append((stage, args))
+            return container
+
+        for patcher in (
+            mock.patch.object(syft_sbom, "checked_exec", checked_exec),
+            mock.patch.object(syft_sbom, "from_image", return_value=mock.MagicMock()),
+            mock.patch.dict(os.environ, {"GITHUB_ACTOR": "me", "GITHUB_TOKEN": "t"}, clear=True),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+
+    def test_outputs(self):
+        self.assertEqual(syft_sbom._outputs("x"), [
+            "-o", "cyclonedx-json=/sbom/x.cdx.json", "-o", "spdx-json=/sbom/x.spdx.json",
+        ])
+
+    def test_rust_binaries_scan_the_lockfile(self):
+        with mock.patch.object(syft_sbom.workspace_checks, "require_lockfile", return_value=Path("Cargo.lock")) \
+                as require, mock.patch.object(syft_sbom.workspace_checks, "optimized_binaries", mock.AsyncMock()), \
+                mock.patch.object(syft_sbom.workspace_checks, "workspace_source") as source, \
+                mock.patch.object(syft_sbom.build_info, "git_sha", return_value="0123abc"):
+            asyncio.run(syft_sbom.rust_binaries(mock.MagicMock()))
+        require.assert_called_once_with("sbom-rust-binaries")
+        source.assert_called_once_with(mock.ANY, paths=["Cargo.lock"])
+        (stage, args), = self.commands
+        self.assertEqual(stage, "sbom-rust-binaries")
+        self.assertEqual(args[:3], ["/syft", "scan", "dir:/scan"])
+        self.assertIn("0123abc", args)
+
+    def test_image_scans_by_reference_with_a_secret(self):
+        client = mock.MagicMock()
+        asyncio.run(syft_sbom.image(client, "ghcr.io/x/btrmind@sha256:abc", "btrmind-image"))
+        (stage, args), = self.commands
+        self.assertEqual((stage, args[2]), ("sbom-btrmind-image", "registry:ghcr.io/x/btrmind@sha256:abc"))
+        client.set_secret.assert_called_once_with("syft-registry-token", "t")
+
+    def test_attest_each_format(self):
+        documents = mock.MagicMock()
+        with mock.patch.object(syft_sbom.signing, "attest_image", mock.AsyncMock()) as attest:
+            asyncio.run(syft_sbom.attest(mock.MagicMock(), "ref", documents, "btrmind-image"))
+        self.assertEqual([call.args[3] for call in attest.await_args_list], ["cyclonedx", "spdxjson"])
+        self.assertEqual(
+            [call.args[0] for call in documents.file.call_args_list],
+            ["btrmind-image.cdx.json", "btrmind-image.spdx.json"],
+        )
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,99 @@
+"""
+Unit tests for test impact analysis (build-system/test_impact.py).
+"""
+
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import test_impact  # noqa: E402
+
+
+def crate(name: str, directory: str, targets: list[dict] | None = None) -> dict:
+    return {
+        "id": name, "name": name, "manifest_path": f"/src/{directory}/Cargo.toml",
+        "targets": targets or [{"name": name, "kind": ["lib"]}],
+    }
+
+
+# installer and btrmind depend on regicide-cli; btrmind has a nested helper crate.
+METADATA = {
+    "workspace_root": "/src",
+    "workspace_members": ["installer", "btrmind", "regicide-cli", "btrmind-sim"],
+    "packages": [
+        crate("installer", "installer", [
+            {"name": "installer", "kind": ["bin"]}, {"name": "build", "kind": ["custom-build"]},
+        ]),
+        crate("btrmind", "ai-agents/btrmind"),
+        crate("btrmind-sim", "ai-agents/btrmind/sim"),
+        crate("regicide-cli", "crates/regicide-cli"),
+        {"id": "clap", "name": "clap", "manifest_path": "/registry/clap/Cargo.toml", "targets": []},
+    ],
+    "resolve": {"nodes": [
+        {"id": "installer", "deps": [{"pkg": "regicide-cli"}, {"pkg": "clap"}]},
+        {"id": "btrmind", "deps": [{"pkg": "regicide-cli"}]},
+        {"id": "btrmind-sim", "deps": []},
+        {"id": "regicide-cli", "deps": [{"pkg": "clap"}]},
+        {"id": "clap", "deps": []},
+    ]},
+}
+
+
+class TestImpacted(unittest.TestCase):
+    """impacted() maps changed files to crates and their dependents."""
+
+    def test_library_change_impacts_dependents(self):
+        crates, direct, full = test_impact.impacted(METADATA, ["crates/regicide-cli/src/docs.rs"])
+        self.assertEqual(crates, ["btrmind", "installer", "regicide-cli"])
+        self.assertEqual(direct, {"regicide-cli": ["crates/regicide-cli/src/docs.rs"]})
+        self.assertIsNone(full)
+
+    def test_innermost_crate_owns_the_file(self):
+        crates, direct, _ = test_impact.impacted(METADATA, ["ai-agents/btrmind/sim/src/lib.rs"])
+        self.assertEqual(crates, ["btrmind-sim"])
+        self.assertEqual(list(direct), ["btrmind-sim"])
+
+    def test_changes_outside_crates(self):
+        self.assertEqual(test_impact.impacted(METADATA, ["README.md", "overlays/x.ebuild"]), ([], {}, None))
+
+    def test_shared_paths_force_a_full_run(self):
+        crates, direct, full = test_impact.impacted(METADATA, ["Cargo.toml", "installer/src/main.rs"])
+        self.assertEqual(len(crates), 4)
+        self.assertEqual(direct, {})
+        self.assertEqual(full, "Cargo.toml changed")
+
+    def test_targets(self):
+        self.assertEqual(
+            test_impact.test_targets(METADATA, ["installer", "regicide-cli"]),
+            ["installer bin installer", "regicide-cli lib regicide-cli"],
+        )
+
+
+class TestBaseRef(unittest.TestCase):
+    """base_ref() picks what to diff against, or None for a full run."""
+
+    def test_explicit(self):
+        self.assertEqual(test_impact.base_ref("origin/release"), "origin/release")
+
+    def test_pull_request(self):
+        with mock.patch.dict(os.environ, {"GITHUB_BASE_REF": "main"}):
+            self.assertEqual(test_impact.base_ref("auto"), "origin/main")
+
+    def test_push_in_actions(self):
+        with mock.patch.dict(os.environ, {"GITHUB_BASE_REF": "", "GITHUB_ACTIONS": "true"}):
+            self.assertIsNone(test_impact.base_ref("auto"))
+
+    def test_local(self):
+        with mock.patch.dict(os.environ, {"GITHUB_BASE_REF": "", "GITHUB_ACTIONS": ""}):
+            with mock.patch.object(test_impact, "_git", return_value="main"):
+                self.assertIsNone(test_impact.base_ref("auto"))
+            with mock.patch.object(test_impact, "_git", return_value="feature"):
+                self.assertEqual(test_impact.base_ref("auto"), "origin/main")
+
+
+if __name__ == "__main__":
+    unittest.main()
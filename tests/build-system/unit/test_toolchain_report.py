@@ -0,0 +1,93 @@
+"""
+Unit tests for the toolchain report (build-system/toolchain_report.py).
+"""
+
+import asyncio
+import json
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+from unittest import mock
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import toolchain_report  # noqa: E402
+
+
+RUST = "rust:1.83-bookworm"
+
+
+class TestToolchainReport(unittest.TestCase):
+    """probe() queries only the tools whose images the run pulled."""
+
+    def setUp(self):
+        for patcher in (
+            mock.patch.object(toolchain_report, "_tools", {}),
+            mock.patch.object(toolchain_report, "_images", {}),
+            mock.patch.object(toolchain_report.workspace_checks, "rust_image", return_value=RUST),
+            mock.patch.object(toolchain_report.fingerprint, "tools", return_value={"python": "3.11.9"}),
+            mock.patch.object(toolchain_report, "_engine_version", mock.AsyncMock(return_value="v0.18.0")),
+            mock.patch.object(
+                toolchain_report.failure_bundle, "resolved_images",
+                mock.AsyncMock(return_value={RUST: f"{RUST}@sha256:abc"}),
+            ),
+        ):
+            patcher.start()
+            self.addCleanup(patcher.stop)
+        self.queried = []
+
+        async def version(client, image, *args, fallback=False):
+            self.queried.append(args[0])
+            return f"{args[0]} 1.0"
+
+        patcher = mock.patch.object(toolchain_report, "_version", side_effect=version)
+        patcher.start()
+        self.addCleanup(patcher.stop)
+
+    def probe(self, pulled: list[str]) -> None:
+        with mock.patch.object(toolchain_report.failure_bundle, "pulled_images", return_value=pulled):
+            asyncio.run(toolchain_report.probe(mock.MagicMock()))
+
+    def test_only_pulled_images_are_probed(self):
+        self.probe([RUST])
+        self.assertEqual(sorted(self.queried), ["cargo", "rustc"])
+        self.assertNotIn("trivy", toolchain_report._tools)
+        self.assertEqual(toolchain_report._tools["dagger-engine"], "v0.18.0")
+
+    def test_nothing_pulled(self):
+        self.probe([])
+        self.assertEqual(self.queried, [])
+        self.assertEqual(set(toolchain_report._tools), {"dagger-engine", "python"})
+
+    def test_recorded_tools_are_not_queried_again(self):
+        self.probe([RUST])
+        self.probe([RUST, toolchain_report.security_scan.TRIVY_IMAGE])
+        self.assertEqual(sorted(self.queried), ["cargo", "rustc", "trivy"])
+
+    def test_write(self):
+        self.probe([RUST])
+        with tempfile.TemporaryDirectory() as tmp, \
+                mock.patch.object(toolchain_report.run_history, "run_id", return_value="run-1"), \
+                mock.patch.object(toolchain_report.build_info, "git_sha", return_value="abc"):
+            report = json.loads(toolchain_report.write(Path(tmp) / "toolchain-report.json").read_text())
+        self.assertEqual(report["run"], "run-1")
+        self.assertEqual(report["images"], {RUST: f"{RUST}@sha256:abc"})
+        self.assertEqual(report["tools"]["rustc"], "rustc 1.0")
+
+    def test_probing_skips_cancelled_runs(self):
+        async def run(error: BaseException) -> None:
+            async with toolchain_report.probing(mock.MagicMock()):
+                raise error
+
+        with mock.patch.object(toolchain_report, "probe", mock.AsyncMock()) as probe:
+            with self.assertRaises(RuntimeError):
+                asyncio.run(run(RuntimeError("stage failed")))
+            self.assertEqual(probe.await_count, 1)
+            with self.assertRaises(asyncio.CancelledError):
+                asyncio.run(run(asyncio.CancelledError()))
+            self.assertEqual(probe.await_count, 1)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,87 @@
+"""
+Unit tests for the run-history trend charts (build-system/trend_charts.py).
+"""
+
+import json
+import sys
+import tempfile
+import unittest
+from pathlib import Path
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import run_history  # noqa: E402
+import trend_charts  # noqa: E402
+
+
+def summary(run, seconds, stages, metrics, artifacts):
+    return {"run": run, "started": run, "status": "passed", "seconds": seconds,
+            "stages": [{"stage": name, "seconds": value} for name, value in stages.items()],
+            "metrics": metrics, "artifacts": {name: {"size": size} for name, size in artifacts.items()}}
+
+
+class TestSeries(unittest.TestCase):
+    """series() groups the summaries into one chart per kind of value."""
+
+    def test_groups_and_gaps(self):
+        summaries = [
+            summary("r1", 10, {"rustfmt": 2}, {"coverage-lines": 71.5}, {"regicide.iso": 2**20}),
+            summary("r2", 12, {"rustfmt": 3, "clippy": 5}, {"bench-idle-ms": 4.0}, {}),
+        ]
+        groups = trend_charts.series(summaries)
+        self.assertEqual(list(groups), ["durations", "coverage", "metrics", "artifacts"])
+        self.assertEqual(groups["durations"][1]["total"], [10, 12])
+        self.assertEqual(groups["durations"][1]["clippy"], [None, 5])
+        self.assertEqual(groups["coverage"][1], {"coverage-lines": [71.5, None]})
+        self.assertEqual(groups["artifacts"], ("MiB", {"regicide.iso": [1.0, None]}))
+
+    def test_keeps_the_slowest_stages(self):
+        stages = {f"stage-{i}": i for i in range(trend_charts.MAX_SERIES + 3)}
+        durations = trend_charts.series([summary("r1", 100, stages, {}, {})])["durations"][1]
+        self.assertEqual(len(durations), trend_charts.MAX_SERIES + 1)
+        self.assertNotIn("stage-0", durations)
+
+
+class TestChart(unittest.TestCase):
+    """chart() draws one line per series and breaks it at missing values."""
+
+    def test_gap_splits_the_line(self):
+        svg = trend_charts.chart("Durations", "seconds", ["r1", "r2", "r3", "r4"],
+                                 {"total": [1, 2, None, 4]})
+        self.assertEqual(svg.count("<polyline"), 1)
+        self.assertEqual(svg.count("<circle"), 1)
+        self.assertIn("<text x=\"64\" y=\"280\">total</text>", svg)
+
+    def test_escapes_names(self):
+        svg = trend_charts.chart("Metrics", "value", ["r1"], {"a<b": [1]})
+        self.assertIn("a&lt;b", svg)
+
+
+class TestWrite(unittest.TestCase):
+    """write() saves the SVG files and the HTML page that embeds them."""
+
+    def setUp(self):
+        self.temp = Path(tempfile.mkdtemp())
+        self.runs_dir = run_history.RUNS_DIR
+        run_history.RUNS_DIR = self.temp / "runs"
+
+    def tearDown(self):
+        run_history.RUNS_DIR = self.runs_dir
+
+    def test_no_history(self):
+        self.assertEqual(trend_charts.write(20, self.temp / "reports"), [])
+
+    def test_writes_page_and_charts(self):
+        for index in range(3):
+            run_dir = run_history.RUNS_DIR / f"r{index}"
+            run_dir.mkdir(parents=True)
+            (run_dir / "summary.json").write_text(json.dumps(summary(f"r{index}", 10 + index, {}, {}, {})))
+        written = trend_charts.write(2, self.temp / "reports")
+        self.assertEqual([path.name for path in written], ["trends.html", "trends-durations.svg"])
+        page = written[0].read_text()
+        self.assertIn("last 2 runs", page)
+        self.assertIn("<svg", page)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,90 @@
+"""
+Unit tests for the ebuild version check and source loading in build-system/workspace_checks.py.
+"""
+
+import asyncio
+import os
+import sys
+import unittest
+from pathlib import Path
+from unittest.mock import MagicMock, patch
+
+sys.path.insert(0, str(Path(__file__).parent.parent.parent.parent / "build-system"))
+
+import workspace_checks  # noqa: E402
+
+
+class TestEbuildVersionDrift(unittest.TestCase):
+    """ebuild_version_drift() fails a crate bump that has no matching ebuild."""
+
+    def drift(self, version, previous, ebuilds):
+        with patch.object(workspace_checks, "CRATE_EBUILDS", {"btrmind": "regicide-tools/btrmind"}), \
+                patch.object(workspace_checks, "crate_version", return_value=version), \
+                patch.object(workspace_checks, "crate_version_at", return_value=previous), \
+                patch.object(workspace_checks, "_ebuild_versions", return_value=ebuilds):
+            return workspace_checks.ebuild_version_drift("origin/main")
+
+    def test_bump_without_ebuild_fails(self):
+        errors, _ = self.drift("0.2.0", "0.1.0", ["9999"])
+        self.assertEqual(
+            errors, ["regicide-tools/btrmind: btrmind was bumped from 0.1.0 to 0.2.0 without btrmind-0.2.0.ebuild"]
+        )
+
+    def test_bump_with_ebuild_passes(self):
+        self.assertEqual(self.drift("0.2.0", "0.1.0", ["9999", "0.2.0"]), ([], []))
+
+    def test_live_only_without_bump_warns(self):
+        errors, warnings = self.drift("0.1.0", "0.1.0", ["9999"])
+        self.assertEqual(errors, [])
+        self.assertEqual(len(warnings), 1)
+
+    def test_released_ebuild_ahead_fails(self):
+        errors, _ = self.drift("0.1.0", "0.1.0", ["0.1.0", "0.1.1"])
+        self.assertEqual(errors, ["regicide-tools/btrmind: ebuild 0.1.1 is ahead of btrmind 0.1.0"])
+
+    def test_versions_compare_numerically(self):
+        self.assertGreater(workspace_checks._version_key("1.10.0"), workspace_checks._version_key("1.9.2"))
+
+
+
+class TestWorkspaceSource(unittest.TestCase):
+    """workspace_source() limits the load to paths or REGICIDE_SOURCE_INCLUDE, except with history."""
+
+    def host_include(self, **kwargs):
+        client = MagicMock()
+        with patch.dict(os.environ, {"REGICIDE_SOURCE_INCLUDE": "docs/**", "REGICIDE_SOURCE_GITIGNORE": "0"}):
+            workspace_checks.workspace_source(client, **kwargs)
+        return client.host().directory.call_args.kwargs["include"]
+
+    def test_paths_win_over_the_environment(self):
+        self.assertEqual(self.host_include(paths=["Cargo.toml"]), ["Cargo.toml"])
+
+    def test_environment_include(self):
+        self.assertEqual(self.host_include(), ["docs/**"])
+
+    def test_history_loads_the_whole_tree(self):
+        self.assertEqual(self.host_include(with_git=True), [])
+        self.assertEqual(self.host_include(with_git=True, paths=["Cargo.toml"]), [])
+
+    def test_module_source_with_history_is_not_filtered(self):
+        client, given = MagicMock(), MagicMock()
+        with workspace_checks.module_source(given), patch.dict(os.environ, {"REGICIDE_SOURCE_INCLUDE": "docs/**"}):
+            self.assertIs(workspace_checks.workspace_source(client, with_git=True), given)
+        client.directory.assert_not_called()
+
+
+
+class TestDependencyTrees(unittest.TestCase):
+    """dependency_trees() names the missing Cargo.lock before starting cargo."""
+
+    def test_requires_the_lockfile(self):
+        lock = patch.object(workspace_checks, "CARGO_LOCK", Path("/nonexistent/Cargo.lock"))
+        with lock, patch.object(workspace_checks, "checked_exec") as run:
+            with self.assertRaises(workspace_checks.MissingLockfile) as raised:
+                asyncio.run(workspace_checks.dependency_trees(MagicMock()))
+        self.assertEqual(raised.exception.stage, "dependency-trees")
+        run.assert_not_called()
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,106 @@
+"""
+Golden-output tests for the command-line surface of every built binary.
+
+Each case runs a binary with fixed arguments and compares its exit code,
+stdout and stderr with tests/cli/golden/<binary>/<case>.txt, so a changed
+flag, help text or error message shows up as a reviewed diff instead of an
+accident.  Cases never touch a disk or the host configuration.
+
+Regenerate the golden files after an intended CLI change with:
+    REGICIDE_UPDATE_SNAPSHOTS=1 python3 -m pytest tests/cli/test_cli_golden.py
+"""
+
+import os
+import subprocess
+import unittest
+from pathlib import Path
+
+PROJECT_ROOT = Path(__file__).parent.parent.parent
+GOLDEN_DIR = PROJECT_ROOT / "tests" / "cli" / "golden"
+UPDATE_SNAPSHOTS = os.environ.get("REGICIDE_UPDATE_SNAPSHOTS") == "1"
+
+# (binary, case, arguments)
+CASES = [
+    ("installer", "help", ["--help"]),
+    ("installer", "version", ["--version"]),
+    ("installer", "unknown-flag", ["--bogus"]),
+    ("installer", "config-without-value", ["--config"]),
+    ("btrmind", "help", ["--help"]),
+    ("btrmind", "version", ["--version"]),
+    ("btrmind", "unknown-flag", ["--bogus"]),
+    ("btrmind", "unknown-subcommand", ["frobnicate"]),
+    ("btrmind", "run-help", ["run", "--help"]),
+    ("btrmind", "analyze-help", ["analyze", "--help"]),
+    ("btrmind", "cleanup-help", ["cleanup", "--help"]),
+    ("btrmind", "stats-help", ["stats", "--help"]),
+    ("btrmind", "config-help", ["config", "--help"]),
+    ("btrmind", "simulate-help", ["simulate", "--help"]),
+    ("btrmind", "simulate-without-trace", ["simulate"]),
+]
+
+
+def get_binary_path(name):
+    """Find a compiled workspace binary (REGICIDE_BIN_DIR overrides)."""
+    override = os.environ.get("REGICIDE_BIN_DIR")
+    candidates = [Path(override)] if override else [
+        PROJECT_ROOT / "target" / "release",
+        PROJECT_ROOT / "target" / "debug",
+    ]
+    for directory in candidates:
+        if (directory / name).exists():
+            return directory / name
+    return None
+
+
+def render(name, args, result):
+    """Format one run as the golden file text."""
+    return (
+        f"$ {' '.join([name, *args])}\n"
+        f"exit: {result.returncode}\n"
+        f"--- stdout\n{result.stdout}"
+        f"--- stderr\n{result.stderr}"
+    )
+
+
+class TestCliGoldenOutput(unittest.TestCase):
+    """Compare CLI output of every binary with golden files."""
+
+    def test_cases(self):
+        missing = []
+        for name, case, args in CASES:
+            binary = get_binary_path(name)
+            if binary is None:
+                # Skip only this binary's cases; the others still run.
+                if name not in missing:
+                    missing.append(name)
+                continue
+            with self.subTest(binary=name, case=case):
+                result = subprocess.run(
+                    [str(binary), *args],
+                    capture_output=True,
+                    text=True,
+                    stdin=subprocess.DEVNULL,
+                    env={"PATH": os.environ.get("PATH", ""), "NO_COLOR": "1", "LANG": "C.UTF-8"},
+                    timeout=30,
+                )
+                self.assert_golden(name, case, render(name, args, result))
+        if missing:
+            self.skipTest(f"{', '.join(missing)} binary not found. Build it first with: cargo build")
+
+    def assert_golden(self, name, case, output):
+        golden = GOLDEN_DIR / name / f"{case}.txt"
+        if UPDATE_SNAPSHOTS or not golden.exists():
+            golden.parent.mkdir(parents=True, exist_ok=True)
+            golden.write_text(output)
+            if not UPDATE_SNAPSHOTS:
+                self.fail(f"Recorded new golden file {golden}; review and commit it")
+            return
+        self.assertEqual(
+            golden.read_text(),
+            output,
+            f"Output differs from {golden}; rerun with REGICIDE_UPDATE_SNAPSHOTS=1 if the change is intended",
+        )
+
+
+if __name__ == "__main__":
+    unittest.main(verbosity=2)
@@ -0,0 +1,206 @@
+"""
+PTY snapshot tests for the interactive installer.
+
+Each scenario runs the installer binary on a pseudo-terminal, answers its
+prompts like a user would, and compares the rendered screen with a golden
+file in tests/installer/snapshots/.  Scenarios stop before any disk is
+touched: the interactive run ends at the "no remote repository" check.
+
+Regenerate the golden files after an intended UI change with:
+    REGICIDE_UPDATE_SNAPSHOTS=1 python3 -m pytest tests/installer/integration/test_tui_snapshots.py
+"""
+
+import fcntl
+import os
+import re
+import select
+import struct
+import subprocess
+import termios
+import time
+import unittest
+from pathlib import Path
+
+PROJECT_ROOT = Path(__file__).parent.parent.parent.parent
+SNAPSHOT_DIR = PROJECT_ROOT / "tests" / "installer" / "snapshots"
+INSTALLER_BIN = PROJECT_ROOT / "installer" / "target" / "release" / "installer"
+INSTALLER_DEBUG = PROJECT_ROOT / "installer" / "target" / "debug" / "installer"
+UPDATE_SNAPSHOTS = os.environ.get("REGICIDE_UPDATE_SNAPSHOTS") == "1"
+
+ROWS, COLUMNS = 40, 100
+TIMEOUT = 10
+
+
+def get_installer_path():
+    """Find the compiled installer binary (REGICIDE_INSTALLER_BIN overrides)."""
+    override = os.environ.get("REGICIDE_INSTALLER_BIN")
+    if override:
+        return Path(override)
+    if INSTALLER_BIN.exists():
+        return INSTALLER_BIN
+    if INSTALLER_DEBUG.exists():
+        return INSTALLER_DEBUG
+    return None
+
+
+class PtySession:
+    """Drive a program on a pseudo-terminal, expect-style."""
+
+    def __init__(self, args):
+        self.master, slave = os.openpty()
+        fcntl.ioctl(slave, termios.TIOCSWINSZ, struct.pack("HHHH", ROWS, COLUMNS, 0, 0))
+        env = dict(os.environ, TERM="xterm", COLUMNS=str(COLUMNS), LINES=str(ROWS), NO_COLOR="")
+        self.process = subprocess.Popen(
+            args,
+            stdin=slave,
+            stdout=slave,
+            stderr=slave,
+            env=env,
+            start_new_session=True,
+            close_fds=True,
+        )
+        os.close(slave)
+        self.output = b""
+
+    def _read(self, timeout):
+        ready, _, _ = select.select([self.master], [], [], timeout)
+        if not ready:
+            return False
+        try:
+            chunk = os.read(self.master, 4096)
+        except OSError:  # EIO once the child has closed the terminal
+            return None
+        if not chunk:
+            return None
+        self.output += chunk
+        return True
+
+    def expect(self, pattern, timeout=TIMEOUT):
+        """Read until pattern appears in the output; fail on timeout or EOF."""
+        deadline = time.monotonic() + timeout
+        while re.search(pattern, self.text()) is None:
+            remaining = deadline - time.monotonic()
+            if remaining <= 0 or self._read(remaining) is None:
+                raise AssertionError(f"Timed out waiting for {pattern!r}; screen so far:\n{self.text()}")
+
+    def send(self, text):
+        os.write(self.master, text.encode())
+
+    def wait(self, timeout=TIMEOUT):
+        """Drain output until the program exits and return its exit code."""
+        deadline = time.monotonic() + timeout
+        while time.monotonic() < deadline and self._read(0.1) is not None:
+            pass
+        try:
+            return self.process.wait(max(deadline - time.monotonic(), 0.1))
+        finally:
+            os.close(self.master)
+
+    def close(self):
+        if self.process.poll() is None:
+            self.process.kill()
+            self.process.wait()
+
+    def text(self):
+        return self.output.decode(errors="replace")
+
+
+def render_screen(raw):
+    """Render terminal output as plain lines, keeping colour codes visible.
+
+    Carriage returns overwrite the current line like a terminal would, and
+    ESC is shown as "^[" so a lost or changed colour is a snapshot diff.
+    """
+    lines, line, column = [], [], 0
+    for char in raw.replace("\x1b", "^["):
+        if char == "\n":
+            lines.append("".join(line).rstrip())
+            line, column = [], 0
+        elif char == "\r":
+            column = 0
+        elif char == "\b":
+            column = max(column - 1, 0)
+        else:
+            if column < len(line):
+                line[column] = char
+            else:
+                line.append(char)
+            column += 1
+    lines.append("".join(line).rstrip())
+    return "\n".join(lines).strip("\n") + "\n"
+
+
+def normalize(screen):
+    """Replace host-specific details (firmware, drives) with placeholders."""
+    screen = re.sub(r"\b(EFI|BIOS) detected\.", "<FIRMWARE> detected.", screen)
+    screen = re.sub(r"Available drives: \[.*\]", "Available drives: <DRIVES>", screen)
+    screen = re.sub(r"(\^\[\[34m)\[[^\]\n]*\](\^\[\[m: )", r"\1[<DEFAULT DRIVE>]\2", screen)
+    # Drive probing warns about devices the host happens to have.
+    return "\n".join(
+        line for line in screen.split("\n") if not line.startswith("^[[33m[WARN]")
+    )
+
+
+class TestInstallerTuiSnapshots(unittest.TestCase):
+    """Compare the installer's terminal output with golden snapshots."""
+
+    @classmethod
+    def setUpClass(cls):
+        cls.installer = get_installer_path()
+        if cls.installer is None:
+            raise unittest.SkipTest(
+                "Installer binary not found. Build it first with: cd installer && cargo build --release"
+            )
+
+    def spawn(self, *args):
+        session = PtySession([str(self.installer), *args])
+        self.addCleanup(session.close)
+        return session
+
+    def assert_snapshot(self, name, session):
+        screen = normalize(render_screen(session.text()))
+        golden = SNAPSHOT_DIR / f"{name}.txt"
+        if UPDATE_SNAPSHOTS or not golden.exists():
+            SNAPSHOT_DIR.mkdir(parents=True, exist_ok=True)
+            golden.write_text(screen)
+            if not UPDATE_SNAPSHOTS:
+                self.fail(f"Recorded new snapshot {golden}; review and commit it")
+            return
+        self.assertEqual(
+            golden.read_text(),
+            screen,
+            f"Screen differs from {golden}; rerun with REGICIDE_UPDATE_SNAPSHOTS=1 if the change is intended",
+        )
+
+    def test_help_screen(self):
+        session = self.spawn("--help")
+        self.assertEqual(session.wait(), 0)
+        self.assert_snapshot("help", session)
+
+    def test_missing_config_file(self):
+        session = self.spawn("--config", "missing-installer-config.toml")
+        session.expect(r"\[ERROR\]")
+        self.assertEqual(session.wait(), 1)
+        self.assert_snapshot("missing-config", session)
+
+    def test_interactive_drive_prompt(self):
+        session = self.spawn()
+        session.expect(r"Enter drive\. Valid options are")
+        session.expect(r"\]\S*: $")
+        session.send("/dev/sda\n")
+        # No repository is configured, so the installer stops here, before
+        # it would partition anything.
+        session.expect(r"No remote repository configured")
+        self.assertEqual(session.wait(), 1)
+        self.assert_snapshot("interactive-drive-prompt", session)
+
+    def test_interactive_rejects_invalid_drive(self):
+        session = self.spawn()
+        session.expect(r"\]\S*: $")
+        session.send("/dev/null\n")
+        self.assertNotEqual(session.wait(), 0)
+        self.assert_snapshot("interactive-invalid-drive", session)
+
+
+if __name__ == "__main__":
+    unittest.main(verbosity=2)